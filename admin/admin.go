@@ -0,0 +1,79 @@
+// Package admin serves an embedded admin UI for a restql API: a schema
+// viewer backed by the OpenAPI document, a table browser and a query builder
+// showing the request each query makes.
+package admin
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+//go:embed ui
+var ui embed.FS
+
+// Options configures the admin UI
+type Options struct {
+	// Prefix is the path the UI is mounted on, "/api/_admin" by default
+	Prefix string
+	// API is the base path of the REST API, "/api" by default
+	API string
+	// Spec is the URL of the OpenAPI document describing the tables,
+	// API + "/openapi.json" by default
+	Spec string
+	// Authorize gates every request to the UI. Requests it rejects get 403.
+	// Without it the UI is open to anyone reaching it, so set it outside of
+	// local development.
+	Authorize func(r *http.Request) bool
+}
+
+// config is the part of Options the UI reads from config.json
+type config struct {
+	API  string `json:"api"`
+	Spec string `json:"spec"`
+}
+
+// Handler serves the UI, e.g.
+// http.Handle("/api/_admin/", admin.Handler(admin.Options{Authorize: isAdmin}))
+func Handler(opts Options) http.Handler {
+	if opts.Prefix == "" {
+		opts.Prefix = "/api/_admin"
+	}
+	if opts.API == "" {
+		opts.API = "/api"
+	}
+	if opts.Spec == "" {
+		opts.Spec = strings.TrimSuffix(opts.API, "/") + "/openapi.json"
+	}
+	opts.Prefix = strings.TrimSuffix(opts.Prefix, "/")
+
+	root, err := fs.Sub(ui, "ui")
+	if err != nil {
+		panic(err)
+	}
+	files := http.StripPrefix(opts.Prefix, http.FileServer(http.FS(root)))
+	settings, _ := json.Marshal(config{API: strings.TrimSuffix(opts.API, "/"), Spec: opts.Spec})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if opts.Authorize != nil && !opts.Authorize(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch r.URL.Path {
+		case opts.Prefix:
+			http.Redirect(w, r, opts.Prefix+"/", http.StatusMovedPermanently)
+		case opts.Prefix + "/config.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(settings)
+		default:
+			files.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the UI and its config are served under the prefix
+func TestHandler(t *testing.T) {
+	h := Handler(Options{API: "/v1/"})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/_admin/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<title>restql admin</title>")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/_admin/app.js", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/_admin/config.json", nil))
+	var cfg map[string]string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &cfg))
+	assert.Equal(t, map[string]string{"api": "/v1", "spec": "/v1/openapi.json"}, cfg)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/_admin", nil))
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/api/_admin/", rec.Header().Get("Location"))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/_admin/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+// Test requests the auth hook rejects are forbidden
+func TestAuthorize(t *testing.T) {
+	h := Handler(Options{Authorize: func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer admin"
+	}})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/_admin/", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/_admin/", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,153 @@
+// restql admin: reads config.json for the API and OpenAPI document URLs,
+// lists the tables the document describes and browses their rows.
+(async function () {
+  const $ = (selector) => document.querySelector(selector);
+  const state = { config: null, tables: {}, table: null, page: 1 };
+
+  async function getJSON(url) {
+    const res = await fetch(url, { credentials: "same-origin" });
+    if (!res.ok) {
+      throw new Error(`${res.status} ${(await res.text()).trim()}`);
+    }
+    return res.json();
+  }
+
+  function cell(tag, text) {
+    const el = document.createElement(tag);
+    el.textContent = text;
+    return el;
+  }
+
+  // columns turns a table's OpenAPI schema into [{name, type, nullable}]
+  function columns(schema) {
+    return Object.entries(schema.properties || {}).map(([name, prop]) => {
+      const types = [].concat(prop.type || "any");
+      return {
+        name,
+        type: types.filter((t) => t !== "null").join(" | ") + (prop.enum ? ` (${prop.enum.join(", ")})` : ""),
+        nullable: types.includes("null"),
+      };
+    });
+  }
+
+  function showTable(name) {
+    state.table = name;
+    state.page = 1;
+    $("#empty").hidden = true;
+    $("#table").hidden = false;
+    $("#table-name").textContent = name;
+    $("#filters").replaceChildren();
+    $("#builder").reset();
+
+    const body = $("#schema tbody");
+    body.replaceChildren();
+    for (const col of state.tables[name]) {
+      const row = document.createElement("tr");
+      row.append(cell("td", col.name), cell("td", col.type), cell("td", col.nullable ? "yes" : "no"));
+      body.append(row);
+    }
+    run();
+  }
+
+  function addFilter() {
+    const filter = $("#filter").content.firstElementChild.cloneNode(true);
+    const select = filter.querySelector("[name=column]");
+    for (const col of state.tables[state.table]) {
+      select.append(cell("option", col.name));
+    }
+    filter.querySelector(".remove").onclick = () => filter.remove();
+    $("#filters").append(filter);
+  }
+
+  // requestURL builds the REST request for the builder's current state
+  function requestURL() {
+    const params = new URLSearchParams();
+    for (const filter of document.querySelectorAll("#filters .filter")) {
+      const column = filter.querySelector("[name=column]").value;
+      const op = filter.querySelector("[name=op]").value;
+      params.append(column, `${op}.${filter.querySelector("[name=value]").value}`);
+    }
+    const form = $("#builder");
+    for (const name of ["select", "order"]) {
+      if (form.elements[name].value) {
+        params.set(name, form.elements[name].value);
+      }
+    }
+    params.set("page", state.page);
+    params.set("page_size", form.elements.page_size.value || 25);
+    return `${state.config.api}/${encodeURIComponent(state.table)}?${params}`;
+  }
+
+  async function run() {
+    const url = requestURL();
+    $("#request").textContent = `GET ${url}`;
+    $("#error").textContent = "";
+    $("#page").textContent = state.page;
+
+    const head = $("#rows thead");
+    const body = $("#rows tbody");
+    try {
+      const data = await getJSON(url);
+      const rows = Array.isArray(data) ? data : data.data || [];
+      const names = rows.length ? Object.keys(rows[0]) : [];
+      const header = document.createElement("tr");
+      header.append(...names.map((name) => cell("th", name)));
+      head.replaceChildren(header);
+      body.replaceChildren(
+        ...rows.map((row) => {
+          const tr = document.createElement("tr");
+          tr.append(
+            ...names.map((name) => {
+              const value = row[name];
+              return cell("td", value !== null && typeof value === "object" ? JSON.stringify(value) : String(value ?? ""));
+            }),
+          );
+          return tr;
+        }),
+      );
+    } catch (err) {
+      head.replaceChildren();
+      body.replaceChildren();
+      $("#error").textContent = err.message;
+    }
+  }
+
+  $("#add-filter").onclick = addFilter;
+  $("#builder").onsubmit = (e) => {
+    e.preventDefault();
+    state.page = 1;
+    run();
+  };
+  $("#prev").onclick = () => {
+    if (state.page > 1) {
+      state.page--;
+      run();
+    }
+  };
+  $("#next").onclick = () => {
+    state.page++;
+    run();
+  };
+
+  try {
+    state.config = await getJSON("config.json");
+    const spec = await getJSON(state.config.spec);
+    const schemas = (spec.components && spec.components.schemas) || {};
+    const list = $("#tables");
+    for (const name of Object.keys(schemas).sort()) {
+      state.tables[name] = columns(schemas[name]);
+      const link = cell("a", name);
+      link.href = `#${name}`;
+      link.onclick = () => showTable(name);
+      const item = document.createElement("li");
+      item.append(link);
+      list.append(item);
+    }
+    const initial = decodeURIComponent(location.hash.slice(1));
+    if (state.tables[initial]) {
+      showTable(initial);
+    }
+  } catch (err) {
+    $("#empty").textContent = `Failed to load the schema: ${err.message}`;
+  }
+})();
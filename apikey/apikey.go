@@ -0,0 +1,222 @@
+// Package apikey authenticates requests by API key. Keys carry a role, a
+// rate limit and the tables they may reach, and the key of a request is put
+// in its context for the code building row filters and permissions.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Header is the request header carrying a key. Keys are also accepted as
+// Authorization: Bearer tokens.
+const Header = "X-Api-Key"
+
+// ErrNotFound is returned by a Store for unknown keys
+var ErrNotFound = errors.New("api key not found")
+
+// Key is an API key's identity and limits
+type Key struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+	// Tables are the tables the key may use. Empty allows every table.
+	Tables []string `json:"tables,omitempty"`
+	// RateLimit is the most requests per minute, zero for no limit
+	RateLimit int `json:"rate_limit,omitempty"`
+}
+
+// Allows reports whether the key may use tableName
+func (k *Key) Allows(tableName string) bool {
+	return len(k.Tables) == 0 || slices.Contains(k.Tables, tableName)
+}
+
+// Store looks keys up by the hash of their secret, so stored keys are
+// useless if the store leaks
+type Store interface {
+	Lookup(ctx context.Context, hash string) (*Key, error)
+}
+
+// StoreFunc adapts a function to a Store, e.g. one running LookupQuery
+type StoreFunc func(ctx context.Context, hash string) (*Key, error)
+
+func (f StoreFunc) Lookup(ctx context.Context, hash string) (*Key, error) {
+	return f(ctx, hash)
+}
+
+// MemoryStore holds keys in memory, keyed by hash
+type MemoryStore map[string]*Key
+
+func (s MemoryStore) Lookup(ctx context.Context, hash string) (*Key, error) {
+	if key, ok := s[hash]; ok {
+		return key, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Hash returns the hash of a key secret, as stored
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate creates a random key secret, to hand to the client once, and the
+// hash to store
+func Generate() (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = hex.EncodeToString(b)
+	return secret, Hash(secret), nil
+}
+
+// LookupQuery selects a key by hash from a table with the columns id, role,
+// tables (comma-separated), rate_limit and key_hash
+func LookupQuery(table, hash string) (*utils.ReturnQuery, error) {
+	if err := utils.ValidateTableName(table); err != nil {
+		return nil, fmt.Errorf("invalid table name")
+	}
+	return &utils.ReturnQuery{
+		Query:    fmt.Sprintf("SELECT id, role, tables, rate_limit FROM %s WHERE key_hash = ?", table),
+		Args:     []any{hash},
+		Table:    table,
+		ReadOnly: true,
+	}, nil
+}
+
+type contextKey struct{}
+
+// FromContext returns the key that authenticated the request, if any
+func FromContext(ctx context.Context) (*Key, bool) {
+	key, ok := ctx.Value(contextKey{}).(*Key)
+	return key, ok
+}
+
+// NewContext returns ctx carrying key
+func NewContext(ctx context.Context, key *Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// Authenticator is HTTP middleware validating API keys
+type Authenticator struct {
+	store Store
+
+	// Prefix is stripped from the request path before reading the table
+	// name, e.g. "/api"
+	Prefix string
+	// Optional lets requests without a key through, unauthenticated.
+	// Requests with an invalid key are still rejected.
+	Optional bool
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+// window counts a key's requests in the current minute
+type window struct {
+	start time.Time
+	count int
+}
+
+// New authenticates keys found in store
+func New(store Store) *Authenticator {
+	return &Authenticator{store: store, windows: map[string]*window{}}
+}
+
+// Middleware wraps next. Requests without a valid key get 401, requests to
+// a table outside the key's scope 403, and requests over the key's rate
+// limit 429 with a Retry-After header.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := requestSecret(r)
+		if secret == "" {
+			if a.Optional {
+				next.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, "api key required", http.StatusUnauthorized)
+			return
+		}
+
+		key, err := a.store.Lookup(r.Context(), Hash(secret))
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to look up api key", http.StatusInternalServerError)
+			return
+		}
+
+		if table := a.table(r); table != "" && !key.Allows(table) {
+			http.Error(w, "api key may not access "+table, http.StatusForbidden)
+			return
+		}
+		if retry, ok := a.allow(key); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), key)))
+	})
+}
+
+// requestSecret reads the key from X-Api-Key or a bearer token
+func requestSecret(r *http.Request) string {
+	if secret := r.Header.Get(Header); secret != "" {
+		return secret
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// table returns the table named by the request path, as GetQL reads it:
+// the last one of nested routes like /users/1/orders
+func (a *Authenticator) table(r *http.Request) string {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, a.Prefix), "/")
+	if len(parts) == 4 && parts[3] != "" {
+		return parts[3]
+	}
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// allow counts a request of key, returning false with the time until the
+// next window when it is over the key's rate limit
+func (a *Authenticator) allow(key *Key) (time.Duration, bool) {
+	if key.RateLimit <= 0 {
+		return 0, true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	win, ok := a.windows[key.ID]
+	if !ok || now.Sub(win.start) >= time.Minute {
+		win = &window{start: now}
+		a.windows[key.ID] = win
+	}
+	if win.count >= key.RateLimit {
+		return win.start.Add(time.Minute).Sub(now), false
+	}
+	win.count++
+	return 0, true
+}
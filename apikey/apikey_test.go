@@ -0,0 +1,97 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serve(h http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// Test keys are validated, scoped to tables and put in the context
+func TestMiddleware(t *testing.T) {
+	store := MemoryStore{
+		Hash("reader"): {ID: "k1", Role: "reader", Tables: []string{"products"}},
+		Hash("admin"):  {ID: "k2", Role: "admin"},
+	}
+	auth := New(store)
+	auth.Prefix = "/api"
+	var role string
+	h := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := FromContext(r.Context())
+		role = key.Role
+	}))
+
+	assert.Equal(t, http.StatusUnauthorized, serve(h, "/api/products").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, "/api/products", Header, "wrong").Code)
+
+	assert.Equal(t, http.StatusOK, serve(h, "/api/products?level=eq.2", Header, "reader").Code)
+	assert.Equal(t, "reader", role)
+	assert.Equal(t, http.StatusForbidden, serve(h, "/api/orders", Header, "reader").Code)
+	assert.Equal(t, http.StatusForbidden, serve(h, "/api/products/1/orders", Header, "reader").Code)
+	assert.Equal(t, http.StatusOK, serve(h, "/api/orders/1/products", Header, "reader").Code)
+
+	assert.Equal(t, http.StatusOK, serve(h, "/api/orders", "Authorization", "Bearer admin").Code)
+	assert.Equal(t, "admin", role)
+}
+
+// Test requests without a key pass when keys are optional
+func TestOptional(t *testing.T) {
+	auth := New(MemoryStore{})
+	auth.Optional = true
+	h := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := FromContext(r.Context())
+		assert.False(t, ok)
+	}))
+
+	assert.Equal(t, http.StatusOK, serve(h, "/products").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, "/products", Header, "wrong").Code)
+}
+
+// Test keys over their rate limit are rejected until the next minute
+func TestRateLimit(t *testing.T) {
+	h := New(MemoryStore{Hash("s"): {ID: "k1", RateLimit: 2}}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	assert.Equal(t, http.StatusOK, serve(h, "/products", Header, "s").Code)
+	assert.Equal(t, http.StatusOK, serve(h, "/products", Header, "s").Code)
+	rec := serve(h, "/products", Header, "s")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+}
+
+// Test store errors other than unknown keys are server errors
+func TestStoreError(t *testing.T) {
+	store := StoreFunc(func(ctx context.Context, hash string) (*Key, error) {
+		return nil, errors.New("connection refused")
+	})
+	h := New(store).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	assert.Equal(t, http.StatusInternalServerError, serve(h, "/products", Header, "s").Code)
+}
+
+// Test generated secrets match their hash and the lookup query
+func TestGenerate(t *testing.T) {
+	secret, hash, err := Generate()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 64)
+	assert.Equal(t, Hash(secret), hash)
+
+	q, err := LookupQuery("api_keys", hash)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id, role, tables, rate_limit FROM api_keys WHERE key_hash = ?", q.Query)
+	assert.Equal(t, []any{hash}, q.Args)
+
+	_, err = LookupQuery("api_keys; DROP", hash)
+	assert.Error(t, err)
+}
@@ -0,0 +1,218 @@
+// Package breaker fails database work fast while the database is down or
+// slow, instead of piling up connections waiting on it. After Threshold
+// consecutive failures the breaker opens and rejects work for Cooldown,
+// then lets one probe through: its success closes the breaker again.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// State is the state of a breaker
+type State int
+
+const (
+	// Closed lets all work through
+	Closed State = iota
+	// Open rejects all work
+	Open
+	// HalfOpen lets one probe through to test the database
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// MarshalJSON encodes the state by name
+func (s State) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("%q", s.String())), nil
+}
+
+// OpenError rejects work while the breaker is open. Serve it as
+// 503 Service Unavailable with Write.
+type OpenError struct {
+	// RetryAfter is the time until the breaker lets a probe through
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return "database unavailable: circuit breaker open"
+}
+
+// StatusCode returns the HTTP status for the error
+func (e *OpenError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// Write responds with 503 and a Retry-After header
+func (e *OpenError) Write(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	http.Error(w, e.Error(), e.StatusCode())
+}
+
+// Stats are counters for monitoring a breaker
+type Stats struct {
+	State State `json:"state"`
+	// Failures is the current run of consecutive failures
+	Failures int `json:"failures"`
+	// Trips is the number of times the breaker opened
+	Trips int64 `json:"trips"`
+	// Rejected is the number of calls failed fast
+	Rejected int64 `json:"rejected"`
+}
+
+// Breaker is a circuit breaker around database work
+type Breaker struct {
+	// Threshold is the number of consecutive failures opening the breaker
+	Threshold int
+	// Cooldown is how long the breaker stays open before probing
+	Cooldown time.Duration
+	// SlowCall counts calls taking longer as failures, even when they
+	// succeed. Zero disables it.
+	SlowCall time.Duration
+	// IsFailure decides which errors count against the database. By
+	// default every error does except context cancellation; exclude errors
+	// caused by the request, like constraint violations, here.
+	IsFailure func(err error) bool
+	// OnStateChange is called on every transition, e.g. to export the
+	// state as a metric. It runs with the breaker locked and must not call
+	// back into it.
+	OnStateChange func(from, to State)
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+	trips    int64
+	rejected int64
+	now      func() time.Time
+}
+
+// New opens after threshold consecutive failures, for cooldown
+func New(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, now: time.Now}
+}
+
+// Do runs fn unless the breaker is open, in which case it returns an
+// *OpenError without calling fn, and records the outcome
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	start := b.now()
+	err = fn(ctx)
+	done(err, b.now().Sub(start))
+	return err
+}
+
+// Allow reserves a call, for work not shaped like Do. Call done with the
+// outcome and duration of the work.
+func (b *Breaker) Allow() (done func(err error, elapsed time.Duration), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := false
+	switch b.state {
+	case Open:
+		if wait := b.openedAt.Add(b.Cooldown).Sub(b.now()); wait > 0 {
+			b.rejected++
+			return nil, &OpenError{RetryAfter: wait}
+		}
+		b.transition(HalfOpen)
+		fallthrough
+	case HalfOpen:
+		if b.probing {
+			b.rejected++
+			return nil, &OpenError{RetryAfter: b.Cooldown}
+		}
+		b.probing, probe = true, true
+	}
+
+	var once sync.Once
+	return func(err error, elapsed time.Duration) {
+		once.Do(func() { b.record(b.failed(err, elapsed), probe) })
+	}, nil
+}
+
+// failed reports whether an outcome counts against the database
+func (b *Breaker) failed(err error, elapsed time.Duration) bool {
+	if b.SlowCall > 0 && elapsed > b.SlowCall {
+		return true
+	}
+	if err == nil {
+		return false
+	}
+	if b.IsFailure != nil {
+		return b.IsFailure(err)
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+func (b *Breaker) record(failed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	if !failed {
+		// Calls started before the breaker opened do not close it, only
+		// the probe does
+		b.failures = 0
+		if probe {
+			b.transition(Closed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == HalfOpen || b.state == Closed && b.failures >= b.Threshold {
+		b.trips++
+		b.openedAt = b.now()
+		b.transition(Open)
+	}
+}
+
+func (b *Breaker) transition(to State) {
+	from := b.state
+	b.state = to
+	if b.OnStateChange != nil && from != to {
+		b.OnStateChange(from, to)
+	}
+}
+
+// State returns the current state. An open breaker past its cooldown
+// reports HalfOpen.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && !b.now().Before(b.openedAt.Add(b.Cooldown)) {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Stats returns the breaker's counters
+func (b *Breaker) Stats() Stats {
+	state := b.State()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return Stats{State: state, Failures: b.failures, Trips: b.trips, Rejected: b.rejected}
+}
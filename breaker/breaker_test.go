@@ -0,0 +1,95 @@
+package breaker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the breaker opens on failures, rejects while open and closes after a
+// successful probe
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := New(2, 10*time.Second)
+	b.now = func() time.Time { return now }
+	transitions := []string{}
+	b.OnStateChange = func(from, to State) { transitions = append(transitions, from.String()+">"+to.String()) }
+
+	down := errors.New("connection refused")
+	fail := func(ctx context.Context) error { return down }
+	succeed := func(ctx context.Context) error { return nil }
+	ctx := context.Background()
+
+	assert.Equal(t, down, b.Do(ctx, fail))
+	assert.Equal(t, Closed, b.State())
+	assert.Equal(t, down, b.Do(ctx, fail))
+	assert.Equal(t, Open, b.State())
+
+	calls := 0
+	err := b.Do(ctx, func(ctx context.Context) error { calls++; return nil })
+	var openErr *OpenError
+	assert.True(t, errors.As(err, &openErr))
+	assert.Equal(t, 10*time.Second, openErr.RetryAfter)
+	assert.Equal(t, 0, calls)
+
+	// A failed probe opens the breaker again
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, HalfOpen, b.State())
+	assert.Equal(t, down, b.Do(ctx, fail))
+	assert.Equal(t, Open, b.State())
+
+	// Only one probe runs at a time
+	now = now.Add(10 * time.Second)
+	done, err := b.Allow()
+	assert.NoError(t, err)
+	_, err = b.Allow()
+	assert.True(t, errors.As(err, &openErr))
+	done(nil, time.Millisecond)
+	assert.Equal(t, Closed, b.State())
+	assert.NoError(t, b.Do(ctx, succeed))
+
+	assert.Equal(t, Stats{State: Closed, Trips: 2, Rejected: 2}, b.Stats())
+	assert.Equal(t, []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}, transitions)
+}
+
+// Test slow calls and filtered errors
+func TestFailures(t *testing.T) {
+	b := New(1, time.Minute)
+	b.SlowCall = time.Second
+	b.IsFailure = func(err error) bool { return err.Error() != "duplicate email" }
+
+	done, _ := b.Allow()
+	done(errors.New("duplicate email"), time.Millisecond)
+	assert.Equal(t, Closed, b.State())
+
+	done, _ = b.Allow()
+	done(context.Canceled, time.Millisecond)
+	assert.Equal(t, Open, b.State())
+
+	b = New(1, time.Minute)
+	done, _ = b.Allow()
+	done(context.Canceled, time.Millisecond)
+	assert.Equal(t, Closed, b.State())
+	b.SlowCall = time.Second
+	done, _ = b.Allow()
+	done(nil, 2*time.Second)
+	assert.Equal(t, Open, b.State())
+}
+
+// Test open errors are served as 503 with Retry-After
+func TestOpenError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&OpenError{RetryAfter: 1500 * time.Millisecond}).Write(rec)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	data, err := json.Marshal(Stats{State: HalfOpen})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"state": "half-open", "failures": 0, "trips": 0, "rejected": 0}`, string(data))
+}
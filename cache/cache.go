@@ -0,0 +1,182 @@
+// Package cache provides an optional read cache for query results, keyed by
+// the generated query and its args and invalidated per table on writes.
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Store is the backend holding cached results. NewLRU provides an in-memory
+// store; implement Store over Redis or similar to share a cache between
+// processes.
+type Store interface {
+	// Get returns the value for key, or false when it is missing or expired
+	Get(key string) ([]byte, bool)
+	// Set stores value under key. A ttl of zero means it never expires.
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// ResultCache caches serialized results of read queries. Each table has a
+// version kept in the store, and writes to a table move it to a new version
+// so earlier entries are never served again.
+type ResultCache struct {
+	store Store
+	ttl   time.Duration
+	mu    sync.Mutex
+
+	// StaleTTL keeps a copy of each result for this long, surviving
+	// invalidation, to serve with GetStale while the database is down. Zero
+	// keeps no copies.
+	StaleTTL time.Duration
+}
+
+const (
+	versionPrefix = "restql:version:"
+	stalePrefix   = "restql:stale:"
+)
+
+// staleEntry is a result kept for GetStale with the time it was cached
+type staleEntry struct {
+	At     time.Time `json:"at"`
+	Result []byte    `json:"result"`
+}
+
+// New creates a result cache over store with entries expiring after ttl
+func New(store Store, ttl time.Duration) *ResultCache {
+	return &ResultCache{store: store, ttl: ttl}
+}
+
+// Key is where the result of a read query is cached, at the versions its
+// tables had when the key was taken. The zero Key caches nothing.
+type Key struct {
+	versioned string
+	// query is the unversioned key of the stale copy
+	query string
+}
+
+// Get returns the cached result for a read query, and the key to cache it
+// under with Set after running it. Taking the key before the query runs
+// means a write racing the read invalidates its result rather than the
+// result being cached as current.
+func (c *ResultCache) Get(q *utils.ReturnQuery) ([]byte, Key, bool) {
+	if !q.ReadOnly {
+		return nil, Key{}, false
+	}
+	key := Key{versioned: c.key(q), query: queryKey(q)}
+	result, ok := c.store.Get(key.versioned)
+	return result, key, ok
+}
+
+// Set caches the result of a read query under the key Get returned for it
+func (c *ResultCache) Set(key Key, result []byte) {
+	if key.versioned == "" {
+		return
+	}
+	c.store.Set(key.versioned, result, c.ttl)
+
+	if c.StaleTTL > 0 {
+		if entry, err := json.Marshal(staleEntry{At: time.Now(), Result: result}); err == nil {
+			c.store.Set(stalePrefix+key.query, entry, c.StaleTTL)
+		}
+	}
+}
+
+// GetStale returns the last result cached for a read query, even if it
+// expired or a write invalidated it since, with its age. Use it to keep
+// serving reads while the database is unreachable, marking the response
+// with StaleHeaders.
+func (c *ResultCache) GetStale(q *utils.ReturnQuery) ([]byte, time.Duration, bool) {
+	if !q.ReadOnly || c.StaleTTL <= 0 {
+		return nil, 0, false
+	}
+	data, ok := c.store.Get(stalePrefix + queryKey(q))
+	if !ok {
+		return nil, 0, false
+	}
+	var entry staleEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, 0, false
+	}
+	return entry.Result, time.Since(entry.At), true
+}
+
+// StaleHeaders marks a response served by GetStale with its Age and a
+// Warning that it is stale
+func StaleHeaders(h http.Header, age time.Duration) {
+	h.Set("Age", strconv.Itoa(int(age.Seconds())))
+	h.Set("Warning", `110 - "Response is Stale"`)
+}
+
+// Invalidate drops every cached result for the table a write query touches.
+// Call it after the write succeeds.
+func (c *ResultCache) Invalidate(q *utils.ReturnQuery) {
+	if q.ReadOnly || q.Table == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store.Set(versionPrefix+q.Table, newVersion(), 0)
+}
+
+// key normalizes a query into table, table versions, SQL, and args. A query
+// over several tables depends on the version of each.
+func (c *ResultCache) key(q *utils.ReturnQuery) string {
+	versions := []string{}
+	for _, table := range strings.Split(q.Table, ",") {
+		versions = append(versions, c.version(table))
+	}
+	return "restql:" + q.Table + ":" + strings.Join(versions, ",") + ":" + queryKey(q)
+}
+
+// queryKey normalizes a query into SQL and args, with the stats and page
+// queries answered along with it
+func queryKey(q *utils.ReturnQuery) string {
+	key := sqlKey(q)
+	if q.Stats != nil {
+		key += ":stats:" + sqlKey(q.Stats)
+	}
+	if page := q.Page; page != nil {
+		key += fmt.Sprintf(":page:%s:%d:%d", page.Strategy, page.Number, page.Size)
+		if page.Count != nil {
+			key += ":count:" + sqlKey(page.Count)
+		}
+	}
+	return key
+}
+
+// sqlKey normalizes a single query into SQL and args
+func sqlKey(q *utils.ReturnQuery) string {
+	args, err := json.Marshal(q.Args)
+	if err != nil {
+		args = []byte(err.Error())
+	}
+	return q.Query + ":" + string(args)
+}
+
+// version returns the current version of a table, starting a new one when
+// the store has none so evicted versions never match older entries
+func (c *ResultCache) version(table string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.store.Get(versionPrefix + table); ok {
+		return string(v)
+	}
+
+	v := newVersion()
+	c.store.Set(versionPrefix+table, v, 0)
+	return string(v)
+}
+
+func newVersion() []byte {
+	return strconv.AppendInt(nil, time.Now().UnixNano(), 36)
+}
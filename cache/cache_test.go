@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test cached reads are invalidated by writes to the same table
+func TestResultCache(t *testing.T) {
+	c := New(NewLRU(100), time.Minute)
+
+	products := &utils.ReturnQuery{Query: "SELECT * FROM products WHERE level = ?", Args: []any{int64(2)}, Table: "products", ReadOnly: true}
+	users := &utils.ReturnQuery{Query: "SELECT * FROM users", Args: []any{}, Table: "users", ReadOnly: true}
+	both := &utils.ReturnQuery{Query: "SELECT id FROM products UNION ALL SELECT id FROM users", Args: []any{}, Table: "products,users", ReadOnly: true}
+	set := func(q *utils.ReturnQuery, result string) {
+		_, key, _ := c.Get(q)
+		c.Set(key, []byte(result))
+	}
+	get := func(q *utils.ReturnQuery) bool {
+		_, _, ok := c.Get(q)
+		return ok
+	}
+
+	assert.False(t, get(products))
+
+	set(products, `[{"id":1}]`)
+	set(users, `[{"id":2}]`)
+	set(both, `[{"id":1},{"id":2}]`)
+
+	result, _, ok := c.Get(products)
+	assert.True(t, ok)
+	assert.Equal(t, `[{"id":1}]`, string(result))
+
+	// Different args are cached separately
+	assert.False(t, get(&utils.ReturnQuery{Query: products.Query, Args: []any{int64(3)}, Table: "products", ReadOnly: true}))
+
+	// So are the stats and page counts answered with a read
+	stats := *products
+	stats.Stats = &utils.ReturnQuery{Query: "SELECT max(price) AS max_price FROM products WHERE level = ?", Args: []any{int64(2)}}
+	assert.False(t, get(&stats))
+	paged := *products
+	paged.Page = &utils.Page{Strategy: "offset", Number: 1, Size: 10, Count: &utils.ReturnQuery{Query: "SELECT count(*) AS count FROM products WHERE level = ?", Args: []any{int64(2)}}}
+	assert.False(t, get(&paged))
+
+	// Writes are never cached
+	write := &utils.ReturnQuery{Query: "DELETE FROM products WHERE id = ?", Args: []any{"1"}, Table: "products"}
+	set(write, "x")
+	assert.False(t, get(write))
+
+	c.Invalidate(write)
+
+	assert.False(t, get(products))
+	assert.False(t, get(both))
+	assert.True(t, get(users))
+
+	// A read racing a write is cached under the versions it started at
+	_, key, _ := c.Get(products)
+	c.Invalidate(write)
+	c.Set(key, []byte(`[{"id":1}]`))
+	assert.False(t, get(products))
+}
+
+// Test stale copies outlive invalidation and are marked stale when served
+func TestStale(t *testing.T) {
+	c := New(NewLRU(100), time.Minute)
+	products := &utils.ReturnQuery{Query: "SELECT * FROM products", Args: []any{}, Table: "products", ReadOnly: true}
+	write := &utils.ReturnQuery{Query: "DELETE FROM products WHERE id = ?", Args: []any{"1"}, Table: "products"}
+
+	_, key, _ := c.Get(products)
+	c.Set(key, []byte(`[{"id":1}]`))
+	_, _, ok := c.GetStale(products)
+	assert.False(t, ok, "stale copies are off by default")
+
+	c.StaleTTL = time.Hour
+	c.Set(key, []byte(`[{"id":1}]`))
+	c.Invalidate(write)
+	_, _, ok = c.Get(products)
+	assert.False(t, ok)
+
+	result, age, ok := c.GetStale(products)
+	assert.True(t, ok)
+	assert.Equal(t, `[{"id":1}]`, string(result))
+	assert.Less(t, age, time.Minute)
+	_, _, ok = c.GetStale(write)
+	assert.False(t, ok)
+
+	h := http.Header{}
+	StaleHeaders(h, 90*time.Second)
+	assert.Equal(t, "90", h.Get("Age"))
+	assert.Equal(t, `110 - "Response is Stale"`, h.Get("Warning"))
+}
+
+// Test LRU eviction and expiry
+func TestLRU(t *testing.T) {
+	now := time.Now()
+	l := NewLRU(2)
+	l.now = func() time.Time { return now }
+
+	l.Set("a", []byte("a"), 0)
+	l.Set("b", []byte("b"), time.Second)
+	_, ok := l.Get("a")
+	assert.True(t, ok)
+
+	l.Set("c", []byte("c"), 0)
+	_, ok = l.Get("b")
+	assert.False(t, ok)
+
+	l.Set("d", []byte("d"), time.Second)
+	now = now.Add(2 * time.Second)
+	_, ok = l.Get("d")
+	assert.False(t, ok)
+	_, ok = l.Get("c")
+	assert.True(t, ok)
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory Store holding at most a fixed number of entries,
+// evicting the least recently used first
+type LRU struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+	now        func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU creates an in-memory store holding up to maxEntries entries
+func NewLRU(maxEntries int) *LRU {
+	return &LRU{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Get implements Store
+func (l *LRU) Get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*lruEntry)
+	if !entry.expires.IsZero() && l.now().After(entry.expires) {
+		l.ll.Remove(el)
+		delete(l.items, key)
+		return nil, false
+	}
+
+	l.ll.MoveToFront(el)
+	return entry.value, true
+}
+
+// Set implements Store
+func (l *LRU) Set(key string, value []byte, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = l.now().Add(ttl)
+	}
+
+	if el, ok := l.items[key]; ok {
+		l.ll.MoveToFront(el)
+		entry := el.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		return
+	}
+
+	l.items[key] = l.ll.PushFront(&lruEntry{key: key, value: value, expires: expires})
+
+	if l.maxEntries > 0 && l.ll.Len() > l.maxEntries {
+		oldest := l.ll.Back()
+		l.ll.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruEntry).key)
+	}
+}
@@ -0,0 +1,63 @@
+// Command restqlgen generates typed TypeScript or Go client code from a JSON
+// schema file holding a list of tables:
+//
+//	restqlgen -schema schema.json -lang ts -out client.ts
+//	restqlgen -schema schema.json -lang go -package client -out client.go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/The-ForgeBase/restql/codegen"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+func main() {
+	schemaPath := flag.String("schema", "", "path to a JSON file with a list of tables")
+	lang := flag.String("lang", "ts", "output language: ts or go")
+	pkg := flag.String("package", "client", "package name for Go output")
+	out := flag.String("out", "", "output file (defaults to stdout)")
+	flag.Parse()
+
+	if err := run(*schemaPath, *lang, *pkg, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "restqlgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(schemaPath, lang, pkg, out string) error {
+	if schemaPath == "" {
+		return fmt.Errorf("-schema is required")
+	}
+
+	data, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return err
+	}
+
+	var tables []*utils.Table
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return fmt.Errorf("invalid schema file: %v", err)
+	}
+
+	var code []byte
+	switch lang {
+	case "ts":
+		code = codegen.TypeScript(tables)
+	case "go":
+		if code, err = codegen.Go(pkg, tables); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown language %q", lang)
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(code)
+		return err
+	}
+	return os.WriteFile(out, code, 0o644)
+}
@@ -0,0 +1,224 @@
+// Package codegen emits typed TypeScript and Go client code from table
+// metadata, keeping client types in sync with the database schema.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+const header = "Code generated by restqlgen. DO NOT EDIT."
+
+// operators returns every filter operator of the URL grammar, sorted
+func operators() []string {
+	ops := []string{}
+	for op := range utils.Operators {
+		ops = append(ops, op)
+	}
+	for op := range utils.ArrayOperators {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// TypeScript emits an interface per table, a filter type per table, and
+// helpers building filter values and query strings
+func TypeScript(tables []*utils.Table) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "// %s\n\n", header)
+
+	ops := operators()
+	quoted := make([]string, len(ops))
+	for i, op := range ops {
+		quoted[i] = fmt.Sprintf("%q", op)
+	}
+	fmt.Fprintf(&b, "export type Operator = %s;\n\n", strings.Join(quoted, " | "))
+	b.WriteString("export type Filter = `${Operator}.${string}`;\n\n")
+	b.WriteString("export type Value = string | number | boolean;\n\n")
+
+	b.WriteString("export const filter = (op: Operator, value: Value): Filter => `${op}.${value}` as Filter;\n")
+	for _, op := range ops {
+		fmt.Fprintf(&b, "export const %s = (value: Value): Filter => filter(%q, value);\n", tsIdentifier(op), op)
+	}
+	b.WriteString("\n")
+
+	b.WriteString("export interface Query {\n")
+	b.WriteString("  order?: string;\n")
+	b.WriteString("  page?: number;\n")
+	b.WriteString("  page_size?: number;\n")
+	b.WriteString("  cursor?: string;\n")
+	b.WriteString("  q?: string;\n")
+	b.WriteString("  q_columns?: string;\n")
+	b.WriteString("}\n\n")
+
+	b.WriteString("export function queryString(filters: Record<string, Filter | undefined>, query: Query = {}): string {\n")
+	b.WriteString("  const params = new URLSearchParams();\n")
+	b.WriteString("  for (const [column, value] of Object.entries(filters)) {\n")
+	b.WriteString("    if (value !== undefined) params.append(column, value);\n")
+	b.WriteString("  }\n")
+	b.WriteString("  for (const [key, value] of Object.entries(query)) {\n")
+	b.WriteString("    if (value !== undefined) params.append(key, String(value));\n")
+	b.WriteString("  }\n")
+	b.WriteString("  return params.toString();\n")
+	b.WriteString("}\n")
+
+	for _, table := range tables {
+		name := typeName(table.Name)
+
+		fmt.Fprintf(&b, "\nexport interface %s {\n", name)
+		for _, column := range table.Columns {
+			optional := ""
+			if column.ReadOnly() {
+				optional = "?"
+			}
+			fmt.Fprintf(&b, "  %s%s: %s;\n", column.Name, optional, tsType(&column))
+		}
+		b.WriteString("}\n\n")
+
+		fmt.Fprintf(&b, "export type %sFilters = Partial<Record<keyof %s, Filter>>;\n\n", name, name)
+		fmt.Fprintf(&b, "export const %sPath = %q;\n", lowerFirst(name), "/"+table.Name)
+	}
+
+	return b.Bytes()
+}
+
+// Go emits a struct per table, column name constants, and helpers building
+// filter query strings. The output is gofmt-formatted.
+func Go(pkg string, tables []*utils.Table) ([]byte, error) {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "// %s\n\n", header)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	b.WriteString("import (\n\t\"fmt\"\n\t\"net/url\"\n)\n\n")
+
+	b.WriteString("// Filter is a single restql filter such as level=lt.2\n")
+	b.WriteString("type Filter struct {\n\tColumn   string\n\tOperator string\n\tValue    any\n}\n\n")
+
+	for _, op := range operators() {
+		fn := goIdentifier(op)
+		fmt.Fprintf(&b, "// %s builds a %q filter\n", fn, op)
+		fmt.Fprintf(&b, "func %s(column string, value any) Filter {\n\treturn Filter{Column: column, Operator: %q, Value: value}\n}\n\n", fn, op)
+	}
+
+	b.WriteString("// Query encodes filters into a query string\n")
+	b.WriteString("func Query(filters ...Filter) url.Values {\n")
+	b.WriteString("\tvalues := url.Values{}\n")
+	b.WriteString("\tfor _, f := range filters {\n")
+	b.WriteString("\t\tvalues.Add(f.Column, fmt.Sprintf(\"%s.%v\", f.Operator, f.Value))\n")
+	b.WriteString("\t}\n")
+	b.WriteString("\treturn values\n")
+	b.WriteString("}\n")
+
+	for _, table := range tables {
+		name := typeName(table.Name)
+
+		fmt.Fprintf(&b, "\n// %s is a row of the %s table\n", name, table.Name)
+		fmt.Fprintf(&b, "type %s struct {\n", name)
+		for _, column := range table.Columns {
+			tag := column.Name
+			if column.ReadOnly() || column.Nullable {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&b, "\t%s %s `json:%q`\n", goIdentifier(column.Name), goType(&column), tag)
+		}
+		b.WriteString("}\n\n")
+
+		fmt.Fprintf(&b, "// Columns of the %s table\n", table.Name)
+		b.WriteString("const (\n")
+		fmt.Fprintf(&b, "\t%sPath = %q\n", name, "/"+table.Name)
+		for _, column := range table.Columns {
+			fmt.Fprintf(&b, "\t%s%s = %q\n", name, goIdentifier(column.Name), column.Name)
+		}
+		b.WriteString(")\n")
+	}
+
+	return format.Source(b.Bytes())
+}
+
+func tsType(column *utils.Column) string {
+	t := ""
+	if len(column.Enum) > 0 {
+		values := make([]string, len(column.Enum))
+		for i, v := range column.Enum {
+			values[i] = fmt.Sprintf("%q", v)
+		}
+		t = strings.Join(values, " | ")
+	} else {
+		switch utils.JSONType(column.Type) {
+		case "integer", "number":
+			t = "number"
+		case "boolean":
+			t = "boolean"
+		default:
+			t = "string"
+		}
+	}
+
+	if column.Nullable {
+		t += " | null"
+	}
+	return t
+}
+
+func goType(column *utils.Column) string {
+	t := ""
+	switch utils.JSONType(column.Type) {
+	case "integer":
+		t = "int64"
+	case "number":
+		t = "float64"
+	case "boolean":
+		t = "bool"
+	default:
+		t = "string"
+	}
+
+	if column.Nullable {
+		return "*" + t
+	}
+	return t
+}
+
+// typeName converts a table name like order_items to OrderItems
+func typeName(table string) string {
+	return goIdentifier(table)
+}
+
+// goIdentifier converts snake_case to an exported CamelCase identifier,
+// upper-casing the common ID initialism
+func goIdentifier(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		if strings.EqualFold(part, "id") {
+			b.WriteString("ID")
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// tsIdentifier keeps operator names usable as TypeScript identifiers
+func tsIdentifier(op string) string {
+	if op == "in" {
+		return "in_"
+	}
+	return op
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
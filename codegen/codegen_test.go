@@ -0,0 +1,40 @@
+package codegen
+
+import (
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var tables = []*utils.Table{{
+	Name: "order_items",
+	Columns: []utils.Column{
+		{Name: "id", Type: "BIGINT", Identity: true},
+		{Name: "order_id", Type: "INTEGER"},
+		{Name: "price", Type: "NUMERIC(10,2)", Nullable: true},
+		{Name: "status", Type: "ENUM", Enum: []string{"new", "shipped"}},
+	},
+}}
+
+// Test TypeScript output
+func TestTypeScript(t *testing.T) {
+	code := string(TypeScript(tables))
+
+	assert.Contains(t, code, "// Code generated by restqlgen. DO NOT EDIT.")
+	assert.Contains(t, code, `export const eq = (value: Value): Filter => filter("eq", value);`)
+	assert.Contains(t, code, "export interface OrderItems {\n  id?: number;\n  order_id: number;\n  price: string | null;\n  status: \"new\" | \"shipped\";\n}")
+	assert.Contains(t, code, "export type OrderItemsFilters = Partial<Record<keyof OrderItems, Filter>>;")
+	assert.Contains(t, code, `export const orderItemsPath = "/order_items";`)
+}
+
+// Test Go output
+func TestGo(t *testing.T) {
+	code, err := Go("client", tables)
+	assert.NoError(t, err)
+
+	assert.Contains(t, string(code), "package client")
+	assert.Contains(t, string(code), "func Lt(column string, value any) Filter {")
+	assert.Contains(t, string(code), "type OrderItems struct {\n\tID      int64   `json:\"id,omitempty\"`\n\tOrderID int64   `json:\"order_id\"`\n\tPrice   *string `json:\"price,omitempty\"`\n\tStatus  string  `json:\"status\"`\n}")
+	assert.Contains(t, string(code), "OrderItemsOrderID = \"order_id\"")
+}
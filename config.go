@@ -0,0 +1,540 @@
+package restql
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/The-ForgeBase/restql/apikey"
+	"github.com/The-ForgeBase/restql/handler"
+	"github.com/The-ForgeBase/restql/masking"
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Auth modes
+const (
+	// AuthNone serves every request
+	AuthNone = "none"
+	// AuthAPIKey requires one of the configured API keys
+	AuthAPIKey = "api_key"
+)
+
+// AdminRole is the role of the API keys allowed to reload the server and
+// change tables
+const AdminRole = "admin"
+
+// Verbs are the methods a table policy may allow
+var Verbs = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// Config is a restql.yaml or restql.toml file, e.g.
+//
+//	dsn: postgres://restql@localhost/app
+//	port: 8080
+//	tables:
+//	  products:
+//	    verbs: [GET]
+//	    columns: [id, name, price]
+//	  orders:
+//	    filter: tenant_id=eq.42
+//	    max_page_size: 50
+//	  active_users:
+//	    table: users
+//	    verbs: [GET]
+//	    columns: [id, name]
+//	    filter: active=is.true
+//	pagination:
+//	  max_page_size: 500
+//	  strategy: keyset
+//	cors:
+//	  allow_origins: [https://app.example.com]
+//	auth:
+//	  mode: api_key
+//	  keys:
+//	    - id: web
+//	      hash: 9f86d081...   # apikey.Hash of the secret
+//	      tables: [products]
+//	dialect:
+//	  postgrest: true
+//	reload:
+//	  watch: true
+type Config struct {
+	DSN    string `yaml:"dsn" toml:"dsn"`
+	Port   int    `yaml:"port" toml:"port"`
+	Prefix string `yaml:"prefix" toml:"prefix"`
+	// Tables are the exposed resources and their policies, by the name
+	// they are served under. Every table of the schema is exposed without
+	// restrictions when empty.
+	Tables map[string]TableConfig `yaml:"tables" toml:"tables"`
+	// QueryCache is the number of generated queries cached, zero disables
+	// the cache
+	QueryCache int `yaml:"query_cache" toml:"query_cache"`
+	// ResultCache caches read responses until a write changes their tables
+	ResultCache ResultCacheConfig `yaml:"result_cache" toml:"result_cache"`
+	// Breaker fails requests fast while the database keeps failing
+	Breaker BreakerConfig `yaml:"breaker" toml:"breaker"`
+	// Idempotency replays the responses of POSTs retried with the same
+	// Idempotency-Key header
+	Idempotency IdempotencyConfig `yaml:"idempotency" toml:"idempotency"`
+	// Events posts a change event to webhooks for every successful write
+	Events EventsConfig `yaml:"events" toml:"events"`
+	// Admin serves the admin UI at Prefix + "/_admin/". The UI itself is
+	// unauthenticated, so only enable it on a trusted network.
+	Admin      bool             `yaml:"admin" toml:"admin"`
+	Pagination PaginationConfig `yaml:"pagination" toml:"pagination"`
+	CORS       CORSConfig       `yaml:"cors" toml:"cors"`
+	Auth       AuthConfig       `yaml:"auth" toml:"auth"`
+	Signing    SigningConfig    `yaml:"signing" toml:"signing"`
+	Dialect    DialectConfig    `yaml:"dialect" toml:"dialect"`
+	Reload     ReloadConfig     `yaml:"reload" toml:"reload"`
+	// Locale is the language tag numbers and dates in filters and bodies
+	// are written in when requests give none in a Locale header or locale
+	// parameter, e.g. de-DE for 1.234,56 and 31.12.2024
+	Locale string `yaml:"locale" toml:"locale"`
+	// LargeIntsAsStrings serves integers beyond ±2^53 as JSON strings in
+	// every table, see utils.EncodeInts
+	LargeIntsAsStrings bool `yaml:"large_ints_as_strings" toml:"large_ints_as_strings"`
+	// DDL serves POST Prefix + "/_tables", creating a table from a
+	// handler.TableDefinition, and PATCH Prefix + "/_tables/{table}",
+	// altering one with a handler.TableAlteration. Like the reload endpoint
+	// they require a key with AdminRole, or Server.AuthorizeAdmin outside
+	// api_key mode.
+	DDL bool `yaml:"ddl" toml:"ddl"`
+	// ShutdownTimeout is how long requests in flight may run after a
+	// shutdown starts, in seconds, 30 when zero. Their queries are
+	// cancelled afterwards.
+	ShutdownTimeout int `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// QueryTimeout is the deadline of the queries of a request, in
+	// seconds, unlimited when zero. Requests past it are answered 504.
+	QueryTimeout int        `yaml:"query_timeout" toml:"query_timeout"`
+	Pool         PoolConfig `yaml:"pool" toml:"pool"`
+}
+
+// ResultCacheConfig caches read responses in memory, see package cache.
+// Writes made outside the server are only seen once entries expire.
+type ResultCacheConfig struct {
+	// MaxEntries is the number of responses kept, zero disables the cache
+	MaxEntries int `yaml:"max_entries" toml:"max_entries"`
+	// TTL is how long a response is served, in seconds, 60 when zero
+	TTL int `yaml:"ttl" toml:"ttl"`
+	// StaleTTL keeps each response this long, in seconds, to answer reads
+	// while the database is unreachable, marked with Age and Warning
+	// headers
+	StaleTTL int `yaml:"stale_ttl" toml:"stale_ttl"`
+}
+
+// BreakerConfig opens a circuit breaker around the queries of requests, see
+// package breaker. Requests are answered 503 while it is open. Reloading
+// closes it.
+type BreakerConfig struct {
+	// Threshold is the number of consecutive database failures opening
+	// the breaker, zero disables it
+	Threshold int `yaml:"threshold" toml:"threshold"`
+	// Cooldown is how long the breaker stays open before probing, in
+	// seconds, 30 when zero
+	Cooldown int `yaml:"cooldown" toml:"cooldown"`
+	// SlowCall counts requests whose queries take longer as failures, in
+	// seconds, off when zero
+	SlowCall int `yaml:"slow_call" toml:"slow_call"`
+}
+
+// IdempotencyConfig keeps the responses of POSTs with an Idempotency-Key in
+// memory, see package idempotency. In api_key mode keys are scoped to the
+// API key sending them.
+type IdempotencyConfig struct {
+	// MaxEntries is the number of responses kept, zero disables replays
+	MaxEntries int `yaml:"max_entries" toml:"max_entries"`
+	// TTL is how long a response is kept, in seconds, a day when zero
+	TTL int `yaml:"ttl" toml:"ttl"`
+}
+
+// EventsConfig publishes the change events of writes, see package events
+type EventsConfig struct {
+	// Webhooks receive the events, publishing is off when empty
+	Webhooks []WebhookConfig `yaml:"webhooks" toml:"webhooks"`
+	// Timeout bounds each delivery, in seconds, 10 when zero. Writes are
+	// answered once their events are delivered.
+	Timeout int `yaml:"timeout" toml:"timeout"`
+}
+
+// WebhookConfig is an endpoint events are posted to as JSON
+type WebhookConfig struct {
+	URL string `yaml:"url" toml:"url"`
+	// Secret signs the bodies when set, see events.Verify
+	Secret string `yaml:"secret" toml:"secret"`
+}
+
+// PoolConfig sizes the database connection pool, see sql.DB. Zero keeps the
+// database/sql default.
+type PoolConfig struct {
+	// MaxOpenConns caps the connections open at once, unlimited when zero
+	MaxOpenConns int `yaml:"max_open_conns" toml:"max_open_conns"`
+	// MaxIdleConns caps the idle connections kept, 2 when zero
+	MaxIdleConns int `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	// ConnMaxLifetime is how long a connection may be reused, in seconds
+	ConnMaxLifetime int `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	// ConnMaxIdleTime is how long a connection may stay idle, in seconds
+	ConnMaxIdleTime int `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+}
+
+// TableConfig is the policy of an exposed table
+type TableConfig struct {
+	// Table is the table or view served, by default the one of the name
+	// the policy is configured under. Setting it serves the table under
+	// another name, e.g. active_users for the users matching Filter.
+	Table string `yaml:"table" toml:"table"`
+	// Verbs are the allowed methods, all of them when empty. Reads by
+	// POST /{table}/query count as GET.
+	Verbs []string `yaml:"verbs" toml:"verbs"`
+	// Columns are the columns requests may read, filter, order and write,
+	// all of them when empty
+	Columns []string `yaml:"columns" toml:"columns"`
+	// Filter restricts every read, update and delete to the rows it
+	// matches, in query string syntax, e.g. tenant_id=eq.42. Rows written
+	// must match it too.
+	Filter string `yaml:"filter" toml:"filter"`
+	// MaxPageSize overrides Pagination.MaxPageSize for the table
+	MaxPageSize int `yaml:"max_page_size" toml:"max_page_size"`
+	// IntStrings are integer columns served as JSON strings, like 64-bit
+	// ids JavaScript clients would round
+	IntStrings []string `yaml:"int_strings" toml:"int_strings"`
+	// Mask masks the values of columns in responses by the role of the
+	// requester's key, see package masking
+	Mask map[string]MaskConfig `yaml:"mask" toml:"mask"`
+}
+
+// MaskConfig masks a column with a masking.Strategy: clear, redact, partial
+// or hash
+type MaskConfig struct {
+	// Default is the strategy of requests without a listed role
+	Default string `yaml:"default" toml:"default"`
+	// Roles choose their own strategy by key role
+	Roles map[string]string `yaml:"roles" toml:"roles"`
+	// Keep is the number of trailing characters partial shows, 4 when zero
+	Keep int `yaml:"keep" toml:"keep"`
+}
+
+// policy converts the mask to a masking.Policy
+func (m MaskConfig) policy() masking.Policy {
+	p := masking.Policy{Default: masking.Strategy(m.Default), Keep: m.Keep}
+	for role, strategy := range m.Roles {
+		if p.Roles == nil {
+			p.Roles = map[string]masking.Strategy{}
+		}
+		p.Roles[role] = masking.Strategy(strategy)
+	}
+	return p
+}
+
+// PaginationConfig bounds the rows a read returns and chooses how reads are
+// paged
+type PaginationConfig struct {
+	// MaxPageSize caps page_size and limit, query.MaxPageSize when zero
+	MaxPageSize int `yaml:"max_page_size" toml:"max_page_size"`
+	// Strategy is offset, keyset or token, see handler.Options. Reads then
+	// respond with {"data": rows, "meta": utils.PageMeta} instead of the
+	// bare rows.
+	Strategy string `yaml:"strategy" toml:"strategy"`
+}
+
+// CORSConfig lets browsers on other origins call the API
+type CORSConfig struct {
+	// AllowOrigins are the allowed origins, or "*" for any. CORS is off
+	// when empty.
+	AllowOrigins []string `yaml:"allow_origins" toml:"allow_origins"`
+	// AllowHeaders are the request headers allowed, by default
+	// Content-Type, Authorization, X-Api-Key and Prefer
+	AllowHeaders []string `yaml:"allow_headers" toml:"allow_headers"`
+	// MaxAge is how long browsers may cache a preflight, in seconds
+	MaxAge int `yaml:"max_age" toml:"max_age"`
+}
+
+// AuthConfig chooses how requests are authenticated
+type AuthConfig struct {
+	// Mode is AuthNone, the default, or AuthAPIKey
+	Mode string      `yaml:"mode" toml:"mode"`
+	Keys []KeyConfig `yaml:"keys" toml:"keys"`
+}
+
+// SigningConfig requires the API, reload and table endpoints to be called
+// with HMAC-signed requests, see package signing
+type SigningConfig struct {
+	// Secrets sign requests, any of them is accepted so they can be
+	// rotated with a reload. Signing is off when empty.
+	Secrets []string `yaml:"secrets" toml:"secrets"`
+	// Tolerance is how far the signing time may be from now, in seconds,
+	// 5 minutes when zero
+	Tolerance int `yaml:"tolerance" toml:"tolerance"`
+}
+
+// secrets returns the secrets as keys
+func (c SigningConfig) secrets() [][]byte {
+	secrets := make([][]byte, len(c.Secrets))
+	for i, secret := range c.Secrets {
+		secrets[i] = []byte(secret)
+	}
+	return secrets
+}
+
+// KeyConfig is an API key. Only the hash of its secret is configured.
+type KeyConfig struct {
+	ID        string   `yaml:"id" toml:"id"`
+	Hash      string   `yaml:"hash" toml:"hash"`
+	Role      string   `yaml:"role" toml:"role"`
+	Tables    []string `yaml:"tables" toml:"tables"`
+	RateLimit int      `yaml:"rate_limit" toml:"rate_limit"`
+}
+
+// DialectConfig selects the query grammars accepted besides restql's own,
+// see handler.Options
+type DialectConfig struct {
+	PostgREST bool `yaml:"postgrest" toml:"postgrest"`
+	OData     bool `yaml:"odata" toml:"odata"`
+	JSONAPI   bool `yaml:"jsonapi" toml:"jsonapi"`
+}
+
+// ReloadConfig chooses how a running server picks up changes to its config
+// file and schema, besides SIGHUP
+type ReloadConfig struct {
+	// Watch reloads the config file when it changes
+	Watch bool `yaml:"watch" toml:"watch"`
+	// Interval is how often a watched file is checked, in seconds, 2 when
+	// zero
+	Interval int `yaml:"interval" toml:"interval"`
+	// Endpoint serves POST Prefix + "/_reload", reloading the config and
+	// schema. It requires a key with AdminRole, or Server.AuthorizeAdmin
+	// outside api_key mode.
+	Endpoint bool `yaml:"endpoint" toml:"endpoint"`
+}
+
+// LoadConfig reads a YAML file, or a TOML file when its extension is .toml,
+// returning an empty config for no path. ${VAR} references are expanded
+// from the environment, so secrets like the DSN need not be written in the
+// file. The config is not validated, so flags can complete it first.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = []byte(os.ExpandEnv(string(data)))
+	if filepath.Ext(path) == ".toml" {
+		err = toml.Unmarshal(data, cfg)
+	} else {
+		err = yaml.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// SetDefaults fills in the port, prefix, auth mode, watch interval, shutdown
+// timeout, result cache TTL, breaker cooldown and idempotency TTL
+func (c *Config) SetDefaults() {
+	if c.Port == 0 {
+		c.Port = 8080
+	}
+	if c.Prefix == "" {
+		c.Prefix = "/api"
+	}
+	c.Prefix = "/" + strings.Trim(c.Prefix, "/")
+	if c.Auth.Mode == "" {
+		c.Auth.Mode = AuthNone
+	}
+	if c.Reload.Interval == 0 {
+		c.Reload.Interval = 2
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = 30
+	}
+	if c.ResultCache.TTL == 0 {
+		c.ResultCache.TTL = 60
+	}
+	if c.Breaker.Cooldown == 0 {
+		c.Breaker.Cooldown = 30
+	}
+	if c.Idempotency.TTL == 0 {
+		c.Idempotency.TTL = 24 * 60 * 60
+	}
+	if c.Events.Timeout == 0 {
+		c.Events.Timeout = 10
+	}
+}
+
+// Validate checks the config, reporting every problem found
+func (c *Config) Validate() error {
+	var errs []error
+	if c.DSN == "" {
+		errs = append(errs, errors.New("dsn is required"))
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid port %d", c.Port))
+	}
+	if c.Pagination.MaxPageSize < 0 {
+		errs = append(errs, errors.New("pagination: max_page_size must not be negative"))
+	}
+	if c.Pagination.Strategy != "" && !slices.Contains(handler.PaginationStrategies, c.Pagination.Strategy) {
+		errs = append(errs, fmt.Errorf("pagination: unknown strategy %q: must be offset, keyset or token", c.Pagination.Strategy))
+	}
+	if c.Locale != "" {
+		if _, err := utils.ParseLocale(c.Locale); err != nil {
+			errs = append(errs, fmt.Errorf("locale: %v", err))
+		}
+	}
+	if c.Reload.Interval < 0 {
+		errs = append(errs, errors.New("reload: interval must not be negative"))
+	}
+	if c.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("shutdown_timeout must not be negative"))
+	}
+	if c.ResultCache.MaxEntries < 0 || c.ResultCache.TTL < 0 || c.ResultCache.StaleTTL < 0 {
+		errs = append(errs, errors.New("result_cache: settings must not be negative"))
+	}
+	if c.Breaker.Threshold < 0 || c.Breaker.Cooldown < 0 || c.Breaker.SlowCall < 0 {
+		errs = append(errs, errors.New("breaker: settings must not be negative"))
+	}
+	if c.Idempotency.MaxEntries < 0 || c.Idempotency.TTL < 0 {
+		errs = append(errs, errors.New("idempotency: settings must not be negative"))
+	}
+	for _, hook := range c.Events.Webhooks {
+		if u, err := url.Parse(hook.URL); err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("events: invalid webhook url %q", hook.URL))
+		}
+	}
+	if c.Events.Timeout < 0 {
+		errs = append(errs, errors.New("events: timeout must not be negative"))
+	}
+	if c.QueryTimeout < 0 {
+		errs = append(errs, errors.New("query_timeout must not be negative"))
+	}
+	if c.Pool.MaxOpenConns < 0 || c.Pool.MaxIdleConns < 0 || c.Pool.ConnMaxLifetime < 0 || c.Pool.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("pool: settings must not be negative"))
+	}
+
+	for name, table := range c.Tables {
+		if err := utils.ValidateTableName(name); err != nil {
+			errs = append(errs, fmt.Errorf("tables: invalid table name %q", name))
+			continue
+		}
+		if err := table.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("tables.%s: %v", name, err))
+		}
+	}
+
+	switch c.Auth.Mode {
+	case AuthNone, "":
+		if len(c.Auth.Keys) > 0 {
+			errs = append(errs, errors.New("auth: keys require mode api_key"))
+		}
+	case AuthAPIKey:
+		if len(c.Auth.Keys) == 0 {
+			errs = append(errs, errors.New("auth: mode api_key requires keys"))
+		}
+		for i, key := range c.Auth.Keys {
+			if key.Hash == "" {
+				errs = append(errs, fmt.Errorf("auth: key %d has no hash", i+1))
+			}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("auth: unknown mode %q: must be none or api_key", c.Auth.Mode))
+	}
+
+	if slices.Contains(c.Signing.Secrets, "") {
+		errs = append(errs, errors.New("signing: secrets must not be empty"))
+	}
+	if c.Signing.Tolerance < 0 {
+		errs = append(errs, errors.New("signing: tolerance must not be negative"))
+	}
+
+	for _, origin := range c.CORS.AllowOrigins {
+		if origin == "" || origin != "*" && !strings.Contains(origin, "://") {
+			errs = append(errs, fmt.Errorf("cors: invalid origin %q", origin))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t TableConfig) validate() error {
+	if t.Table != "" && utils.ValidateTableName(t.Table) != nil {
+		return fmt.Errorf("invalid table name %q", t.Table)
+	}
+	for _, verb := range t.Verbs {
+		if !slices.Contains(Verbs, strings.ToUpper(verb)) {
+			return fmt.Errorf("unknown verb %q", verb)
+		}
+	}
+	for _, column := range slices.Concat(t.Columns, t.IntStrings, slices.Collect(maps.Keys(t.Mask))) {
+		if err := utils.ValidateColumnName(column); err != nil {
+			return err
+		}
+	}
+	rules := masking.Rules{"mask": {}}
+	for column, mask := range t.Mask {
+		rules["mask"][column] = mask.policy()
+	}
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	if t.MaxPageSize < 0 {
+		return errors.New("max_page_size must not be negative")
+	}
+	if t.Filter != "" {
+		params, err := query.ParseParams(t.Filter)
+		if err != nil {
+			return fmt.Errorf("invalid filter: %v", err)
+		}
+		sql, _, err := query.ParseFilters(params, query.Options{})
+		if err != nil || sql == "" {
+			return fmt.Errorf("invalid filter %q", t.Filter)
+		}
+	}
+	return nil
+}
+
+// references reports whether the table policies name a table, or a column
+// of it when column is set, so renaming or dropping it would break them
+func (c *Config) references(table, column string) bool {
+	for name, tc := range c.Tables {
+		if tc.tableName(name) != table {
+			continue
+		}
+		if _, masked := tc.Mask[column]; masked || column == "" || slices.Contains(tc.Columns, column) || slices.Contains(tc.IntStrings, column) {
+			return true
+		}
+		params, _ := query.ParseParams(tc.Filter)
+		if query.ReferencedColumns(params)[column] {
+			return true
+		}
+	}
+	return false
+}
+
+// tableName returns the table served under name
+func (t TableConfig) tableName(name string) string {
+	if t.Table != "" {
+		return t.Table
+	}
+	return name
+}
+
+// keyStore holds the configured API keys
+func (c *Config) keyStore() apikey.MemoryStore {
+	store := apikey.MemoryStore{}
+	for _, key := range c.Auth.Keys {
+		store[key.Hash] = &apikey.Key{ID: key.ID, Role: key.Role, Tables: key.Tables, RateLimit: key.RateLimit}
+	}
+	return store
+}
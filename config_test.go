@@ -0,0 +1,128 @@
+package restql
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test YAML and TOML config files are read with environment references
+// expanded
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("RESTQL_TEST_DSN", "postgres://restql@localhost/app")
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"restql.yaml": `
+dsn: ${RESTQL_TEST_DSN}
+port: 9090
+tables:
+  products:
+    verbs: [GET]
+    columns: [id, name]
+  orders:
+    filter: tenant_id=eq.42
+cors:
+  allow_origins: ["*"]
+auth:
+  mode: api_key
+  keys:
+    - id: web
+      hash: abc
+`,
+		"restql.toml": `
+dsn = "${RESTQL_TEST_DSN}"
+port = 9090
+
+[tables.products]
+verbs = ["GET"]
+columns = ["id", "name"]
+
+[tables.orders]
+filter = "tenant_id=eq.42"
+
+[cors]
+allow_origins = ["*"]
+
+[auth]
+mode = "api_key"
+keys = [{id = "web", hash = "abc"}]
+`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0o644)
+
+		cfg, err := LoadConfig(path)
+		assert.NoError(t, err, name)
+		cfg.SetDefaults()
+		assert.NoError(t, cfg.Validate(), name)
+		assert.Equal(t, "postgres://restql@localhost/app", cfg.DSN, name)
+		assert.Equal(t, 9090, cfg.Port, name)
+		assert.Equal(t, "/api", cfg.Prefix, name)
+		assert.Equal(t, TableConfig{Verbs: []string{"GET"}, Columns: []string{"id", "name"}}, cfg.Tables["products"], name)
+		assert.Equal(t, "tenant_id=eq.42", cfg.Tables["orders"].Filter, name)
+		assert.Equal(t, "web", cfg.keyStore()["abc"].ID, name)
+	}
+
+	cfg, err := LoadConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{}, cfg)
+}
+
+// Test validation reports every problem of a config
+func TestValidateConfig(t *testing.T) {
+	cfg := &Config{
+		Port: 70000,
+		Tables: map[string]TableConfig{
+			"products":  {Verbs: []string{"get", "TRACE"}},
+			"orders":    {Columns: []string{"id;"}},
+			"events":    {Filter: "bogus"},
+			"bad-table": {},
+			"offers":    {Table: "products;"},
+			"invoices":  {IntStrings: []string{"id;"}},
+		},
+		CORS:            CORSConfig{AllowOrigins: []string{"example.com"}},
+		Auth:            AuthConfig{Mode: AuthAPIKey, Keys: []KeyConfig{{ID: "web"}}},
+		Pagination:      PaginationConfig{Strategy: "cursor"},
+		Reload:          ReloadConfig{Interval: -1},
+		Locale:          "xx-YY",
+		ShutdownTimeout: -1,
+		QueryTimeout:    -1,
+		Pool:            PoolConfig{MaxOpenConns: -1},
+		Signing:         SigningConfig{Secrets: []string{""}, Tolerance: -1},
+		Events:          EventsConfig{Webhooks: []WebhookConfig{{URL: "example.com/hooks"}}, Timeout: -1},
+	}
+
+	err := cfg.Validate()
+	for _, want := range []string{
+		"dsn is required",
+		"invalid port 70000",
+		`tables.products: unknown verb "TRACE"`,
+		`tables.orders: invalid column name "id;"`,
+		`tables.events: invalid filter "bogus"`,
+		`tables: invalid table name "bad-table"`,
+		`tables.offers: invalid table name "products;"`,
+		`tables.invoices: invalid column name "id;"`,
+		`cors: invalid origin "example.com"`,
+		"auth: key 1 has no hash",
+		`pagination: unknown strategy "cursor": must be offset, keyset or token`,
+		`locale: unknown locale "xx-YY"`,
+		"reload: interval must not be negative",
+		"shutdown_timeout must not be negative",
+		"query_timeout must not be negative",
+		"pool: settings must not be negative",
+		"signing: secrets must not be empty",
+		"signing: tolerance must not be negative",
+		`events: invalid webhook url "example.com/hooks"`,
+		"events: timeout must not be negative",
+	} {
+		assert.ErrorContains(t, err, want)
+	}
+
+	cfg = &Config{DSN: "postgres://localhost/app", Auth: AuthConfig{Mode: "oauth"}}
+	assert.EqualError(t, cfg.Validate(), `auth: unknown mode "oauth": must be none or api_key`)
+}
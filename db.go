@@ -0,0 +1,321 @@
+package restql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/The-ForgeBase/restql/dsn"
+	"github.com/The-ForgeBase/restql/migrate"
+	"github.com/The-ForgeBase/restql/utils"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// schemaQueries list the columns of every table and view of the connected
+// schema, in table and column order
+var schemaQueries = map[string]string{
+	"postgres": `SELECT table_name, column_name, data_type, is_nullable = 'YES', is_identity = 'YES', is_generated = 'ALWAYS', column_default IS NOT NULL
+		FROM information_schema.columns WHERE table_schema = current_schema()
+		ORDER BY table_name, ordinal_position`,
+	"mysql": `SELECT table_name, column_name, data_type, is_nullable = 'YES', false, extra LIKE '%GENERATED%', column_default IS NOT NULL OR extra LIKE '%auto_increment%'
+		FROM information_schema.columns WHERE table_schema = DATABASE()
+		ORDER BY table_name, ordinal_position`,
+	// Only INTEGER PRIMARY KEY columns alias the rowid and are generated on
+	// insert; hidden 2 and 3 are generated columns
+	"sqlite": `SELECT m.name, c.name, c.type, c."notnull" = 0, c.pk = 1 AND upper(c.type) = 'INTEGER', c.hidden IN (2, 3), c.dflt_value IS NOT NULL
+		FROM sqlite_master m JOIN pragma_table_xinfo(m.name) c
+		WHERE m.type IN ('table', 'view') AND m.name NOT LIKE 'sqlite_%'
+		ORDER BY m.name, c.cid`,
+}
+
+// foreignKeyQueries list the single-column foreign keys of every table of
+// the connected schema
+var foreignKeyQueries = map[string]string{
+	"postgres": `SELECT tc.table_name, kcu.column_name, ccu.table_name, ccu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name
+		JOIN information_schema.constraint_column_usage ccu ON ccu.constraint_schema = tc.constraint_schema AND ccu.constraint_name = tc.constraint_name
+		WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema()
+		AND (SELECT count(*) FROM information_schema.key_column_usage k WHERE k.constraint_schema = tc.constraint_schema AND k.constraint_name = tc.constraint_name) = 1
+		ORDER BY tc.table_name, kcu.column_name`,
+	"mysql": `SELECT table_name, column_name, referenced_table_name, referenced_column_name
+		FROM information_schema.key_column_usage k
+		WHERE table_schema = DATABASE() AND referenced_table_name IS NOT NULL
+		AND (SELECT count(*) FROM information_schema.key_column_usage c WHERE c.constraint_schema = k.constraint_schema AND c.table_name = k.table_name AND c.constraint_name = k.constraint_name) = 1
+		ORDER BY table_name, column_name`,
+	// A foreign key without columns references the primary key, taken to be id
+	"sqlite": `SELECT m.name, f."from", f."table", COALESCE(f."to", 'id')
+		FROM sqlite_master m JOIN pragma_foreign_key_list(m.name) f
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'
+		AND (SELECT count(*) FROM pragma_foreign_key_list(m.name) g WHERE g.id = f.id) = 1
+		ORDER BY m.name, f."from"`,
+}
+
+// database runs generated queries on a connection pool
+type database struct {
+	*sql.DB
+	dbType string
+}
+
+// openDatabase connects to the database of a URL, see package dsn
+func openDatabase(ctx context.Context, rawURL string) (*database, error) {
+	db, d, err := dsn.Open(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := schemaQueries[d.DBType]; !ok {
+		db.Close()
+		return nil, fmt.Errorf("serving %s is not supported", d.DBType)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	return &database{DB: db, dbType: d.DBType}, nil
+}
+
+// setPool sizes the connection pool. Connections already open are kept
+// until the new limits close them.
+func (db *database) setPool(pool PoolConfig) {
+	if db.DB == nil {
+		return
+	}
+	idle := pool.MaxIdleConns
+	if idle == 0 {
+		// database/sql's default, as zero would keep no idle connection
+		idle = 2
+	}
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(idle)
+	db.SetConnMaxLifetime(time.Duration(pool.ConnMaxLifetime) * time.Second)
+	db.SetConnMaxIdleTime(time.Duration(pool.ConnMaxIdleTime) * time.Second)
+}
+
+// Migrate applies the migrations of fsys not yet applied to the database of
+// a URL, returning the ones applied, see package migrate
+func Migrate(ctx context.Context, rawURL string, fsys fs.FS) ([]migrate.Migration, error) {
+	// Migrations hold several statements, which MySQL only runs in one Exec
+	// when asked to
+	if u, err := url.Parse(rawURL); err == nil && u.Scheme == "mysql" {
+		q := u.Query()
+		q.Set("multiStatements", "true")
+		u.RawQuery = q.Encode()
+		rawURL = u.String()
+	}
+
+	db, err := openDatabase(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	migrations, err := migrate.Load(fsys, db.dbType)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.Up(ctx, db.DB, db.dbType, migrations)
+}
+
+// loadSchema reads the columns and foreign keys of every table of the
+// connected schema
+func (db *database) loadSchema(ctx context.Context) (map[string]*utils.Table, error) {
+	rows, err := db.QueryContext(ctx, schemaQueries[db.dbType])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := map[string]*utils.Table{}
+	for rows.Next() {
+		var tableName string
+		var column utils.Column
+		if err := rows.Scan(&tableName, &column.Name, &column.Type, &column.Nullable, &column.Identity, &column.Generated, &column.Default); err != nil {
+			return nil, err
+		}
+		if utils.ValidateTableName(tableName) != nil || utils.ValidateColumnName(column.Name) != nil {
+			continue
+		}
+		column.Type = strings.ToUpper(column.Type)
+
+		table, ok := tables[tableName]
+		if !ok {
+			table = &utils.Table{Name: tableName}
+			tables[tableName] = table
+		}
+		table.Columns = append(table.Columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tables, db.loadForeignKeys(ctx, tables)
+}
+
+// loadForeignKeys adds the foreign keys between tables to them
+func (db *database) loadForeignKeys(ctx context.Context, tables map[string]*utils.Table) error {
+	rows, err := db.QueryContext(ctx, foreignKeyQueries[db.dbType])
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName string
+		var key utils.ForeignKey
+		if err := rows.Scan(&tableName, &key.Column, &key.RefTable, &key.RefColumn); err != nil {
+			return err
+		}
+		table, ok := tables[tableName]
+		if !ok || tables[key.RefTable] == nil {
+			continue
+		}
+		table.ForeignKeys = append(table.ForeignKeys, key)
+	}
+	return rows.Err()
+}
+
+// querier runs statements on the database or a transaction
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// exec runs the statements of q, in a transaction when there are several,
+// or its COPY load, returning the rows of the last one, or nil rows and the
+// number of rows affected for writes
+func (db *database) exec(ctx context.Context, q *utils.ReturnQuery) ([]map[string]any, int64, error) {
+	if q.Copy != nil {
+		affected, err := db.copy(ctx, q.Copy)
+		return nil, affected, err
+	}
+	statements := q.Statements()
+	if len(statements) == 1 {
+		return db.run(ctx, db.DB, statements[0])
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var rows []map[string]any
+	var affected int64
+	for _, statement := range statements {
+		if rows, affected, err = db.run(ctx, tx, statement); err != nil {
+			return nil, 0, err
+		}
+	}
+	return rows, affected, tx.Commit()
+}
+
+// copy loads rows with COPY FROM STDIN on a pgx connection of the pool
+func (db *database) copy(ctx context.Context, data *utils.CopyData) (int64, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var affected int64
+	err = conn.Raw(func(driverConn any) error {
+		pgxConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("COPY needs the pgx driver, not %T", driverConn)
+		}
+		affected, err = pgxConn.Conn().CopyFrom(ctx, pgx.Identifier{data.Table}, data.Columns, pgx.CopyFromRows(data.Rows))
+		return err
+	})
+	return affected, err
+}
+
+// fetch runs a read, returning its column names and rows in column order,
+// as export.Serve reads pages
+func (db *database) fetch(ctx context.Context, q *utils.ReturnQuery) ([]string, [][]any, error) {
+	query, args := q.Bind(utils.BindStyleOf(db.dbType))
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	return scanValues(rows)
+}
+
+func (db *database) run(ctx context.Context, conn querier, q utils.ReturnQuery) ([]map[string]any, int64, error) {
+	query, args := q.Bind(utils.BindStyleOf(db.dbType))
+	if !returnsRows(query) {
+		result, err := conn.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, 0, err
+		}
+		affected, err := result.RowsAffected()
+		return nil, affected, err
+	}
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	result, err := scanRows(rows)
+	return result, int64(len(result)), err
+}
+
+// returnsRows reports whether a statement is a read or a write with
+// RETURNING
+func returnsRows(query string) bool {
+	upper := strings.ToUpper(query)
+	return strings.HasPrefix(upper, "SELECT") || strings.HasPrefix(upper, "WITH") ||
+		strings.Contains(upper, " RETURNING ")
+}
+
+// scanRows reads rows into maps, converting values by column type with
+// utils.Types so numbers and booleans encode as JSON numbers and booleans
+func scanRows(rows *sql.Rows) ([]map[string]any, error) {
+	columns, values, err := scanValues(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]any, len(values))
+	for i, row := range values {
+		result[i] = make(map[string]any, len(columns))
+		for j, column := range columns {
+			result[i][column] = row[j]
+		}
+	}
+	return result, nil
+}
+
+// scanValues reads rows in column order, converting values like scanRows
+func scanValues(rows *sql.Rows) ([]string, [][]any, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := make([]string, len(types))
+	for i, t := range types {
+		columns[i] = t.Name()
+	}
+
+	result := [][]any{}
+	for rows.Next() {
+		values := make([]any, len(types))
+		for i, t := range types {
+			values[i] = utils.NewValue(t.DatabaseTypeName())
+		}
+		if err := rows.Scan(values...); err != nil {
+			return nil, nil, err
+		}
+		for i, t := range types {
+			values[i] = utils.ConvertValue(t.DatabaseTypeName(), values[i])
+		}
+		result = append(result, values)
+	}
+	return columns, result, rows.Err()
+}
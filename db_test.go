@@ -0,0 +1,22 @@
+package restql
+
+import (
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test placeholders are numbered for Postgres only
+func TestRebind(t *testing.T) {
+	query := "SELECT * FROM products WHERE level < ? AND name = ?"
+	q := &utils.ReturnQuery{Query: query, Args: []any{3, "pen"}}
+	text, _ := q.Bind(utils.BindStyleOf("postgres"))
+	assert.Equal(t, "SELECT * FROM products WHERE level < $1 AND name = $2", text)
+	text, _ = q.Bind(utils.BindStyleOf("mysql"))
+	assert.Equal(t, query, text)
+
+	assert.True(t, returnsRows(query))
+	assert.True(t, returnsRows("INSERT INTO products (name) VALUES ($1) RETURNING *"))
+	assert.False(t, returnsRows("DELETE FROM products WHERE id = $1"))
+}
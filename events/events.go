@@ -0,0 +1,86 @@
+// Package events publishes change events after successful writes, turning
+// restql into a lightweight change data capture source.
+package events
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Operation is the kind of write that produced an event
+type Operation string
+
+const (
+	Insert Operation = "insert"
+	Update Operation = "update"
+	Delete Operation = "delete"
+)
+
+// Event describes a change to a table
+type Event struct {
+	Table     string           `json:"table"`
+	Operation Operation        `json:"operation"`
+	Rows      []map[string]any `json:"rows,omitempty"`
+	Time      time.Time        `json:"time"`
+}
+
+// Sink receives published events
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// OperationForMethod maps the HTTP method of a write request to its operation
+func OperationForMethod(method string) (Operation, bool) {
+	switch method {
+	case http.MethodPost:
+		return Insert, true
+	case http.MethodPut, http.MethodPatch:
+		return Update, true
+	case http.MethodDelete:
+		return Delete, true
+	default:
+		return "", false
+	}
+}
+
+// Publisher fans events out to every configured sink
+type Publisher struct {
+	sinks []Sink
+}
+
+// NewPublisher creates a publisher delivering to sinks
+func NewPublisher(sinks ...Sink) *Publisher {
+	return &Publisher{sinks: sinks}
+}
+
+// Publish delivers event to all sinks, stamping its time when unset. Every
+// sink is attempted; their errors are joined.
+func (p *Publisher) Publish(ctx context.Context, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	var errs []error
+	for _, sink := range p.sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ChannelSink delivers events to a Go channel
+type ChannelSink chan<- Event
+
+// Publish implements Sink, blocking until the event is received or ctx is done
+func (c ChannelSink) Publish(ctx context.Context, event Event) error {
+	select {
+	case c <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test events reach both webhook and channel sinks
+func TestPublish(t *testing.T) {
+	secret := []byte("s3cret")
+
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.True(t, Verify(secret, body, r.Header.Get(SignatureHeader)))
+		assert.NoError(t, json.Unmarshal(body, &received))
+	}))
+	defer server.Close()
+
+	ch := make(chan Event, 1)
+	p := NewPublisher(&WebhookSink{URL: server.URL, Secret: secret}, ChannelSink(ch))
+
+	op, ok := OperationForMethod(http.MethodPost)
+	assert.True(t, ok)
+
+	err := p.Publish(context.Background(), Event{Table: "products", Operation: op, Rows: []map[string]any{{"id": float64(1)}}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "products", received.Table)
+	assert.Equal(t, Insert, received.Operation)
+	assert.Equal(t, []map[string]any{{"id": float64(1)}}, received.Rows)
+	assert.False(t, received.Time.IsZero())
+
+	event := <-ch
+	assert.Equal(t, "products", event.Table)
+}
+
+// Test failing sinks do not stop delivery to the others
+func TestPublishErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ch := make(chan Event, 1)
+	p := NewPublisher(&WebhookSink{URL: server.URL}, ChannelSink(ch))
+
+	err := p.Publish(context.Background(), Event{Table: "products", Operation: Delete})
+	assert.ErrorContains(t, err, "responded with status 500")
+	assert.Len(t, ch, 1)
+
+	assert.False(t, Verify([]byte("a"), []byte("body"), "not-hex"))
+}
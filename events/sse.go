@@ -0,0 +1,152 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Broker is an in-process Sink that streams published events to subscribers
+// over server-sent events. Mount it to serve /{table}/subscribe; the query
+// string takes the same filter grammar as GET requests, and only rows
+// matching it are streamed. restql.Server does not mount it, as its
+// subscribers would bypass the table policies of the config.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[*subscription]struct{}
+	// Buffer is the number of events queued per subscriber before further
+	// events for it are dropped. Defaults to 16.
+	Buffer int
+}
+
+type subscription struct {
+	table  string
+	params []query.Param
+	events chan Event
+}
+
+// NewBroker creates an empty broker
+func NewBroker() *Broker {
+	return &Broker{subs: map[*subscription]struct{}{}}
+}
+
+// Publish implements Sink. Slow subscribers whose buffer is full miss the
+// event rather than blocking the writer.
+func (b *Broker) Publish(ctx context.Context, event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if sub.table != event.Table {
+			continue
+		}
+
+		filtered, ok := filterRows(sub.params, event)
+		if !ok {
+			continue
+		}
+
+		select {
+		case sub.events <- filtered:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// filterRows keeps the rows of an event matching a subscriber's filters. An
+// event without rows is delivered only to subscribers without filters.
+func filterRows(params []query.Param, event Event) (Event, bool) {
+	if len(event.Rows) == 0 {
+		return event, len(params) == 0
+	}
+
+	rows := []map[string]any{}
+	for _, row := range event.Rows {
+		if ok, err := query.MatchFilters(params, row); err == nil && ok {
+			rows = append(rows, row)
+		}
+	}
+	event.Rows = rows
+
+	return event, len(rows) > 0
+}
+
+// ServeHTTP streams events for the table in the path until the client leaves
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || parts[1] != "subscribe" {
+		http.Error(w, "subscribe path must be /{table}/subscribe", http.StatusNotFound)
+		return
+	}
+	if err := utils.ValidateTableName(parts[0]); err != nil {
+		http.Error(w, "invalid table name", http.StatusBadRequest)
+		return
+	}
+
+	params, err := query.ParseParams(r.URL.RawQuery)
+	if err != nil {
+		http.Error(w, "invalid query string", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := b.subscribe(parts[0], params)
+	defer b.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-sub.events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Operation, data)
+			flusher.Flush()
+		}
+	}
+}
+
+func (b *Broker) subscribe(table string, params []query.Param) *subscription {
+	size := b.Buffer
+	if size <= 0 {
+		size = 16
+	}
+
+	sub := &subscription{table: table, params: params, events: make(chan Event, size)}
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = map[*subscription]struct{}{}
+	}
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+func (b *Broker) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	delete(b.subs, sub)
+	b.mu.Unlock()
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test subscribers receive only matching rows of their table
+func TestBrokerSubscribe(t *testing.T) {
+	broker := NewBroker()
+	server := httptest.NewServer(broker)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/tasks/subscribe?status=eq.open")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Wait for the subscription to register
+	for i := 0; i < 100; i++ {
+		broker.mu.Lock()
+		n := len(broker.subs)
+		broker.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx := context.Background()
+	assert.NoError(t, broker.Publish(ctx, Event{Table: "users", Operation: Insert, Rows: []map[string]any{{"status": "open"}}}))
+	assert.NoError(t, broker.Publish(ctx, Event{Table: "tasks", Operation: Insert, Rows: []map[string]any{{"id": 1, "status": "done"}}}))
+	assert.NoError(t, broker.Publish(ctx, Event{Table: "tasks", Operation: Update, Rows: []map[string]any{{"id": 2, "status": "open"}, {"id": 3, "status": "done"}}}))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "event: update\n", line)
+
+	line, err = reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(line, `data: {"table":"tasks","operation":"update","rows":[{"id":2,"status":"open"}]`), line)
+}
+
+// Test invalid subscribe paths are rejected
+func TestBrokerInvalidPath(t *testing.T) {
+	broker := NewBroker()
+
+	rec := httptest.NewRecorder()
+	broker.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	broker.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/1tasks/subscribe", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,76 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SignatureHeader carries the hex-encoded HMAC-SHA256 of the request body
+const SignatureHeader = "X-Restql-Signature"
+
+// WebhookSink posts events as JSON to an HTTP endpoint
+type WebhookSink struct {
+	URL string
+	// Secret signs each body with HMAC-SHA256 when set
+	Secret []byte
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// Publish implements Sink
+func (w *WebhookSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded with status %d", w.URL, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of body, as sent in SignatureHeader
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature received in SignatureHeader
+func Verify(secret, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -0,0 +1,165 @@
+// Package export streams a result set as a downloadable file, reading the
+// pages of a query built by GET /{table}/export one after another.
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Fetcher runs a query, returning the column names and rows
+type Fetcher func(ctx context.Context, q *utils.ReturnQuery) ([]string, [][]any, error)
+
+// Writer encodes rows into a file format
+type Writer interface {
+	// WriteRow writes a row whose values line up with columns
+	WriteRow(columns []string, row []any) error
+	// Flush writes any buffered data
+	Flush() error
+}
+
+// ContentTypes maps export formats to their media types
+var ContentTypes = map[string]string{
+	"csv":   "text/csv; charset=utf-8",
+	"jsonl": "application/jsonl",
+}
+
+// NewWriter returns a Writer encoding format to w
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case "jsonl":
+		return &jsonlWriter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %s", format)
+	}
+}
+
+// Serve writes the export q to w as a file download, fetching pages until a
+// short one. Errors after the first page has been written can no longer
+// change the response status; the download is then cut short.
+func Serve(ctx context.Context, w http.ResponseWriter, q *utils.ReturnQuery, fetch Fetcher) error {
+	export := q.Export
+	if export == nil {
+		return fmt.Errorf("not an export query")
+	}
+	writer, err := NewWriter(export.Format, w)
+	if err != nil {
+		return err
+	}
+
+	for page := 0; ; page++ {
+		columns, rows, err := fetch(ctx, q)
+		if err != nil {
+			return err
+		}
+		if page == 0 {
+			w.Header().Set("Content-Type", ContentTypes[export.Format])
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": export.Filename}))
+		}
+
+		for _, row := range rows {
+			if err := writer.WriteRow(columns, row); err != nil {
+				return err
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+
+		if len(rows) < export.BatchSize || len(rows) == 0 {
+			return nil
+		}
+		id := slices.Index(columns, "id")
+		if id < 0 {
+			return fmt.Errorf("export rows have no id column")
+		}
+		q = export.Next(rows[len(rows)-1][id])
+	}
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (c *csvWriter) WriteRow(columns []string, row []any) error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write(columns); err != nil {
+			return err
+		}
+	}
+
+	record := make([]string, len(row))
+	for i, value := range row {
+		record[i] = formatCell(value)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatCell formats a value as a CSV cell. NULL is an empty cell.
+func formatCell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type jsonlWriter struct {
+	w io.Writer
+}
+
+// WriteRow writes the row as one JSON object, keeping the column order
+func (j *jsonlWriter) WriteRow(columns []string, row []any) error {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(row[i])
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	_, err := j.w.Write(buf.Bytes())
+	return err
+}
+
+func (j *jsonlWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package export
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeExport pages through rows with ids 1..n, two at a time
+func fakeExport(format string, n int) (*utils.ReturnQuery, Fetcher) {
+	export := &utils.Export{Format: format, Filename: "products." + format, BatchSize: 2}
+	export.Next = func(after any) *utils.ReturnQuery {
+		return &utils.ReturnQuery{Args: []any{after}, Export: export}
+	}
+
+	fetch := func(ctx context.Context, q *utils.ReturnQuery) ([]string, [][]any, error) {
+		start := 0
+		if after, ok := q.Args[0].(int); ok {
+			start = after
+		}
+		rows := [][]any{}
+		for id := start + 1; id <= n && id <= start+2; id++ {
+			var name any = "item, " + string(rune('a'+id-1))
+			if id == 2 {
+				name = nil
+			}
+			rows = append(rows, []any{id, name})
+		}
+		return []string{"id", "name"}, rows, nil
+	}
+	return export.Next(nil), fetch
+}
+
+// Test Serve writes every page as a file download
+func TestServe(t *testing.T) {
+	q, fetch := fakeExport("csv", 3)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, Serve(context.Background(), rec, q, fetch))
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=products.csv`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "id,name\n1,\"item, a\"\n2,\n3,\"item, c\"\n", rec.Body.String())
+
+	q, fetch = fakeExport("jsonl", 4)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, Serve(context.Background(), rec, q, fetch))
+	assert.Equal(t, "application/jsonl", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `{"id":1,"name":"item, a"}
+{"id":2,"name":null}
+{"id":3,"name":"item, c"}
+{"id":4,"name":"item, d"}
+`, rec.Body.String())
+
+	_, err := NewWriter("parquet", rec)
+	assert.EqualError(t, err, "unsupported export format parquet")
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// IndexAdvisor counts the filter and order columns of reads when set, to
+// suggest indexes for the access patterns the API actually serves
+var IndexAdvisor *Advisor
+
+// Advisor tracks read access patterns. Serve it on an admin route to list
+// index suggestions as JSON.
+type Advisor struct {
+	mu    sync.Mutex
+	usage map[accessPattern]int
+}
+
+// accessPattern is a table with the sorted columns a read filters on and
+// the columns it orders by
+type accessPattern struct {
+	table   string
+	filters string
+	order   string
+}
+
+// IndexSuggestion is an index that would serve reads no known index covers
+type IndexSuggestion struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	// Count is the number of reads using the pattern
+	Count int `json:"count"`
+}
+
+// NewAdvisor creates an advisor with no recorded reads
+func NewAdvisor() *Advisor {
+	return &Advisor{usage: map[accessPattern]int{}}
+}
+
+// recordRead counts a read in the IndexAdvisor, when set. Special tables
+// like _union are skipped.
+func (h *Handler) recordRead(r *http.Request, tableName string, q *utils.ReturnQuery) {
+	if a := IndexAdvisor; a != nil && r.Method == http.MethodGet && q.ReadOnly && !strings.HasPrefix(tableName, "_") {
+		a.record(r, tableName, h)
+	}
+}
+
+// record counts a read of tableName, parsing its parameters in the grammar
+// of h
+func (a *Advisor) record(r *http.Request, tableName string, h *Handler) {
+	params, err := h.Params(r, tableName)
+	if err != nil {
+		return
+	}
+
+	filters := []string{}
+	for column := range query.FilterColumns(params) {
+		filters = append(filters, column)
+	}
+	sort.Strings(filters)
+
+	order := []string{}
+	for _, part := range strings.Split(paramValues(params).Get("order"), ",") {
+		if column, _, _ := strings.Cut(part, "."); column != "" && column != "random" && !slices.Contains(filters, column) {
+			order = append(order, column)
+		}
+	}
+	if len(filters) == 0 && len(order) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.usage[accessPattern{tableName, strings.Join(filters, ","), strings.Join(order, ",")}]++
+}
+
+// Suggestions returns an index for each recorded access pattern not covered
+// by the indexes in Schema, most used first. An index covers a pattern when
+// it starts with the filtered columns, in any order, followed by the order
+// columns. Tables without index metadata are assumed to have none.
+func (a *Advisor) Suggestions() []IndexSuggestion {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	suggestions := []IndexSuggestion{}
+	for pattern, count := range a.usage {
+		filters, order := splitColumns(pattern.filters), splitColumns(pattern.order)
+		if covered(pattern.table, filters, order) {
+			continue
+		}
+		suggestions = append(suggestions, IndexSuggestion{
+			Table:   pattern.table,
+			Columns: append(filters, order...),
+			Count:   count,
+		})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Count != suggestions[j].Count {
+			return suggestions[i].Count > suggestions[j].Count
+		}
+		if suggestions[i].Table != suggestions[j].Table {
+			return suggestions[i].Table < suggestions[j].Table
+		}
+		return strings.Join(suggestions[i].Columns, ",") < strings.Join(suggestions[j].Columns, ",")
+	})
+	return suggestions
+}
+
+// ServeHTTP lists the suggestions as JSON
+func (a *Advisor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Suggestions())
+}
+
+// covered reports whether an index of tableName serves filters and order
+func covered(tableName string, filters, order []string) bool {
+	table := tableMeta(tableName)
+	if table == nil {
+		return false
+	}
+
+	for _, index := range table.Indexes {
+		if len(index.Columns) < len(filters)+len(order) {
+			continue
+		}
+		lead := slices.Clone(index.Columns[:len(filters)])
+		sort.Strings(lead)
+		if slices.Equal(lead, filters) && slices.Equal(index.Columns[len(filters):len(filters)+len(order)], order) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitColumns(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the advisor suggests indexes for frequent uncovered reads
+func TestIndexAdvisor(t *testing.T) {
+	defer func(a *Advisor) { IndexAdvisor = a }(IndexAdvisor)
+	IndexAdvisor = NewAdvisor()
+	Schema["tickets"] = &utils.Table{
+		Name:    "tickets",
+		Columns: []utils.Column{{Name: "id"}, {Name: "status"}, {Name: "team_id"}, {Name: "created_at"}},
+		Indexes: []utils.Index{{Name: "tickets_team_status", Columns: []string{"team_id", "status", "created_at"}}},
+	}
+	defer delete(Schema, "tickets")
+
+	paths := []string{
+		"/tickets?status=eq.open&team_id=eq.4&order=created_at.desc", // covered
+		"/tickets?status=eq.open&order=created_at.desc",
+		"/tickets?status=eq.closed&order=created_at.desc",
+		"/orders?customer_id=eq.9",
+		"/orders",
+	}
+	for _, path := range paths {
+		_, err := GetQL(httptest.NewRequest(http.MethodGet, path, nil), "postgres")
+		assert.NoError(t, err)
+	}
+	_, err := GetQL(httptest.NewRequest(http.MethodDelete, "/orders?customer_id=eq.9", nil), "postgres")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []IndexSuggestion{
+		{Table: "tickets", Columns: []string{"status", "created_at"}, Count: 2},
+		{Table: "orders", Columns: []string{"customer_id"}, Count: 1},
+	}, IndexAdvisor.Suggestions())
+
+	rec := httptest.NewRecorder()
+	IndexAdvisor.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/indexes", nil))
+	var served []IndexSuggestion
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Equal(t, IndexAdvisor.Suggestions(), served)
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// TableAlteration is a change to a table for AlterTableQL, with exactly one
+// field set, e.g.
+//
+//	{"add_column": {"name": "sku", "type": "VARCHAR(32)", "nullable": true}}
+//	{"rename_column": {"from": "title", "to": "name"}}
+//	{"add_index": {"columns": ["sku"], "unique": true}}
+type TableAlteration struct {
+	AddColumn    *ColumnDefinition `json:"add_column,omitempty"`
+	DropColumn   string            `json:"drop_column,omitempty"`
+	RenameColumn *Rename           `json:"rename_column,omitempty"`
+	// RenameTo renames the table
+	RenameTo  string       `json:"rename_to,omitempty"`
+	AddIndex  *utils.Index `json:"add_index,omitempty"`
+	DropIndex string       `json:"drop_index,omitempty"`
+}
+
+// Rename renames a column
+type Rename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// AlterTableQL builds the statement applying an alteration to a table for
+// the given database type. With table metadata in Schema, the columns it
+// names are checked against it. Call SetSchema with the altered schema once
+// it ran, so no query of the previous one is served.
+func AlterTableQL(tableName string, alt *TableAlteration, dbType string) (*utils.ReturnQuery, error) {
+	return New(dbType, Options{}).AlterTableQL(tableName, alt)
+}
+
+// AlterTableQL builds the statement applying an alteration to a table like
+// AlterTableQL, checking the columns it names against the schema of h
+func (h *Handler) AlterTableQL(tableName string, alt *TableAlteration) (*utils.ReturnQuery, error) {
+	dbType := h.dbType
+	if err := utils.ValidateTableName(tableName); err != nil {
+		return nil, err
+	}
+	if alt.count() != 1 {
+		return nil, errors.New("an alteration must set exactly one of add_column, drop_column, rename_column, rename_to, add_index or drop_index")
+	}
+
+	table := h.tableMeta(tableName)
+	exists := func(column string) bool {
+		if table == nil {
+			return true
+		}
+		_, ok := table.Column(column)
+		return ok
+	}
+	unsupported := func(change string) error {
+		return fmt.Errorf("%s is not supported on %s", change, dbType)
+	}
+
+	var sql string
+	switch {
+	case alt.AddColumn != nil:
+		column := *alt.AddColumn
+		if err := column.validate(); err != nil {
+			return nil, err
+		}
+		if table != nil && exists(column.Name) {
+			return nil, fmt.Errorf("column %s already exists", column.Name)
+		}
+		if column.Identity {
+			return nil, fmt.Errorf("identity column %s can only be declared when creating the table", column.Name)
+		}
+		if dbType == "surrealdb" {
+			statements, err := surrealFieldQL(tableName, column)
+			if err != nil {
+				return nil, err
+			}
+			return batch(statements), nil
+		}
+		if dbType == "sqlite" && column.Unique {
+			return nil, fmt.Errorf("unique column %s cannot be added on sqlite: add a unique index instead", column.Name)
+		}
+
+		definition, err := columnSQL(&TableDefinition{Name: tableName}, column, dbType)
+		if err != nil {
+			return nil, err
+		}
+		sql = fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", tableName, definition)
+		if column.References != "" {
+			refTable, ref, _ := strings.Cut(column.References, ".")
+			if dbType == "mysql" {
+				// MySQL ignores REFERENCES in column definitions
+				sql += fmt.Sprintf(", ADD FOREIGN KEY (%s) REFERENCES %s (%s)", column.Name, refTable, ref)
+			} else {
+				sql += fmt.Sprintf(" REFERENCES %s (%s)", refTable, ref)
+			}
+		}
+
+	case alt.DropColumn != "":
+		if err := utils.ValidateColumnName(alt.DropColumn); err != nil {
+			return nil, err
+		}
+		if !exists(alt.DropColumn) {
+			return nil, fmt.Errorf("unknown column %s", alt.DropColumn)
+		}
+		if dbType == "surrealdb" {
+			sql = fmt.Sprintf("REMOVE FIELD %s ON %s", alt.DropColumn, tableName)
+		} else {
+			sql = fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", tableName, alt.DropColumn)
+		}
+
+	case alt.RenameColumn != nil:
+		from, to := alt.RenameColumn.From, alt.RenameColumn.To
+		for _, name := range []string{from, to} {
+			if err := utils.ValidateColumnName(name); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case !exists(from):
+			return nil, fmt.Errorf("unknown column %s", from)
+		case table != nil && exists(to):
+			return nil, fmt.Errorf("column %s already exists", to)
+		case dbType == "surrealdb":
+			return nil, unsupported("renaming a column")
+		}
+		sql = fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", tableName, from, to)
+
+	case alt.RenameTo != "":
+		if err := utils.ValidateTableName(alt.RenameTo); err != nil {
+			return nil, err
+		}
+		switch {
+		case h.tableMeta(alt.RenameTo) != nil:
+			return nil, fmt.Errorf("table %s already exists", alt.RenameTo)
+		case dbType == "surrealdb":
+			return nil, unsupported("renaming a table")
+		}
+		sql = fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tableName, alt.RenameTo)
+
+	case alt.AddIndex != nil:
+		if err := validateIndex(*alt.AddIndex, exists); err != nil {
+			return nil, err
+		}
+		q := createIndexQL(tableName, *alt.AddIndex, dbType)
+		return &q, nil
+
+	case alt.DropIndex != "":
+		if err := utils.ValidateTableName(alt.DropIndex); err != nil {
+			return nil, fmt.Errorf("invalid index name %q", alt.DropIndex)
+		}
+		switch dbType {
+		case "surrealdb":
+			sql = fmt.Sprintf("REMOVE INDEX %s ON %s", alt.DropIndex, tableName)
+		case "mysql":
+			sql = fmt.Sprintf("DROP INDEX %s ON %s", alt.DropIndex, tableName)
+		default:
+			sql = "DROP INDEX " + alt.DropIndex
+		}
+	}
+	return &utils.ReturnQuery{Query: sql, Table: tableName}, nil
+}
+
+// count returns the number of changes set
+func (alt *TableAlteration) count() int {
+	n := 0
+	for _, set := range []bool{
+		alt.AddColumn != nil, alt.DropColumn != "", alt.RenameColumn != nil,
+		alt.RenameTo != "", alt.AddIndex != nil, alt.DropIndex != "",
+	} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
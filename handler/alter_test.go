@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test alterations render in each dialect
+func TestAlterTableQL(t *testing.T) {
+	sku := &ColumnDefinition{Name: "sku", Type: "VARCHAR(32)", Nullable: true, References: "skus.code"}
+	tests := []struct {
+		alt    TableAlteration
+		dbType string
+		sql    string
+	}{
+		{TableAlteration{AddColumn: sku}, "postgres", "ALTER TABLE products ADD COLUMN sku VARCHAR(32) REFERENCES skus (code)"},
+		{TableAlteration{AddColumn: sku}, "mysql", "ALTER TABLE products ADD COLUMN sku VARCHAR(32), ADD FOREIGN KEY (sku) REFERENCES skus (code)"},
+		{TableAlteration{AddColumn: &ColumnDefinition{Name: "active", Type: "BOOLEAN", Default: true}}, "sqlite", "ALTER TABLE products ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE"},
+		{TableAlteration{AddColumn: &ColumnDefinition{Name: "active", Type: "BOOLEAN", Default: true}}, "surrealdb", "DEFINE FIELD active ON products TYPE bool DEFAULT TRUE"},
+		{TableAlteration{DropColumn: "level"}, "postgres", "ALTER TABLE products DROP COLUMN level"},
+		{TableAlteration{DropColumn: "level"}, "surrealdb", "REMOVE FIELD level ON products"},
+		{TableAlteration{RenameColumn: &Rename{From: "name", To: "title"}}, "mysql", "ALTER TABLE products RENAME COLUMN name TO title"},
+		{TableAlteration{RenameTo: "items"}, "sqlite", "ALTER TABLE products RENAME TO items"},
+		{TableAlteration{AddIndex: &utils.Index{Columns: []string{"name", "level"}}}, "postgres", "CREATE INDEX products_name_level_idx ON products (name, level)"},
+		{TableAlteration{AddIndex: &utils.Index{Name: "products_name", Columns: []string{"name"}, Unique: true}}, "surrealdb", "DEFINE INDEX products_name ON products FIELDS name UNIQUE"},
+		{TableAlteration{DropIndex: "products_name"}, "postgres", "DROP INDEX products_name"},
+		{TableAlteration{DropIndex: "products_name"}, "mysql", "DROP INDEX products_name ON products"},
+		{TableAlteration{DropIndex: "products_name"}, "surrealdb", "REMOVE INDEX products_name ON products"},
+	}
+
+	for _, tt := range tests {
+		q, err := AlterTableQL("products", &tt.alt, tt.dbType)
+		if assert.NoError(t, err, tt.sql) {
+			assert.Equal(t, tt.sql, q.Query)
+			assert.Equal(t, "products", q.Table)
+		}
+	}
+}
+
+// Test alterations are checked against the table metadata
+func TestAlterTableQLErrors(t *testing.T) {
+	defer func(schema map[string]*utils.Table) { Schema = schema }(Schema)
+	Schema = map[string]*utils.Table{
+		"products": {Name: "products", Columns: []utils.Column{{Name: "id", Type: "INTEGER"}, {Name: "name", Type: "TEXT"}}},
+		"items":    {Name: "items"},
+	}
+
+	tests := []struct {
+		alt    TableAlteration
+		dbType string
+		err    string
+	}{
+		{TableAlteration{}, "postgres", "exactly one"},
+		{TableAlteration{DropColumn: "name", RenameTo: "goods"}, "postgres", "exactly one"},
+		{TableAlteration{AddColumn: &ColumnDefinition{Name: "name", Type: "TEXT"}}, "postgres", "column name already exists"},
+		{TableAlteration{AddColumn: &ColumnDefinition{Name: "n", Type: "INTEGER", Identity: true}}, "postgres", "can only be declared when creating the table"},
+		{TableAlteration{AddColumn: &ColumnDefinition{Name: "sku", Type: "TEXT", Unique: true}}, "sqlite", "add a unique index instead"},
+		{TableAlteration{AddColumn: &ColumnDefinition{Name: "sku", Type: "TEXT; DROP TABLE users"}}, "postgres", "invalid type"},
+		{TableAlteration{DropColumn: "level"}, "postgres", "unknown column level"},
+		{TableAlteration{DropColumn: "name; --"}, "postgres", "invalid column name"},
+		{TableAlteration{RenameColumn: &Rename{From: "name", To: "id"}}, "postgres", "column id already exists"},
+		{TableAlteration{RenameColumn: &Rename{From: "name", To: "title"}}, "surrealdb", "renaming a column is not supported on surrealdb"},
+		{TableAlteration{RenameTo: "items"}, "postgres", "table items already exists"},
+		{TableAlteration{AddIndex: &utils.Index{Columns: []string{"level"}}}, "postgres", "unknown index column level"},
+		{TableAlteration{DropIndex: "x; DROP TABLE users"}, "postgres", "invalid index name"},
+	}
+
+	for _, tt := range tests {
+		_, err := AlterTableQL("products", &tt.alt, tt.dbType)
+		assert.ErrorContains(t, err, tt.err)
+	}
+}
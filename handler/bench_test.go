@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func BenchmarkGetQL(b *testing.B) {
+	req := httptest.NewRequest(http.MethodGet, "/products?level=lt.2&hidden=is.false&or=(name=like.foo*,price=gte.10)&order=price.desc&page=2&page_size=20", nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := GetQL(req, "postgres"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package handler
+
+import (
+	"container/list"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// queryCache is an LRU cache of compiled queries keyed by the shape of the
+// request, so requests differing only in their filter values skip building
+// the query
+type queryCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type queryCacheEntry struct {
+	key  string
+	plan plan
+}
+
+// plan is a cached query and the filters it was built with. The args of
+// the filters are found at offsets in the args of the query, of its count
+// and of its stats, -1 where they are not, and replaced by those of each
+// request. When they cannot be found the query only serves requests with
+// the same args.
+type plan struct {
+	query  utils.ReturnQuery
+	filter string
+	args   []any
+	at     [3]int
+	exact  bool
+}
+
+var planCache *queryCache
+
+// EnableQueryCache caches up to size compiled GET/DELETE queries, shared by
+// every Handler. A size of zero or less disables the cache. Call it again
+// after changing Schema so stale queries are dropped.
+func EnableQueryCache(size int) {
+	if size <= 0 {
+		planCache = nil
+		return
+	}
+	planCache = newQueryCache(size)
+}
+
+// plans returns the query cache of h, or the shared one
+func (h *Handler) plans() *queryCache {
+	if h.cache != nil {
+		return h.cache
+	}
+	return planCache
+}
+
+func newQueryCache(size int) *queryCache {
+	return &queryCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// cacheKey builds the cache key from the method, path, database type, the
+// shape of the parameters, see query.Shape, and the modes and headers that
+// change the generated SQL. Handlers share the cache, so their database type
+// and options are part of the key, and so are the defaults of the table,
+// which can change while it is cached, and the Handler itself when it has
+// its own schema or table defaults.
+func (h *Handler) cacheKey(r *http.Request, tableName string, params []query.Param) string {
+	shape := r.URL.Query().Encode()
+	if shaped(tableName) {
+		shape = query.Shape(params)
+	}
+	key := r.Method + " " + h.dbType + " " + r.URL.Path + "?" + shape
+	if h.schema.Load() != nil || h.opts.TableDefaults != nil {
+		key += " handler=" + strconv.FormatUint(h.id, 10)
+	}
+	if defaults, ok := h.tableDefault(tableName); ok {
+		key += " select=" + defaults.Select + " order=" + defaults.Order
+	}
+	if h.useJSONAPI(r) {
+		key += " jsonapi"
+	}
+	if h.opts.OData {
+		key += " odata"
+	}
+	if h.opts.PostgREST {
+		key += " postgrest range=" + r.Header.Get("Range") + " prefer=" + strings.Join(r.Header.Values("Prefer"), ",")
+	}
+	if h.opts.Pagination != "" {
+		key += " pagination=" + h.opts.Pagination
+	}
+	if tag := h.localeTag(r); tag != "" {
+		key += " locale=" + tag
+	}
+	return key
+}
+
+// shaped reports whether the queries of a table are cached by the shape of
+// their parameters. Named queries, raw SQL and unions read parameters that
+// are not filters, so they are cached by the whole query string.
+func shaped(tableName string) bool {
+	return !strings.HasPrefix(tableName, "_")
+}
+
+// cacheable reports whether the query for a request depends only on its URL.
+// Relative dates like now-7d and reads of partitioned tables also depend on
+// the time.
+func (h *Handler) cacheable(r *http.Request, tableName string) bool {
+	if _, partitioned := h.partition(tableName); partitioned {
+		return false
+	}
+	if query.HasRelativeTime(r.URL.RawQuery) {
+		return false
+	}
+	return r.Method == http.MethodGet || r.Method == http.MethodDelete
+}
+
+// newPlan returns the plan of q, built for a request with params, false
+// when its filters do not parse
+func (h *Handler) newPlan(r *http.Request, tableName string, params []query.Param, q *utils.ReturnQuery) (plan, bool) {
+	p := plan{query: *q, at: [3]int{-1, -1, -1}}
+	if !shaped(tableName) {
+		return p, true
+	}
+	filter, args, err := query.ParseFilters(params, h.filterOptions(r, tableName))
+	if err != nil {
+		return p, false
+	}
+	p.filter, p.args = filter, args
+	if len(args) == 0 {
+		return p, true
+	}
+
+	// Exports page through closures holding the args
+	p.exact = q.Export != nil
+	for i, target := range p.targets() {
+		if target == nil || p.exact {
+			continue
+		}
+		at, ok := locate(target.Args, args)
+		p.at[i] = at
+		p.exact = !ok || at < 0
+	}
+	return p, true
+}
+
+// bind returns the query of p for a request with params, false when p was
+// built for other filters
+func (h *Handler) bind(r *http.Request, tableName string, params []query.Param, p plan) (*utils.ReturnQuery, bool) {
+	if !shaped(tableName) {
+		return &p.query, true
+	}
+	filter, args, err := query.ParseFilters(params, h.filterOptions(r, tableName))
+	if err != nil || filter != p.filter || len(args) != len(p.args) {
+		return nil, false
+	}
+	if p.exact {
+		return &p.query, reflect.DeepEqual(args, p.args)
+	}
+	for i, target := range p.targets() {
+		if target != nil && p.at[i] >= 0 {
+			copy(target.Args[p.at[i]:], args)
+		}
+	}
+	return &p.query, true
+}
+
+// targets returns the queries of p holding the args of its filters: the
+// query, its count and its stats, nil when it has none
+func (p *plan) targets() [3]*utils.ReturnQuery {
+	targets := [3]*utils.ReturnQuery{&p.query, nil, p.query.Stats}
+	if p.query.Page != nil {
+		targets[1] = p.query.Page.Count
+	}
+	return targets
+}
+
+// locate returns the offset of the only run of args in in, -1 when there
+// is none, and false when there are several
+func locate(in, args []any) (int, bool) {
+	at := -1
+	for i := 0; i+len(args) <= len(in); i++ {
+		if !reflect.DeepEqual(in[i:i+len(args)], args) {
+			continue
+		}
+		if at >= 0 {
+			return -1, false
+		}
+		at = i
+	}
+	return at, true
+}
+
+func (c *queryCache) get(key string) (plan, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return plan{}, false
+	}
+	c.ll.MoveToFront(el)
+
+	p := el.Value.(*queryCacheEntry).plan
+	p.query = *copyQuery(p.query)
+	return p, true
+}
+
+func (c *queryCache) add(key string, p plan) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p.query = *copyQuery(p.query)
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		el.Value.(*queryCacheEntry).plan = p
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&queryCacheEntry{key: key, plan: p})
+
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*queryCacheEntry).key)
+	}
+}
+
+// clear drops every cached query
+func (c *queryCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	clear(c.items)
+}
+
+// copyQuery copies the args of q, its count and its stats so callers cannot
+// mutate cached entries
+func copyQuery(q utils.ReturnQuery) *utils.ReturnQuery {
+	args := make([]any, len(q.Args))
+	copy(args, q.Args)
+	q.Args = args
+	if q.Stats != nil {
+		q.Stats = copyQuery(*q.Stats)
+	}
+	if q.Page != nil {
+		page := *q.Page
+		if page.Count != nil {
+			page.Count = copyQuery(*page.Count)
+		}
+		q.Page = &page
+	}
+	return &q
+}
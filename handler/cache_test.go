@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the LRU query cache used by GetQL
+func TestQueryCache(t *testing.T) {
+	defer EnableQueryCache(0)
+	EnableQueryCache(2)
+
+	req := httptest.NewRequest(http.MethodGet, "/products?level=eq.2", nil)
+	first, err := GetQL(req, "surrealdb")
+	assert.NoError(t, err)
+
+	// Mutating a returned query must not leak into the cache
+	first.Args[0] = "mutated"
+
+	req = httptest.NewRequest(http.MethodGet, "/products?level=eq.2", nil)
+	second, err := GetQL(req, "surrealdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM products WHERE level = ? ORDER BY id ASC LIMIT 100 START 0", second.Query)
+	assert.Equal(t, []interface{}{int64(2)}, second.Args)
+
+	// Different database types are cached separately
+	req = httptest.NewRequest(http.MethodGet, "/products?level=eq.2", nil)
+	third, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM products WHERE level = ? ORDER BY id ASC LIMIT 100 OFFSET 0", third.Query)
+
+	// Changing the defaults of a table drops its cached queries
+	TableDefaults["products"] = TableDefault{Order: "name.asc"}
+	defer delete(TableDefaults, "products")
+	req = httptest.NewRequest(http.MethodGet, "/products?level=eq.2", nil)
+	fourth, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM products WHERE level = ? ORDER BY name ASC LIMIT 100 OFFSET 0", fourth.Query)
+}
+
+// Test least recently used entries are evicted
+func TestQueryCacheEviction(t *testing.T) {
+	c := newQueryCache(2)
+	c.add("a", plan{query: utils.ReturnQuery{Query: "a"}})
+	c.add("b", plan{query: utils.ReturnQuery{Query: "b"}})
+
+	_, ok := c.get("a")
+	assert.True(t, ok)
+
+	c.add("c", plan{query: utils.ReturnQuery{Query: "c"}})
+
+	_, ok = c.get("b")
+	assert.False(t, ok)
+	_, ok = c.get("a")
+	assert.True(t, ok)
+	_, ok = c.get("c")
+	assert.True(t, ok)
+}
+
+// Test requests differing only in their filter values share a cached query
+// bound to their own args
+func TestQueryCacheShape(t *testing.T) {
+	defer EnableQueryCache(0)
+	EnableQueryCache(10)
+
+	h := New("postgres", Options{Pagination: OffsetPagination})
+	for _, level := range []int64{2, 3} {
+		q, err := h.GetQL(httptest.NewRequest(http.MethodGet, "/products?level=eq."+strconv.FormatInt(level, 10)+"&stats=max(price)", nil))
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM products WHERE level = ? ORDER BY id ASC LIMIT 100 OFFSET 0", q.Query)
+		assert.Equal(t, []any{level}, q.Args)
+		assert.Equal(t, []any{level}, q.Page.Count.Args)
+		assert.Equal(t, []any{level}, q.Stats.Args)
+	}
+	assert.Equal(t, 1, planCache.ll.Len())
+
+	// Lists of another length and is conditions have their own shape
+	q, err := h.GetQL(httptest.NewRequest(http.MethodGet, "/products?level=in.(1,2)", nil))
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(1), int64(2)}, q.Args)
+	q, err = h.GetQL(httptest.NewRequest(http.MethodGet, "/products?level=in.(1,2,3)", nil))
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(1), int64(2), int64(3)}, q.Args)
+	q, err = h.GetQL(httptest.NewRequest(http.MethodGet, "/products?level=is.null", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM products WHERE level IS NULL ORDER BY id ASC LIMIT 100 OFFSET 0", q.Query)
+	assert.Equal(t, 4, planCache.ll.Len())
+
+	// Exports hold their args, so only the same args are served from the cache
+	q, err = h.GetQL(httptest.NewRequest(http.MethodGet, "/products/export?level=eq.2&format=csv", nil))
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(2)}, q.Args)
+	q, err = h.GetQL(httptest.NewRequest(http.MethodGet, "/products/export?level=eq.3&format=csv", nil))
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(3)}, q.Args)
+}
+
+// Test handlers with their own schema do not serve each other's queries
+// from the shared cache
+func TestQueryCacheHandlers(t *testing.T) {
+	defer EnableQueryCache(0)
+	EnableQueryCache(10)
+
+	app := New("postgres", Options{})
+	app.SetSchema(map[string]*utils.Table{
+		"products": {Name: "products", Columns: []utils.Column{{Name: "id", Type: "INTEGER"}, {Name: "name", Type: "TEXT"}}},
+	})
+	shop := New("postgres", Options{})
+	shop.SetSchema(map[string]*utils.Table{
+		"products": {Name: "products", Columns: []utils.Column{{Name: "id", Type: "INTEGER"}, {Name: "title", Type: "TEXT"}}},
+	})
+
+	_, err := app.GetQL(httptest.NewRequest(http.MethodGet, "/products?select=name", nil))
+	assert.NoError(t, err)
+	_, err = shop.GetQL(httptest.NewRequest(http.MethodGet, "/products?select=name", nil))
+	assert.Error(t, err)
+}
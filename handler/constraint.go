@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Constraint violation codes of a ConstraintError
+const (
+	Duplicate  = "duplicate"
+	ForeignKey = "foreign_key"
+	NotNull    = "not_null"
+	Check      = "check"
+)
+
+// ConstraintError is a database constraint violation translated from a
+// driver error, the same for every database. Serve it with StatusCode:
+// duplicates and foreign keys conflict with existing rows (409), missing
+// and rejected values are unprocessable (422).
+type ConstraintError struct {
+	// Code is Duplicate, ForeignKey, NotNull or Check
+	Code string
+	// Table, Column and Constraint are set when the driver reports them
+	Table      string
+	Column     string
+	Constraint string
+	// Err is the driver error
+	Err error
+}
+
+func (e *ConstraintError) Error() string {
+	subject := e.Column
+	if subject == "" {
+		subject = e.Constraint
+	}
+	switch {
+	case e.Code == Duplicate && subject != "":
+		return "duplicate " + subject
+	case e.Code == Duplicate:
+		return "duplicate value"
+	case e.Code == ForeignKey && e.Column != "":
+		return "invalid reference in " + e.Column
+	case e.Code == ForeignKey:
+		return "row is referenced or references a missing row"
+	case e.Code == NotNull && subject != "":
+		return subject + " is required"
+	case e.Code == Check && subject != "":
+		return fmt.Sprintf("value violates %s", subject)
+	default:
+		return strings.ReplaceAll(e.Code, "_", " ") + " constraint violated"
+	}
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status for the error
+func (e *ConstraintError) StatusCode() int {
+	if e.Code == Duplicate || e.Code == ForeignKey {
+		return http.StatusConflict
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// sqlStates maps Postgres and standard SQLSTATE codes to violation codes
+var sqlStates = map[string]string{
+	"23505": Duplicate,
+	"23503": ForeignKey,
+	"23502": NotNull,
+	"23514": Check,
+}
+
+// mysqlErrors maps MySQL error numbers to violation codes
+var mysqlErrors = map[string]string{
+	"1062": Duplicate,
+	"1451": ForeignKey,
+	"1452": ForeignKey,
+	"1048": NotNull,
+	"1364": NotNull,
+	"3819": Check,
+}
+
+var (
+	sqlStateRegexp  = regexp.MustCompile(`\(SQLSTATE (\w{5})\)`)
+	pgRelation      = regexp.MustCompile(`(?:relation|table) "([^"]+)"`)
+	pgConstraint    = regexp.MustCompile(`constraint "([^"]+)"`)
+	pgColumn        = regexp.MustCompile(`column "([^"]+)"`)
+	pgDetailKey     = regexp.MustCompile(`^Key \(([^)]+)\)`)
+	mysqlNumber     = regexp.MustCompile(`^Error (\d+)`)
+	mysqlKey        = regexp.MustCompile(`for key '(?:[^'.]+\.)?([^']+)'`)
+	mysqlColumn     = regexp.MustCompile(`^(?:Column|Field) '([^']+)'`)
+	mysqlConstraint = regexp.MustCompile("(?:CONSTRAINT `([^`]+)`|constraint '([^']+)')")
+	mysqlFKColumn   = regexp.MustCompile("FOREIGN KEY \\(`([^`]+)`\\)")
+	mysqlTable      = regexp.MustCompile("\\(`[^`]+`\\.`([^`]+)`")
+	sqliteFailure   = regexp.MustCompile(`(UNIQUE|FOREIGN KEY|NOT NULL|CHECK) constraint failed(?:: ([\w.]+(?:, [\w.]+)*))?`)
+)
+
+var sqliteKinds = map[string]string{
+	"UNIQUE":      Duplicate,
+	"FOREIGN KEY": ForeignKey,
+	"NOT NULL":    NotNull,
+	"CHECK":       Check,
+}
+
+// TranslateError turns a constraint violation reported by the Postgres
+// (pgx or lib/pq), MySQL or SQLite drivers into a *ConstraintError, e.g.
+// 409 "duplicate email" for a unique violation. Other errors are returned
+// unchanged.
+func TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var constraintErr *ConstraintError
+	if errors.As(err, &constraintErr) {
+		return err
+	}
+
+	if e := postgresViolation(err); e != nil {
+		return e
+	}
+	if e := mysqlViolation(err); e != nil {
+		return e
+	}
+	if e := sqliteViolation(err); e != nil {
+		return e
+	}
+	return err
+}
+
+// postgresViolation reads a Postgres error by its SQLSTATE, using the
+// fields pgx and lib/pq expose for the table, column and constraint
+func postgresViolation(err error) *ConstraintError {
+	var state string
+	var stater interface{ SQLState() string }
+	if errors.As(err, &stater) {
+		state = stater.SQLState()
+	} else if m := sqlStateRegexp.FindStringSubmatch(err.Error()); m != nil {
+		state = m[1]
+	}
+	code, ok := sqlStates[state]
+	if !ok {
+		return nil
+	}
+
+	e := &ConstraintError{Code: code, Err: err}
+	if stater != nil {
+		e.Table = errorField(stater, "TableName", "Table")
+		e.Column = errorField(stater, "ColumnName", "Column")
+		e.Constraint = errorField(stater, "ConstraintName", "Constraint")
+		if m := pgDetailKey.FindStringSubmatch(errorField(stater, "Detail")); m != nil && e.Column == "" {
+			e.Column = m[1]
+		}
+	}
+
+	msg := err.Error()
+	if m := pgRelation.FindStringSubmatch(msg); m != nil && e.Table == "" {
+		e.Table = m[1]
+	}
+	if m := pgConstraint.FindStringSubmatch(msg); m != nil && e.Constraint == "" {
+		e.Constraint = m[1]
+	}
+	if m := pgColumn.FindStringSubmatch(msg); m != nil && e.Column == "" {
+		e.Column = m[1]
+	}
+	return e
+}
+
+// mysqlViolation reads a MySQL error by its number
+func mysqlViolation(err error) *ConstraintError {
+	msg := err.Error()
+	m := mysqlNumber.FindStringSubmatch(msg)
+	if m == nil {
+		return nil
+	}
+	code, ok := mysqlErrors[m[1]]
+	if !ok {
+		return nil
+	}
+
+	e := &ConstraintError{Code: code, Err: err}
+	_, detail, _ := strings.Cut(msg, ": ")
+	if m := mysqlKey.FindStringSubmatch(detail); m != nil {
+		e.Constraint = m[1]
+		e.Column = m[1]
+	}
+	if m := mysqlColumn.FindStringSubmatch(detail); m != nil {
+		e.Column = m[1]
+	}
+	if m := mysqlConstraint.FindStringSubmatch(detail); m != nil {
+		e.Constraint = m[1] + m[2]
+	}
+	if m := mysqlFKColumn.FindStringSubmatch(detail); m != nil {
+		e.Column = m[1]
+	}
+	if m := mysqlTable.FindStringSubmatch(detail); m != nil {
+		e.Table = m[1]
+	}
+	return e
+}
+
+// sqliteViolation reads a SQLite "... constraint failed" error
+func sqliteViolation(err error) *ConstraintError {
+	m := sqliteFailure.FindStringSubmatch(err.Error())
+	if m == nil {
+		return nil
+	}
+
+	e := &ConstraintError{Code: sqliteKinds[m[1]], Err: err}
+	if m[2] == "" {
+		return e
+	}
+	if e.Code == Check {
+		e.Constraint = m[2]
+		return e
+	}
+	// Columns are reported as table.column, several for composite keys
+	columns := []string{}
+	for _, qualified := range strings.Split(m[2], ", ") {
+		table, column, ok := strings.Cut(qualified, ".")
+		if !ok {
+			column = table
+		} else {
+			e.Table = table
+		}
+		columns = append(columns, column)
+	}
+	e.Column = strings.Join(columns, ", ")
+	return e
+}
+
+// errorField returns the first non-empty string field among names of a
+// driver error struct, like pgconn.PgError's ConstraintName
+func errorField(err any, names ...string) string {
+	v := reflect.ValueOf(err)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	for _, name := range names {
+		if f := v.FieldByName(name); f.IsValid() && f.Kind() == reflect.String && f.String() != "" {
+			return f.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pgError mimics pgconn.PgError
+type pgError struct {
+	Code           string
+	Message        string
+	Detail         string
+	TableName      string
+	ColumnName     string
+	ConstraintName string
+}
+
+func (e *pgError) Error() string {
+	return fmt.Sprintf("ERROR: %s (SQLSTATE %s)", e.Message, e.Code)
+}
+
+func (e *pgError) SQLState() string {
+	return e.Code
+}
+
+// Test driver constraint errors are translated to ConstraintErrors
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		want   ConstraintError
+		msg    string
+		status int
+	}{
+		{
+			"pgx unique",
+			fmt.Errorf("insert: %w", &pgError{Code: "23505", Message: `duplicate key value violates unique constraint "users_email_key"`, Detail: "Key (email)=(a@b.co) already exists.", TableName: "users", ConstraintName: "users_email_key"}),
+			ConstraintError{Code: Duplicate, Table: "users", Column: "email", Constraint: "users_email_key"},
+			"duplicate email", http.StatusConflict,
+		},
+		{
+			"pgx not null",
+			&pgError{Code: "23502", Message: `null value in column "name" of relation "users" violates not-null constraint`, TableName: "users", ColumnName: "name"},
+			ConstraintError{Code: NotNull, Table: "users", Column: "name"},
+			"name is required", http.StatusUnprocessableEntity,
+		},
+		{
+			"postgres message",
+			errors.New(`ERROR: insert or update on table "orders" violates foreign key constraint "orders_user_id_fkey" (SQLSTATE 23503)`),
+			ConstraintError{Code: ForeignKey, Table: "orders", Constraint: "orders_user_id_fkey"},
+			"row is referenced or references a missing row", http.StatusConflict,
+		},
+		{
+			"mysql duplicate",
+			errors.New("Error 1062 (23000): Duplicate entry 'a@b.co' for key 'users.email'"),
+			ConstraintError{Code: Duplicate, Column: "email", Constraint: "email"},
+			"duplicate email", http.StatusConflict,
+		},
+		{
+			"mysql foreign key",
+			errors.New("Error 1452 (23000): Cannot add or update a child row: a foreign key constraint fails (`shop`.`orders`, CONSTRAINT `orders_user_fk` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))"),
+			ConstraintError{Code: ForeignKey, Table: "orders", Column: "user_id", Constraint: "orders_user_fk"},
+			"invalid reference in user_id", http.StatusConflict,
+		},
+		{
+			"mysql not null",
+			errors.New("Error 1048 (23000): Column 'name' cannot be null"),
+			ConstraintError{Code: NotNull, Column: "name"},
+			"name is required", http.StatusUnprocessableEntity,
+		},
+		{
+			"mysql check",
+			errors.New("Error 3819 (HY000): Check constraint 'users_chk_1' is violated."),
+			ConstraintError{Code: Check, Constraint: "users_chk_1"},
+			"value violates users_chk_1", http.StatusUnprocessableEntity,
+		},
+		{
+			"sqlite unique",
+			errors.New("constraint failed: UNIQUE constraint failed: users.email (2067)"),
+			ConstraintError{Code: Duplicate, Table: "users", Column: "email"},
+			"duplicate email", http.StatusConflict,
+		},
+		{
+			"sqlite composite unique",
+			errors.New("UNIQUE constraint failed: memberships.team_id, memberships.user_id"),
+			ConstraintError{Code: Duplicate, Table: "memberships", Column: "team_id, user_id"},
+			"duplicate team_id, user_id", http.StatusConflict,
+		},
+		{
+			"sqlite foreign key",
+			errors.New("FOREIGN KEY constraint failed"),
+			ConstraintError{Code: ForeignKey},
+			"row is referenced or references a missing row", http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		err := TranslateError(tt.err)
+		var constraintErr *ConstraintError
+		if !assert.True(t, errors.As(err, &constraintErr), tt.name) {
+			continue
+		}
+		tt.want.Err = tt.err
+		assert.Equal(t, &tt.want, constraintErr, tt.name)
+		assert.EqualError(t, err, tt.msg, tt.name)
+		assert.Equal(t, tt.status, constraintErr.StatusCode(), tt.name)
+		assert.True(t, errors.Is(err, tt.err), tt.name)
+	}
+
+	other := errors.New("connection refused")
+	assert.Equal(t, other, TranslateError(other))
+	assert.Nil(t, TranslateError(nil))
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// CopyThreshold switches Postgres bulk inserts of at least this many records
+// to COPY FROM STDIN, which loads rows far faster than INSERT statements.
+// Zero disables COPY.
+var CopyThreshold = 0
+
+// useCopy reports whether an insert of n records should be loaded with COPY.
+// COPY cannot return the inserted rows, so Prefer: return=representation
+// keeps the INSERT.
+func (h *Handler) useCopy(r *http.Request, n int) bool {
+	return h.dbType == "postgres" && CopyThreshold > 0 && n >= CopyThreshold && !h.wantsRepresentation(r)
+}
+
+// Build a COPY FROM STDIN load of records. COPY has no per-row DEFAULT, so
+// every record must have every column, and with table metadata the columns
+// must exist.
+func (h *Handler) copyLoad(tableName string, records []map[string]interface{}, columns []string) (*utils.ReturnQuery, error) {
+	if table := h.tableMeta(tableName); table != nil {
+		for _, column := range columns {
+			if _, ok := table.Column(column); !ok {
+				return nil, fmt.Errorf("unknown column %s", column)
+			}
+		}
+	}
+	if err := checkMissingColumns(records, columns); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]any, len(records))
+	for i, record := range records {
+		row := make([]any, len(columns))
+		for j, column := range columns {
+			row[j] = record[column]
+		}
+		rows[i] = row
+	}
+
+	sql := fmt.Sprintf("COPY %s (%s) FROM STDIN", tableName, strings.Join(columns, ", "))
+	return &utils.ReturnQuery{
+		Query: sql,
+		Table: tableName,
+		Copy:  &utils.CopyData{Table: tableName, Columns: columns, Rows: rows},
+	}, nil
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test large Postgres inserts are loaded with COPY
+func TestCopyInsert(t *testing.T) {
+	defer func(threshold int) { CopyThreshold = threshold }(CopyThreshold)
+	CopyThreshold = 2
+
+	body := `[{"name": "A", "price": 1}, {"name": "B", "price": null}]`
+	query, err := GetQL(httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body)), "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "COPY products (name, price) FROM STDIN", query.Query)
+	assert.Equal(t, &utils.CopyData{
+		Table:   "products",
+		Columns: []string{"name", "price"},
+		Rows:    [][]any{{"A", float64(1)}, {"B", nil}},
+	}, query.Copy)
+
+	// Below the threshold
+	query, err = GetQL(httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name": "A"}`)), "postgres")
+	assert.NoError(t, err)
+	assert.Nil(t, query.Copy)
+
+	// COPY cannot return rows
+	req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+	req.Header.Set("Prefer", "return=representation")
+	query, err = New("postgres", Options{PostgREST: true}).GetQL(req)
+	assert.NoError(t, err)
+	assert.Nil(t, query.Copy)
+	assert.Equal(t, "INSERT INTO products (name, price) VALUES (?, ?), (?, ?) RETURNING *", query.Query)
+
+	_, err = GetQL(httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`[{"name": "A"}, {"price": 2}]`)), "postgres")
+	assert.EqualError(t, err, "records have different columns: record 0 is missing price; record 1 is missing name")
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+var (
+	// MaxQueryCost rejects reads whose estimated cost, as reported by the
+	// plan passed to CheckQueryCost, exceeds it. Zero disables the check.
+	MaxQueryCost = 0.0
+
+	// RequireIndexedFilter rejects reads of tables with index metadata that
+	// filter on no indexed column, as those scan the whole table
+	RequireIndexedFilter = false
+)
+
+// CostError reports a query rejected as too expensive. Serve it as
+// 400 Bad Request.
+type CostError struct {
+	Table string
+	// Cost is the estimated cost, zero when rejected by heuristics
+	Cost float64
+	// Reason explains the rejection and how to narrow the query
+	Reason string
+}
+
+func (e *CostError) Error() string {
+	return e.Reason
+}
+
+// StatusCode returns the HTTP status for the error
+func (e *CostError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// ExplainQuery returns the statement estimating the cost of a read without
+// running it. Pass its result to CheckQueryCost before running q.
+func (h *Handler) ExplainQuery(q *utils.ReturnQuery) (*utils.ReturnQuery, error) {
+	var sql string
+	switch h.dbType {
+	case "postgres":
+		sql = "EXPLAIN (FORMAT JSON) " + q.Query
+	case "mysql":
+		sql = "EXPLAIN FORMAT=JSON " + q.Query
+	default:
+		return nil, fmt.Errorf("cost estimation is not supported on %s", h.dbType)
+	}
+	return &utils.ReturnQuery{Query: sql, Args: q.Args, Table: q.Table, ReadOnly: true}, nil
+}
+
+// CheckQueryCost reads the estimated cost from the JSON plan returned by
+// ExplainQuery and rejects q when it exceeds MaxQueryCost
+func CheckQueryCost(q *utils.ReturnQuery, plan []byte) error {
+	if MaxQueryCost <= 0 {
+		return nil
+	}
+
+	cost, err := planCost(plan)
+	if err != nil {
+		return err
+	}
+	if cost > MaxQueryCost {
+		return &CostError{
+			Table:  q.Table,
+			Cost:   cost,
+			Reason: fmt.Sprintf("query on %s is too expensive (estimated cost %.0f, maximum %.0f): narrow the filters", q.Table, cost, MaxQueryCost),
+		}
+	}
+	return nil
+}
+
+// planCost extracts the total cost of a Postgres or MySQL JSON plan
+func planCost(plan []byte) (float64, error) {
+	// Postgres: [{"Plan": {"Total Cost": 12.5, ...}}]
+	var pg []struct {
+		Plan struct {
+			TotalCost *float64 `json:"Total Cost"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &pg); err == nil && len(pg) > 0 && pg[0].Plan.TotalCost != nil {
+		return *pg[0].Plan.TotalCost, nil
+	}
+
+	// MySQL: {"query_block": {"cost_info": {"query_cost": "12.50"}}}
+	var my struct {
+		QueryBlock struct {
+			CostInfo struct {
+				QueryCost string `json:"query_cost"`
+			} `json:"cost_info"`
+		} `json:"query_block"`
+	}
+	if err := json.Unmarshal(plan, &my); err == nil && my.QueryBlock.CostInfo.QueryCost != "" {
+		return strconv.ParseFloat(my.QueryBlock.CostInfo.QueryCost, 64)
+	}
+
+	return 0, fmt.Errorf("unrecognized query plan")
+}
+
+// checkIndexedFilter applies the RequireIndexedFilter heuristic to a read
+// of tableName filtering on columns
+func (h *Handler) checkIndexedFilter(tableName string, columns map[string]bool) error {
+	table := h.tableMeta(tableName)
+	if !RequireIndexedFilter || table == nil || len(table.Indexes) == 0 {
+		return nil
+	}
+
+	for column := range columns {
+		if table.Indexed(column) {
+			return nil
+		}
+	}
+
+	indexed := map[string]bool{}
+	for _, index := range table.Indexes {
+		if len(index.Columns) > 0 {
+			indexed[index.Columns[0]] = true
+		}
+	}
+	names := make([]string, 0, len(indexed))
+	for name := range indexed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return &CostError{
+		Table:  tableName,
+		Reason: fmt.Sprintf("query on %s would scan the whole table: filter on one of %s", tableName, strings.Join(names, ", ")),
+	}
+}
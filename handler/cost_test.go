@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test plans over the cost limit are rejected
+func TestQueryCost(t *testing.T) {
+	defer func(max float64) { MaxQueryCost = max }(MaxQueryCost)
+	MaxQueryCost = 1000
+
+	q, err := GetQL(httptest.NewRequest(http.MethodGet, "/orders?status=eq.paid", nil), "postgres")
+	assert.NoError(t, err)
+
+	explain, err := New("postgres", Options{}).ExplainQuery(q)
+	assert.NoError(t, err)
+	assert.Equal(t, "EXPLAIN (FORMAT JSON) SELECT * FROM orders WHERE status = ? ORDER BY id ASC LIMIT 100 OFFSET 0", explain.Query)
+	assert.Equal(t, q.Args, explain.Args)
+
+	assert.NoError(t, CheckQueryCost(q, []byte(`[{"Plan": {"Node Type": "Index Scan", "Total Cost": 8.3}}]`)))
+
+	err = CheckQueryCost(q, []byte(`[{"Plan": {"Node Type": "Seq Scan", "Total Cost": 48213.75}}]`))
+	assert.EqualError(t, err, "query on orders is too expensive (estimated cost 48214, maximum 1000): narrow the filters")
+	var costErr *CostError
+	assert.True(t, errors.As(err, &costErr))
+	assert.Equal(t, http.StatusBadRequest, costErr.StatusCode())
+
+	assert.Error(t, CheckQueryCost(q, []byte(`{"query_block": {"cost_info": {"query_cost": "2500.10"}}}`)))
+	assert.EqualError(t, CheckQueryCost(q, []byte(`{}`)), "unrecognized query plan")
+
+	_, err = New("sqlite", Options{}).ExplainQuery(q)
+	assert.EqualError(t, err, "cost estimation is not supported on sqlite")
+}
+
+// Test the indexed filter heuristic rejects reads that would scan
+func TestRequireIndexedFilter(t *testing.T) {
+	defer func(require bool) { RequireIndexedFilter = require }(RequireIndexedFilter)
+	RequireIndexedFilter = true
+	Schema["events"] = &utils.Table{
+		Name:    "events",
+		Columns: []utils.Column{{Name: "id"}, {Name: "kind"}, {Name: "user_id"}, {Name: "created_at"}},
+		Indexes: []utils.Index{
+			{Name: "events_pkey", Columns: []string{"id"}, Unique: true},
+			{Name: "events_user_created", Columns: []string{"user_id", "created_at"}},
+		},
+	}
+	defer delete(Schema, "events")
+
+	_, err := GetQL(httptest.NewRequest(http.MethodGet, "/events?user_id=eq.7&kind=eq.click", nil), "postgres")
+	assert.NoError(t, err)
+
+	_, err = GetQL(httptest.NewRequest(http.MethodGet, "/events?kind=eq.click&created_at=gte.2024-01-01", nil), "postgres")
+	assert.EqualError(t, err, "query on events would scan the whole table: filter on one of id, user_id")
+
+	// Tables without index metadata are not checked
+	_, err = GetQL(httptest.NewRequest(http.MethodGet, "/products?kind=eq.click", nil), "postgres")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,393 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// TableDefinition declares a table to create with CreateTableQL, e.g.
+//
+//	{"name": "products",
+//	 "columns": [
+//	   {"name": "id", "type": "BIGINT", "identity": true},
+//	   {"name": "name", "type": "VARCHAR(100)", "unique": true},
+//	   {"name": "status", "type": "TEXT", "enum": ["draft", "published"], "default": "draft"},
+//	   {"name": "category_id", "type": "INTEGER", "nullable": true, "references": "categories.id"}],
+//	 "primary_key": ["id"],
+//	 "indexes": [{"columns": ["category_id", "status"]}]}
+type TableDefinition struct {
+	Name       string             `json:"name"`
+	Columns    []ColumnDefinition `json:"columns"`
+	PrimaryKey []string           `json:"primary_key,omitempty"`
+	// Indexes are created after the table. Unnamed indexes are named
+	// <table>_<columns>_idx.
+	Indexes []utils.Index `json:"indexes,omitempty"`
+}
+
+// ColumnDefinition declares a column of a TableDefinition
+type ColumnDefinition struct {
+	Name string `json:"name"`
+	// Type is one of the types of utils.Types, with an optional length or
+	// precision like VARCHAR(100) or NUMERIC(10,2). It is rendered in the
+	// dialect's closest type, e.g. JSON becomes JSONB on Postgres.
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable,omitempty"`
+	// Identity numbers the column automatically: GENERATED BY DEFAULT AS
+	// IDENTITY on Postgres, AUTO_INCREMENT on MySQL and AUTOINCREMENT on
+	// SQLite, where it must be the whole primary key
+	Identity bool `json:"identity,omitempty"`
+	Unique   bool `json:"unique,omitempty"`
+	// Default is a string, number or boolean literal
+	Default any `json:"default,omitempty"`
+	// Enum restricts the values with a CHECK constraint
+	Enum []string `json:"enum,omitempty"`
+	// References is a foreign key, as table.column
+	References string `json:"references,omitempty"`
+}
+
+// columnTypeRegexp matches a column type and its optional length or precision
+var columnTypeRegexp = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*?)\s*(\(\s*\d+\s*(?:,\s*\d+\s*)?\))?$`)
+
+// ddlTypes renders the types of utils.Types a dialect names differently.
+// SQLite accepts every type name.
+var ddlTypes = map[string]map[string]string{
+	"postgres": {
+		"TINYINT":  "SMALLINT",
+		"DOUBLE":   "DOUBLE PRECISION",
+		"JSON":     "JSONB",
+		"NVARCHAR": "VARCHAR",
+		"ENUM":     "TEXT",
+		"BLOB":     "BYTEA",
+		"BINARY":   "BYTEA",
+		"DATETIME": "TIMESTAMP",
+	},
+	"mysql": {
+		"UUID": "CHAR(36)",
+		"ENUM": "VARCHAR(255)",
+		"XML":  "TEXT",
+	},
+}
+
+// surrealTypes renders JSON types as SurrealDB field types
+var surrealTypes = map[string]string{
+	"integer": "int",
+	"number":  "number",
+	"decimal": "decimal",
+	"boolean": "bool",
+	"string":  "string",
+}
+
+// CreateTableQL builds the statements creating a table from its definition,
+// for the given database type: the table, then its indexes. On SurrealDB the
+// table is SCHEMAFULL with a DEFINE FIELD per column, and record ids serve as
+// the primary key.
+func CreateTableQL(def *TableDefinition, dbType string) (*utils.ReturnQuery, error) {
+	if err := def.validate(); err != nil {
+		return nil, err
+	}
+	if dbType == "surrealdb" {
+		return surrealTableQL(def)
+	}
+
+	var lines []string
+	for _, column := range def.Columns {
+		line, err := columnSQL(def, column, dbType)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	if len(def.PrimaryKey) > 0 && !(dbType == "sqlite" && def.identity() != nil) {
+		lines = append(lines, "PRIMARY KEY ("+strings.Join(def.PrimaryKey, ", ")+")")
+	}
+	for _, column := range def.Columns {
+		if column.References != "" {
+			table, ref, _ := strings.Cut(column.References, ".")
+			lines = append(lines, fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)", column.Name, table, ref))
+		}
+	}
+
+	statements := []utils.ReturnQuery{{
+		Query: fmt.Sprintf("CREATE TABLE %s (%s)", def.Name, strings.Join(lines, ", ")),
+		Table: def.Name,
+	}}
+	for _, index := range def.Indexes {
+		statements = append(statements, createIndexQL(def.Name, index, dbType))
+	}
+	return batch(statements), nil
+}
+
+// columnSQL renders a column definition of a CREATE TABLE
+func columnSQL(def *TableDefinition, column ColumnDefinition, dbType string) (string, error) {
+	base, size := splitColumnType(column.Type)
+	sqlType := base + size
+	if rendered, ok := ddlTypes[dbType][base]; ok {
+		sqlType = rendered
+		if !strings.Contains(rendered, "(") {
+			sqlType += size
+		}
+	}
+
+	parts := []string{column.Name, sqlType}
+	if column.Identity {
+		switch dbType {
+		case "postgres":
+			parts = append(parts, "GENERATED BY DEFAULT AS IDENTITY")
+		case "mysql":
+			parts = append(parts, "AUTO_INCREMENT")
+		case "sqlite":
+			// Only an INTEGER PRIMARY KEY is an alias of the rowid
+			if len(def.PrimaryKey) != 1 || def.PrimaryKey[0] != column.Name {
+				return "", fmt.Errorf("identity column %s must be the primary key on sqlite", column.Name)
+			}
+			parts = []string{column.Name, "INTEGER PRIMARY KEY AUTOINCREMENT"}
+		}
+	}
+	if !column.Nullable {
+		parts = append(parts, "NOT NULL")
+	}
+	if column.Unique {
+		parts = append(parts, "UNIQUE")
+	}
+	if column.Default != nil {
+		literal, err := sqlLiteral(column.Default)
+		if err != nil {
+			return "", fmt.Errorf("invalid default of %s: %v", column.Name, err)
+		}
+		parts = append(parts, "DEFAULT "+literal)
+	}
+	if len(column.Enum) > 0 {
+		values := make([]string, len(column.Enum))
+		for i, value := range column.Enum {
+			values[i], _ = sqlLiteral(value)
+		}
+		parts = append(parts, fmt.Sprintf("CHECK (%s IN (%s))", column.Name, strings.Join(values, ", ")))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// surrealTableQL renders a definition as SurrealDB DEFINE statements
+func surrealTableQL(def *TableDefinition) (*utils.ReturnQuery, error) {
+	statements := []utils.ReturnQuery{{Query: "DEFINE TABLE " + def.Name + " SCHEMAFULL", Table: def.Name}}
+	for _, column := range def.Columns {
+		fields, err := surrealFieldQL(def.Name, column)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, fields...)
+	}
+	for _, index := range def.Indexes {
+		statements = append(statements, createIndexQL(def.Name, index, "surrealdb"))
+	}
+	return batch(statements), nil
+}
+
+// createIndexQL renders an index of a table
+func createIndexQL(tableName string, index utils.Index, dbType string) utils.ReturnQuery {
+	name := index.Name
+	if name == "" {
+		name = tableName + "_" + strings.Join(index.Columns, "_") + "_idx"
+	}
+	columns := strings.Join(index.Columns, ", ")
+
+	var sql string
+	switch {
+	case dbType == "surrealdb" && index.Unique:
+		sql = fmt.Sprintf("DEFINE INDEX %s ON %s FIELDS %s UNIQUE", name, tableName, columns)
+	case dbType == "surrealdb":
+		sql = fmt.Sprintf("DEFINE INDEX %s ON %s FIELDS %s", name, tableName, columns)
+	case index.Unique:
+		sql = fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", name, tableName, columns)
+	default:
+		sql = fmt.Sprintf("CREATE INDEX %s ON %s (%s)", name, tableName, columns)
+	}
+	return utils.ReturnQuery{Query: sql, Table: tableName}
+}
+
+// surrealFieldQL renders a column as a DEFINE FIELD, and a DEFINE INDEX
+// when it is unique
+func surrealFieldQL(tableName string, column ColumnDefinition) ([]utils.ReturnQuery, error) {
+	if column.Identity {
+		return nil, fmt.Errorf("identity column %s is not supported on surrealdb: records have ids", column.Name)
+	}
+
+	fieldType := surrealTypes[utils.JSONType(column.Type)]
+	switch base, _ := splitColumnType(column.Type); {
+	case base == "DATE" || base == "DATETIME" || base == "TIMESTAMP":
+		fieldType = "datetime"
+	case base == "JSON":
+		fieldType = "object"
+	case column.References != "":
+		table, _, _ := strings.Cut(column.References, ".")
+		fieldType = "record<" + table + ">"
+	}
+	if column.Nullable {
+		fieldType = "option<" + fieldType + ">"
+	}
+
+	field := fmt.Sprintf("DEFINE FIELD %s ON %s TYPE %s", column.Name, tableName, fieldType)
+	if column.Default != nil {
+		literal, err := sqlLiteral(column.Default)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default of %s: %v", column.Name, err)
+		}
+		field += " DEFAULT " + literal
+	}
+	if len(column.Enum) > 0 {
+		values := make([]string, len(column.Enum))
+		for i, value := range column.Enum {
+			values[i], _ = sqlLiteral(value)
+		}
+		field += " ASSERT $value INSIDE [" + strings.Join(values, ", ") + "]"
+	}
+	statements := []utils.ReturnQuery{{Query: field, Table: tableName}}
+
+	if column.Unique {
+		statements = append(statements, utils.ReturnQuery{
+			Query: fmt.Sprintf("DEFINE INDEX %s_%s_key ON %s FIELDS %s UNIQUE", tableName, column.Name, tableName, column.Name),
+			Table: tableName,
+		})
+	}
+	return statements, nil
+}
+
+// batch returns statements as one query running them in order
+func batch(statements []utils.ReturnQuery) *utils.ReturnQuery {
+	q := statements[0]
+	if len(statements) > 1 {
+		q.Batch = statements
+	}
+	return &q
+}
+
+func (def *TableDefinition) validate() error {
+	if err := utils.ValidateTableName(def.Name); err != nil {
+		return err
+	}
+	if len(def.Columns) == 0 {
+		return fmt.Errorf("table %s has no columns", def.Name)
+	}
+
+	columns := map[string]bool{}
+	identities := 0
+	for _, column := range def.Columns {
+		if err := column.validate(); err != nil {
+			return err
+		}
+		if columns[column.Name] {
+			return fmt.Errorf("duplicate column %s", column.Name)
+		}
+		columns[column.Name] = true
+		if column.Identity {
+			identities++
+		}
+	}
+	if identities > 1 {
+		return errors.New("a table can have only one identity column")
+	}
+
+	for _, name := range def.PrimaryKey {
+		if !columns[name] {
+			return fmt.Errorf("unknown primary key column %s", name)
+		}
+	}
+	for _, index := range def.Indexes {
+		if err := validateIndex(index, func(name string) bool { return columns[name] }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (column *ColumnDefinition) validate() error {
+	if err := utils.ValidateColumnName(column.Name); err != nil {
+		return err
+	}
+	base, _ := splitColumnType(column.Type)
+	if _, _, ok := utils.LookupType(column.Type); base == "" || !ok {
+		return fmt.Errorf("invalid type %q of column %s", column.Type, column.Name)
+	}
+	if column.Identity && utils.JSONType(base) != "integer" {
+		return fmt.Errorf("identity column %s must have an integer type", column.Name)
+	}
+	if column.References != "" {
+		table, ref, _ := strings.Cut(column.References, ".")
+		if utils.ValidateTableName(table) != nil || utils.ValidateColumnName(ref) != nil {
+			return fmt.Errorf("invalid reference %q of column %s: expected table.column", column.References, column.Name)
+		}
+	}
+	for _, value := range column.Enum {
+		if _, err := sqlLiteral(value); err != nil {
+			return fmt.Errorf("invalid enum value of %s: %v", column.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateIndex checks the name of an index and that its columns exist
+func validateIndex(index utils.Index, exists func(column string) bool) error {
+	if index.Name != "" {
+		if err := utils.ValidateTableName(index.Name); err != nil {
+			return fmt.Errorf("invalid index name %q", index.Name)
+		}
+	}
+	if len(index.Columns) == 0 {
+		return errors.New("index has no columns")
+	}
+	for _, name := range index.Columns {
+		if !exists(name) {
+			return fmt.Errorf("unknown index column %s", name)
+		}
+	}
+	return nil
+}
+
+// identity returns the identity column, if any
+func (def *TableDefinition) identity() *ColumnDefinition {
+	for i := range def.Columns {
+		if def.Columns[i].Identity {
+			return &def.Columns[i]
+		}
+	}
+	return nil
+}
+
+// splitColumnType returns the upper-cased base type of a column type, and
+// its length or precision like (10,2)
+func splitColumnType(columnType string) (base, size string) {
+	m := columnTypeRegexp.FindStringSubmatch(strings.TrimSpace(columnType))
+	if m == nil {
+		return "", ""
+	}
+	return strings.ToUpper(strings.Join(strings.Fields(m[1]), " ")), strings.ReplaceAll(m[2], " ", "")
+}
+
+// sqlLiteral renders a string, number or boolean as a SQL literal. DDL
+// cannot bind parameters, so strings with backslashes, which MySQL treats
+// as escapes, are rejected.
+func sqlLiteral(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		if strings.ContainsAny(v, "\\\x00") {
+			return "", errors.New("strings may not contain backslashes")
+		}
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	}
+	return "", fmt.Errorf("unsupported literal %v", value)
+}
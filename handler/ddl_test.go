@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test table definitions render in each dialect
+func TestCreateTableQL(t *testing.T) {
+	def := &TableDefinition{
+		Name: "products",
+		Columns: []ColumnDefinition{
+			{Name: "id", Type: "bigint", Identity: true},
+			{Name: "name", Type: "VARCHAR(100)", Unique: true},
+			{Name: "status", Type: "TEXT", Enum: []string{"draft", "published"}, Default: "draft"},
+			{Name: "price", Type: "NUMERIC(10, 2)", Nullable: true},
+			{Name: "attributes", Type: "JSON", Nullable: true},
+			{Name: "category_id", Type: "INTEGER", Nullable: true, References: "categories.id"},
+		},
+		PrimaryKey: []string{"id"},
+		Indexes:    []utils.Index{{Columns: []string{"category_id", "status"}}},
+	}
+
+	tests := []struct {
+		dbType     string
+		statements []string
+	}{
+		{"postgres", []string{
+			"CREATE TABLE products (id BIGINT GENERATED BY DEFAULT AS IDENTITY NOT NULL, name VARCHAR(100) NOT NULL UNIQUE, " +
+				"status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'published')), price NUMERIC(10,2), " +
+				"attributes JSONB, category_id INTEGER, PRIMARY KEY (id), FOREIGN KEY (category_id) REFERENCES categories (id))",
+			"CREATE INDEX products_category_id_status_idx ON products (category_id, status)",
+		}},
+		{"mysql", []string{
+			"CREATE TABLE products (id BIGINT AUTO_INCREMENT NOT NULL, name VARCHAR(100) NOT NULL UNIQUE, " +
+				"status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'published')), price NUMERIC(10,2), " +
+				"attributes JSON, category_id INTEGER, PRIMARY KEY (id), FOREIGN KEY (category_id) REFERENCES categories (id))",
+			"CREATE INDEX products_category_id_status_idx ON products (category_id, status)",
+		}},
+		{"sqlite", []string{
+			"CREATE TABLE products (id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL, name VARCHAR(100) NOT NULL UNIQUE, " +
+				"status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'published')), price NUMERIC(10,2), " +
+				"attributes JSON, category_id INTEGER, FOREIGN KEY (category_id) REFERENCES categories (id))",
+			"CREATE INDEX products_category_id_status_idx ON products (category_id, status)",
+		}},
+	}
+
+	for _, tt := range tests {
+		q, err := CreateTableQL(def, tt.dbType)
+		if !assert.NoError(t, err, tt.dbType) {
+			continue
+		}
+		var statements []string
+		for _, statement := range q.Statements() {
+			statements = append(statements, statement.Query)
+			assert.Empty(t, statement.Args)
+		}
+		assert.Equal(t, tt.statements, statements, tt.dbType)
+	}
+
+	_, err := CreateTableQL(def, "surrealdb")
+	assert.EqualError(t, err, "identity column id is not supported on surrealdb: records have ids")
+}
+
+// Test SurrealDB tables are defined field by field
+func TestCreateTableQLSurrealDB(t *testing.T) {
+	def := &TableDefinition{
+		Name: "products",
+		Columns: []ColumnDefinition{
+			{Name: "name", Type: "TEXT", Unique: true},
+			{Name: "status", Type: "TEXT", Enum: []string{"draft", "published"}, Default: "draft"},
+			{Name: "price", Type: "NUMERIC", Nullable: true},
+			{Name: "created_at", Type: "TIMESTAMP"},
+			{Name: "category", Type: "TEXT", References: "categories.id"},
+		},
+		Indexes: []utils.Index{{Name: "products_status", Columns: []string{"status"}}},
+	}
+
+	q, err := CreateTableQL(def, "surrealdb")
+	assert.NoError(t, err)
+	var statements []string
+	for _, statement := range q.Statements() {
+		statements = append(statements, statement.Query)
+	}
+	assert.Equal(t, []string{
+		"DEFINE TABLE products SCHEMAFULL",
+		"DEFINE FIELD name ON products TYPE string",
+		"DEFINE INDEX products_name_key ON products FIELDS name UNIQUE",
+		"DEFINE FIELD status ON products TYPE string DEFAULT 'draft' ASSERT $value INSIDE ['draft', 'published']",
+		"DEFINE FIELD price ON products TYPE option<decimal>",
+		"DEFINE FIELD created_at ON products TYPE datetime",
+		"DEFINE FIELD category ON products TYPE record<categories>",
+		"DEFINE INDEX products_status ON products FIELDS status",
+	}, statements)
+}
+
+// Test invalid definitions are rejected before any SQL is built
+func TestCreateTableQLErrors(t *testing.T) {
+	column := ColumnDefinition{Name: "id", Type: "INTEGER"}
+	tests := []struct {
+		def TableDefinition
+		err string
+	}{
+		{TableDefinition{Name: "products; DROP", Columns: []ColumnDefinition{column}}, "invalid table name"},
+		{TableDefinition{Name: "products"}, "table products has no columns"},
+		{TableDefinition{Name: "products", Columns: []ColumnDefinition{column, column}}, "duplicate column id"},
+		{TableDefinition{Name: "products", Columns: []ColumnDefinition{{Name: "id", Type: "INTEGER) ; DROP TABLE users; --"}}}, "invalid type"},
+		{TableDefinition{Name: "products", Columns: []ColumnDefinition{{Name: "id", Type: "GEOMETRY"}}}, "invalid type"},
+		{TableDefinition{Name: "products", Columns: []ColumnDefinition{{Name: "id", Type: "INT8"}}}, "invalid type"},
+		{TableDefinition{Name: "products", Columns: []ColumnDefinition{{Name: "id", Type: "TEXT", Identity: true}}}, "identity column id must have an integer type"},
+		{TableDefinition{Name: "products", Columns: []ColumnDefinition{{Name: "id", Type: "TEXT", Default: `\'; DROP`}}}, "strings may not contain backslashes"},
+		{TableDefinition{Name: "products", Columns: []ColumnDefinition{{Name: "id", Type: "TEXT", Default: []any{1}}}}, "unsupported literal"},
+		{TableDefinition{Name: "products", Columns: []ColumnDefinition{{Name: "id", Type: "TEXT", References: "users"}}}, "invalid reference"},
+		{TableDefinition{Name: "products", Columns: []ColumnDefinition{column}, PrimaryKey: []string{"uuid"}}, "unknown primary key column uuid"},
+		{TableDefinition{Name: "products", Columns: []ColumnDefinition{column}, Indexes: []utils.Index{{Columns: []string{"name"}}}}, "unknown index column name"},
+		{TableDefinition{Name: "products", Columns: []ColumnDefinition{{Name: "id", Type: "INTEGER", Identity: true}}}, "identity column id must be the primary key on sqlite"},
+	}
+
+	for _, tt := range tests {
+		_, err := CreateTableQL(&tt.def, "sqlite")
+		assert.ErrorContains(t, err, tt.err, tt.def.Name)
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// ExportFormats are the file formats GET /{table}/export can produce
+var ExportFormats = []string{"csv", "jsonl"}
+
+// ExportBatchSize is the number of rows read per page of an export
+var ExportBatchSize = 1000
+
+// Export a whole filtered table as a file, e.g.
+// GET /products/export?format=csv&level=gt.2. The query reads the first page;
+// Export.Next continues after the last id read, so deep pages need no OFFSET.
+func (h *Handler) exportRecords(r *http.Request, tableName string) (*utils.ReturnQuery, error) {
+	params, err := h.Params(r, tableName)
+	if err != nil {
+		return nil, err
+	}
+	queryParams := paramValues(params)
+	h.applyTableDefaults(tableName, queryParams)
+
+	format := queryParams.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if !slices.Contains(ExportFormats, format) {
+		return nil, fmt.Errorf("unsupported export format %s", format)
+	}
+
+	// The keyset needs the id of every row
+	columns, err := query.ParseSelect(queryParams.Get("select"), h.tableMeta(tableName))
+	if err != nil {
+		return nil, err
+	}
+	if columns != "*" && !slices.Contains(strings.Split(columns, ", "), "id") {
+		return nil, fmt.Errorf("select must include id to export")
+	}
+
+	filters := slices.DeleteFunc(slices.Clone(params), func(p query.Param) bool { return p.Key == "format" })
+	if err := h.checkReadFilters(tableName, query.FilterColumns(filters)); err != nil {
+		return nil, err
+	}
+	filterSQL, args, err := query.ParseFilters(filters, h.filterOptions(r, tableName))
+	if err != nil {
+		return nil, err
+	}
+
+	export := &utils.Export{
+		Format:    format,
+		Filename:  tableName + "." + format,
+		BatchSize: ExportBatchSize,
+	}
+	export.Next = func(after any) *utils.ReturnQuery {
+		where, pageArgs := filterSQL, slices.Clone(args)
+		if after != nil {
+			if where != "" {
+				where = "(" + where + ") AND "
+			}
+			where += "id > ?"
+			pageArgs = append(pageArgs, after)
+		}
+		if where != "" {
+			where = " WHERE " + where
+		}
+
+		sql := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY id ASC LIMIT %d", columns, tableName, where, ExportBatchSize)
+		return &utils.ReturnQuery{Query: sql, Args: pageArgs, Table: tableName, ReadOnly: true, Export: export}
+	}
+
+	return export.Next(nil), nil
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test exports page through the table by id instead of OFFSET
+func TestExport(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/products/export?format=jsonl&level=gt.2&select=id,name", nil)
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id, name FROM products WHERE level > ? ORDER BY id ASC LIMIT 1000", query.Query)
+	assert.Equal(t, []interface{}{int64(2)}, query.Args)
+	assert.True(t, query.ReadOnly)
+	assert.Equal(t, "jsonl", query.Export.Format)
+	assert.Equal(t, "products.jsonl", query.Export.Filename)
+
+	next := query.Export.Next(int64(1000))
+	assert.Equal(t, "SELECT id, name FROM products WHERE (level > ?) AND id > ? ORDER BY id ASC LIMIT 1000", next.Query)
+	assert.Equal(t, []interface{}{int64(2), int64(1000)}, next.Args)
+
+	query, err = GetQL(httptest.NewRequest(http.MethodGet, "/products/export", nil), "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "products.csv", query.Export.Filename)
+	assert.Equal(t, "SELECT * FROM products WHERE id > ? ORDER BY id ASC LIMIT 1000", query.Export.Next("p9").Query)
+
+	errors := map[string]string{
+		"/products/export?format=parquet":    "unsupported export format parquet",
+		"/products/export?select=name,level": "select must include id to export",
+	}
+	for path, expected := range errors {
+		_, err := GetQL(httptest.NewRequest(http.MethodGet, path, nil), "postgres")
+		assert.EqualError(t, err, expected)
+	}
+}
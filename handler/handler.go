@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Handler builds the queries of requests for one database type. It carries
+// its own configuration, so one process can serve several databases, and is
+// safe for concurrent use. Its schema, table defaults, partitions and query
+// cache default to the package ones shared by every Handler; validators,
+// required filters and the other package settings are always shared.
+type Handler struct {
+	dbType string
+	opts   Options
+	// schema replaces the package Schema once SetSchema is called
+	schema atomic.Pointer[map[string]*utils.Table]
+	// cache is the query cache of Options.QueryCache
+	cache *queryCache
+	// id tells the queries of Handlers with their own schema or table
+	// defaults apart in the shared query cache
+	id uint64
+}
+
+// handlers counts the Handlers made by New
+var handlers atomic.Uint64
+
+// Options are the request grammars a Handler accepts besides restql's own,
+// see PostgRESTCompat, ODataCompat and JSONAPICompat, and how it pages reads
+type Options struct {
+	PostgREST bool
+	OData     bool
+	JSONAPI   bool
+	// Pagination is the pagination strategy of reads, one of
+	// PaginationStrategies. Reads then carry a utils.Page describing their
+	// page; they carry none when empty.
+	Pagination string
+	// Locale is the default language tag numbers and dates are written in,
+	// see localeTag
+	Locale string
+	// QueryCache gives the Handler its own cache of up to QueryCache
+	// compiled queries, instead of the one of EnableQueryCache
+	QueryCache int
+	// TableDefaults and Partitions replace the package variables of the
+	// same names when set
+	TableDefaults map[string]TableDefault
+	Partitions    map[string]Partition
+}
+
+// New returns a Handler building queries for dbType: postgres, mysql, sqlite
+// or surrealdb
+func New(dbType string, opts Options) *Handler {
+	h := &Handler{dbType: dbType, opts: opts, id: handlers.Add(1)}
+	if opts.QueryCache > 0 {
+		h.cache = newQueryCache(opts.QueryCache)
+	}
+	return h
+}
+
+// DBType returns the database type queries are built for
+func (h *Handler) DBType() string {
+	return h.dbType
+}
+
+// Options returns the options of the Handler
+func (h *Handler) Options() Options {
+	return h.opts
+}
+
+// GetQL builds the query of a request for dbtype, in the compatibility modes
+// set by the package variables. It is New(dbtype, opts).GetQL(r).
+func GetQL(r *http.Request, dbtype string) (*utils.ReturnQuery, error) {
+	return New(dbtype, Options{
+		PostgREST: PostgRESTCompat,
+		OData:     ODataCompat,
+		JSONAPI:   JSONAPICompat,
+	}).GetQL(r)
+}
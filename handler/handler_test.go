@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test handlers for different databases and modes build queries side by side
+func TestHandlers(t *testing.T) {
+	defer EnableQueryCache(0)
+	EnableQueryCache(10)
+
+	tests := []struct {
+		name        string
+		handler     *Handler
+		path        string
+		expectedSQL string
+	}{
+		{
+			"postgres",
+			New("postgres", Options{}),
+			"/products?level=eq.2&limit=5",
+			"SELECT * FROM products WHERE level = ? ORDER BY id ASC LIMIT 100 OFFSET 0",
+		},
+		{
+			"postgres with postgrest",
+			New("postgres", Options{PostgREST: true}),
+			"/products?level=eq.2&limit=5",
+			"SELECT * FROM products WHERE level = ? ORDER BY id ASC LIMIT 5 OFFSET 0",
+		},
+		{
+			"surrealdb",
+			New("surrealdb", Options{}),
+			"/products?level=eq.2&limit=5",
+			"SELECT * FROM products WHERE level = ? ORDER BY id ASC LIMIT 100 START 0",
+		},
+		{
+			"sqlite with odata",
+			New("sqlite", Options{OData: true}),
+			"/products?$filter=level%20eq%202",
+			"SELECT * FROM products WHERE level = ? ORDER BY id ASC LIMIT 100 OFFSET 0",
+		},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(tests)*20)
+	for i := 0; i < 20; i++ {
+		for _, tt := range tests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				q, err := tt.handler.GetQL(httptest.NewRequest(http.MethodGet, tt.path, nil))
+				if err != nil {
+					errs <- fmt.Errorf("%s: %v", tt.name, err)
+				} else if q.Query != tt.expectedSQL {
+					errs <- fmt.Errorf("%s: got %s", tt.name, q.Query)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	assert.Equal(t, "sqlite", tests[3].handler.DBType())
+	assert.Equal(t, Options{OData: true}, tests[3].handler.Options())
+}
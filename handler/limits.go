@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var (
+	// MaxBodySize bounds request bodies in bytes. Zero means no limit.
+	MaxBodySize int64 = 10 << 20
+
+	// MaxRecords bounds how many records a bulk insert may hold. Zero means
+	// no limit.
+	MaxRecords = 0
+
+	// MaxJSONDepth bounds the nesting of JSON bodies, checked before they are
+	// decoded. Zero means no limit.
+	MaxJSONDepth = 32
+)
+
+// LimitError reports a request exceeding one of the limits above. Serve it
+// as 413 Request Entity Too Large:
+//
+//	var limitErr *handler.LimitError
+//	if errors.As(err, &limitErr) {
+//		http.Error(w, err.Error(), limitErr.StatusCode())
+//	}
+type LimitError struct {
+	// Limit names the exceeded limit: "body size", "records" or "JSON depth"
+	Limit string
+	// Max is the configured maximum
+	Max int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("request exceeds the maximum %s of %d", e.Limit, e.Max)
+}
+
+// StatusCode returns the HTTP status for the error
+func (e *LimitError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// readLimitedBody reads the request body, enforcing MaxBodySize, and
+// MaxJSONDepth unless the body is CSV or a form
+func readLimitedBody(r *http.Request) ([]byte, error) {
+	reader := io.Reader(r.Body)
+	if MaxBodySize > 0 {
+		reader = io.LimitReader(r.Body, MaxBodySize+1)
+	}
+	body, err := io.ReadAll(reader)
+	// Servers may cap the body before it gets here
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, &LimitError{Limit: "body size", Max: tooLarge.Limit}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %v", err)
+	}
+	if MaxBodySize > 0 && int64(len(body)) > MaxBodySize {
+		return nil, &LimitError{Limit: "body size", Max: MaxBodySize}
+	}
+
+	if MaxJSONDepth > 0 && jsonDepthExceeds(body, MaxJSONDepth) {
+		return nil, &LimitError{Limit: "JSON depth", Max: int64(MaxJSONDepth)}
+	}
+	return body, nil
+}
+
+// jsonDepthExceeds reports whether body nests arrays and objects deeper than
+// max. It only tokenizes, stopping at the first level too deep, and leaves
+// bodies that are not JSON to their decoder.
+func jsonDepthExceeds(body []byte, max int) bool {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		switch tok {
+		case json.Delim('['), json.Delim('{'):
+			depth++
+			if depth > max {
+				return true
+			}
+		case json.Delim(']'), json.Delim('}'):
+			depth--
+		}
+	}
+}
+
+// checkRecords enforces MaxRecords on a bulk insert
+func checkRecords(n int) error {
+	if MaxRecords > 0 && n > MaxRecords {
+		return &LimitError{Limit: "records", Max: int64(MaxRecords)}
+	}
+	return nil
+}
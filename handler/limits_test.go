@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test oversized, over-nested and over-long bodies are rejected as 413s
+func TestLimits(t *testing.T) {
+	defer func(size int64) { MaxBodySize = size }(MaxBodySize)
+	defer func(records int) { MaxRecords = records }(MaxRecords)
+	defer func(depth int) { MaxJSONDepth = depth }(MaxJSONDepth)
+	MaxBodySize = 64
+	MaxRecords = 2
+	MaxJSONDepth = 3
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		errMsg string
+	}{
+		{"body size", "/products", `[{"name": "` + strings.Repeat("a", 64) + `"}]`, "request exceeds the maximum body size of 64"},
+		{"records", "/products", `[{"a": 1}, {"a": 2}, {"a": 3}]`, "request exceeds the maximum records of 2"},
+		{"JSON depth", "/products", `{"a": {"b": [[1]]}}`, "request exceeds the maximum JSON depth of 3"},
+		{"query depth", "/products/query", `{"filter": {"and": [{"or": []}]}}`, "request exceeds the maximum JSON depth of 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GetQL(httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)), "postgres")
+			assert.EqualError(t, err, tt.errMsg)
+
+			var limitErr *LimitError
+			assert.True(t, errors.As(err, &limitErr))
+			assert.Equal(t, http.StatusRequestEntityTooLarge, limitErr.StatusCode())
+		})
+	}
+
+	// Within the limits
+	_, err := GetQL(httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`[{"a": [1]}, {"a": 2}]`)), "postgres")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+var (
+	// Logger receives debug logs of every generated query. A nil Logger
+	// disables query logging.
+	Logger *slog.Logger
+
+	// RedactColumns lists sensitive columns. The args of any query touching
+	// one of them are logged as [REDACTED].
+	RedactColumns []string
+)
+
+const redacted = "[REDACTED]"
+
+// logQuery logs a generated query, or the error that prevented building it
+func (h *Handler) logQuery(ctx context.Context, method, tableName string, q *utils.ReturnQuery, err error) {
+	logger := Logger
+	if logger == nil || !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	if err != nil {
+		logger.DebugContext(ctx, "restql query rejected",
+			slog.String("method", method),
+			slog.String("table", tableName),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	text, args := q.Query, q.Args
+	if touchesRedactedColumn(q) {
+		if !h.sanitized(q) {
+			text = redacted
+		}
+		args = make([]any, len(q.Args))
+		for i := range args {
+			args[i] = redacted
+		}
+	}
+
+	logger.DebugContext(ctx, "restql query",
+		slog.String("method", method),
+		slog.String("table", tableName),
+		slog.String("db", h.dbType),
+		slog.String("query", text),
+		slog.Any("args", args),
+	)
+}
+
+// touchesRedactedColumn reports whether the query text mentions a redacted
+// column as a whole identifier, or a record bound as a named arg, e.g. the
+// $data of SurrealDB writes, holds one
+func touchesRedactedColumn(q *utils.ReturnQuery) bool {
+	for _, column := range RedactColumns {
+		if column == "" {
+			continue
+		}
+		if containsIdentifier(q.Query, column) {
+			return true
+		}
+		for _, arg := range q.Args {
+			if named, ok := arg.(sql.NamedArg); ok && recordsHave(named.Value, column) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recordsHave reports whether a record or records hold a column
+func recordsHave(value any, column string) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		_, ok := v[column]
+		return ok
+	case []map[string]any:
+		for _, record := range v {
+			if _, ok := record[column]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsIdentifier reports whether ident appears in text without being part
+// of a longer identifier
+func containsIdentifier(text, ident string) bool {
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], ident)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(ident)
+		if (start == 0 || !isIdentifierByte(text[start-1])) && (end == len(text) || !isIdentifierByte(text[end])) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
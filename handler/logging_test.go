@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test generated queries are logged with sensitive values redacted
+func TestQueryLogging(t *testing.T) {
+	defer func(logger *slog.Logger, columns []string) { Logger, RedactColumns = logger, columns }(Logger, RedactColumns)
+
+	var buf bytes.Buffer
+	Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	RedactColumns = []string{"password"}
+
+	req := httptest.NewRequest(http.MethodGet, "/users?name=eq.alice", nil)
+	_, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `msg="restql query" method=GET table=users db=postgres query="SELECT * FROM users WHERE name = ? ORDER BY id ASC LIMIT 100 OFFSET 0" args=[alice]`)
+
+	buf.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/users?password=eq.secret", nil)
+	_, err = GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "args=[[REDACTED]]")
+	assert.NotContains(t, buf.String(), "secret")
+
+	buf.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/users?password_hint=eq.pet", nil)
+	_, err = GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "args=[pet]")
+
+	buf.Reset()
+	req = httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name": "alice", "password": "secret"}`))
+	_, err = GetQL(req, "surrealdb")
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "args=[[REDACTED]]")
+	assert.NotContains(t, buf.String(), "secret")
+
+	buf.Reset()
+	req = httptest.NewRequest(http.MethodOptions, "/users", nil)
+	_, err = GetQL(req, "postgres")
+	assert.Error(t, err)
+	assert.Contains(t, buf.String(), `msg="restql query rejected" method=OPTIONS table=users error="method not allowed"`)
+}
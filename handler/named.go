@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// NamedQuery is an operator-defined SQL template exposed as
+// GET /_query/{name}. Parameters are referenced as :name in the SQL and bound
+// from the query string, e.g. /_query/top_customers?since=2024-01-01.
+type NamedQuery struct {
+	SQL    string
+	Params []QueryParam
+	// Table is the table the query reads, used for cache invalidation
+	Table string
+	// ReadOnly marks queries that never write, so they can be routed to a
+	// read replica
+	ReadOnly bool
+
+	sql   string
+	order []string
+}
+
+// QueryParam declares a named query parameter
+type QueryParam struct {
+	Name string
+	// Type is the SQL type the value must parse as, e.g. "INTEGER", "DATE"
+	// or "TIMESTAMP"
+	Type string
+	// Optional parameters bind NULL when missing
+	Optional bool
+	// Enum restricts the value to a fixed set
+	Enum []string
+}
+
+var (
+	namedMu      sync.RWMutex
+	namedQueries = map[string]*NamedQuery{}
+)
+
+// RegisterQuery exposes q as GET /_query/{name}. Every :param in the SQL must
+// be declared in q.Params and every declared parameter must be used.
+func RegisterQuery(name string, q NamedQuery) error {
+	if err := utils.ValidateTableName(name); err != nil {
+		return fmt.Errorf("invalid query name %q", name)
+	}
+
+	declared := map[string]bool{}
+	for _, p := range q.Params {
+		if err := utils.ValidateColumnName(p.Name); err != nil {
+			return err
+		}
+		declared[p.Name] = false
+	}
+
+	sql, order, err := compileNamedSQL(q.SQL)
+	if err != nil {
+		return err
+	}
+	for _, name := range order {
+		if _, ok := declared[name]; !ok {
+			return fmt.Errorf("undeclared parameter :%s", name)
+		}
+		declared[name] = true
+	}
+	for name, used := range declared {
+		if !used {
+			return fmt.Errorf("parameter %s is not used", name)
+		}
+	}
+
+	q.sql, q.order = sql, order
+
+	namedMu.Lock()
+	defer namedMu.Unlock()
+	namedQueries[name] = &q
+	return nil
+}
+
+// compileNamedSQL rewrites :name placeholders to ? and returns the parameter
+// names in order. Casts like ::date and quoted strings are left alone.
+func compileNamedSQL(sql string) (string, []string, error) {
+	var b strings.Builder
+	order := []string{}
+	inString := false
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+		case c == ':' && !inString && i+1 < len(sql) && sql[i+1] == ':':
+			b.WriteString("::")
+			i++
+			continue
+		case c == ':' && !inString:
+			j := i + 1
+			for j < len(sql) && isIdentifierByte(sql[j]) {
+				j++
+			}
+			if j == i+1 {
+				return "", nil, fmt.Errorf("invalid placeholder at offset %d", i)
+			}
+			order = append(order, sql[i+1:j])
+			b.WriteByte('?')
+			i = j - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	if inString {
+		return "", nil, fmt.Errorf("unterminated string in query")
+	}
+	return b.String(), order, nil
+}
+
+// Build a registered named query, binding and validating its parameters
+func namedQuery(r *http.Request) (*utils.ReturnQuery, error) {
+	if r.Method != http.MethodGet {
+		return nil, fmt.Errorf("method not allowed")
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 || parts[2] == "" {
+		return nil, fmt.Errorf("query name required")
+	}
+
+	namedMu.RLock()
+	q, ok := namedQueries[parts[2]]
+	namedMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown query %s", parts[2])
+	}
+
+	queryParams := r.URL.Query()
+	values := map[string]any{}
+	for _, p := range q.Params {
+		if !queryParams.Has(p.Name) {
+			if !p.Optional {
+				return nil, fmt.Errorf("missing parameter %s", p.Name)
+			}
+			values[p.Name] = nil
+			continue
+		}
+		value, err := p.parse(queryParams.Get(p.Name))
+		if err != nil {
+			return nil, err
+		}
+		values[p.Name] = value
+	}
+
+	args := make([]any, len(q.order))
+	for i, name := range q.order {
+		args[i] = values[name]
+	}
+
+	return &utils.ReturnQuery{Query: q.sql, Args: args, Table: q.Table, ReadOnly: q.ReadOnly}, nil
+}
+
+// parse converts a raw parameter value to its declared type
+func (p QueryParam) parse(raw string) (any, error) {
+	if len(p.Enum) > 0 {
+		if err := utils.ValidateEnumValue(&utils.Column{Name: p.Name, Enum: p.Enum}, raw); err != nil {
+			return nil, err
+		}
+	}
+
+	invalid := fmt.Errorf("invalid value %q for parameter %s", raw, p.Name)
+	switch base := utils.BaseType(p.Type); {
+	case base == "DATE":
+		if _, err := time.Parse(time.DateOnly, raw); err != nil {
+			return nil, invalid
+		}
+		return raw, nil
+	case base == "DATETIME" || base == "TIMESTAMP":
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, invalid
+		}
+		return t, nil
+	}
+
+	switch utils.JSONType(p.Type) {
+	case "integer":
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return n, nil
+	case "number":
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return f, nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, invalid
+		}
+		return b, nil
+	}
+	return raw, nil
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test named queries bind validated parameters
+func TestNamedQuery(t *testing.T) {
+	err := RegisterQuery("top_customers", NamedQuery{
+		SQL:      "SELECT customer_id, SUM(amount) FROM orders WHERE created_at >= :since::date AND region = :region AND note <> ':x' GROUP BY customer_id LIMIT :n",
+		Params:   []QueryParam{{Name: "since", Type: "DATE"}, {Name: "region", Enum: []string{"eu", "us"}}, {Name: "n", Type: "INTEGER", Optional: true}},
+		Table:    "orders",
+		ReadOnly: true,
+	})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/_query/top_customers?since=2024-01-01&region=eu&n=10", nil)
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT customer_id, SUM(amount) FROM orders WHERE created_at >= ?::date AND region = ? AND note <> ':x' GROUP BY customer_id LIMIT ?", query.Query)
+	assert.Equal(t, []interface{}{"2024-01-01", "eu", int64(10)}, query.Args)
+	assert.Equal(t, "orders", query.Table)
+	assert.True(t, query.ReadOnly)
+
+	// Optional parameters bind NULL
+	req = httptest.NewRequest(http.MethodGet, "/_query/top_customers?since=2024-01-01&region=us", nil)
+	query, err = GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"2024-01-01", "us", nil}, query.Args)
+
+	for _, path := range []string{
+		"/_query/top_customers?since=yesterday&region=eu",
+		"/_query/top_customers?since=2024-01-01&region=asia",
+		"/_query/top_customers?region=eu",
+		"/_query/top_customers?since=2024-01-01&region=eu&n=ten",
+		"/_query/unknown",
+	} {
+		_, err := GetQL(httptest.NewRequest(http.MethodGet, path, nil), "postgres")
+		assert.Error(t, err, path)
+	}
+
+	_, err = GetQL(httptest.NewRequest(http.MethodDelete, "/_query/top_customers", nil), "postgres")
+	assert.EqualError(t, err, "method not allowed")
+
+	assert.Error(t, RegisterQuery("bad", NamedQuery{SQL: "SELECT :a"}))
+	assert.Error(t, RegisterQuery("bad", NamedQuery{SQL: "SELECT 1", Params: []QueryParam{{Name: "a"}}}))
+	assert.Error(t, RegisterQuery("bad-name", NamedQuery{SQL: "SELECT 1"}))
+
+	param := QueryParam{Name: "at", Type: "TIMESTAMP"}
+	value, err := param.parse("2024-01-01T10:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), value)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// parentKey is the context key of the parent of a nested route
+type parentKey struct{}
+
+// parentRow is the row a nested route like /users/1/orders is under: the
+// rows of the route have column set to id, typed as value
+type parentRow struct {
+	path   string
+	column string
+	id     string
+	value  interface{}
+}
+
+// Unnest rewrites a request to a nested route like /users/1/orders into one
+// to /orders, the rows of orders whose foreign key to users.id is 1. Reads
+// and deletes get the filter user_id=eq.1 ahead of their own, and inserts
+// set user_id on every record. The foreign key is looked up in Schema, and
+// must be the only one of orders referencing users.id. Other requests are
+// returned unchanged.
+func Unnest(r *http.Request) (*http.Request, error) {
+	return New("", Options{}).Unnest(r)
+}
+
+// Unnest rewrites a request to a nested route like Unnest, looking the
+// foreign key up in the schema of h
+func (h *Handler) Unnest(r *http.Request) (*http.Request, error) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 4 || parts[3] == "" {
+		return r, nil
+	}
+	parentTable, id, tableName := parts[1], parts[2], parts[3]
+	for _, name := range []string{parentTable, tableName} {
+		if err := utils.ValidateTableName(name); err != nil {
+			return nil, fmt.Errorf("invalid table name")
+		}
+	}
+	if id == "" {
+		return nil, fmt.Errorf("primary key of %s required", parentTable)
+	}
+
+	table := h.tableMeta(tableName)
+	var keys []utils.ForeignKey
+	if table != nil {
+		keys = table.References(parentTable, "id")
+	}
+	switch len(keys) {
+	case 0:
+		return nil, fmt.Errorf("%s has no foreign key to %s.id", tableName, parentTable)
+	case 1:
+	default:
+		return nil, fmt.Errorf("%s has several foreign keys to %s.id", tableName, parentTable)
+	}
+	parent := parentRow{path: "/" + parentTable + "/" + id, column: keys[0].Column, id: id, value: id}
+	if column, ok := table.Column(parent.column); ok {
+		value, err := utils.ParseColumnValue(column, id)
+		if err != nil {
+			return nil, err
+		}
+		parent.value = value
+	}
+
+	nested := r.Clone(context.WithValue(r.Context(), parentKey{}, parent))
+	nested.URL.Path = "/" + tableName
+	nested.URL.RawPath = ""
+	switch r.Method {
+	case http.MethodGet, http.MethodDelete:
+		filter := parent.column + "=eq." + url.QueryEscape(id)
+		if r.URL.RawQuery != "" {
+			filter += "&" + r.URL.RawQuery
+		}
+		nested.URL.RawQuery = filter
+	case http.MethodPost:
+	default:
+		return nil, fmt.Errorf("%s is not supported on %s/%s: use /%s/{id}", r.Method, parent.path, tableName, tableName)
+	}
+	return nested, nil
+}
+
+// fillParent sets the foreign key of a nested route on each record,
+// rejecting records naming another parent
+func fillParent(r *http.Request, records []map[string]interface{}) error {
+	parent, ok := r.Context().Value(parentKey{}).(parentRow)
+	if !ok {
+		return nil
+	}
+	for i, record := range records {
+		if v, ok := record[parent.column]; ok && v != nil && fmt.Sprint(v) != parent.id {
+			return fmt.Errorf("record %d: %s must be %s under %s", i, parent.column, parent.id, parent.path)
+		}
+		record[parent.column] = parent.value
+	}
+	return nil
+}
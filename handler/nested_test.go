@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test nested routes select, insert and delete the rows under their parent
+func TestNestedRoutes(t *testing.T) {
+	Schema["orders"] = &utils.Table{
+		Name:        "orders",
+		Columns:     []utils.Column{{Name: "id", Type: "INTEGER"}, {Name: "user_id", Type: "INTEGER"}, {Name: "total", Type: "NUMERIC"}},
+		ForeignKeys: []utils.ForeignKey{{Column: "user_id", RefTable: "users", RefColumn: "id"}},
+	}
+	defer delete(Schema, "orders")
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		expectedSQL  string
+		expectedArgs []interface{}
+		expectedErr  string
+	}{
+		{
+			"select",
+			http.MethodGet,
+			"/users/1/orders?total=gt.10",
+			"",
+			"SELECT * FROM orders WHERE user_id = ? AND total > ? ORDER BY id ASC LIMIT 100 OFFSET 0",
+			[]interface{}{int64(1), "10"},
+			"",
+		},
+		{
+			"insert",
+			http.MethodPost,
+			"/users/1/orders",
+			`{"total": 20}`,
+			"INSERT INTO orders (total, user_id) VALUES (?, ?)",
+			[]interface{}{float64(20), int64(1)},
+			"",
+		},
+		{
+			"insert naming the parent",
+			http.MethodPost,
+			"/users/1/orders",
+			`{"total": 20, "user_id": 1}`,
+			"INSERT INTO orders (total, user_id) VALUES (?, ?)",
+			[]interface{}{float64(20), int64(1)},
+			"",
+		},
+		{
+			"insert naming another parent",
+			http.MethodPost,
+			"/users/1/orders",
+			`[{"total": 20}, {"total": 5, "user_id": 2}]`,
+			"",
+			nil,
+			"record 1: user_id must be 1 under /users/1",
+		},
+		{
+			"delete",
+			http.MethodDelete,
+			"/users/1/orders",
+			"",
+			"DELETE FROM orders WHERE user_id = ?",
+			[]interface{}{int64(1)},
+			"",
+		},
+		{
+			"update",
+			http.MethodPatch,
+			"/users/1/orders",
+			`{"total": 20}`,
+			"",
+			nil,
+			"PATCH is not supported on /users/1/orders: use /orders/{id}",
+		},
+		{
+			"no foreign key",
+			http.MethodGet,
+			"/products/1/orders",
+			"",
+			"",
+			nil,
+			"orders has no foreign key to products.id",
+		},
+		{
+			"invalid id",
+			http.MethodGet,
+			"/users/abc/orders",
+			"",
+			"",
+			nil,
+			`invalid integer value "abc" for column user_id`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			q, err := New("postgres", Options{}).GetQL(req)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, q.Query)
+			assert.Equal(t, tt.expectedArgs, q.Args)
+		})
+	}
+}
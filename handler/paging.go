@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Pagination strategies of Options.Pagination. Every strategy reads the
+// next page from the next_cursor of the last one, passed as ?cursor=.
+const (
+	// OffsetPagination numbers pages: ?page=2, or ?cursor=2
+	OffsetPagination = "offset"
+	// KeysetPagination continues after the id of the cursor, so deep pages
+	// need no OFFSET. Reads must be ordered by id.
+	KeysetPagination = "keyset"
+	// TokenPagination continues from an opaque cursor keeping the page
+	// number, seeking by id when reads are ordered by id
+	TokenPagination = "token"
+)
+
+// PaginationStrategies are the values Options.Pagination may take besides
+// the empty string
+var PaginationStrategies = []string{OffsetPagination, KeysetPagination, TokenPagination}
+
+// pageToken is the content of a TokenPagination cursor: the number of the
+// page, and where it starts
+type pageToken struct {
+	Page   int    `json:"p"`
+	Offset int    `json:"o,omitempty"`
+	After  string `json:"a,omitempty"`
+}
+
+// pageRead is where a read under a pagination strategy starts: at offset,
+// or after the row matching seek with arg
+type pageRead struct {
+	page   *utils.Page
+	offset int
+	seek   string
+	arg    interface{}
+}
+
+// paginate resolves the page a read of limit rows returns, from ?cursor= or
+// the offset of ?page=
+func (h *Handler) paginate(tableName string, queryParams url.Values, columns, orderSQL string, limit, offset int) (*pageRead, error) {
+	page := &utils.Page{Strategy: h.opts.Pagination, Size: limit}
+	read := &pageRead{page: page, offset: offset}
+	cursor := queryParams.Get("cursor")
+
+	// Seeking needs the order to be by id alone, and the id of every row
+	seekOp := map[string]string{"ORDER BY id ASC": ">", "ORDER BY id DESC": "<"}[orderSQL]
+	if seekOp != "" && columns != "*" && !slices.Contains(strings.Split(columns, ", "), "id") {
+		seekOp = ""
+	}
+
+	switch h.opts.Pagination {
+	case OffsetPagination:
+		if cursor != "" {
+			n, err := strconv.Atoi(cursor)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid cursor %q", cursor)
+			}
+			read.offset = (n - 1) * limit
+		}
+		page.Number = read.offset/limit + 1
+		page.Next = func(map[string]any) string {
+			return strconv.Itoa(page.Number + 1)
+		}
+
+	case KeysetPagination:
+		if seekOp == "" {
+			return nil, fmt.Errorf("keyset pagination requires order=id.asc or order=id.desc and the id column")
+		}
+		read.offset = 0
+		if cursor != "" {
+			if err := read.seekAfter(h.tableMeta(tableName), seekOp, cursor); err != nil {
+				return nil, err
+			}
+		}
+		page.Next = func(last map[string]any) string {
+			return formatCursor(last["id"])
+		}
+
+	case TokenPagination:
+		token := pageToken{Page: 1}
+		if cursor != "" {
+			data, err := base64.RawURLEncoding.DecodeString(cursor)
+			if err != nil || json.Unmarshal(data, &token) != nil || token.Page < 1 || token.Offset < 0 {
+				return nil, fmt.Errorf("invalid cursor %q", cursor)
+			}
+		}
+		page.Number = token.Page
+		read.offset = token.Offset
+		if seekOp != "" {
+			read.offset = 0
+			if token.After != "" {
+				if err := read.seekAfter(h.tableMeta(tableName), seekOp, token.After); err != nil {
+					return nil, err
+				}
+			}
+		}
+		page.Next = func(last map[string]any) string {
+			next := pageToken{Page: token.Page + 1, Offset: read.offset + limit}
+			if seekOp != "" {
+				next = pageToken{Page: token.Page + 1, After: formatCursor(last["id"])}
+			}
+			data, _ := json.Marshal(next)
+			return base64.RawURLEncoding.EncodeToString(data)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown pagination strategy %q", h.opts.Pagination)
+	}
+	return read, nil
+}
+
+// seekAfter continues the read after the row with id, typed as the id
+// column of table when it is known
+func (read *pageRead) seekAfter(table *utils.Table, op, id string) error {
+	after, err := utils.ParseQueryParam(id)
+	if table != nil {
+		if column, ok := table.Column("id"); ok {
+			after, err = utils.ParseColumnValue(column, id)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid cursor %q", id)
+	}
+	read.seek, read.arg = "id "+op+" ?", after
+	return nil
+}
+
+// formatCursor renders an id as a cursor, keeping JSON numbers like 1e+06
+// whole
+func formatCursor(id any) string {
+	if f, ok := id.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(id)
+}
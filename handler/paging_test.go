@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test each pagination strategy reads its page and describes it
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		name         string
+		strategy     string
+		path         string
+		expectedSQL  string
+		expectedArgs []interface{}
+		number       int
+		expectedErr  string
+	}{
+		{
+			"offset",
+			OffsetPagination,
+			"/products?level=eq.2&page=2&page_size=10",
+			"SELECT * FROM products WHERE level = ? ORDER BY id ASC LIMIT 10 OFFSET 10",
+			[]interface{}{int64(2)},
+			2,
+			"",
+		},
+		{
+			"offset cursor",
+			OffsetPagination,
+			"/products?page_size=10&cursor=3",
+			"SELECT * FROM products ORDER BY id ASC LIMIT 10 OFFSET 20",
+			[]interface{}{},
+			3,
+			"",
+		},
+		{
+			"keyset",
+			KeysetPagination,
+			"/products?level=eq.2&page_size=10&cursor=5",
+			"SELECT * FROM products WHERE (level = ?) AND id > ? ORDER BY id ASC LIMIT 10 OFFSET 0",
+			[]interface{}{int64(2), int64(5)},
+			0,
+			"",
+		},
+		{
+			"keyset descending",
+			KeysetPagination,
+			"/products?order=id.desc&page=3&cursor=5",
+			"SELECT * FROM products WHERE id < ? ORDER BY id DESC LIMIT 100 OFFSET 0",
+			[]interface{}{int64(5)},
+			0,
+			"",
+		},
+		{
+			"keyset by another order",
+			KeysetPagination,
+			"/products?order=name.asc",
+			"",
+			nil,
+			0,
+			"keyset pagination requires order=id.asc or order=id.desc and the id column",
+		},
+		{
+			"keyset without id",
+			KeysetPagination,
+			"/products?select=name",
+			"",
+			nil,
+			0,
+			"keyset pagination requires order=id.asc or order=id.desc and the id column",
+		},
+		{
+			"token by another order",
+			TokenPagination,
+			"/products?order=name.asc&page_size=10&cursor=eyJwIjozLCJvIjoyMH0",
+			"SELECT * FROM products ORDER BY name ASC LIMIT 10 OFFSET 20",
+			[]interface{}{},
+			3,
+			"",
+		},
+		{
+			"invalid offset cursor",
+			OffsetPagination,
+			"/products?cursor=0",
+			"",
+			nil,
+			0,
+			`invalid cursor "0"`,
+		},
+		{
+			"invalid token",
+			TokenPagination,
+			"/products?cursor=abc",
+			"",
+			nil,
+			0,
+			`invalid cursor "abc"`,
+		},
+		{
+			"unknown strategy",
+			"cursor",
+			"/products",
+			"",
+			nil,
+			0,
+			`unknown pagination strategy "cursor"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := New("postgres", Options{Pagination: tt.strategy}).GetQL(httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, q.Query)
+			assert.Equal(t, tt.expectedArgs, q.Args)
+			require.NotNil(t, q.Page)
+			assert.Equal(t, tt.strategy, q.Page.Strategy)
+			assert.Equal(t, tt.number, q.Page.Number)
+		})
+	}
+
+	q, err := New("postgres", Options{}).GetQL(httptest.NewRequest(http.MethodGet, "/products", nil))
+	require.NoError(t, err)
+	assert.Nil(t, q.Page)
+}
+
+// Test pages report their number, size, total and next cursor, which reads
+// the next page
+func TestPageMeta(t *testing.T) {
+	rows := []map[string]any{{"id": int64(6)}, {"id": int64(7)}}
+	counted := []map[string]any{{"count": int64(5)}}
+
+	h := New("postgres", Options{Pagination: OffsetPagination})
+	q, err := h.GetQL(httptest.NewRequest(http.MethodGet, "/products?level=eq.2&page_size=2", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT COUNT(*) AS count FROM products WHERE level = ?", q.Page.Count.Query)
+	meta := q.Page.Meta(rows, counted)
+	assert.Equal(t, 1, *meta.Page)
+	assert.Equal(t, 2, meta.PageSize)
+	assert.Equal(t, int64(5), *meta.Total)
+	assert.Equal(t, "2", *meta.NextCursor)
+
+	q, err = h.GetQL(httptest.NewRequest(http.MethodGet, "/products?page=3&page_size=2", nil))
+	require.NoError(t, err)
+	assert.Nil(t, q.Page.Meta(rows[:1], counted).NextCursor)
+
+	q, err = New("postgres", Options{Pagination: KeysetPagination}).GetQL(httptest.NewRequest(http.MethodGet, "/products?page_size=2", nil))
+	require.NoError(t, err)
+	assert.Equal(t, utils.PageMeta{PageSize: 2}, q.Page.Meta(rows[:1], nil))
+	assert.Equal(t, "7", *q.Page.Meta(rows, nil).NextCursor)
+
+	// Tokens keep the page number and seek by id
+	h = New("postgres", Options{Pagination: TokenPagination})
+	q, err = h.GetQL(httptest.NewRequest(http.MethodGet, "/products?page_size=2", nil))
+	require.NoError(t, err)
+	cursor := *q.Page.Meta(rows, nil).NextCursor
+	q, err = h.GetQL(httptest.NewRequest(http.MethodGet, "/products?page_size=2&cursor="+cursor, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM products WHERE id > ? ORDER BY id ASC LIMIT 2 OFFSET 0", q.Query)
+	assert.Equal(t, []interface{}{int64(7)}, q.Args)
+	assert.Equal(t, 2, *q.Page.Meta(rows, counted).Page)
+	assert.NotNil(t, q.Page.Meta(rows, counted).NextCursor)
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Partition declares a logical table stored as one physical table per period,
+// named by Pattern, e.g. "events_%Y%m" for events_202401, events_202402, ...
+// Reads of the logical table only touch the partitions overlapping the range
+// filtered on Column.
+type Partition struct {
+	// Pattern names the physical tables with %Y, %m and %d
+	Pattern string
+	// Column is the timestamp column the tables are partitioned by
+	Column string
+	// Start is the first partition, used when a read has no lower bound
+	Start time.Time
+}
+
+// Partitions maps logical table names to their partitioning. Tables using
+// Postgres native partitioning need no entry, since Postgres prunes
+// partitions itself.
+var Partitions = map[string]Partition{}
+
+// MaxPartitions bounds how many partitions a single read may span
+const MaxPartitions = 120
+
+// Read a partitioned table through the partitions its filters can match
+func (h *Handler) partitionQuery(r *http.Request, tableName string, p Partition) (*utils.ReturnQuery, error) {
+	params, err := h.Params(r, tableName)
+	if err != nil {
+		return nil, err
+	}
+	queryParams := paramValues(params)
+	h.applyTableDefaults(tableName, queryParams)
+	if err := h.checkReadFilters(tableName, query.FilterColumns(params)); err != nil {
+		return nil, err
+	}
+
+	from, to, err := partitionRange(params, p, h.filterOptions(r, tableName))
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := p.tables(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	metas := make([]*utils.Table, len(tables))
+	for i := range tables {
+		metas[i] = h.tableMeta(tableName)
+	}
+
+	q, err := h.unionSQL(r, tables, metas, params, queryParams, true)
+	if err != nil {
+		return nil, err
+	}
+	q.Table = tableName
+	return q, nil
+}
+
+// partitionRange returns the range of the partition column given by the
+// top-level gt/gte/lt/lte/eq filters, defaulting to Start through now.
+// Relative dates are evaluated as the filters are.
+func partitionRange(params []query.Param, p Partition, opts query.Options) (time.Time, time.Time, error) {
+	from, to := p.Start, time.Now().UTC()
+
+	for _, param := range params {
+		if param.Key != p.Column {
+			continue
+		}
+		op, value, ok := strings.Cut(param.Value, ".")
+		if !ok {
+			continue
+		}
+		t, relative, err := query.ParseRelativeTime(value, opts)
+		if !relative {
+			t, err = parseTime(value)
+		}
+		if err != nil {
+			return from, to, fmt.Errorf("invalid value %q for column %s", value, p.Column)
+		}
+
+		switch op {
+		case "gt", "gte":
+			from = t
+		case "lt", "lte":
+			to = t
+		case "eq":
+			from, to = t, t
+		}
+	}
+
+	if from.IsZero() {
+		return from, to, fmt.Errorf("%s lower bound required: filter %s with gt, gte or eq", p.Column, p.Column)
+	}
+	return from, to, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t.UTC(), err
+}
+
+// tables lists the partitions overlapping from through to
+func (p Partition) tables(from, to time.Time) ([]string, error) {
+	step := func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }
+	start := time.Date(from.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	switch {
+	case strings.Contains(p.Pattern, "%d"):
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+		start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	case strings.Contains(p.Pattern, "%m"):
+		step = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+		start = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	tables := []string{}
+	for t := start; !t.After(to); t = step(t) {
+		if len(tables) == MaxPartitions {
+			return nil, fmt.Errorf("range spans more than %d partitions", MaxPartitions)
+		}
+		name := strings.NewReplacer(
+			"%Y", fmt.Sprintf("%04d", t.Year()),
+			"%m", fmt.Sprintf("%02d", int(t.Month())),
+			"%d", fmt.Sprintf("%02d", t.Day()),
+		).Replace(p.Pattern)
+		if err := utils.ValidateTableName(name); err != nil {
+			return nil, fmt.Errorf("invalid partition name %q", name)
+		}
+		tables = append(tables, name)
+	}
+
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("empty %s range", p.Column)
+	}
+	return tables, nil
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test reads of partitioned tables only touch matching partitions
+func TestPartitions(t *testing.T) {
+	defer func(partitions map[string]Partition) { Partitions = partitions }(Partitions)
+
+	Partitions = map[string]Partition{
+		"events": {Pattern: "events_%Y%m", Column: "created_at"},
+		"logs":   {Pattern: "logs_%Y", Column: "at", Start: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/events?created_at=gte.2024-01-15&created_at=lt.2024-03-01&kind=eq.click", nil)
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM (SELECT * FROM events_202401 WHERE created_at >= ? AND created_at < ? AND kind = ? UNION ALL SELECT * FROM events_202402 WHERE created_at >= ? AND created_at < ? AND kind = ? UNION ALL SELECT * FROM events_202403 WHERE created_at >= ? AND created_at < ? AND kind = ?) AS combined ORDER BY id ASC LIMIT 100 OFFSET 0", query.Query)
+	assert.Len(t, query.Args, 9)
+	assert.Equal(t, "events", query.Table)
+
+	req = httptest.NewRequest(http.MethodGet, "/events?created_at=eq.2024-05-02T10:00:00Z", nil)
+	query, err = GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM events_202405 WHERE created_at = ? ORDER BY id ASC LIMIT 100 OFFSET 0", query.Query)
+
+	// Start is the lower bound when no filter gives one
+	req = httptest.NewRequest(http.MethodGet, "/logs?at=lte.2022-01-01&select=id", nil)
+	query, err = GetQL(req, "surrealdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id FROM logs_2020, logs_2021, logs_2022 WHERE at <= ? ORDER BY id ASC LIMIT 100 START 0", query.Query)
+
+	errors := map[string]string{
+		"/events?kind=eq.click":                                      "created_at lower bound required: filter created_at with gt, gte or eq",
+		"/events?created_at=gte.yesterday":                           `invalid value "yesterday" for column created_at`,
+		"/events?created_at=gte.2000-01-01&created_at=lt.2020-01-01": "range spans more than 120 partitions",
+		"/events?created_at=gte.2024-03-01&created_at=lt.2024-01-01": "empty created_at range",
+	}
+	for path, expected := range errors {
+		_, err := GetQL(httptest.NewRequest(http.MethodGet, path, nil), "postgres")
+		assert.EqualError(t, err, expected, path)
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RequiredFilters lists per table the columns every read, and every delete
+// by filter, must filter on, so full scans of huge tables can be forbidden,
+// e.g. {"orders": {"tenant_id"}, "logs": {"created_at"}}. Only filters
+// applying to every row count: conditions under or and not do not.
+var RequiredFilters = map[string][]string{}
+
+// checkRequiredFilters rejects a query on tableName whose filters restrict
+// rows by columns missing some required column
+func checkRequiredFilters(tableName string, columns map[string]bool) error {
+	missing := []string{}
+	for _, column := range RequiredFilters[tableName] {
+		if !columns[column] {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("queries on %s must filter on %s", tableName, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkReadFilters applies the filter policies of reads: required filters
+// and, when enabled, the indexed filter heuristic
+func (h *Handler) checkReadFilters(tableName string, columns map[string]bool) error {
+	if err := checkRequiredFilters(tableName, columns); err != nil {
+		return err
+	}
+	return h.checkIndexedFilter(tableName, columns)
+}
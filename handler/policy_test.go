@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test reads and filtered deletes must filter on the required columns
+func TestRequiredFilters(t *testing.T) {
+	RequiredFilters["orders"] = []string{"tenant_id", "created_at"}
+	defer delete(RequiredFilters, "orders")
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		errMsg string
+	}{
+		{http.MethodGet, "/orders?tenant_id=eq.7&created_at=gte.2024-01-01", "", ""},
+		{http.MethodGet, "/orders?and=(tenant_id=eq.7,created_at=gte.2024-01-01)&select=id", "", ""},
+		{http.MethodGet, "/orders?tenant_id=eq.7", "", "queries on orders must filter on created_at"},
+		{http.MethodGet, "/orders?or=(tenant_id=eq.7,created_at=gte.2024-01-01)", "", "queries on orders must filter on tenant_id, created_at"},
+		{http.MethodGet, "/orders/aggregate?metrics=count(*)&created_at=gte.2024-01-01", "", "queries on orders must filter on tenant_id"},
+		{http.MethodGet, "/orders/export?tenant_id=eq.7", "", "queries on orders must filter on created_at"},
+		{http.MethodDelete, "/orders?status=eq.void", "", "queries on orders must filter on tenant_id, created_at"},
+		{http.MethodDelete, "/orders/1", "", ""},
+		{http.MethodPost, "/orders/query", `{"filter": {"and": [{"column": "tenant_id", "op": "eq", "value": 7}, {"column": "created_at", "op": "gte", "value": "2024-01-01"}]}}`, ""},
+		{http.MethodPost, "/orders/query", `{"filter": {"column": "tenant_id", "op": "eq", "value": 7}}`, "queries on orders must filter on created_at"},
+		{http.MethodGet, "/products", "", ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(tt.body)))
+		_, err := GetQL(req, "postgres")
+		if tt.errMsg == "" {
+			assert.NoError(t, err, tt.path)
+		} else {
+			assert.EqualError(t, err, tt.errMsg, tt.path)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// RawSQLConfig enables POST /_sql, which accepts a read-only SQL statement
+// for trusted internal tooling. Mount it behind authentication.
+type RawSQLConfig struct {
+	// Tables the statement may read
+	Tables []string
+	// MaxRows caps the result with a LIMIT; zero means query.MaxPageSize
+	MaxRows int
+}
+
+// RawSQL configures the raw SQL endpoint; nil disables it
+var RawSQL *RawSQLConfig
+
+// Build a guarded raw SQL query from a body like {"sql": "SELECT ..."}
+func rawSQLQuery(r *http.Request) (*utils.ReturnQuery, error) {
+	cfg := RawSQL
+	if cfg == nil {
+		return nil, fmt.Errorf("raw SQL is disabled")
+	}
+	if r.Method != http.MethodPost {
+		return nil, fmt.Errorf("method not allowed")
+	}
+
+	var body struct {
+		SQL string `json:"sql"`
+	}
+	raw, err := readLimitedBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, fmt.Errorf("invalid JSON format")
+	}
+
+	maxRows := cfg.MaxRows
+	if maxRows <= 0 {
+		maxRows = query.MaxPageSize
+	}
+	sql, err := query.GuardSQL(body.SQL, cfg.Tables, maxRows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &utils.ReturnQuery{Query: sql, Args: []any{}, ReadOnly: true}, nil
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the raw SQL endpoint is opt-in and guarded
+func TestRawSQL(t *testing.T) {
+	defer func(cfg *RawSQLConfig) { RawSQL = cfg }(RawSQL)
+
+	body := `{"sql": "SELECT region, SUM(amount) FROM orders GROUP BY region"}`
+	_, err := GetQL(httptest.NewRequest(http.MethodPost, "/_sql", strings.NewReader(body)), "postgres")
+	assert.EqualError(t, err, "raw SQL is disabled")
+
+	RawSQL = &RawSQLConfig{Tables: []string{"orders"}, MaxRows: 50}
+	query, err := GetQL(httptest.NewRequest(http.MethodPost, "/_sql", strings.NewReader(body)), "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT region, SUM(amount) FROM orders GROUP BY region LIMIT 50", query.Query)
+	assert.True(t, query.ReadOnly)
+
+	_, err = GetQL(httptest.NewRequest(http.MethodPost, "/_sql", strings.NewReader(`{"sql": "SELECT * FROM users"}`)), "postgres")
+	assert.EqualError(t, err, "table users is not allowed")
+
+	_, err = GetQL(httptest.NewRequest(http.MethodGet, "/_sql", nil), "postgres")
+	assert.EqualError(t, err, "method not allowed")
+}
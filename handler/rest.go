@@ -1,15 +1,22 @@
 package handler
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/The-ForgeBase/restql/jsonapi"
 	"github.com/The-ForgeBase/restql/query"
 	"github.com/The-ForgeBase/restql/utils"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Function to check if a value is boolean and needs `IS` or `=`
@@ -25,13 +32,166 @@ func isBoolean(val any) bool {
 }
 
 var (
-	DBType = "surrealdb"
+	// Schema holds table metadata keyed by table name. When a table is
+	// present, filters and write payloads are validated against it. Set it
+	// before serving, and replace it with SetSchema afterwards.
+	Schema = map[string]*utils.Table{}
+
+	// PostgRESTCompat makes requests follow PostgREST's grammar so PostgREST
+	// clients (supabase-js, postgrest-js) work unchanged: not./ilike/match/
+	// full-text filters, limit/offset and Range pagination, and
+	// Prefer: return=representation on writes
+	PostgRESTCompat = false
+
+	// ODataCompat translates OData v4 query options ($filter, $select,
+	// $orderby, $top, $skip) so OData consumers like Excel and Power BI can
+	// read tables
+	ODataCompat = false
+
+	// JSONAPICompat accepts JSON:API query parameters (fields[table], sort,
+	// page[number], page[size]) on every request. Without it they are only
+	// accepted when the client sends Accept: application/vnd.api+json.
+	JSONAPICompat = false
+
+	// TreeParentColumn is the self-referencing column walked by
+	// ?tree=descendants.of.42 and ?tree=ancestors.of.42
+	TreeParentColumn = "parent_id"
+
+	// TreeMaxDepth bounds how many levels a tree query walks, which also
+	// stops cycles
+	TreeMaxDepth = 10
+
+	// MaxPlaceholders is the most bind parameters each database accepts in
+	// one statement. Bulk inserts needing more are split into a batch.
+	MaxPlaceholders = map[string]int{
+		"postgres": 65535,
+		"mysql":    65535,
+		"sqlite":   32766,
+	}
+
+	// TableDefaults holds per table the select and order applied to reads
+	// that do not give their own, instead of * and id ASC
+	TableDefaults = map[string]TableDefault{}
 )
 
-// DynamicHandler handles dynamic routes like /products, /users, etc.
-func GetQL(r *http.Request, dbtype string) (*utils.ReturnQuery, error) {
+// TableDefault is a default projection and ordering for a table, in query
+// string syntax, e.g. TableDefault{Select: "!blob_data", Order: "created_at.desc"}
+type TableDefault struct {
+	Select string
+	Order  string
+}
+
+// applyTableDefaults fills in the configured select and order of a table
+// missing from queryParams
+func (h *Handler) applyTableDefaults(tableName string, queryParams url.Values) {
+	defaults, ok := h.tableDefault(tableName)
+	if !ok {
+		return
+	}
+	if defaults.Select != "" && !queryParams.Has("select") {
+		queryParams.Set("select", defaults.Select)
+	}
+	if defaults.Order != "" && !queryParams.Has("order") {
+		queryParams.Set("order", defaults.Order)
+	}
+}
+
+// filterOptions returns the filter parsing options for a table. OData
+// filters are translated into the PostgREST grammar for null checks and
+// string functions. Relative dates are evaluated in the zone given by the TZ
+// header or tz parameter, text compared in the collation of collate, and
+// numbers and dates read in the locale of localeTag.
+func (h *Handler) filterOptions(r *http.Request, tableName string) query.Options {
+	tz := r.Header.Get("TZ")
+	if tz == "" {
+		tz = r.URL.Query().Get("tz")
+	}
+	return query.Options{
+		DBType:    h.dbType,
+		Table:     h.tableMeta(tableName),
+		PostgREST: h.opts.PostgREST || h.opts.OData,
+		TimeZone:  tz,
+		Collate:   r.URL.Query().Get("collate"),
+		Locale:    h.localeTag(r),
+	}
+}
+
+// localeTag is the language tag numbers and dates of a request are written
+// in, from the Locale header or locale parameter, or Options.Locale
+func (h *Handler) localeTag(r *http.Request) string {
+	if tag := r.Header.Get("Locale"); tag != "" {
+		return tag
+	}
+	if tag := r.URL.Query().Get("locale"); tag != "" {
+		return tag
+	}
+	return h.opts.Locale
+}
+
+// locale looks up the locale of a request's body, nil when it has none
+func (h *Handler) locale(r *http.Request) (*utils.Locale, error) {
+	tag := h.localeTag(r)
+	if tag == "" {
+		return nil, nil
+	}
+	return utils.ParseLocale(tag)
+}
+
+// Params parses the query string of a request to a table in order,
+// translating OData or JSON:API parameters when those modes are in use
+func (h *Handler) Params(r *http.Request, tableName string) ([]query.Param, error) {
+	params, err := query.ParseParams(r.URL.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query string")
+	}
+	if h.opts.OData {
+		if params, err = query.ParseOData(params); err != nil {
+			return nil, err
+		}
+	}
+	if h.useJSONAPI(r) {
+		return jsonapi.TranslateParams(tableName, params)
+	}
+	return params, nil
+}
+
+// paramValues indexes parsed parameters by key
+func paramValues(params []query.Param) url.Values {
+	values := url.Values{}
+	for _, param := range params {
+		values.Add(param.Key, param.Value)
+	}
+	return values
+}
+
+// useJSONAPI reports whether the request uses JSON:API parameters
+func (h *Handler) useJSONAPI(r *http.Request) bool {
+	return h.opts.JSONAPI || jsonapi.Accepts(r)
+}
+
+// readBody reads a write payload, unwrapping JSON:API resource objects into
+// plain records
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := readLimitedBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if jsonapi.IsDocument(r) {
+		return jsonapi.Attributes(body)
+	}
+	return body, nil
+}
 
-	DBType = dbtype
+// GetQL builds the query of a request to a dynamic route like /products or
+// /users, failing with the error of its context once that is done
+func (h *Handler) GetQL(r *http.Request) (*utils.ReturnQuery, error) {
+	if err := r.Context().Err(); err != nil {
+		return nil, err
+	}
+	r, err := h.Unnest(r)
+	if err != nil {
+		return nil, err
+	}
 
 	// Extract the table name from the URL path
 	parts := strings.Split(r.URL.Path, "/")
@@ -45,153 +205,755 @@ func GetQL(r *http.Request, dbtype string) (*utils.ReturnQuery, error) {
 		return nil, fmt.Errorf("invalid table name")
 	}
 
+	ctx, span := h.startSpan(r, tableName)
+
+	// 2. Serve URL-only queries from the cache when enabled
+	cache := h.plans()
+	var key string
+	var params []query.Param
+	if cache != nil && h.cacheable(r, tableName) {
+		if params, err = h.Params(r, tableName); err == nil {
+			key = h.cacheKey(r, tableName, params)
+		}
+	}
+	if key != "" {
+		if p, ok := cache.get(key); ok {
+			if q, ok := h.bind(r, tableName, params, p); ok {
+				h.recordRead(r, tableName, q)
+				recordRequest(tableName, q, nil)
+				span.SetAttributes(attribute.Bool("restql.cache_hit", true))
+				h.endSpan(span, q, nil)
+				h.logQuery(ctx, r.Method, tableName, q, nil)
+				return q, nil
+			}
+		}
+	}
+
+	q, err := h.buildQuery(r, tableName)
+	h.endSpan(span, q, err)
+	h.logQuery(ctx, r.Method, tableName, q, err)
+	recordRequest(tableName, q, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != "" {
+		if p, ok := h.newPlan(r, tableName, params, q); ok {
+			cache.add(key, p)
+		}
+	}
+	h.recordRead(r, tableName, q)
+
+	return q, nil
+}
+
+// buildQuery dispatches the request to the builder for its method
+func (h *Handler) buildQuery(r *http.Request, tableName string) (*utils.ReturnQuery, error) {
+	switch tableName {
+	case "_query":
+		return namedQuery(r)
+	case "_sql":
+		return rawSQLQuery(r)
+	case "_union":
+		return h.unionQuery(r)
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		q, err := getRecords(r, tableName)
+		if isSubPath(r, "aggregate") {
+			return h.aggregateRecords(r, tableName)
+		}
+		if isSubPath(r, "export") {
+			return h.exportRecords(r, tableName)
+		}
+		if p, ok := h.partition(tableName); ok {
+			return h.partitionQuery(r, tableName, p)
+		}
+		return h.getRecords(r, tableName)
+	case http.MethodPost:
+		if isSubPath(r, "query") {
+			return h.queryRecords(r, tableName)
+		}
+		return h.insertRecord(r, tableName)
+	case http.MethodPut:
+		return h.updateRecord(r, tableName, true)
+	case http.MethodPatch:
+		return h.updateRecord(r, tableName, false)
+	case http.MethodDelete:
+		return h.deleteRecord(r, tableName)
+	default:
+		return nil, fmt.Errorf("method not allowed")
+	}
+}
+
+// isSubPath reports whether the request targets /{table}/{name}, like
+// /{table}/query or /{table}/aggregate
+func isSubPath(r *http.Request, name string) bool {
+	parts := strings.Split(r.URL.Path, "/")
+	return len(parts) == 3 && parts[2] == name
+}
+
+// Get records (supports filtering, pagination, sorting)
+func (h *Handler) getRecords(r *http.Request, tableName string) (*utils.ReturnQuery, error) {
+	// 1. Parse filters in the order they appear in the query string
+	params, err := h.Params(r, tableName)
+	if err != nil {
+		return nil, err
+	}
+	queryParams := paramValues(params)
+
+	// Grouped reads like ?group_by=day(created_at)&select=count(*) aggregate
+	if queryParams.Has("group_by") {
+		metrics, err := query.GroupByMetrics(queryParams.Get("select"), queryParams.Get("group_by"))
 		if err != nil {
 			return nil, err
 		}
-		return q, nil
-	case http.MethodPost:
-		q, err := insertRecord(r, tableName)
+		return h.aggregateQuery(r, tableName, params, queryParams, metrics, queryParams.Get("group_by"))
+	}
+	h.applyTableDefaults(tableName, queryParams)
+
+	if err := h.checkReadFilters(tableName, query.FilterColumns(params)); err != nil {
+		return nil, err
+	}
+	filterSQL, args, err := query.ParseFilters(params, h.filterOptions(r, tableName))
+	if err != nil {
+		return nil, err
+	}
+
+	// Search boxes like ?q=jo&q_columns=name,email match any of the columns
+	if queryParams.Has("q") {
+		search, searchArgs, err := query.ParseSearch(queryParams.Get("q"), queryParams.Get("q_columns"), queryParams.Get("q_mode"), h.filterOptions(r, tableName))
 		if err != nil {
 			return nil, err
 		}
-		return q, nil
-	case http.MethodPut:
-		q, err := updateRecord(r, tableName)
+		if filterSQL != "" {
+			filterSQL += " AND " + search
+		} else {
+			filterSQL = search
+		}
+		args = append(args, searchArgs...)
+	}
+
+	// Live queries stream changes instead of returning a page of rows
+	if queryParams.Get("live") == "true" {
+		return h.liveQuery(tableName, filterSQL, args)
+	}
+
+	// Existence checks return a single boolean instead of rows
+	if queryParams.Get("exists") == "true" {
+		return h.existsQuery(tableName, filterSQL, args), nil
+	}
+
+	// Quick stats like ?stats=min(price),max(price) summarize the filtered
+	// rows in a second query, returned alone with stats_only=true
+	var stats *utils.ReturnQuery
+	if queryParams.Has("stats") {
+		if stats, err = h.statsQuery(tableName, queryParams.Get("stats"), filterSQL, args); err != nil {
+			return nil, err
+		}
+		if queryParams.Get("stats_only") == "true" {
+			return stats, nil
+		}
+	}
+
+	// 2. Handle pagination
+	limit, offset := h.pagination(r, queryParams)
+
+	// 3. Handle sorting, including random order
+	orderSQL, random, err := query.ParseRandomOrder(queryParams.Get("order"), h.dbType)
+	if err != nil {
+		return nil, err
+	}
+	if !random {
+		if orderSQL, err = query.ParseCollatedOrder(queryParams.Get("order"), h.filterOptions(r, tableName)); err != nil {
+			return nil, err
+		}
+	}
+
+	if orderSQL == "" {
+		orderSQL = "ORDER BY id ASC"
+	}
+
+	// 4. Handle column selection
+	columns, err := query.ParseSelect(queryParams.Get("select"), h.tableMeta(tableName))
+	if err != nil {
+		return nil, err
+	}
+
+	// 5. Handle sampling a percentage of rows
+	from := tableName
+	if queryParams.Has("sample") {
+		tablesample, condition, err := query.ParseSample(queryParams.Get("sample"), h.dbType)
 		if err != nil {
 			return nil, err
 		}
-		return q, nil
-	case http.MethodDelete:
-		q, err := deleteRecord(r, tableName)
+		if tablesample != "" {
+			from += " " + tablesample
+		}
+		if condition != "" && filterSQL != "" {
+			filterSQL += " AND " + condition
+		} else if condition != "" {
+			filterSQL = condition
+		}
+	}
+
+	// 6. Page by the pagination strategy, counting every filtered row for
+	// the total. Trees and groups keep their own pages.
+	var page *utils.Page
+	if h.opts.Pagination != "" && !queryParams.Has("tree") && !queryParams.Has("per_group") {
+		read, err := h.paginate(tableName, queryParams, columns, orderSQL, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		if read.page.Count, err = h.statsQuery(tableName, "count(*)", filterSQL, args); err != nil {
+			return nil, err
+		}
+		if read.seek != "" {
+			if filterSQL != "" {
+				filterSQL = "(" + filterSQL + ") AND "
+			}
+			filterSQL += read.seek
+			args = append(args, read.arg)
+		}
+		offset = read.offset
+		page = read.page
+	}
+
+	// 7. Build dynamic SQL query, walking a tree for ?tree=descendants.of.42
+	// or keeping the first rows of each group for ?per_group=category:3
+	var sql string
+	switch {
+	case queryParams.Has("tree"):
+		if !queryParams.Has("order") {
+			orderSQL = "ORDER BY depth ASC, id ASC"
+		}
+		var treeArgs []interface{}
+		sql, treeArgs, err = h.treeSQL(queryParams.Get("tree"), tableName, columns, filterSQL, orderSQL, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		args = append(treeArgs, args...)
+	case queryParams.Has("per_group"):
+		sql, err = h.perGroupSQL(queryParams.Get("per_group"), tableName, from, columns, filterSQL, orderSQL, limit, offset)
 		if err != nil {
 			return nil, err
 		}
-		return q, nil
 	default:
-		return nil, fmt.Errorf("method not allowed")
+		sql = h.selectSQL(from, columns, filterSQL, orderSQL, limit, offset)
 	}
+
+	// 8. Return the query and args
+	query := utils.ReturnQuery{Query: sql, Args: args, Table: tableName, ReadOnly: true, Stats: stats, Page: page}
+
+	return &query, nil
 }
 
-// Get records (supports filtering, pagination, sorting)
-func getRecords(r *http.Request, tableName string) (*utils.ReturnQuery, error) {
-	queryParams := r.URL.Query()
+// Aggregate records, e.g. ?metrics=sum(amount),count(*)&dimensions=region,
+// month(created_at), with the same filters and pagination as a GET
+func (h *Handler) aggregateRecords(r *http.Request, tableName string) (*utils.ReturnQuery, error) {
+	params, err := h.Params(r, tableName)
+	if err != nil {
+		return nil, err
+	}
+	queryParams := paramValues(params)
 
-	// 1. Parse filters
-	filterSQL, args := query.ParseFilters(queryParams, DBType)
+	return h.aggregateQuery(r, tableName, params, queryParams, queryParams.Get("metrics"), queryParams.Get("dimensions"))
+}
 
-	// 2. Handle pagination
-	page := queryParams.Get("page")
-	pageSize := queryParams.Get("page_size")
+// aggregateQuery builds a GROUP BY query of metrics over dimensions
+func (h *Handler) aggregateQuery(r *http.Request, tableName string, params []query.Param, queryParams url.Values, metrics, dimensions string) (*utils.ReturnQuery, error) {
+	// 1. Parse metrics and dimensions
+	agg, err := query.ParseAggregate(metrics, dimensions, h.dbType, h.tableMeta(tableName))
+	if err != nil {
+		return nil, err
+	}
 
-	if page == "" {
-		page = "1"
+	// 2. Parse filters, skipping the aggregation parameters
+	filters := make([]query.Param, 0, len(params))
+	for _, param := range params {
+		if param.Key != "metrics" && param.Key != "dimensions" {
+			filters = append(filters, param)
+		}
+	}
+	if err := h.checkReadFilters(tableName, query.FilterColumns(filters)); err != nil {
+		return nil, err
+	}
+	filterSQL, args, err := query.ParseFilters(filters, h.filterOptions(r, tableName))
+	if err != nil {
+		return nil, err
 	}
 
-	if pageSize == "" {
-		pageSize = "100"
+	// 3. Sort by output columns, defaulting to the dimensions
+	order := queryParams.Get("order")
+	for _, part := range strings.Split(order, ",") {
+		if column, _, _ := strings.Cut(part, "."); order != "" && !slices.Contains(agg.Aliases, column) {
+			return nil, fmt.Errorf("cannot order by %s: not a metric or dimension", column)
+		}
+	}
+	orderSQL, err := query.ParseOrder(order)
+	if err != nil {
+		return nil, err
 	}
 
-	limit, offset := query.ParsePagination(page, pageSize)
+	sql := fmt.Sprintf("SELECT %s FROM %s", agg.Select, tableName)
+	if filterSQL != "" {
+		sql += " WHERE " + filterSQL
+	}
+	if agg.GroupBy != "" {
+		sql += " GROUP BY " + agg.GroupBy
+		if orderSQL == "" {
+			orderSQL = "ORDER BY " + agg.GroupBy
+		}
+	}
+	if orderSQL != "" {
+		sql += " " + orderSQL
+	}
 
-	// 3. Handle sorting
-	orderSQL := query.ParseOrder(queryParams.Get("order"))
+	limit, offset := h.pagination(r, queryParams)
+	if h.dbType == "surrealdb" {
+		sql += fmt.Sprintf(" LIMIT %d START %d", limit, offset)
+	} else {
+		sql += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	}
+
+	return &utils.ReturnQuery{Query: sql, Args: args, Table: tableName, ReadOnly: true}, nil
+}
 
+// treeSQL walks a self-referencing table from a row with a recursive CTE.
+// Rows carry their distance from the starting row as depth, and filters and
+// ordering apply to the rows found.
+func (h *Handler) treeSQL(tree, tableName, columns, filterSQL, orderSQL string, limit, offset int) (string, []interface{}, error) {
+	if h.dbType == "surrealdb" {
+		return "", nil, fmt.Errorf("tree is not supported on surrealdb")
+	}
+
+	direction, id, err := query.ParseTree(tree)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := utils.ValidateColumnName(TreeParentColumn); err != nil {
+		return "", nil, err
+	}
+
+	parent := TreeParentColumn
+
+	// Start from the row's children (or parent), then follow the same link
+	start := fmt.Sprintf("SELECT %s.*, 1 AS depth FROM %s WHERE %s = ?", tableName, tableName, parent)
+	join := fmt.Sprintf("%s.%s = tree.id", tableName, parent)
+	if direction == "ancestors" {
+		start = fmt.Sprintf("SELECT %s.*, 1 AS depth FROM %s WHERE id = (SELECT %s FROM %s WHERE id = ?)", tableName, tableName, parent, tableName)
+		join = fmt.Sprintf("%s.id = tree.%s", tableName, parent)
+	}
+
+	sql := fmt.Sprintf("WITH RECURSIVE tree AS (%s UNION ALL SELECT %s.*, tree.depth + 1 FROM %s JOIN tree ON %s WHERE tree.depth < %d) SELECT %s FROM tree",
+		start, tableName, tableName, join, TreeMaxDepth, columns)
+	if filterSQL != "" {
+		sql += " WHERE " + filterSQL
+	}
+	sql += fmt.Sprintf(" %s LIMIT %d OFFSET %d", orderSQL, limit, offset)
+
+	return sql, []interface{}{id}, nil
+}
+
+// perGroupSQL numbers the rows of each group with ROW_NUMBER in the order of
+// orderSQL and keeps the first count, exposing the number as group_rank
+func (h *Handler) perGroupSQL(perGroup, tableName, from, columns, filterSQL, orderSQL string, limit, offset int) (string, error) {
+	if h.dbType == "surrealdb" {
+		return "", fmt.Errorf("per_group is not supported on surrealdb")
+	}
+
+	column, count, err := query.ParsePerGroup(perGroup, h.tableMeta(tableName))
+	if err != nil {
+		return "", err
+	}
+
+	inner := fmt.Sprintf("SELECT %s.*, ROW_NUMBER() OVER (PARTITION BY %s %s) AS group_rank FROM %s", tableName, column, orderSQL, from)
+	if filterSQL != "" {
+		inner += " WHERE " + filterSQL
+	}
+
+	return fmt.Sprintf("SELECT %s FROM (%s) AS ranked WHERE group_rank <= %d ORDER BY %s, group_rank LIMIT %d OFFSET %d",
+		columns, inner, count, column, limit, offset), nil
+}
+
+// selectSQL builds a paginated SELECT in the syntax of the database type
+func (h *Handler) selectSQL(tableName, columns, filterSQL, orderSQL string, limit, offset int) string {
+	where := ""
+	if filterSQL != "" {
+		where = " WHERE " + filterSQL
+	}
+
+	if h.dbType == "surrealdb" {
+		return fmt.Sprintf("SELECT %s FROM %s%s %s LIMIT %d START %d", columns, tableName, where, orderSQL, limit, offset)
+	}
+	return fmt.Sprintf("SELECT %s FROM %s%s %s LIMIT %d OFFSET %d", columns, tableName, where, orderSQL, limit, offset)
+}
+
+// queryBody is the body of POST /{table}/query, the JSON equivalent of a GET
+// for queries that do not fit in a URL
+type queryBody struct {
+	Filter   *query.Filter `json:"filter"`
+	Select   []string      `json:"select"`
+	Order    []string      `json:"order"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Limit    *int          `json:"limit"`
+	Offset   *int          `json:"offset"`
+}
+
+// Query records with a JSON body, e.g.
+// {"filter": {"or": [...]}, "select": ["id"], "order": ["price.desc"]}
+func (h *Handler) queryRecords(r *http.Request, tableName string) (*utils.ReturnQuery, error) {
+	raw, err := readLimitedBody(r)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var body queryBody
+	if err := dec.Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid JSON format")
+	}
+
+	// 1. Parse the filter tree
+	filtered := map[string]bool{}
+	if body.Filter != nil {
+		filtered = body.Filter.Columns()
+	}
+	if err := h.checkReadFilters(tableName, filtered); err != nil {
+		return nil, err
+	}
+	filterSQL, args := "", []interface{}{}
+	if body.Filter != nil {
+		filterSQL, args, err = query.ParseFilter(*body.Filter, h.filterOptions(r, tableName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. Handle pagination
+	limit, offset := query.ParsePagination(strconv.Itoa(body.Page), strconv.Itoa(body.PageSize))
+	if body.Limit != nil || body.Offset != nil {
+		limit, offset = query.ParseLimitOffset(intString(body.Limit), intString(body.Offset))
+	}
+
+	// 3. Handle sorting
+	if defaults, _ := h.tableDefault(tableName); len(body.Order) == 0 && defaults.Order != "" {
+		body.Order = []string{defaults.Order}
+	}
+	orderSQL, err := query.ParseOrder(strings.Join(body.Order, ","))
+	if err != nil {
+		return nil, err
+	}
 	if orderSQL == "" {
 		orderSQL = "ORDER BY id ASC"
 	}
 
-	// 4. Build dynamic SQL query
-	sql := ""
+	// 4. Handle column selection
+	if defaults, _ := h.tableDefault(tableName); len(body.Select) == 0 && defaults.Select != "" {
+		body.Select = []string{defaults.Select}
+	}
+	columns, err := query.ParseSelect(strings.Join(body.Select, ","), h.tableMeta(tableName))
+	if err != nil {
+		return nil, err
+	}
+
+	sql := h.selectSQL(tableName, columns, filterSQL, orderSQL, limit, offset)
+	return &utils.ReturnQuery{Query: sql, Args: args, Table: tableName, ReadOnly: true}, nil
+}
 
-	if filterSQL != "" {
-		sql = fmt.Sprintf("SELECT * FROM %s WHERE %s %s LIMIT %d OFFSET %d", tableName, filterSQL, orderSQL, limit, offset)
+func intString(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
 
-		if DBType == "surrealdb" {
-			sql = fmt.Sprintf("SELECT * FROM %s WHERE %s %s LIMIT %d START %d", tableName, filterSQL, orderSQL, limit, offset)
+// pagination returns the LIMIT and OFFSET for a GET. page/page_size are
+// always accepted; in PostgREST mode a Range header or limit/offset take
+// precedence, and in OData mode $top/$skip do.
+func (h *Handler) pagination(r *http.Request, queryParams url.Values) (limit, offset int) {
+	if h.opts.PostgREST {
+		if limit, offset, ok := query.ParseRange(r.Header.Get("Range")); ok {
+			return limit, offset
 		}
-	} else {
-		sql = fmt.Sprintf("SELECT * FROM %s %s LIMIT %d OFFSET %d", tableName, orderSQL, limit, offset)
+	}
+	if h.opts.PostgREST || h.opts.OData {
+		if queryParams.Has("limit") || queryParams.Has("offset") {
+			return query.ParseLimitOffset(queryParams.Get("limit"), queryParams.Get("offset"))
+		}
+	}
+
+	return query.ParsePagination(queryParams.Get("page"), queryParams.Get("page_size"))
+}
+
+// returning appends RETURNING * to a write when a PostgREST client asks for
+// the affected rows with Prefer: return=representation. SurrealDB returns
+// them by default, and MySQL has no RETURNING, so the preference is ignored
+// there as RFC 7240 allows. SQLite supports it from 3.35.
+func (h *Handler) returning(r *http.Request, sql string) string {
+	if h.wantsRepresentation(r) {
+		return sql + " RETURNING *"
+	}
+	return sql
+}
 
-		if DBType == "surrealdb" {
-			sql = fmt.Sprintf("SELECT * FROM %s %s LIMIT %d START %d", tableName, orderSQL, limit, offset)
+// wantsRepresentation reports whether RETURNING * applies to a write
+func (h *Handler) wantsRepresentation(r *http.Request) bool {
+	if !h.opts.PostgREST || h.dbType == "surrealdb" || h.dbType == "mysql" {
+		return false
+	}
+	for _, prefer := range r.Header.Values("Prefer") {
+		for _, p := range strings.Split(prefer, ",") {
+			if strings.TrimSpace(p) == "return=representation" {
+				return true
+			}
 		}
 	}
+	return false
+}
 
-	// 5. Return the query and args
-	query := utils.ReturnQuery{Query: sql, Args: args}
+// Build a query returning whether any row matches the filters, stopping at
+// the first one
+func (h *Handler) existsQuery(tableName, filterSQL string, args []interface{}) *utils.ReturnQuery {
+	where := ""
+	if filterSQL != "" {
+		where = " WHERE " + filterSQL
+	}
 
-	return &query, nil
+	sql := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s%s)", tableName, where)
+	if h.dbType == "surrealdb" {
+		sql = fmt.Sprintf("RETURN array::len((SELECT id FROM %s%s LIMIT 1)) > 0", tableName, where)
+	}
+	return &utils.ReturnQuery{Query: sql, Args: args, Table: tableName, ReadOnly: true}
+}
+
+// Build a single-row summary of the filtered rows, e.g. ?stats=avg(price)
+// selects AVG(price) AS avg_price
+func (h *Handler) statsQuery(tableName, stats, filterSQL string, args []interface{}) (*utils.ReturnQuery, error) {
+	agg, err := query.ParseAggregate(stats, "", h.dbType, h.tableMeta(tableName))
+	if err != nil {
+		return nil, err
+	}
+
+	sql := fmt.Sprintf("SELECT %s FROM %s", agg.Select, tableName)
+	if filterSQL != "" {
+		sql += " WHERE " + filterSQL
+	}
+	if h.dbType == "surrealdb" {
+		sql += " GROUP ALL"
+	}
+	return &utils.ReturnQuery{Query: sql, Args: args, Table: tableName, ReadOnly: true}, nil
+}
+
+// Build a SurrealDB LIVE SELECT from the same filters as a GET. Running it
+// returns the live query UUID used to receive notifications over SurrealDB's
+// websocket protocol. LIVE SELECT supports neither ORDER BY nor LIMIT.
+func (h *Handler) liveQuery(tableName, filterSQL string, args []interface{}) (*utils.ReturnQuery, error) {
+	if h.dbType != "surrealdb" {
+		return nil, fmt.Errorf("live queries are only supported on surrealdb")
+	}
+
+	sql := fmt.Sprintf("LIVE SELECT * FROM %s", tableName)
+	if filterSQL != "" {
+		sql = fmt.Sprintf("LIVE SELECT * FROM %s WHERE %s", tableName, filterSQL)
+	}
+
+	// Not ReadOnly: the result is a subscription id, which must never be
+	// cached or served from a replica like rows are
+	return &utils.ReturnQuery{Query: sql, Args: args, Table: tableName}, nil
 }
 
 // Insert, update, and delete records with bulk support
-func insertRecord(r *http.Request, tableName string) (*utils.ReturnQuery, error) {
-	body, err := io.ReadAll(r.Body)
+func (h *Handler) insertRecord(r *http.Request, tableName string) (*utils.ReturnQuery, error) {
+	body, err := readBody(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read request body: %v", err)
+		return nil, err
 	}
 
-	// 1. Parse the JSON body (can be a single record or a list of records)
+	// 1. Parse the JSON body (can be a single record or a list of records),
+	// keeping the key order so columns follow the body. CSV bodies name
+	// the columns in their header row, and form bodies hold one record.
+	// Numbers and dates may be written in the request's locale.
+	locale, err := h.locale(r)
+	if err != nil {
+		return nil, err
+	}
 	var records []map[string]interface{}
-	if err := json.Unmarshal(body, &records); err != nil {
-		// If it fails, try to unmarshal it as a single record
-		var singleRecord map[string]interface{}
-		if err := json.Unmarshal(body, &singleRecord); err != nil {
+	var order []string
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case isCSV(r):
+		if records, order, err = utils.DecodeCSV(body, h.tableMeta(tableName), locale); err != nil {
+			return nil, err
+		}
+	case utils.IsForm(contentType):
+		record, keys, err := utils.DecodeForm(body, contentType, h.tableMeta(tableName), locale)
+		if err != nil {
+			return nil, err
+		}
+		records, order = []map[string]interface{}{record}, keys
+	default:
+		if records, order, err = utils.DecodeRecords(body); err != nil {
 			return nil, fmt.Errorf("invalid JSON format")
 		}
-		records = append(records, singleRecord)
+		for _, record := range records {
+			locale.Record(h.tableMeta(tableName), record)
+			utils.DecodeInts(h.tableMeta(tableName), record)
+		}
 	}
 
 	if len(records) == 0 {
 		return nil, fmt.Errorf("no records to insert")
 	}
+	if err := checkRecords(len(records)); err != nil {
+		return nil, err
+	}
+	if err := fillParent(r, records); err != nil {
+		return nil, err
+	}
 
-	// 2. Build column names and placeholders
-	columns, placeholders, values := query.BuildInsertQueryParts(records)
+	// ?columns= fixes the column list, so records may omit keys
+	var insertColumns []string
+	if columnsParam := r.URL.Query().Get("columns"); columnsParam != "" {
+		if insertColumns, err = h.parseInsertColumns(columnsParam, tableName); err != nil {
+			return nil, err
+		}
+	}
 
-	// 3. Construct the SQL query for bulk insert
-	var sql string
-	if len(records) == 1 {
-		sql = fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", tableName, columns, placeholders[0])
-	} else {
-		sql = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, columns, strings.Join(placeholders, ", "))
-	}
-
-	// fmt.Println(sql)
-
-	if DBType == "surrealdb" {
-		// sample insert query
-		// 		INSERT INTO planet [
-		// 	{
-		// 		name: 'Venus',
-		//         surface_temp: 462,
-		//         temp_55_km_up: 27
-		// 	},
-		// 	{
-		// 		name: 'Earth',
-		//         surface_temp: 15,
-		//         temp_55_km_up: -55
-		// 	}
-		// ]
-		// TODO: improve for single record, currently default to bulk insert
-		body := records // No need to append, just use records directly
-		bodyJSON, err := json.Marshal(body)
-		if err != nil {
-			return nil, err // Handle error appropriately
+	for _, record := range records {
+		utils.StripReadOnlyColumns(h.tableMeta(tableName), record)
+		if insertColumns != nil {
+			for key := range record {
+				if !slices.Contains(insertColumns, key) {
+					delete(record, key)
+				}
+			}
+		} else if len(record) == 0 {
+			return nil, fmt.Errorf("no writable fields to insert")
+		}
+		if err := utils.ValidateRecord(h.tableMeta(tableName), record); err != nil {
+			return nil, err
 		}
-		sql = fmt.Sprintf("INSERT INTO %s %s", tableName, bodyJSON)
+	}
+	if err := validateRecords(tableName, records); err != nil {
+		return nil, err
+	}
+
+	// 2. Build column names and placeholders. Records may have different
+	// keys, in which case the gaps take the column default.
+	if insertColumns == nil {
+		insertColumns = query.InsertColumns(records, order)
+	}
+	if h.dbType == "sqlite" {
+		if err := checkMissingColumns(records, insertColumns); err != nil {
+			return nil, err
+		}
+	}
+
+	if h.dbType == "surrealdb" {
+		// The records are bound as one $data variable, e.g.
+		// INSERT INTO planet $data with $data = [{name: 'Venus'}, ...],
+		// keeping their types
+		data := sql.Named("data", records)
+		return &utils.ReturnQuery{Query: fmt.Sprintf("INSERT INTO %s $data", tableName), Args: []any{data}, Table: tableName}, nil
+	}
+
+	// Large loads on Postgres go through COPY instead
+	if h.useCopy(r, len(records)) {
+		return h.copyLoad(tableName, records, insertColumns)
+	}
+
+	// 3. Construct the SQL query for bulk insert, split into a batch of
+	// statements when the rows need more placeholders than the database
+	// allows in one
+	chunkSize := len(records)
+	if limit := MaxPlaceholders[h.dbType]; limit > 0 && len(records)*len(insertColumns) > limit {
+		chunkSize = max(limit/len(insertColumns), 1)
+	}
+
+	batch := []utils.ReturnQuery{}
+	for chunk := range slices.Chunk(records, chunkSize) {
+		columns, placeholders, values := query.BuildInsertColumnsQueryParts(chunk, insertColumns)
+		sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", tableName, columns, strings.Join(placeholders, ", "))
+		batch = append(batch, utils.ReturnQuery{Query: h.returning(r, sql), Args: values, Table: tableName})
 	}
 
 	// 4. Return the query and args
-	return &utils.ReturnQuery{Query: sql, Args: values}, nil
+	result := batch[0]
+	if len(batch) > 1 {
+		result.Batch = batch
+	}
+	return &result, nil
+}
+
+// isCSV reports whether the request body is CSV
+func isCSV(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "text/csv"
 }
 
-func updateRecord(r *http.Request, tableName string) (*utils.ReturnQuery, error) {
-	body, err := io.ReadAll(r.Body)
+// parseInsertColumns parses ?columns=name,price, validated against the table
+// metadata when it is known. Generated and identity columns are dropped so
+// the database computes them.
+func (h *Handler) parseInsertColumns(columnsParam, tableName string) ([]string, error) {
+	columns := []string{}
+	for _, column := range strings.Split(columnsParam, ",") {
+		column = strings.TrimSpace(column)
+		if err := utils.ValidateColumnName(column); err != nil {
+			return nil, err
+		}
+		if table := h.tableMeta(tableName); table != nil {
+			col, ok := table.Column(column)
+			if !ok {
+				return nil, fmt.Errorf("unknown column %s", column)
+			}
+			if col.ReadOnly() {
+				continue
+			}
+		}
+		if !slices.Contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no writable fields to insert")
+	}
+	return columns, nil
+}
+
+// checkMissingColumns reports, for each record, the columns it lacks. SQLite
+// has no DEFAULT keyword in VALUES, so it cannot fill the gaps.
+func checkMissingColumns(records []map[string]interface{}, columns []string) error {
+	problems := []string{}
+	for i, record := range records {
+		missing := []string{}
+		for _, column := range columns {
+			if _, ok := record[column]; !ok {
+				missing = append(missing, column)
+			}
+		}
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("record %d is missing %s", i, strings.Join(missing, ", ")))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("records have different columns: %s", strings.Join(problems, "; "))
+}
+
+// Update a record by primary key. Only the keys present in the body are
+// set, so omitted columns keep their values while an explicit null sets the
+// column to NULL. A replace (PUT) must set every writable column without a
+// default when the table metadata is known, while a merge (PATCH) may set
+// any of them.
+func (h *Handler) updateRecord(r *http.Request, tableName string, replace bool) (*utils.ReturnQuery, error) {
+	body, err := readBody(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read request body: %v", err)
+		return nil, err
 	}
 
 	// Extract the primary key from the URL path (e.g., /products/1)
@@ -201,40 +963,107 @@ func updateRecord(r *http.Request, tableName string) (*utils.ReturnQuery, error)
 	}
 	primaryKey := parts[2]
 
-	// 1. Parse the JSON body (can be a single update or multiple updates)
+	// 1. Parse the JSON or form body, reading numbers and dates in the
+	// request's locale
+	locale, err := h.locale(r)
+	if err != nil {
+		return nil, err
+	}
 	var updates map[string]interface{}
-	if err := json.Unmarshal(body, &updates); err != nil {
+	var order []string
+	if contentType := r.Header.Get("Content-Type"); utils.IsForm(contentType) {
+		if updates, order, err = utils.DecodeForm(body, contentType, h.tableMeta(tableName), locale); err != nil {
+			return nil, err
+		}
+	} else if updates, order, err = utils.DecodeObject(body); err != nil {
 		return nil, fmt.Errorf("invalid JSON format")
 	}
+	locale.Record(h.tableMeta(tableName), updates)
+	utils.DecodeInts(h.tableMeta(tableName), updates)
+
+	utils.StripReadOnlyColumns(h.tableMeta(tableName), updates)
 
 	if len(updates) == 0 {
 		return nil, fmt.Errorf("no fields to update")
 	}
 
-	// 2. Build the SET clause
-	setClause, values := query.BuildUpdateQueryParts(updates)
-
-	// 3. Construct the SQL query for update
-	sql := fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", tableName, setClause)
+	if err := utils.ValidateRecord(h.tableMeta(tableName), updates); err != nil {
+		return nil, err
+	}
+	if err := validateRecords(tableName, []map[string]any{updates}); err != nil {
+		return nil, err
+	}
+	if replace {
+		if err := h.checkReplaceColumns(tableName, updates); err != nil {
+			return nil, err
+		}
+	}
 
-	if DBType == "surrealdb" {
-		// NOTE: surrealdb does not support bulk update
-		body := updates // No need to append, just use records directly
-		bodyJSON, err := json.Marshal(body)
+	if h.dbType == "surrealdb" {
+		// NOTE: surrealdb does not support bulk update. The changes are
+		// bound as a $data variable, replacing the record's content on PUT.
+		record, err := surrealRecord(tableName, primaryKey)
 		if err != nil {
-			return nil, err // Handle error appropriately
+			return nil, err
 		}
-		sql = fmt.Sprintf("UPDATE %s:%s MERGE %s", tableName, primaryKey, bodyJSON)
+		data := sql.Named("data", updates)
+		clause := "MERGE"
+		if replace {
+			clause = "CONTENT"
+		}
+		return &utils.ReturnQuery{Query: fmt.Sprintf("UPDATE %s %s $data", record, clause), Args: []any{data}, Table: tableName}, nil
 	}
 
+	// 2. Build the SET clause
+	setClause, values := query.BuildUpdateQueryParts(updates, order)
+
+	// 3. Construct the SQL query for update
+	sql := fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", tableName, setClause)
+
 	// 4. Append the primary key to the query args
 	values = append(values, primaryKey)
 
 	// 5. Return the query and args
-	return &utils.ReturnQuery{Query: sql, Args: values}, nil
+	return &utils.ReturnQuery{Query: h.returning(r, sql), Args: values, Table: tableName}, nil
 }
 
-func deleteRecord(r *http.Request, tableName string) (*utils.ReturnQuery, error) {
+// surrealRecordID matches the record ids written without escaping in
+// SurrealQL, like 1 or tobie
+var surrealRecordID = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// surrealRecord renders the record table:id of a path id. Ids are pasted
+// into the query, so only plain ids are accepted.
+func surrealRecord(tableName, id string) (string, error) {
+	if !surrealRecordID.MatchString(id) {
+		return "", fmt.Errorf("invalid record id %q", id)
+	}
+	return tableName + ":" + id, nil
+}
+
+// checkReplaceColumns reports the writable columns without a default that a
+// replacing update lacks. The primary key comes from the path.
+func (h *Handler) checkReplaceColumns(tableName string, record map[string]any) error {
+	table := h.tableMeta(tableName)
+	if table == nil {
+		return nil
+	}
+
+	missing := []string{}
+	for _, column := range table.Columns {
+		if column.ReadOnly() || column.Default || column.Name == "id" {
+			continue
+		}
+		if _, ok := record[column.Name]; !ok {
+			missing = append(missing, column.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("PUT replaces the whole record and is missing %s: use PATCH to update some columns", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (h *Handler) deleteRecord(r *http.Request, tableName string) (*utils.ReturnQuery, error) {
 	// Extract the primary key from the URL path (e.g., /products/1)
 	parts := strings.Split(r.URL.Path, "/")
 
@@ -244,25 +1073,38 @@ func deleteRecord(r *http.Request, tableName string) (*utils.ReturnQuery, error)
 	}
 
 	// Parse filters from query string for bulk delete
-	queryParams := r.URL.Query()
-	filterSQL, args := query.ParseFilters(queryParams, DBType)
+	params, err := h.Params(r, tableName)
+	if err != nil {
+		return nil, err
+	}
+	filterSQL, args, err := query.ParseFilters(params, h.filterOptions(r, tableName))
+	if err != nil {
+		return nil, err
+	}
 
 	// 1. If a primary key is provided, delete only that specific record
 	if primaryKey != "" {
 		sql := fmt.Sprintf("DELETE FROM %s WHERE id = ?", tableName)
-		if DBType == "surrealdb" {
-			sql = fmt.Sprintf("DELETE %s:%s", tableName, primaryKey)
+		if h.dbType == "surrealdb" {
+			record, err := surrealRecord(tableName, primaryKey)
+			if err != nil {
+				return nil, err
+			}
+			sql = "DELETE " + record
 		}
-		return &utils.ReturnQuery{Query: sql, Args: []interface{}{primaryKey}}, nil
+		return &utils.ReturnQuery{Query: h.returning(r, sql), Args: []interface{}{primaryKey}, Table: tableName}, nil
 	}
 
 	// 2. If query filters are present, build the WHERE clause
+	if err := checkRequiredFilters(tableName, query.FilterColumns(params)); err != nil {
+		return nil, err
+	}
 	if filterSQL != "" {
 		sql := fmt.Sprintf("DELETE FROM %s WHERE %s", tableName, filterSQL)
-		if DBType == "surrealdb" {
+		if h.dbType == "surrealdb" {
 			sql = fmt.Sprintf("DELETE %s WHERE %s", tableName, filterSQL)
 		}
-		return &utils.ReturnQuery{Query: sql, Args: args}, nil
+		return &utils.ReturnQuery{Query: h.returning(r, sql), Args: args, Table: tableName}, nil
 	}
 
 	// 3. If no filters and no primary key, return an error
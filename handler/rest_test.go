@@ -2,12 +2,19 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/The-ForgeBase/restql/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,7 +30,7 @@ func TestGetQL(t *testing.T) {
 	}{
 		{"missing table name", http.MethodGet, "/", nil, true, "table name required"},
 		{"invalid table name", http.MethodGet, "/123invalidTable", nil, true, "invalid table name"},
-		{"method not allowed", http.MethodPatch, "/products", nil, true, "method not allowed"},
+		{"method not allowed", http.MethodOptions, "/products", nil, true, "method not allowed"},
 		{"valid GET request", http.MethodGet, "/products", nil, false, ""},
 	}
 
@@ -40,6 +47,15 @@ func TestGetQL(t *testing.T) {
 	}
 }
 
+// Test no query is built for a request whose context is done
+func TestGetQLCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/products", nil).WithContext(ctx)
+	_, err := GetQL(req, "postgres")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
 // Test getRecords function with filters and pagination
 func TestGetRecords(t *testing.T) {
 	tests := []struct {
@@ -66,12 +82,24 @@ func TestGetRecords(t *testing.T) {
 			"SELECT * FROM products WHERE (level < ? OR hidden = ?) ORDER BY id ASC LIMIT 100 START 0",
 			[]interface{}{int64(2), false},
 		},
+		{
+			"nested OR inside AND",
+			"/products?and=(level=lt.2,or=(hidden=is.false,price=gt.5))",
+			"SELECT * FROM products WHERE (level < ? AND (hidden = ? OR price > ?)) ORDER BY id ASC LIMIT 100 START 0",
+			[]interface{}{int64(2), false, int64(5)},
+		},
 		{
 			"pagination and sorting",
 			"/products?page=2&page_size=10&order=level.asc",
 			"SELECT * FROM products ORDER BY level ASC LIMIT 10 START 10",
 			[]interface{}{},
 		},
+		{
+			"column selection with alias",
+			"/products?select=id,title:name&level=gt.5",
+			"SELECT id, name AS title FROM products WHERE level > ? ORDER BY id ASC LIMIT 100 START 0",
+			[]interface{}{int64(5)},
+		},
 		{
 			"filter with sorting",
 			"/products?level=gt.5&order=price.desc",
@@ -83,7 +111,7 @@ func TestGetRecords(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, tt.query, nil)
-			query, err := getRecords(req, "products")
+			query, err := New("surrealdb", Options{}).getRecords(req, "products")
 			assert.NoError(t, err)
 			assert.Equal(t, tt.expectedSQL, query.Query)
 			assert.Equal(t, tt.expectedArgs, query.Args)
@@ -106,8 +134,8 @@ func TestInsertRecord(t *testing.T) {
 			map[string]interface{}{"name": "Product1", "price": float64(100)},
 			false,
 			"",
-			"INSERT INTO products [{\"name\":\"Product1\",\"price\":100}]",
-			[]interface{}{"Product1", float64(100)},
+			"INSERT INTO products $data",
+			[]interface{}{sql.Named("data", []map[string]interface{}{{"name": "Product1", "price": float64(100)}})},
 		},
 		{
 			"bulk insertion",
@@ -117,8 +145,11 @@ func TestInsertRecord(t *testing.T) {
 			},
 			false,
 			"",
-			"INSERT INTO products [{\"name\":\"Product1\",\"price\":100},{\"name\":\"Product2\",\"price\":200}]",
-			[]interface{}{"Product1", float64(100), "Product2", float64(200)},
+			"INSERT INTO products $data",
+			[]interface{}{sql.Named("data", []map[string]interface{}{
+				{"name": "Product1", "price": float64(100)},
+				{"name": "Product2", "price": float64(200)},
+			})},
 		},
 		{
 			"invalid JSON",
@@ -134,7 +165,7 @@ func TestInsertRecord(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			body, _ := json.Marshal(tt.body)
 			req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewReader(body))
-			query, err := insertRecord(req, "products")
+			query, err := New("surrealdb", Options{}).insertRecord(req, "products")
 
 			if tt.wantErr {
 				assert.ErrorContains(t, err, tt.errMessage)
@@ -162,8 +193,8 @@ func TestUpdateRecord(t *testing.T) {
 			"update by primary key",
 			"/products/1",
 			map[string]interface{}{"name": "Updated Product", "price": float64(150)},
-			"UPDATE products:1 MERGE {\"name\":\"Updated Product\",\"price\":150}",
-			[]interface{}{"Updated Product", float64(150), "1"},
+			"UPDATE products:1 CONTENT $data",
+			[]interface{}{sql.Named("data", map[string]interface{}{"name": "Updated Product", "price": float64(150)})},
 			false,
 			"",
 		},
@@ -176,6 +207,15 @@ func TestUpdateRecord(t *testing.T) {
 		// 	false,
 		// 	"",
 		// },
+		{
+			"update by hostile primary key",
+			"/products/1%20CONTENT%20{}%3BDELETE%20products%3B",
+			map[string]interface{}{"name": "Updated Product"},
+			"",
+			nil,
+			true,
+			`invalid record id "1 CONTENT {};DELETE products;"`,
+		},
 		{
 			"no fields to update",
 			"/products/1",
@@ -200,7 +240,7 @@ func TestUpdateRecord(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			body, _ := json.Marshal(tt.body)
 			req := httptest.NewRequest(http.MethodPut, tt.path, bytes.NewReader(body))
-			query, err := updateRecord(req, "products")
+			query, err := New("surrealdb", Options{}).updateRecord(req, "products", true)
 
 			if tt.wantErr {
 				assert.ErrorContains(t, err, tt.errMessage)
@@ -215,6 +255,82 @@ func TestUpdateRecord(t *testing.T) {
 	}
 }
 
+// Test PUT replaces a whole record and PATCH merges some columns into it
+func TestReplaceRecord(t *testing.T) {
+	Schema["gadgets"] = &utils.Table{
+		Name: "gadgets",
+		Columns: []utils.Column{
+			{Name: "id", Type: "INTEGER", Identity: true},
+			{Name: "name", Type: "TEXT"},
+			{Name: "price", Type: "NUMERIC", Nullable: true},
+			{Name: "stock", Type: "INTEGER", Default: true},
+			{Name: "total", Type: "NUMERIC", Generated: true},
+		},
+	}
+	defer delete(Schema, "gadgets")
+
+	tests := []struct {
+		dbType  string
+		method  string
+		body    string
+		wantSQL string
+		wantErr string
+	}{
+		{"postgres", http.MethodPut, `{"name": "dial", "price": null}`, "UPDATE gadgets SET name = ?, price = ? WHERE id = ?", ""},
+		{"postgres", http.MethodPut, `{"name": "dial"}`, "", "PUT replaces the whole record and is missing price: use PATCH to update some columns"},
+		{"postgres", http.MethodPut, `{"stock": 2}`, "", "PUT replaces the whole record and is missing name, price: use PATCH to update some columns"},
+		{"postgres", http.MethodPatch, `{"stock": 2}`, "UPDATE gadgets SET stock = ? WHERE id = ?", ""},
+		{"surrealdb", http.MethodPut, `{"name": "dial", "price": 3}`, "UPDATE gadgets:1 CONTENT $data", ""},
+		{"surrealdb", http.MethodPatch, `{"price": 3}`, "UPDATE gadgets:1 MERGE $data", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dbType+" "+tt.method+" "+tt.body, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/gadgets/1", strings.NewReader(tt.body))
+			q, err := GetQL(req, tt.dbType)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSQL, q.Query)
+		})
+	}
+}
+
+// Test body keys that are not column names are rejected on every write, as
+// are columns missing from the schema when the table is known
+func TestHostileColumns(t *testing.T) {
+	Schema["gadgets"] = &utils.Table{
+		Name:    "gadgets",
+		Columns: []utils.Column{{Name: "id", Type: "INTEGER", Identity: true}, {Name: "name", Type: "TEXT"}},
+	}
+	defer delete(Schema, "gadgets")
+
+	tests := []struct {
+		method  string
+		path    string
+		body    string
+		wantErr string
+	}{
+		{http.MethodPost, "/users", `{"name) VALUES (1); DROP TABLE users; --": 1}`, `invalid column name "name) VALUES (1); DROP TABLE users; --"`},
+		{http.MethodPost, "/users", `[{"name": "a"}, {"a = 1; --": 1}]`, `invalid column name "a = 1; --"`},
+		{http.MethodPatch, "/users/1", `{"a = 1; DROP TABLE users; --": 1}`, `invalid column name "a = 1; DROP TABLE users; --"`},
+		{http.MethodPut, "/users/1", `{"name": "a", "b\"": 1}`, `invalid column name "b\""`},
+		{http.MethodPost, "/gadgets", `{"name": "dial", "owner": 1}`, "unknown column owner"},
+		{http.MethodPatch, "/gadgets/1", `{"owner": 1}`, "unknown column owner"},
+		{http.MethodPut, "/gadgets/1", `{"name": "dial", "owner": 1}`, "unknown column owner"},
+	}
+
+	for _, tt := range tests {
+		for _, dbType := range []string{"postgres", "surrealdb"} {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			_, err := GetQL(req, dbType)
+			assert.EqualError(t, err, tt.wantErr, "%s %s %s", dbType, tt.method, tt.body)
+		}
+	}
+}
+
 // Test deleteRecord function (with filters and primary key)
 func TestDeleteRecord(t *testing.T) {
 	tests := []struct {
@@ -244,6 +360,15 @@ func TestDeleteRecord(t *testing.T) {
 			false,
 			"",
 		},
+		{
+			"delete by hostile primary key",
+			"/products/1;DELETE%20products",
+			"",
+			"",
+			nil,
+			true,
+			`invalid record id "1;DELETE products"`,
+		},
 		{
 			"delete with no primary key or filters",
 			"/products",
@@ -258,7 +383,243 @@ func TestDeleteRecord(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := httptest.NewRequest(http.MethodDelete, tt.path+"?"+tt.query, nil)
-			query, err := deleteRecord(req, "products")
+			query, err := New("surrealdb", Options{}).deleteRecord(req, "products")
+
+			if tt.wantErr {
+				assert.ErrorContains(t, err, tt.errMessage)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedSQL, query.Query)
+				assert.Equal(t, tt.expectedArgs, query.Args)
+			}
+		})
+	}
+}
+
+// Test array column filters (Postgres only)
+func TestArrayFilters(t *testing.T) {
+	Schema["posts"] = &utils.Table{
+		Name:    "posts",
+		Columns: []utils.Column{{Name: "id", Type: "INTEGER"}, {Name: "tags", Type: "ARRAY"}, {Name: "scores", Type: "INT[]"}},
+	}
+	defer delete(Schema, "posts")
+
+	tests := []struct {
+		name         string
+		dbType       string
+		query        string
+		expectedSQL  string
+		expectedArgs []interface{}
+		wantErr      string
+	}{
+		{
+			"any element equals",
+			"postgres",
+			"/products?tags=any.sale",
+			"SELECT * FROM products WHERE ? = ANY(tags) ORDER BY id ASC LIMIT 100 OFFSET 0",
+			[]interface{}{"sale"},
+			"",
+		},
+		{
+			"all elements equal",
+			"postgres",
+			"/products?scores=all.10",
+			"SELECT * FROM products WHERE ? = ALL(scores) ORDER BY id ASC LIMIT 100 OFFSET 0",
+			[]interface{}{int64(10)},
+			"",
+		},
+		{
+			"contains array literal",
+			"postgres",
+			"/products?tags=cs.{sale,new}",
+			"SELECT * FROM products WHERE tags @> ? ORDER BY id ASC LIMIT 100 OFFSET 0",
+			[]interface{}{"{sale,new}"},
+			"",
+		},
+		{
+			"overlap inside group",
+			"postgres",
+			"/products?or=(tags=ov.{sale,new},level=lt.2)",
+			"SELECT * FROM products WHERE (tags && ? OR level < ?) ORDER BY id ASC LIMIT 100 OFFSET 0",
+			[]interface{}{"{sale,new}", int64(2)},
+			"",
+		},
+		{
+			"in on array column",
+			"postgres",
+			"/posts?tags=in.(sale,\"a,b\")",
+			"SELECT * FROM posts WHERE tags && ? ORDER BY id ASC LIMIT 100 OFFSET 0",
+			[]interface{}{`{"sale","a,b"}`},
+			"",
+		},
+		{
+			"in on integer array column",
+			"postgres",
+			"/posts?scores=in.(1,2)",
+			"SELECT * FROM posts WHERE scores && ? ORDER BY id ASC LIMIT 100 OFFSET 0",
+			[]interface{}{`{"1","2"}`},
+			"",
+		},
+		{
+			"rejected outside postgres",
+			"surrealdb",
+			"/products?tags=any.sale",
+			"",
+			nil,
+			"operator any requires postgres",
+		},
+		{
+			"array literal required",
+			"postgres",
+			"/products?tags=cs.sale",
+			"",
+			nil,
+			"operator cs requires an array like {a,b}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.query, nil)
+			query, err := New(tt.dbType, Options{}).getRecords(req, strings.TrimPrefix(req.URL.Path, "/"))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, query.Query)
+			assert.Equal(t, tt.expectedArgs, query.Args)
+		})
+	}
+}
+
+// Test ENUM validation of filters and write payloads
+func TestEnumValidation(t *testing.T) {
+	defer func(schema map[string]*utils.Table) { Schema = schema }(Schema)
+	Schema = map[string]*utils.Table{
+		"products": {
+			Name: "products",
+			Columns: []utils.Column{
+				{Name: "id", Type: "INTEGER"},
+				{Name: "status", Type: "ENUM", Enum: []string{"draft", "published"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       interface{}
+		wantErr    bool
+		errMessage string
+	}{
+		{"valid filter value", http.MethodGet, "/products?status=eq.draft", nil, false, ""},
+		{"invalid filter value", http.MethodGet, "/products?status=eq.archived", nil, true, `invalid value "archived" for column status: must be one of draft, published`},
+		{"invalid filter in group", http.MethodDelete, "/products?or=(status=ne.archived,id=eq.1)", nil, true, "invalid value"},
+		{"non-equality filter is not checked", http.MethodGet, "/products?status=like.pub*", nil, false, ""},
+		{"valid insert", http.MethodPost, "/products", map[string]interface{}{"status": "published"}, false, ""},
+		{"invalid insert", http.MethodPost, "/products", []map[string]interface{}{{"status": "draft"}, {"status": "archived"}}, true, "invalid value"},
+		{"invalid update", http.MethodPut, "/products/1", map[string]interface{}{"status": "archived"}, true, "invalid value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != nil {
+				b, _ := json.Marshal(tt.body)
+				body = bytes.NewReader(b)
+			}
+			req := httptest.NewRequest(tt.method, tt.path, body)
+			_, err := GetQL(req, "postgres")
+			if tt.wantErr {
+				assert.ErrorContains(t, err, tt.errMessage)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// Test generated and identity columns are excluded from writes
+func TestReadOnlyColumns(t *testing.T) {
+	defer func(schema map[string]*utils.Table) { Schema = schema }(Schema)
+	h := New("postgres", Options{})
+	Schema = map[string]*utils.Table{
+		"products": {
+			Name: "products",
+			Columns: []utils.Column{
+				{Name: "id", Type: "INTEGER", Identity: true},
+				{Name: "name", Type: "TEXT"},
+				{Name: "total", Type: "NUMERIC", Generated: true},
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         interface{}
+		expectedSQL  string
+		expectedArgs []interface{}
+		wantErr      bool
+		errMessage   string
+	}{
+		{
+			"insert skips generated columns",
+			http.MethodPost,
+			"/products",
+			map[string]interface{}{"id": 5, "name": "Product1", "total": 10},
+			"INSERT INTO products (name) VALUES (?)",
+			[]interface{}{"Product1"},
+			false,
+			"",
+		},
+		{
+			"insert with only generated columns",
+			http.MethodPost,
+			"/products",
+			map[string]interface{}{"id": 5},
+			"",
+			nil,
+			true,
+			"no writable fields to insert",
+		},
+		{
+			"update skips generated columns",
+			http.MethodPut,
+			"/products/1",
+			map[string]interface{}{"name": "Product1", "total": 10},
+			"UPDATE products SET name = ? WHERE id = ?",
+			[]interface{}{"Product1", "1"},
+			false,
+			"",
+		},
+		{
+			"update with only generated columns",
+			http.MethodPut,
+			"/products/1",
+			map[string]interface{}{"total": 10},
+			"",
+			nil,
+			true,
+			"no fields to update",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader(body))
+
+			var query *utils.ReturnQuery
+			var err error
+			if tt.method == http.MethodPost {
+				query, err = h.insertRecord(req, "products")
+			} else {
+				query, err = h.updateRecord(req, "products", tt.method == http.MethodPut)
+			}
 
 			if tt.wantErr {
 				assert.ErrorContains(t, err, tt.errMessage)
@@ -270,3 +631,681 @@ func TestDeleteRecord(t *testing.T) {
 		})
 	}
 }
+
+// Test generated SQL follows the order of the request, not map iteration
+func TestDeterministicOrder(t *testing.T) {
+	h := New("postgres", Options{})
+
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/products?price=gt.5&level=lt.2&hidden=is.false", nil)
+		q, err := h.getRecords(req, "products")
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM products WHERE price > ? AND level < ? AND hidden = ? ORDER BY id ASC LIMIT 100 OFFSET 0", q.Query)
+
+		body := `[{"price": 100, "name": "Product1", "active": true}, {"name": "Product2", "active": false, "price": 200}]`
+		req = httptest.NewRequest(http.MethodPost, "/products", bytes.NewReader([]byte(body)))
+		q, err = h.insertRecord(req, "products")
+		assert.NoError(t, err)
+		assert.Contains(t, q.Query, "INSERT INTO products (price, name, active) VALUES")
+		assert.Equal(t, []interface{}{float64(100), "Product1", true, float64(200), "Product2", false}, q.Args)
+
+		body = `{"price": 150, "name": "Updated"}`
+		req = httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewReader([]byte(body)))
+		q, err = h.updateRecord(req, "products", true)
+		assert.NoError(t, err)
+		assert.Equal(t, "UPDATE products SET price = ?, name = ? WHERE id = ?", q.Query)
+		assert.Equal(t, []interface{}{float64(150), "Updated", "1"}, q.Args)
+	}
+}
+
+// Test only reads are marked for replica routing
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		readOnly bool
+	}{
+		{http.MethodGet, "/products?level=eq.2", "", true},
+		{http.MethodPost, "/products", `{"name": "Product1"}`, false},
+		{http.MethodPut, "/products/1", `{"name": "Product1"}`, false},
+		{http.MethodDelete, "/products/1", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(tt.body)))
+			q, err := GetQL(req, "postgres")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.readOnly, q.ReadOnly)
+		})
+	}
+}
+
+// Test SurrealDB LIVE SELECT generation
+func TestLiveQuery(t *testing.T) {
+	tests := []struct {
+		name         string
+		dbType       string
+		query        string
+		expectedSQL  string
+		expectedArgs []interface{}
+		errMessage   string
+	}{
+		{
+			"live select with filters",
+			"surrealdb",
+			"/products?live=true&level=gt.5&order=price.desc&page=2",
+			"LIVE SELECT * FROM products WHERE level > ?",
+			[]interface{}{int64(5)},
+			"",
+		},
+		{
+			"live select without filters",
+			"surrealdb",
+			"/products?live=true",
+			"LIVE SELECT * FROM products",
+			[]interface{}{},
+			"",
+		},
+		{
+			"live select outside surrealdb",
+			"postgres",
+			"/products?live=true",
+			"",
+			nil,
+			"live queries are only supported on surrealdb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.query, nil)
+			query, err := New(tt.dbType, Options{}).getRecords(req, "products")
+			if tt.errMessage != "" {
+				assert.ErrorContains(t, err, tt.errMessage)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, query.Query)
+			assert.Equal(t, tt.expectedArgs, query.Args)
+			assert.False(t, query.ReadOnly)
+		})
+	}
+}
+
+// Test PostgREST compatibility mode
+func TestPostgRESTCompat(t *testing.T) {
+	defer func(compat bool) { PostgRESTCompat = compat }(PostgRESTCompat)
+	PostgRESTCompat = true
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		headers      map[string]string
+		body         string
+		expectedSQL  string
+		expectedArgs []interface{}
+	}{
+		{
+			"negated filter",
+			http.MethodGet,
+			"/products?level=not.eq.2",
+			nil,
+			"",
+			"SELECT * FROM products WHERE NOT (level = ?) ORDER BY id ASC LIMIT 100 OFFSET 0",
+			[]interface{}{int64(2)},
+		},
+		{
+			"ilike and full-text search",
+			http.MethodGet,
+			"/products?name=ilike.*phone*&description=plfts.fast%20charger",
+			nil,
+			"",
+			"SELECT * FROM products WHERE name ILIKE ? AND description @@ plainto_tsquery(?) ORDER BY id ASC LIMIT 100 OFFSET 0",
+			[]interface{}{"%phone%", "fast charger"},
+		},
+		{
+			"is null and regex match in group",
+			http.MethodGet,
+			"/products?or=(deleted_at=is.null,sku=imatch.^ab)",
+			nil,
+			"",
+			"SELECT * FROM products WHERE (deleted_at IS NULL OR sku ~* ?) ORDER BY id ASC LIMIT 100 OFFSET 0",
+			[]interface{}{"^ab"},
+		},
+		{
+			"limit and offset",
+			http.MethodGet,
+			"/products?select=id,name&limit=10&offset=20&order=price.desc.nullslast",
+			nil,
+			"",
+			"SELECT id, name FROM products ORDER BY price DESC NULLS LAST LIMIT 10 OFFSET 20",
+			[]interface{}{},
+		},
+		{
+			"range header",
+			http.MethodGet,
+			"/products",
+			map[string]string{"Range": "25-49"},
+			"",
+			"SELECT * FROM products ORDER BY id ASC LIMIT 25 OFFSET 25",
+			[]interface{}{},
+		},
+		{
+			"insert returning representation",
+			http.MethodPost,
+			"/products",
+			map[string]string{"Prefer": "return=representation"},
+			`{"name": "Product1"}`,
+			"INSERT INTO products (name) VALUES (?) RETURNING *",
+			[]interface{}{"Product1"},
+		},
+		{
+			"delete returning representation",
+			http.MethodDelete,
+			"/products?level=lt.2",
+			map[string]string{"Prefer": "count=exact, return=representation"},
+			"",
+			"DELETE FROM products WHERE level < ? RETURNING *",
+			[]interface{}{int64(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(tt.body)))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			query, err := GetQL(req, "postgres")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, query.Query)
+			assert.Equal(t, tt.expectedArgs, query.Args)
+		})
+	}
+
+	// MySQL has no RETURNING, so the preference is ignored
+	req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name": "Product1"}`))
+	req.Header.Set("Prefer", "return=representation")
+	query, err := GetQL(req, "mysql")
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO products (name) VALUES (?)", query.Query)
+
+	req = httptest.NewRequest(http.MethodGet, "/products?deleted_at=is.maybe", nil)
+	_, err = GetQL(req, "postgres")
+	assert.ErrorContains(t, err, "invalid value \"maybe\" for is operator")
+
+	req = httptest.NewRequest(http.MethodGet, "/products?select=id,author(name)", nil)
+	_, err = GetQL(req, "postgres")
+	assert.ErrorContains(t, err, "resource embedding is not supported")
+}
+
+// Test OData query options
+func TestODataCompat(t *testing.T) {
+	defer func(compat bool) { ODataCompat = compat }(ODataCompat)
+	ODataCompat = true
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		expectedSQL  string
+		expectedArgs []interface{}
+	}{
+		{
+			"filter, order and paging",
+			http.MethodGet,
+			"/products?$filter=price%20gt%2010%20and%20status%20eq%20'open'&$orderby=price%20desc&$top=5&$skip=10",
+			"SELECT * FROM products WHERE price > ? AND status = ? ORDER BY price DESC LIMIT 5 OFFSET 10",
+			[]interface{}{int64(10), "open"},
+		},
+		{
+			"selection and or group",
+			http.MethodGet,
+			"/products?$select=id,name&$filter=contains(name,'phone')%20or%20deleted_at%20eq%20null",
+			"SELECT id, name FROM products WHERE (name LIKE ? OR deleted_at IS NULL) ORDER BY id ASC LIMIT 100 OFFSET 0",
+			[]interface{}{"%phone%"},
+		},
+		{
+			"delete by filter",
+			http.MethodDelete,
+			"/products?$filter=level%20lt%202",
+			"DELETE FROM products WHERE level < ?",
+			[]interface{}{int64(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			query, err := GetQL(req, "postgres")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, query.Query)
+			assert.Equal(t, tt.expectedArgs, query.Args)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/products?$filter=price%20gt", nil)
+	_, err := GetQL(req, "postgres")
+	assert.Error(t, err)
+}
+
+// Test JSON:API parameters and request documents
+func TestJSONAPI(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/products?fields%5Bproducts%5D=name&sort=-price&page%5Bnumber%5D=3&page%5Bsize%5D=10", nil)
+	req.Header.Set("Accept", "application/vnd.api+json")
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id, name FROM products ORDER BY price DESC LIMIT 10 OFFSET 20", query.Query)
+
+	// Without the media type the parameters are not translated
+	req = httptest.NewRequest(http.MethodGet, "/products?sort=-price", nil)
+	query, err = GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM products ORDER BY id ASC LIMIT 100 OFFSET 0", query.Query)
+
+	req = httptest.NewRequest(http.MethodPost, "/products", bytes.NewReader([]byte(`{"data": {"type": "products", "attributes": {"name": "Phone", "level": 2}}}`)))
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+	query, err = GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO products (name, level) VALUES (?, ?)", query.Query)
+	assert.Equal(t, []interface{}{"Phone", float64(2)}, query.Args)
+}
+
+// Test querying with a JSON body
+func TestQueryByPost(t *testing.T) {
+	body := `{
+		"filter": {"or": [{"column": "level", "op": "lt", "value": 2}, {"column": "name", "op": "eq", "value": "a,b"}]},
+		"select": ["id", "name"],
+		"order": ["price.desc"],
+		"limit": 5
+	}`
+	req := httptest.NewRequest(http.MethodPost, "/products/query", bytes.NewReader([]byte(body)))
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id, name FROM products WHERE (level < ? OR name = ?) ORDER BY price DESC LIMIT 5 OFFSET 0", query.Query)
+	assert.Equal(t, []interface{}{int64(2), "a,b"}, query.Args)
+	assert.True(t, query.ReadOnly)
+
+	req = httptest.NewRequest(http.MethodPost, "/products/query", bytes.NewReader([]byte(`{}`)))
+	query, err = GetQL(req, "surrealdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM products ORDER BY id ASC LIMIT 100 START 0", query.Query)
+
+	req = httptest.NewRequest(http.MethodPost, "/products/query", bytes.NewReader([]byte(`{"where": {}}`)))
+	_, err = GetQL(req, "postgres")
+	assert.EqualError(t, err, "invalid JSON format")
+}
+
+// Test the aggregation endpoint
+func TestAggregate(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/orders/aggregate?metrics=sum(amount),count(*)&dimensions=region&status=eq.paid&order=sum_amount.desc&page_size=10", nil)
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT region AS region, SUM(amount) AS sum_amount, COUNT(*) AS count FROM orders WHERE status = ? GROUP BY region ORDER BY sum_amount DESC LIMIT 10 OFFSET 0", query.Query)
+	assert.Equal(t, []interface{}{"paid"}, query.Args)
+	assert.True(t, query.ReadOnly)
+
+	req = httptest.NewRequest(http.MethodGet, "/orders/aggregate?metrics=count(*)&dimensions=day(created_at)", nil)
+	query, err = GetQL(req, "surrealdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT time::group(created_at, 'day') AS day_created_at, count() AS count FROM orders GROUP BY day_created_at ORDER BY day_created_at LIMIT 100 START 0", query.Query)
+
+	req = httptest.NewRequest(http.MethodGet, "/orders/aggregate?metrics=count(*)&order=id.desc", nil)
+	_, err = GetQL(req, "postgres")
+	assert.EqualError(t, err, "cannot order by id: not a metric or dimension")
+}
+
+// Test random order and sampling
+func TestRandomSample(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/products?level=gt.1&order=random&sample=10%25&page_size=5", nil)
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM products TABLESAMPLE SYSTEM (10) WHERE level > ? ORDER BY RANDOM() LIMIT 5 OFFSET 0", query.Query)
+
+	req = httptest.NewRequest(http.MethodGet, "/products?order=random&sample=10", nil)
+	query, err = GetQL(req, "surrealdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM products WHERE rand() < 0.1 ORDER BY RAND() LIMIT 100 START 0", query.Query)
+}
+
+// Test top-N rows per group
+func TestPerGroup(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/products?per_group=category:3&order=score.desc&active=eq.true&select=id,category,score", nil)
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id, category, score FROM (SELECT products.*, ROW_NUMBER() OVER (PARTITION BY category ORDER BY score DESC) AS group_rank FROM products WHERE active = ?) AS ranked WHERE group_rank <= 3 ORDER BY category, group_rank LIMIT 100 OFFSET 0", query.Query)
+	assert.Equal(t, []interface{}{true}, query.Args)
+
+	for _, perGroup := range []string{"category", "category:0", "category:x", "cat;egory:3"} {
+		_, err := GetQL(httptest.NewRequest(http.MethodGet, "/products?per_group="+url.QueryEscape(perGroup), nil), "postgres")
+		assert.Error(t, err, perGroup)
+	}
+
+	_, err = GetQL(httptest.NewRequest(http.MethodGet, "/products?per_group=category:3", nil), "surrealdb")
+	assert.EqualError(t, err, "per_group is not supported on surrealdb")
+}
+
+// Test recursive tree queries
+func TestTree(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/categories?tree=descendants.of.42&active=eq.true", nil)
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "WITH RECURSIVE tree AS (SELECT categories.*, 1 AS depth FROM categories WHERE parent_id = ? UNION ALL SELECT categories.*, tree.depth + 1 FROM categories JOIN tree ON categories.parent_id = tree.id WHERE tree.depth < 10) SELECT * FROM tree WHERE active = ? ORDER BY depth ASC, id ASC LIMIT 100 OFFSET 0", query.Query)
+	assert.Equal(t, []interface{}{int64(42), true}, query.Args)
+
+	defer func(depth int) { TreeMaxDepth = depth }(TreeMaxDepth)
+	TreeMaxDepth = 3
+	req = httptest.NewRequest(http.MethodGet, "/employees?tree=ancestors.of.7&select=id,name", nil)
+	query, err = GetQL(req, "sqlite")
+	assert.NoError(t, err)
+	assert.Equal(t, "WITH RECURSIVE tree AS (SELECT employees.*, 1 AS depth FROM employees WHERE id = (SELECT parent_id FROM employees WHERE id = ?) UNION ALL SELECT employees.*, tree.depth + 1 FROM employees JOIN tree ON employees.id = tree.parent_id WHERE tree.depth < 3) SELECT id, name FROM tree ORDER BY depth ASC, id ASC LIMIT 100 OFFSET 0", query.Query)
+	assert.Equal(t, []interface{}{int64(7)}, query.Args)
+
+	for _, tree := range []string{"children.of.1", "descendants.42", "descendants.of."} {
+		_, err := GetQL(httptest.NewRequest(http.MethodGet, "/categories?tree="+tree, nil), "postgres")
+		assert.Error(t, err, tree)
+	}
+}
+
+// Test time bucketing with group_by
+func TestGroupBy(t *testing.T) {
+	tests := []struct {
+		dbType      string
+		expectedSQL string
+	}{
+		{"postgres", "SELECT date_trunc('week', created_at) AS week_created_at, SUM(amount) AS sum_amount FROM orders WHERE status = ? GROUP BY date_trunc('week', created_at) ORDER BY date_trunc('week', created_at) LIMIT 100 OFFSET 0"},
+		{"mysql", "SELECT DATE_SUB(DATE(created_at), INTERVAL WEEKDAY(created_at) DAY) AS week_created_at, SUM(amount) AS sum_amount FROM orders WHERE status = ? GROUP BY DATE_SUB(DATE(created_at), INTERVAL WEEKDAY(created_at) DAY) ORDER BY DATE_SUB(DATE(created_at), INTERVAL WEEKDAY(created_at) DAY) LIMIT 100 OFFSET 0"},
+		{"sqlite", "SELECT date(created_at, 'weekday 0', '-6 days') AS week_created_at, SUM(amount) AS sum_amount FROM orders WHERE status = ? GROUP BY date(created_at, 'weekday 0', '-6 days') ORDER BY date(created_at, 'weekday 0', '-6 days') LIMIT 100 OFFSET 0"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/orders?group_by=week(created_at)&select=week_created_at,sum(amount)&status=eq.paid", nil)
+		query, err := GetQL(req, tt.dbType)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expectedSQL, query.Query, tt.dbType)
+		assert.Equal(t, []interface{}{"paid"}, query.Args)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/orders?group_by=month(created_at)", nil)
+	query, err := GetQL(req, "surrealdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT time::group(created_at, 'month') AS month_created_at, count() AS count FROM orders GROUP BY month_created_at ORDER BY month_created_at LIMIT 100 START 0", query.Query)
+}
+
+// Test relative date filters use the requested time zone and skip the cache
+func TestRelativeDates(t *testing.T) {
+	defer EnableQueryCache(0)
+	EnableQueryCache(10)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders?created_at=gte.today&tz=Asia/Tokyo", nil)
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM orders WHERE created_at >= ? ORDER BY id ASC LIMIT 100 OFFSET 0", query.Query)
+	today := query.Args[0].(time.Time)
+	assert.Equal(t, "Asia/Tokyo", today.Location().String())
+	assert.Equal(t, 0, today.Hour())
+	assert.Equal(t, 0, planCache.ll.Len())
+
+	req = httptest.NewRequest(http.MethodGet, "/orders?created_at=gte.now-7d", nil)
+	req.Header.Set("TZ", "Nowhere/Invalid")
+	_, err = GetQL(req, "postgres")
+	assert.EqualError(t, err, `invalid time zone "Nowhere/Invalid"`)
+}
+
+// Test explicit nulls are written while missing keys take the column default
+func TestInsertColumns(t *testing.T) {
+	body := `[{"name": "A", "price": null}, {"name": "B", "extra": 1}]`
+	req := httptest.NewRequest(http.MethodPost, "/products?columns=name,price", bytes.NewReader([]byte(body)))
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO products (name, price) VALUES (?, ?), (?, DEFAULT)", query.Query)
+	assert.Equal(t, []interface{}{"A", nil, "B"}, query.Args)
+
+	req = httptest.NewRequest(http.MethodPut, "/products/1", bytes.NewReader([]byte(`{"price": null}`)))
+	query, err = GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "UPDATE products SET price = ? WHERE id = ?", query.Query)
+	assert.Equal(t, []interface{}{nil, "1"}, query.Args)
+
+	req = httptest.NewRequest(http.MethodPost, "/products?columns=name,bad-name", bytes.NewReader([]byte(body)))
+	_, err = GetQL(req, "postgres")
+	assert.EqualError(t, err, `invalid column name "bad-name"`)
+
+	req = httptest.NewRequest(http.MethodPost, "/products?columns=name,price", bytes.NewReader([]byte(body)))
+	_, err = GetQL(req, "sqlite")
+	assert.EqualError(t, err, "records have different columns: record 1 is missing price")
+}
+
+// Test bulk inserts take the columns of every record, not just the first
+func TestHeterogeneousInsert(t *testing.T) {
+	body := `[{"name": "A"}, {"name": "B", "price": 5}, {"level": 2}]`
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewReader([]byte(body)))
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO products (name, price, level) VALUES (?, DEFAULT, DEFAULT), (?, ?, DEFAULT), (DEFAULT, DEFAULT, ?)", query.Query)
+	assert.Equal(t, []interface{}{"A", "B", float64(5), float64(2)}, query.Args)
+
+	req = httptest.NewRequest(http.MethodPost, "/products", bytes.NewReader([]byte(body)))
+	_, err = GetQL(req, "sqlite")
+	assert.EqualError(t, err, "records have different columns: record 0 is missing price, level; record 1 is missing level; record 2 is missing name, price")
+}
+
+// Test bulk inserts beyond the placeholder limit are split into a batch
+func TestChunkedInsert(t *testing.T) {
+	defer func(limit int) { MaxPlaceholders["postgres"] = limit }(MaxPlaceholders["postgres"])
+	MaxPlaceholders["postgres"] = 4
+
+	body := `[{"name": "A", "price": 1}, {"name": "B", "price": 2}, {"name": "C", "price": 3}]`
+	req := httptest.NewRequest(http.MethodPost, "/products", bytes.NewReader([]byte(body)))
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO products (name, price) VALUES (?, ?), (?, ?)", query.Query)
+	assert.Equal(t, []interface{}{"A", float64(1), "B", float64(2)}, query.Args)
+
+	statements := query.Statements()
+	assert.Len(t, statements, 2)
+	assert.Equal(t, "INSERT INTO products (name, price) VALUES (?, ?)", statements[1].Query)
+	assert.Equal(t, []interface{}{"C", float64(3)}, statements[1].Args)
+
+	req = httptest.NewRequest(http.MethodPost, "/products", bytes.NewReader([]byte(`{"name": "A"}`)))
+	query, err = GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Nil(t, query.Batch)
+	assert.Len(t, query.Statements(), 1)
+}
+
+// Test CSV bodies insert one record per row, typed by the schema
+func TestCSVInsert(t *testing.T) {
+	Schema["csv_items"] = &utils.Table{
+		Name: "csv_items",
+		Columns: []utils.Column{
+			{Name: "name", Type: "TEXT"},
+			{Name: "qty", Type: "INTEGER"},
+			{Name: "active", Type: "BOOLEAN"},
+		},
+	}
+	defer delete(Schema, "csv_items")
+
+	body := "name,qty,active\nA,3,true\n\"B, C\",,false\n"
+	req := httptest.NewRequest(http.MethodPost, "/csv_items", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO csv_items (name, qty, active) VALUES (?, ?, ?), (?, ?, ?)", query.Query)
+	assert.Equal(t, []interface{}{"A", int64(3), true, "B, C", nil, false}, query.Args)
+
+	errors := map[string]string{
+		"name,qty\nA,many\n":  `row 1: invalid integer value "many" for column qty`,
+		"name,color\nA,red\n": "unknown column color",
+		"name,name\nA,B\n":    "duplicate column name",
+		"name,qty\nA\n":       "invalid CSV: record on line 2: wrong number of fields",
+	}
+	for body, expected := range errors {
+		req := httptest.NewRequest(http.MethodPost, "/csv_items", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "text/csv")
+		_, err := GetQL(req, "postgres")
+		assert.EqualError(t, err, expected, body)
+	}
+}
+
+// Test urlencoded and multipart form bodies map fields to columns
+func TestFormBody(t *testing.T) {
+	Schema["form_items"] = &utils.Table{
+		Name: "form_items",
+		Columns: []utils.Column{
+			{Name: "name", Type: "TEXT"},
+			{Name: "qty", Type: "INTEGER"},
+			{Name: "photo", Type: "BLOB"},
+		},
+	}
+	defer delete(Schema, "form_items")
+
+	req := httptest.NewRequest(http.MethodPost, "/form_items", bytes.NewReader([]byte("name=Big+box&qty=3")))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO form_items (name, qty) VALUES (?, ?)", query.Query)
+	assert.Equal(t, []interface{}{"Big box", int64(3)}, query.Args)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	assert.NoError(t, form.WriteField("qty", ""))
+	file, err := form.CreateFormFile("photo", "photo.png")
+	assert.NoError(t, err)
+	file.Write([]byte{0x89, 'P', 'N', 'G'})
+	form.Close()
+
+	req = httptest.NewRequest(http.MethodPatch, "/form_items/7", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	query, err = GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "UPDATE form_items SET qty = ?, photo = ? WHERE id = ?", query.Query)
+	assert.Equal(t, []interface{}{nil, []byte{0x89, 'P', 'N', 'G'}, "7"}, query.Args)
+
+	req = httptest.NewRequest(http.MethodPost, "/form_items", bytes.NewReader([]byte("name=a&name=b")))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = GetQL(req, "postgres")
+	assert.EqualError(t, err, "duplicate field name")
+}
+
+// Test exists=true checks for a matching row without reading rows
+func TestExists(t *testing.T) {
+	query, err := GetQL(httptest.NewRequest(http.MethodGet, "/users?email=eq.a@example.com&exists=true", nil), "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT EXISTS (SELECT 1 FROM users WHERE email = ?)", query.Query)
+	assert.Equal(t, []interface{}{"a@example.com"}, query.Args)
+	assert.True(t, query.ReadOnly)
+
+	query, err = GetQL(httptest.NewRequest(http.MethodGet, "/users?exists=true", nil), "surrealdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "RETURN array::len((SELECT id FROM users LIMIT 1)) > 0", query.Query)
+}
+
+// Test stats=... summarizes the filtered rows in a second query
+func TestStats(t *testing.T) {
+	query, err := GetQL(httptest.NewRequest(http.MethodGet, "/products?stats=min(price),max(price),avg(price)&level=gt.2", nil), "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM products WHERE level > ? ORDER BY id ASC LIMIT 100 OFFSET 0", query.Query)
+	assert.Equal(t, "SELECT MIN(price) AS min_price, MAX(price) AS max_price, AVG(price) AS avg_price FROM products WHERE level > ?", query.Stats.Query)
+	assert.Equal(t, []interface{}{int64(2)}, query.Stats.Args)
+	assert.True(t, query.Stats.ReadOnly)
+
+	query, err = GetQL(httptest.NewRequest(http.MethodGet, "/products?stats=count(*)&stats_only=true", nil), "surrealdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT count() AS count FROM products GROUP ALL", query.Query)
+	assert.Nil(t, query.Stats)
+
+	_, err = GetQL(httptest.NewRequest(http.MethodGet, "/products?stats=median(price)", nil), "postgres")
+	assert.EqualError(t, err, "unsupported metric median(price)")
+}
+
+// Test q=... searches the listed columns alongside the filters
+func TestSearch(t *testing.T) {
+	query, err := GetQL(httptest.NewRequest(http.MethodGet, "/users?level=gt.2&q=jo&q_columns=name,email", nil), "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM users WHERE level > ? AND (name ILIKE ? OR email ILIKE ?) ORDER BY id ASC LIMIT 100 OFFSET 0", query.Query)
+	assert.Equal(t, []interface{}{int64(2), "%jo%", "%jo%"}, query.Args)
+
+	_, err = GetQL(httptest.NewRequest(http.MethodGet, "/users?q=jo", nil), "postgres")
+	assert.EqualError(t, err, "q requires q_columns")
+}
+
+// Test numbers and dates in filters and bodies are read in the request's
+// locale, or the handler's when it gives none
+func TestLocale(t *testing.T) {
+	Schema["locale_orders"] = &utils.Table{
+		Name: "locale_orders",
+		Columns: []utils.Column{
+			{Name: "note", Type: "TEXT"},
+			{Name: "total", Type: "NUMERIC(10,2)"},
+			{Name: "placed", Type: "DATE"},
+		},
+	}
+	defer delete(Schema, "locale_orders")
+
+	req := httptest.NewRequest(http.MethodPost, "/locale_orders", strings.NewReader(`{"note":"1,5","total":"1.234,56","placed":"31.12.2024"}`))
+	req.Header.Set("Locale", "de-DE")
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO locale_orders (note, total, placed) VALUES (?, ?, ?)", query.Query)
+	assert.Equal(t, []interface{}{"1,5", "1234.56", "2024-12-31"}, query.Args)
+
+	req = httptest.NewRequest(http.MethodPost, "/locale_orders?locale=fr-FR", strings.NewReader("note,total\nA,\"12,5\"\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	query, err = GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"A", "12.5"}, query.Args)
+
+	h := New("postgres", Options{Locale: "en-GB"})
+	query, err = h.GetQL(httptest.NewRequest(http.MethodGet, "/locale_orders?placed=gte.01/02/2024", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"2024-02-01"}, query.Args)
+
+	req = httptest.NewRequest(http.MethodPost, "/locale_orders", strings.NewReader(`{"total":"1,5"}`))
+	req.Header.Set("Locale", "klingon")
+	_, err = GetQL(req, "postgres")
+	assert.EqualError(t, err, `unknown locale "klingon"`)
+}
+
+// Test per-table defaults apply only when the request has no select or order
+func TestTableDefaults(t *testing.T) {
+	TableDefaults["events"] = TableDefault{Select: "id,kind", Order: "created_at.desc"}
+	defer delete(TableDefaults, "events")
+
+	query, err := GetQL(httptest.NewRequest(http.MethodGet, "/events?kind=eq.click", nil), "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id, kind FROM events WHERE kind = ? ORDER BY created_at DESC LIMIT 100 OFFSET 0", query.Query)
+
+	query, err = GetQL(httptest.NewRequest(http.MethodGet, "/events?select=id&order=id.asc", nil), "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id FROM events ORDER BY id ASC LIMIT 100 OFFSET 0", query.Query)
+
+	query, err = GetQL(httptest.NewRequest(http.MethodPost, "/events/query", bytes.NewReader([]byte(`{}`))), "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id, kind FROM events ORDER BY created_at DESC LIMIT 100 OFFSET 0", query.Query)
+}
+
+// Test reads and deletes of id lists type the ids by the key column
+func TestIDList(t *testing.T) {
+	Schema["coupons"] = &utils.Table{
+		Name:    "coupons",
+		Columns: []utils.Column{{Name: "id", Type: "VARCHAR(8)"}, {Name: "percent", Type: "INTEGER"}},
+	}
+	defer delete(Schema, "coupons")
+
+	query, err := GetQL(httptest.NewRequest(http.MethodDelete, "/coupons?id=in.(007,SAVE10)", nil), "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "DELETE FROM coupons WHERE id IN (?, ?)", query.Query)
+	assert.Equal(t, []interface{}{"007", "SAVE10"}, query.Args)
+
+	query, err = GetQL(httptest.NewRequest(http.MethodGet, "/products?id=in.(007,8)", nil), "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM products WHERE id IN (?, ?) ORDER BY id ASC LIMIT 100 OFFSET 0", query.Query)
+	assert.Equal(t, []interface{}{int64(7), int64(8)}, query.Args)
+
+	_, err = GetQL(httptest.NewRequest(http.MethodGet, "/coupons?percent=in.(10,ten)", nil), "mysql")
+	assert.EqualError(t, err, `invalid integer value "ten" for column percent`)
+}
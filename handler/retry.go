@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// Retries is the retry policy for running generated queries. Set
+// MaxAttempts to 1 to disable retries.
+var Retries = RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: time.Second}
+
+// RetryPolicy retries work failing with transient database errors, like
+// serialization failures and deadlocks, with exponential backoff
+type RetryPolicy struct {
+	// MaxAttempts is the most times the work runs, including the first
+	MaxAttempts int
+	// BaseDelay is the longest wait before the first retry. Each retry
+	// doubles it, up to MaxDelay, and waits a random part of it.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// transientStates are Postgres SQLSTATE codes worth retrying: serialization
+// failure, deadlock and lock not available
+var transientStates = map[string]bool{
+	"40001": true,
+	"40P01": true,
+	"55P03": true,
+}
+
+// transientMySQLErrors are MySQL deadlock and lock wait timeout errors
+var transientMySQLErrors = map[string]bool{
+	"1213": true,
+	"1205": true,
+}
+
+// IsTransient reports whether err is a database error that may succeed
+// when retried: a serialization failure or deadlock on Postgres, a deadlock
+// or lock wait timeout on MySQL, or a busy database on SQLite
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var stater interface{ SQLState() string }
+	if errors.As(err, &stater) {
+		return transientStates[stater.SQLState()]
+	}
+	msg := err.Error()
+	if m := sqlStateRegexp.FindStringSubmatch(msg); m != nil {
+		return transientStates[m[1]]
+	}
+	if m := mysqlNumber.FindStringSubmatch(msg); m != nil {
+		return transientMySQLErrors[m[1]]
+	}
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "SQLITE_BUSY")
+}
+
+// Do runs fn until it succeeds, fails with an error that is not transient,
+// or has run MaxAttempts times, returning its last error. fn should run a
+// whole transaction, as a failed one must be retried from the start. Waits
+// end early when ctx is done.
+func (p RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	delay := p.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !IsTransient(err) {
+			return err
+		}
+
+		wait := time.Duration(0)
+		if delay > 0 {
+			wait = rand.N(delay) + 1
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		if delay = 2 * delay; p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test transient errors are recognized for each database
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&pgError{Code: "40001", Message: "could not serialize access due to concurrent update"}, true},
+		{&pgError{Code: "40P01", Message: "deadlock detected"}, true},
+		{&pgError{Code: "23505", Message: "duplicate key value violates unique constraint"}, false},
+		{errors.New("ERROR: deadlock detected (SQLSTATE 40P01)"), true},
+		{errors.New("Error 1213 (40001): Deadlock found when trying to get lock; try restarting transaction"), true},
+		{errors.New("Error 1062 (23000): Duplicate entry 'a' for key 'users.email'"), false},
+		{errors.New("database is locked (5) (SQLITE_BUSY)"), true},
+		{errors.New("connection refused"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, IsTransient(tt.err), "%v", tt.err)
+	}
+}
+
+// Test work is retried on transient errors only, up to MaxAttempts
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	deadlock := &pgError{Code: "40P01", Message: "deadlock detected"}
+
+	calls := 0
+	err := policy.Do(context.Background(), func(ctx context.Context) error {
+		if calls++; calls < 3 {
+			return deadlock
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = policy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return deadlock
+	})
+	assert.Equal(t, deadlock, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	duplicate := errors.New("Error 1062 (23000): Duplicate entry 'a' for key 'users.email'")
+	err = policy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return duplicate
+	})
+	assert.Equal(t, duplicate, err)
+	assert.Equal(t, 1, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	err = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}.Do(ctx, func(ctx context.Context) error {
+		calls++
+		return deadlock
+	})
+	assert.Equal(t, deadlock, err)
+	assert.Equal(t, 1, calls)
+}
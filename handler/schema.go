@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"sync"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// schemaMu guards Schema against SetSchema swapping it while requests are
+// served
+var schemaMu sync.RWMutex
+
+// SetSchema replaces Schema while requests are being served, e.g. after a
+// migration. Requests in flight finish with the tables they already looked
+// up, and the query cache is cleared so no query of the previous schema is
+// served.
+func SetSchema(tables map[string]*utils.Table) {
+	schemaMu.Lock()
+	Schema = tables
+	schemaMu.Unlock()
+
+	if cache := planCache; cache != nil {
+		cache.clear()
+	}
+}
+
+// tableMeta returns the metadata of a table, nil when it is not in Schema
+func tableMeta(tableName string) *utils.Table {
+	schemaMu.RLock()
+	defer schemaMu.RUnlock()
+	return Schema[tableName]
+}
+
+// SetSchema gives h its own schema in place of the package Schema, so
+// Handlers of different databases do not share their tables. Call it again
+// to replace the schema while serving; the query cache of h is cleared.
+func (h *Handler) SetSchema(tables map[string]*utils.Table) {
+	h.schema.Store(&tables)
+	if cache := h.plans(); cache != nil {
+		cache.clear()
+	}
+}
+
+// Table returns the metadata of a table in the schema of h, nil when it is
+// not there
+func (h *Handler) Table(tableName string) *utils.Table {
+	return h.tableMeta(tableName)
+}
+
+// tableMeta returns the metadata of a table in the schema of h, nil when it
+// is not there
+func (h *Handler) tableMeta(tableName string) *utils.Table {
+	if tables := h.schema.Load(); tables != nil {
+		return (*tables)[tableName]
+	}
+	return tableMeta(tableName)
+}
+
+// tableDefault returns the TableDefault of a table, from Options or else
+// the package TableDefaults
+func (h *Handler) tableDefault(tableName string) (TableDefault, bool) {
+	defaults := h.opts.TableDefaults
+	if defaults == nil {
+		defaults = TableDefaults
+	}
+	d, ok := defaults[tableName]
+	return d, ok
+}
+
+// partition returns the Partition of a table, from Options or else the
+// package Partitions
+func (h *Handler) partition(tableName string) (Partition, bool) {
+	partitions := h.opts.Partitions
+	if partitions == nil {
+		partitions = Partitions
+	}
+	p, ok := partitions[tableName]
+	return p, ok
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test swapping the schema drops queries cached for the previous one
+func TestSetSchema(t *testing.T) {
+	defer func(schema map[string]*utils.Table) { Schema = schema }(Schema)
+	defer EnableQueryCache(0)
+	EnableQueryCache(10)
+
+	SetSchema(map[string]*utils.Table{
+		"products": {Name: "products", Columns: []utils.Column{{Name: "id", Type: "INTEGER"}, {Name: "name", Type: "TEXT"}}},
+	})
+	_, err := GetQL(httptest.NewRequest(http.MethodGet, "/products?select=name", nil), "postgres")
+	assert.NoError(t, err)
+
+	SetSchema(map[string]*utils.Table{
+		"products": {Name: "products", Columns: []utils.Column{{Name: "id", Type: "INTEGER"}, {Name: "title", Type: "TEXT"}}},
+	})
+	_, err = GetQL(httptest.NewRequest(http.MethodGet, "/products?select=name", nil), "postgres")
+	assert.Error(t, err)
+	_, err = GetQL(httptest.NewRequest(http.MethodGet, "/products?select=title", nil), "postgres")
+	assert.NoError(t, err)
+}
+
+// Test handlers with their own schema, defaults and query cache do not see
+// each other's
+func TestHandlerSchema(t *testing.T) {
+	app := New("postgres", Options{QueryCache: 10, TableDefaults: map[string]TableDefault{"products": {Order: "name.asc"}}})
+	app.SetSchema(map[string]*utils.Table{
+		"products": {Name: "products", Columns: []utils.Column{{Name: "id", Type: "INTEGER"}, {Name: "name", Type: "TEXT"}}},
+	})
+	shop := New("postgres", Options{QueryCache: 10})
+	shop.SetSchema(map[string]*utils.Table{
+		"products": {Name: "products", Columns: []utils.Column{{Name: "id", Type: "INTEGER"}, {Name: "title", Type: "TEXT"}}},
+	})
+
+	q, err := app.GetQL(httptest.NewRequest(http.MethodGet, "/products?select=name", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT name FROM products ORDER BY name ASC LIMIT 100 OFFSET 0", q.Query)
+	_, err = shop.GetQL(httptest.NewRequest(http.MethodGet, "/products?select=name", nil))
+	assert.Error(t, err)
+	q, err = shop.GetQL(httptest.NewRequest(http.MethodGet, "/products?select=title", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT title FROM products ORDER BY id ASC LIMIT 100 OFFSET 0", q.Query)
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// MaxSlowShapes bounds the number of distinct query shapes a SlowLog keeps.
+// Slow queries of new shapes are dropped once it is full.
+var MaxSlowShapes = 1000
+
+var (
+	// stringLiteralRegexp matches quoted literals, like inline SurrealDB values
+	stringLiteralRegexp = regexp.MustCompile(`'(?:[^']|'')*'|"(?:[^"\\]|\\.)*"`)
+	// numberLiteralRegexp matches numbers that are not part of an identifier
+	numberLiteralRegexp = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	// placeholderListRegexp matches runs of placeholders, as in a VALUES row
+	placeholderListRegexp = regexp.MustCompile(`(?:\?|DEFAULT)(?:, (?:\?|DEFAULT))+`)
+	// valuesRowsRegexp matches repeated rows of a multi-row insert
+	valuesRowsRegexp = regexp.MustCompile(`\((?:\?|\.\.\.)\)(?:, \((?:\?|\.\.\.)\))+`)
+)
+
+// SlowLog records queries slower than its threshold, grouped by normalized
+// shape. restql does not run queries, so callers report each execution with
+// Record. Serve it on an admin route to list the slow shapes as JSON.
+type SlowLog struct {
+	// Threshold is the latency above which a query is recorded
+	Threshold time.Duration
+
+	mu     sync.Mutex
+	shapes map[slowKey]*SlowQuery
+}
+
+// slowKey is a normalized query with the types of its args
+type slowKey struct {
+	shape string
+	types string
+}
+
+// SlowQuery is a query shape that ran slower than the threshold
+type SlowQuery struct {
+	Table string `json:"table"`
+	// Shape is the query with literals and placeholder lists collapsed
+	Shape string `json:"shape"`
+	// ArgTypes are the Go types of the bound args
+	ArgTypes []string `json:"arg_types"`
+	// Calls is the number of slow executions
+	Calls     int           `json:"calls"`
+	TotalTime time.Duration `json:"total_time"`
+	MaxTime   time.Duration `json:"max_time"`
+	// Rows is the total number of rows returned or affected
+	Rows     int64     `json:"rows"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// NewSlowLog creates a slow query log recording queries slower than
+// threshold
+func NewSlowLog(threshold time.Duration) *SlowLog {
+	return &SlowLog{Threshold: threshold, shapes: map[slowKey]*SlowQuery{}}
+}
+
+// Record reports an execution of q that took elapsed and returned or
+// affected rows. It is ignored when faster than the threshold.
+func (l *SlowLog) Record(q *utils.ReturnQuery, elapsed time.Duration, rows int) {
+	if q == nil || elapsed < l.Threshold {
+		return
+	}
+
+	types := make([]string, len(q.Args))
+	for i, arg := range q.Args {
+		types[i] = fmt.Sprintf("%T", arg)
+	}
+	shape := NormalizeQuery(q.Query)
+	key := slowKey{shape, fmt.Sprint(types)}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.shapes[key]
+	if !ok {
+		if len(l.shapes) >= MaxSlowShapes {
+			return
+		}
+		entry = &SlowQuery{Table: q.Table, Shape: shape, ArgTypes: types}
+		l.shapes[key] = entry
+	}
+	entry.Calls++
+	entry.TotalTime += elapsed
+	entry.MaxTime = max(entry.MaxTime, elapsed)
+	entry.Rows += int64(rows)
+	entry.LastSeen = time.Now()
+}
+
+// Entries returns the recorded shapes, most total time first
+func (l *SlowLog) Entries() []SlowQuery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]SlowQuery, 0, len(l.shapes))
+	for _, entry := range l.shapes {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].TotalTime != entries[j].TotalTime {
+			return entries[i].TotalTime > entries[j].TotalTime
+		}
+		return entries[i].Shape < entries[j].Shape
+	})
+	return entries
+}
+
+// Reset forgets every recorded shape
+func (l *SlowLog) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.shapes = map[slowKey]*SlowQuery{}
+}
+
+// ServeHTTP lists the entries as JSON
+func (l *SlowLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.Entries())
+}
+
+// NormalizeQuery reduces a query to its shape, so queries differing only in
+// values, limits or the number of rows inserted are grouped together.
+// Literals become ?, and lists of placeholders become (...).
+func NormalizeQuery(sql string) string {
+	sql = stringLiteralRegexp.ReplaceAllString(sql, "?")
+	sql = numberLiteralRegexp.ReplaceAllString(sql, "?")
+	sql = placeholderListRegexp.ReplaceAllString(sql, "...")
+	sql = valuesRowsRegexp.ReplaceAllString(sql, "(...)")
+	return sql
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test queries are normalized to their shape
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT * FROM events_2024 WHERE id = ? LIMIT 10 OFFSET 20", "SELECT * FROM events_2024 WHERE id = ? LIMIT ? OFFSET ?"},
+		{"INSERT INTO products (name, price) VALUES (?, ?), (?, DEFAULT), (?, ?)", "INSERT INTO products (name, price) VALUES (...)"},
+		{"INSERT INTO tags (name) VALUES (?), (?)", "INSERT INTO tags (name) VALUES (...)"},
+		{"SELECT * FROM products WHERE name = 'it''s' AND price > 9.5", "SELECT * FROM products WHERE name = ? AND price > ?"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, NormalizeQuery(tt.sql), tt.sql)
+	}
+}
+
+// Test slow queries are grouped by shape and arg types
+func TestSlowLog(t *testing.T) {
+	log := NewSlowLog(100 * time.Millisecond)
+	page := func(limit string, arg any) *utils.ReturnQuery {
+		return &utils.ReturnQuery{Query: "SELECT * FROM orders WHERE status = ? LIMIT " + limit, Args: []any{arg}, Table: "orders"}
+	}
+
+	log.Record(page("10", "open"), 300*time.Millisecond, 10)
+	log.Record(page("50", "closed"), 200*time.Millisecond, 50)
+	log.Record(page("10", 3), 150*time.Millisecond, 0)
+	log.Record(page("10", "open"), 10*time.Millisecond, 10) // fast
+
+	entries := log.Entries()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "SELECT * FROM orders WHERE status = ? LIMIT ?", entries[0].Shape)
+	assert.Equal(t, []string{"string"}, entries[0].ArgTypes)
+	assert.Equal(t, 2, entries[0].Calls)
+	assert.Equal(t, 500*time.Millisecond, entries[0].TotalTime)
+	assert.Equal(t, 300*time.Millisecond, entries[0].MaxTime)
+	assert.Equal(t, int64(60), entries[0].Rows)
+	assert.Equal(t, []string{"int"}, entries[1].ArgTypes)
+
+	rec := httptest.NewRecorder()
+	log.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/slow", nil))
+	var served []SlowQuery
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Len(t, served, 2)
+	assert.Equal(t, "orders", served[0].Table)
+
+	log.Reset()
+	assert.Empty(t, log.Entries())
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Stats keeps per-table request counters when set. Mount it on /api/_stats
+// for a lightweight view of the traffic each table serves.
+var Stats *RequestStats
+
+// RequestStats counts the reads, writes and errors of each table. GetQL
+// counts requests and the queries it fails to build, and callers report
+// each execution with Observe to add latency, rows and database errors.
+type RequestStats struct {
+	mu     sync.Mutex
+	tables map[string]*tableCounters
+}
+
+type tableCounters struct {
+	reads, writes, errors int64
+	rows                  int64
+	executions            int64
+	latency               time.Duration
+}
+
+// TableStats are the counters of one table
+type TableStats struct {
+	Table  string `json:"table"`
+	Reads  int64  `json:"reads"`
+	Writes int64  `json:"writes"`
+	Errors int64  `json:"errors"`
+	// Rows is the number of rows served or written, as reported by Observe
+	Rows int64 `json:"rows"`
+	// AvgLatencyMS is the mean execution time of the observed queries
+	AvgLatencyMS float64 `json:"avg_latency_ms"`
+}
+
+// NewRequestStats creates request statistics with every counter at zero
+func NewRequestStats() *RequestStats {
+	return &RequestStats{tables: map[string]*tableCounters{}}
+}
+
+// recordRequest counts a request in Stats, when set: a read or write when q
+// was built, otherwise an error
+func recordRequest(tableName string, q *utils.ReturnQuery, err error) {
+	s := Stats
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.counters(tableName)
+	switch {
+	case err != nil:
+		c.errors++
+	case q.ReadOnly:
+		c.reads++
+	default:
+		c.writes++
+	}
+}
+
+// Observe reports the execution of the query built for r, which took
+// elapsed and served or wrote rows. A non-nil err counts as an error.
+func (s *RequestStats) Observe(r *http.Request, elapsed time.Duration, rows int, err error) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 2 || parts[1] == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.counters(parts[1])
+	if err != nil {
+		c.errors++
+		return
+	}
+	c.executions++
+	c.latency += elapsed
+	c.rows += int64(rows)
+}
+
+// counters returns the counters of tableName, creating them if needed. The
+// caller holds s.mu.
+func (s *RequestStats) counters(tableName string) *tableCounters {
+	c, ok := s.tables[tableName]
+	if !ok {
+		c = &tableCounters{}
+		s.tables[tableName] = c
+	}
+	return c
+}
+
+// Tables returns the counters of every table seen, by table name
+func (s *RequestStats) Tables() []TableStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]TableStats, 0, len(s.tables))
+	for name, c := range s.tables {
+		stat := TableStats{Table: name, Reads: c.reads, Writes: c.writes, Errors: c.errors, Rows: c.rows}
+		if c.executions > 0 {
+			stat.AvgLatencyMS = float64(c.latency) / float64(c.executions) / float64(time.Millisecond)
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Table < stats[j].Table })
+	return stats
+}
+
+// ServeHTTP lists the table counters as JSON
+func (s *RequestStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Tables())
+}
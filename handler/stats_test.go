@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test per-table counters of requests and reported executions
+func TestRequestStats(t *testing.T) {
+	defer func(s *RequestStats) { Stats = s }(Stats)
+	Stats = NewRequestStats()
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/products?level=eq.2", nil),
+		httptest.NewRequest(http.MethodGet, "/products", nil),
+		httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name":"pen"}`)),
+		httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`not json`)),
+		httptest.NewRequest(http.MethodDelete, "/orders?id=eq.1", nil),
+	}
+	for _, r := range requests {
+		GetQL(r, "postgres")
+	}
+
+	Stats.Observe(requests[0], 10*time.Millisecond, 5, nil)
+	Stats.Observe(requests[1], 30*time.Millisecond, 15, nil)
+	Stats.Observe(requests[4], 0, 0, errors.New("connection reset"))
+
+	assert.Equal(t, []TableStats{
+		{Table: "orders", Writes: 1, Errors: 1},
+		{Table: "products", Reads: 2, Writes: 1, Errors: 1, Rows: 20, AvgLatencyMS: 20},
+	}, Stats.Tables())
+
+	rec := httptest.NewRecorder()
+	Stats.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/_stats", nil))
+	var served []TableStats
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Equal(t, Stats.Tables(), served)
+}
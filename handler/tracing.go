@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/The-ForgeBase/restql/handler"
+
+// startSpan starts the span covering query parsing and building. When the
+// request context carries no span yet, the incoming trace context is read
+// from the request headers so the span joins the caller's trace.
+func (h *Handler) startSpan(r *http.Request, tableName string) (context.Context, trace.Span) {
+	ctx := r.Context()
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+	}
+
+	return otel.Tracer(tracerName).Start(ctx, "restql.GetQL",
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("restql.table", tableName),
+			attribute.String("http.request.method", r.Method),
+			attribute.String("db.system", h.dbType),
+		),
+	)
+}
+
+// endSpan records the outcome of building a query and ends the span
+func (h *Handler) endSpan(span trace.Span, q *utils.ReturnQuery, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if h.sanitized(q) {
+		span.SetAttributes(
+			attribute.String("db.query.text", q.Query),
+			attribute.Int("restql.args", len(q.Args)),
+		)
+	}
+	span.End()
+}
+
+// sanitized reports whether the query text holds only placeholders and no
+// request values, so it is safe to attach to a span. SurrealDB writes inline
+// the record id of the path.
+func (h *Handler) sanitized(q *utils.ReturnQuery) bool {
+	return q.ReadOnly || h.dbType != "surrealdb"
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Test GetQL emits a span joined to the incoming trace context
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	defer otel.SetTextMapPropagator(otel.GetTextMapPropagator())
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	req := httptest.NewRequest(http.MethodGet, "/products?level=eq.2", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest(http.MethodGet, "/123invalid", nil)
+	_, err = GetQL(req, "postgres")
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+
+	span := spans[0]
+	assert.Equal(t, "restql.GetQL", span.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Contains(t, span.Attributes(), attribute.String("restql.table", "products"))
+	assert.Contains(t, span.Attributes(), attribute.String("db.query.text", "SELECT * FROM products WHERE level = ? ORDER BY id ASC LIMIT 100 OFFSET 0"))
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Build a UNION ALL over sibling tables, e.g.
+// GET /_union?tables=events_2023,events_2024&kind=eq.click, applying the same
+// filters, selection, order and pagination to the combined rows
+func (h *Handler) unionQuery(r *http.Request) (*utils.ReturnQuery, error) {
+	if r.Method != http.MethodGet {
+		return nil, fmt.Errorf("method not allowed")
+	}
+
+	params, err := query.ParseParams(r.URL.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query string")
+	}
+	queryParams := url.Values{}
+	filters := make([]query.Param, 0, len(params))
+	for _, param := range params {
+		queryParams.Add(param.Key, param.Value)
+		if param.Key != "tables" {
+			filters = append(filters, param)
+		}
+	}
+
+	// 1. Validate the tables
+	tables := strings.Split(queryParams.Get("tables"), ",")
+	if len(tables) < 2 {
+		return nil, fmt.Errorf("at least two tables required")
+	}
+	for _, table := range tables {
+		if err := utils.ValidateTableName(table); err != nil {
+			return nil, fmt.Errorf("invalid table name")
+		}
+	}
+
+	metas := make([]*utils.Table, len(tables))
+	for i, table := range tables {
+		metas[i] = h.tableMeta(table)
+	}
+
+	return h.unionSQL(r, tables, metas, filters, queryParams, false)
+}
+
+// unionSQL combines tables, whose schema metadata is metas, with UNION ALL.
+// sameColumns skips checking the columns line up, for tables known to share
+// a structure like partitions.
+func (h *Handler) unionSQL(r *http.Request, tables []string, metas []*utils.Table, filters []query.Param, queryParams url.Values, sameColumns bool) (*utils.ReturnQuery, error) {
+	// 2. Check every table has the selected columns
+	columns, err := query.ParseSelect(queryParams.Get("select"), metas[0])
+	if err != nil {
+		return nil, err
+	}
+	if !sameColumns {
+		if columns, err = unionColumns(queryParams.Get("select"), tables, metas); err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. Handle sorting and pagination
+	orderSQL, err := query.ParseOrder(queryParams.Get("order"))
+	if err != nil {
+		return nil, err
+	}
+	if orderSQL == "" {
+		orderSQL = "ORDER BY id ASC"
+	}
+	limit, offset := h.pagination(r, queryParams)
+
+	// SurrealDB selects from several tables natively
+	if h.dbType == "surrealdb" || len(tables) == 1 {
+		opts := h.filterOptions(r, tables[0])
+		opts.Table = metas[0]
+		filterSQL, args, err := query.ParseFilters(filters, opts)
+		if err != nil {
+			return nil, err
+		}
+		sql := h.selectSQL(strings.Join(tables, ", "), columns, filterSQL, orderSQL, limit, offset)
+		return &utils.ReturnQuery{Query: sql, Args: args, Table: strings.Join(tables, ","), ReadOnly: true}, nil
+	}
+
+	// 4. Apply the filters to each table, validated against its own schema
+	selects := make([]string, 0, len(tables))
+	args := []interface{}{}
+	for i, table := range tables {
+		opts := h.filterOptions(r, table)
+		opts.Table = metas[i]
+		filterSQL, filterArgs, err := query.ParseFilters(filters, opts)
+		if err != nil {
+			return nil, err
+		}
+		sql := fmt.Sprintf("SELECT %s FROM %s", columns, table)
+		if filterSQL != "" {
+			sql += " WHERE " + filterSQL
+		}
+		selects = append(selects, sql)
+		args = append(args, filterArgs...)
+	}
+
+	sql := h.selectSQL("("+strings.Join(selects, " UNION ALL ")+") AS combined", "*", "", orderSQL, limit, offset)
+	return &utils.ReturnQuery{Query: sql, Args: args, Table: strings.Join(tables, ","), ReadOnly: true}, nil
+}
+
+// unionColumns returns the select list shared by every table. Without an
+// explicit select, every table must have metadata with the same columns so
+// UNION ALL lines them up.
+func unionColumns(selectParam string, tables []string, metas []*utils.Table) (string, error) {
+	if selectParam == "" {
+		var first []string
+		for i, table := range tables {
+			meta := metas[i]
+			if meta == nil {
+				return "", fmt.Errorf("select required: no schema for %s", table)
+			}
+			names := make([]string, 0, len(meta.Columns))
+			for _, col := range meta.Columns {
+				names = append(names, col.Name)
+			}
+			if first == nil {
+				first = names
+			} else if strings.Join(names, ",") != strings.Join(first, ",") {
+				return "", fmt.Errorf("tables %s and %s have different columns", tables[0], table)
+			}
+		}
+		return strings.Join(first, ", "), nil
+	}
+
+	var columns string
+	for i, table := range tables {
+		cols, err := query.ParseSelect(selectParam, metas[i])
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", table, err)
+		}
+		columns = cols
+	}
+	if columns == "*" {
+		return unionColumns("", tables, metas)
+	}
+	return columns, nil
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test UNION ALL reads across sibling tables
+func TestUnion(t *testing.T) {
+	defer func(schema map[string]*utils.Table) { Schema = schema }(Schema)
+
+	columns := []utils.Column{{Name: "id", Type: "BIGINT"}, {Name: "kind", Type: "TEXT"}}
+	Schema = map[string]*utils.Table{
+		"events_2023": {Name: "events_2023", Columns: columns},
+		"events_2024": {Name: "events_2024", Columns: columns},
+		"events_old":  {Name: "events_old", Columns: columns[:1]},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/_union?tables=events_2023,events_2024&kind=eq.click&order=id.desc&page_size=10", nil)
+	query, err := GetQL(req, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM (SELECT id, kind FROM events_2023 WHERE kind = ? UNION ALL SELECT id, kind FROM events_2024 WHERE kind = ?) AS combined ORDER BY id DESC LIMIT 10 OFFSET 0", query.Query)
+	assert.Equal(t, []interface{}{"click", "click"}, query.Args)
+	assert.Equal(t, "events_2023,events_2024", query.Table)
+	assert.True(t, query.ReadOnly)
+
+	req = httptest.NewRequest(http.MethodGet, "/_union?tables=events_2023,events_2024&select=id", nil)
+	query, err = GetQL(req, "surrealdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id FROM events_2023, events_2024 ORDER BY id ASC LIMIT 100 START 0", query.Query)
+
+	errors := map[string]string{
+		"/_union?tables=events_2023":                        "at least two tables required",
+		"/_union?tables=events_2023,events_old":             "tables events_2023 and events_old have different columns",
+		"/_union?tables=events_2023,events_old&select=kind": "events_old: unknown column kind",
+		"/_union?tables=events_2023,logs":                   "select required: no schema for logs",
+		"/_union?tables=events_2023,bad-name&select=id":     "invalid table name",
+	}
+	for path, expected := range errors {
+		_, err := GetQL(httptest.NewRequest(http.MethodGet, path, nil), "postgres")
+		assert.EqualError(t, err, expected, path)
+	}
+}
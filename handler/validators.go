@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validators holds per table and column the checks run against write
+// payloads before any SQL is generated, e.g.
+//
+//	handler.Validators["users"] = map[string][]handler.Validator{
+//		"email": {handler.Pattern(`^[^@\s]+@[^@\s]+$`), handler.Length(3, 254)},
+//		"age":   {handler.Range(0, 150)},
+//	}
+var Validators = map[string]map[string][]Validator{}
+
+// Validator checks a column value of an insert or update, returning an
+// error whose message is shown to the client. Null values are not checked.
+type Validator func(value any) error
+
+// FieldError is a value a Validator rejected
+type FieldError struct {
+	// Record is the position of the record in an insert, 0 for updates
+	Record  int    `json:"record"`
+	Column  string `json:"column"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every rejected value of a write. Serve it as
+// 422 Unprocessable Entity with its Fields as the body.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	// Records are only numbered when an insert of several failed past the
+	// first
+	numbered := false
+	for _, field := range e.Fields {
+		numbered = numbered || field.Record > 0
+	}
+
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Column + ": " + field.Message
+		if numbered {
+			messages[i] = fmt.Sprintf("record %d %s", field.Record, messages[i])
+		}
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// StatusCode returns the HTTP status for the error
+func (e *ValidationError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// validateRecords runs the Validators of tableName against every record,
+// returning a *ValidationError with all failures
+func validateRecords(tableName string, records []map[string]any) error {
+	validators := Validators[tableName]
+	if len(validators) == 0 {
+		return nil
+	}
+
+	columns := make([]string, 0, len(validators))
+	for column := range validators {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	var fields []FieldError
+	for i, record := range records {
+		for _, column := range columns {
+			value, ok := record[column]
+			if !ok || value == nil {
+				continue
+			}
+			for _, validate := range validators[column] {
+				if err := validate(value); err != nil {
+					fields = append(fields, FieldError{Record: i, Column: column, Message: err.Error()})
+					break
+				}
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// Pattern accepts strings matching the regular expression expr. It panics
+// if expr does not compile, like regexp.MustCompile.
+func Pattern(expr string) Validator {
+	re := regexp.MustCompile(expr)
+	return func(value any) error {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a string")
+		}
+		if !re.MatchString(s) {
+			return fmt.Errorf("must match %s", expr)
+		}
+		return nil
+	}
+}
+
+// Length accepts strings of min to max characters. A max of zero sets no
+// upper bound.
+func Length(min, max int) Validator {
+	return func(value any) error {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a string")
+		}
+		n := utf8.RuneCountInString(s)
+		if n < min {
+			return fmt.Errorf("must be at least %d characters", min)
+		}
+		if max > 0 && n > max {
+			return fmt.Errorf("must be at most %d characters", max)
+		}
+		return nil
+	}
+}
+
+// Range accepts numbers from min to max inclusive
+func Range(min, max float64) Validator {
+	return func(value any) error {
+		n, ok := number(value)
+		if !ok {
+			return fmt.Errorf("must be a number")
+		}
+		if n < min || n > max {
+			return fmt.Errorf("must be between %v and %v", min, max)
+		}
+		return nil
+	}
+}
+
+// number converts a decoded JSON, CSV or form value to a float
+func number(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test write payloads are checked by the column validators
+func TestValidators(t *testing.T) {
+	Validators["users"] = map[string][]Validator{
+		"email": {Pattern(`^[^@\s]+@[^@\s]+$`), Length(3, 20)},
+		"age":   {Range(0, 150)},
+		"name": {func(value any) error {
+			if value == "admin" {
+				return fmt.Errorf("is reserved")
+			}
+			return nil
+		}},
+	}
+	defer delete(Validators, "users")
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		errMsg string
+	}{
+		{http.MethodPost, "/users", `{"email": "a@b.co", "age": 30, "name": "ann"}`, ""},
+		{http.MethodPost, "/users", `{"email": null, "name": "ann"}`, ""},
+		{http.MethodPost, "/users", `{"email": "not-an-email", "age": 200}`, "validation failed: age: must be between 0 and 150; email: must match ^[^@\\s]+@[^@\\s]+$"},
+		{http.MethodPost, "/users", `[{"email": "a@b.co"}, {"email": "averyveryverylong@example.com", "name": "admin"}]`, "validation failed: record 1 email: must be at most 20 characters; record 1 name: is reserved"},
+		{http.MethodPost, "/users", `{"age": "old"}`, "validation failed: age: must be a number"},
+		{http.MethodPut, "/users/1", `{"name": "admin"}`, "validation failed: name: is reserved"},
+		{http.MethodPut, "/users/1", `{"age": 40}`, ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(tt.body)))
+		_, err := GetQL(req, "postgres")
+		if tt.errMsg == "" {
+			assert.NoError(t, err, tt.body)
+			continue
+		}
+		assert.EqualError(t, err, tt.errMsg, tt.body)
+		var validationErr *ValidationError
+		if assert.True(t, errors.As(err, &validationErr)) {
+			assert.Equal(t, http.StatusUnprocessableEntity, validationErr.StatusCode())
+		}
+	}
+}
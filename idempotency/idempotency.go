@@ -0,0 +1,183 @@
+// Package idempotency replays the stored response of a POST retried with the
+// same Idempotency-Key header, so a flaky client retrying an insert does not
+// insert twice.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/The-ForgeBase/restql/cache"
+)
+
+// Header is the request header carrying the client's key
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses replayed from the store
+const ReplayedHeader = "Idempotent-Replayed"
+
+const keyPrefix = "restql:idempotency:"
+
+// MaxKeyLength bounds the length of accepted keys
+const MaxKeyLength = 255
+
+// Keys is HTTP middleware remembering responses by Idempotency-Key. Keys are
+// global, so clients should use random keys, like UUIDs; prefix them per
+// user in front of the middleware when clients cannot be trusted to.
+type Keys struct {
+	store cache.Store
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+}
+
+// New stores responses in store, such as cache.NewLRU, for ttl. A store
+// shared between processes, like Redis, makes retries safe across them.
+func New(store cache.Store, ttl time.Duration) *Keys {
+	return &Keys{store: store, ttl: ttl, inFlight: map[string]bool{}}
+}
+
+// response is a stored response with the fingerprint of its request
+type response struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// Middleware wraps next. A POST with a key seen before gets the stored
+// response without reaching next; reusing a key for a different request is
+// rejected with 422, and a retry while the first request is still running
+// with 409. Server errors are not stored, so they can be retried.
+func (k *Keys) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > MaxKeyLength {
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := fingerprint(r, body)
+
+		if stored, ok := k.load(key); ok {
+			if stored.Fingerprint != fingerprint {
+				http.Error(w, "Idempotency-Key was used for a different request", http.StatusUnprocessableEntity)
+				return
+			}
+			replay(w, stored)
+			return
+		}
+
+		if !k.begin(key) {
+			http.Error(w, "a request with this Idempotency-Key is in progress", http.StatusConflict)
+			return
+		}
+		defer k.end(key)
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status < 500 {
+			k.save(key, &response{
+				Fingerprint: fingerprint,
+				Status:      rec.status,
+				Header:      w.Header().Clone(),
+				Body:        rec.body.Bytes(),
+			})
+		}
+	})
+}
+
+func (k *Keys) load(key string) (*response, bool) {
+	data, ok := k.store.Get(keyPrefix + key)
+	if !ok {
+		return nil, false
+	}
+	var stored response
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, false
+	}
+	return &stored, true
+}
+
+func (k *Keys) save(key string, stored *response) {
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return
+	}
+	k.store.Set(keyPrefix+key, data, k.ttl)
+}
+
+// begin marks key in flight, reporting false when it already is
+func (k *Keys) begin(key string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.inFlight[key] {
+		return false
+	}
+	k.inFlight[key] = true
+	return true
+}
+
+func (k *Keys) end(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.inFlight, key)
+}
+
+// fingerprint identifies a request by its method, URL and body
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, stored *response) {
+	for name, values := range stored.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+}
+
+// recorder passes a response through while keeping a copy
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,72 @@
+package idempotency
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/The-ForgeBase/restql/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test retries with the same key replay the first response
+func TestMiddleware(t *testing.T) {
+	calls := 0
+	keys := New(cache.NewLRU(10), time.Hour)
+	handler := keys.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(Header, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := post("abc", `{"name": "A"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, `{"name": "A"}`, first.Body.String())
+
+	retry := post("abc", `{"name": "A"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, `{"name": "A"}`, retry.Body.String())
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+	assert.Equal(t, "true", retry.Header().Get(ReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	reused := post("abc", `{"name": "B"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Equal(t, 1, calls)
+
+	post("", `{"name": "A"}`)
+	post("", `{"name": "A"}`)
+	assert.Equal(t, 3, calls)
+}
+
+// Test server errors are not stored, so retries run again
+func TestServerErrorsNotStored(t *testing.T) {
+	calls := 0
+	keys := New(cache.NewLRU(10), time.Hour)
+	handler := keys.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+	}))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{}`))
+		req.Header.Set(Header, "abc")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	assert.Equal(t, 2, calls)
+}
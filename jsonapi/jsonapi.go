@@ -0,0 +1,255 @@
+// Package jsonapi maps restql requests and results to the JSON:API format:
+// resource objects with type/id/attributes, fields[type] sparse fieldsets,
+// sort, page[number]/page[size] pagination, and pagination links.
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/query"
+)
+
+// MediaType is the JSON:API media type
+const MediaType = "application/vnd.api+json"
+
+// Accepts reports whether the request asks for a JSON:API response
+func Accepts(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			if mediaType(part) == MediaType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsDocument reports whether the request body is a JSON:API document
+func IsDocument(r *http.Request) bool {
+	return mediaType(r.Header.Get("Content-Type")) == MediaType
+}
+
+func mediaType(value string) string {
+	mt, _, err := mime.ParseMediaType(strings.TrimSpace(value))
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// TranslateParams rewrites JSON:API query parameters into restql's:
+// fields[table] becomes select (always including id), sort=-price,name
+// becomes order=price.desc,name.asc, and page[number]/page[size] become
+// page/page_size. Filters pass through unchanged. include is rejected because
+// resource embedding is not supported.
+func TranslateParams(table string, params []query.Param) ([]query.Param, error) {
+	out := make([]query.Param, 0, len(params))
+
+	for _, param := range params {
+		switch {
+		case param.Key == "include":
+			return nil, fmt.Errorf("include is not supported")
+		case param.Key == "fields["+table+"]":
+			fields := strings.Split(param.Value, ",")
+			if !contains(fields, "id") {
+				fields = append([]string{"id"}, fields...)
+			}
+			out = append(out, query.Param{Key: "select", Value: strings.Join(fields, ",")})
+		case strings.HasPrefix(param.Key, "fields["):
+			// Fieldsets for other types only apply to included resources
+			return nil, fmt.Errorf("include is not supported")
+		case param.Key == "sort":
+			out = append(out, query.Param{Key: "order", Value: sortOrder(param.Value)})
+		case param.Key == "page[number]":
+			out = append(out, query.Param{Key: "page", Value: param.Value})
+		case param.Key == "page[size]":
+			out = append(out, query.Param{Key: "page_size", Value: param.Value})
+		default:
+			out = append(out, param)
+		}
+	}
+
+	return out, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sortOrder converts a JSON:API sort like -price,name to price.desc,name.asc
+func sortOrder(sort string) string {
+	fields := strings.Split(sort, ",")
+	for i, field := range fields {
+		if strings.HasPrefix(field, "-") {
+			fields[i] = field[1:] + ".desc"
+		} else {
+			fields[i] = field + ".asc"
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// Attributes unwraps the resource objects in a JSON:API request document
+// into a JSON object (or array of objects) of their attributes, keeping the
+// attribute order. A client-generated id is copied into the attributes.
+func Attributes(body []byte) ([]byte, error) {
+	var doc struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil || len(doc.Data) == 0 {
+		return nil, fmt.Errorf("invalid JSON:API document")
+	}
+
+	data := bytes.TrimSpace(doc.Data)
+	if len(data) > 0 && data[0] == '[' {
+		var resources []json.RawMessage
+		if err := json.Unmarshal(data, &resources); err != nil {
+			return nil, fmt.Errorf("invalid JSON:API document")
+		}
+		parts := make([][]byte, 0, len(resources))
+		for _, raw := range resources {
+			attrs, err := resourceAttributes(raw)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, attrs)
+		}
+		return append(append([]byte("["), bytes.Join(parts, []byte(","))...), ']'), nil
+	}
+
+	return resourceAttributes(data)
+}
+
+func resourceAttributes(raw json.RawMessage) ([]byte, error) {
+	var resource struct {
+		Type       string          `json:"type"`
+		ID         json.RawMessage `json:"id"`
+		Attributes json.RawMessage `json:"attributes"`
+	}
+	if err := json.Unmarshal(raw, &resource); err != nil || resource.Type == "" {
+		return nil, fmt.Errorf("invalid JSON:API resource object")
+	}
+
+	attrs := bytes.TrimSpace(resource.Attributes)
+	if len(attrs) == 0 {
+		attrs = []byte("{}")
+	}
+	if attrs[0] != '{' {
+		return nil, fmt.Errorf("invalid JSON:API resource object")
+	}
+	if len(resource.ID) == 0 {
+		return attrs, nil
+	}
+
+	// Prepend the id so it is inserted like any other column
+	if bytes.Equal(bytes.TrimSpace(attrs[1:]), []byte("}")) {
+		return []byte(`{"id":` + string(resource.ID) + `}`), nil
+	}
+	return append([]byte(`{"id":`+string(resource.ID)+`,`), attrs[1:]...), nil
+}
+
+// Links are the top-level pagination links of a collection document
+type Links struct {
+	Self  string `json:"self,omitempty"`
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+}
+
+// PageLinks builds pagination links for a page of count rows. Without a total
+// the last link is omitted, and next is only set when the page is full.
+func PageLinks(u *url.URL, page, size, count int) Links {
+	link := func(number int) string {
+		next := *u
+		q := next.Query()
+		q.Del("page")
+		q.Del("page_size")
+		q.Set("page[number]", strconv.Itoa(number))
+		q.Set("page[size]", strconv.Itoa(size))
+		next.RawQuery = q.Encode()
+		return next.String()
+	}
+
+	links := Links{Self: link(page), First: link(1)}
+	if page > 1 {
+		links.Prev = link(page - 1)
+	}
+	if count >= size {
+		links.Next = link(page + 1)
+	}
+	return links
+}
+
+type resource struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// Marshal renders rows of table as a JSON:API collection document
+func Marshal(table string, rows []map[string]interface{}, links Links) ([]byte, error) {
+	data := make([]resource, 0, len(rows))
+	for _, row := range rows {
+		res, err := toResource(table, row)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, res)
+	}
+
+	doc := struct {
+		Data  []resource `json:"data"`
+		Links *Links     `json:"links,omitempty"`
+	}{Data: data}
+	if links != (Links{}) {
+		doc.Links = &links
+	}
+	return json.Marshal(doc)
+}
+
+// MarshalOne renders a single row of table as a JSON:API document
+func MarshalOne(table string, row map[string]interface{}) ([]byte, error) {
+	res, err := toResource(table, row)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Data resource `json:"data"`
+	}{res})
+}
+
+func toResource(table string, row map[string]interface{}) (resource, error) {
+	id, ok := row["id"]
+	if !ok || id == nil {
+		return resource{}, fmt.Errorf("row of %s has no id", table)
+	}
+
+	attrs := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		if k != "id" {
+			attrs[k] = v
+		}
+	}
+
+	return resource{Type: table, ID: formatID(id), Attributes: attrs}, nil
+}
+
+// formatID renders an id as a string, keeping JSON numbers like 1e+06 whole
+func formatID(id interface{}) string {
+	if f, ok := id.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(id)
+}
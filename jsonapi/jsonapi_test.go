@@ -0,0 +1,76 @@
+package jsonapi
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test JSON:API query parameters are translated
+func TestTranslateParams(t *testing.T) {
+	params, err := TranslateParams("products", []query.Param{
+		{Key: "fields[products]", Value: "name,price"},
+		{Key: "sort", Value: "-price,name"},
+		{Key: "page[number]", Value: "2"},
+		{Key: "page[size]", Value: "10"},
+		{Key: "level", Value: "gt.5"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []query.Param{
+		{Key: "select", Value: "id,name,price"},
+		{Key: "order", Value: "price.desc,name.asc"},
+		{Key: "page", Value: "2"},
+		{Key: "page_size", Value: "10"},
+		{Key: "level", Value: "gt.5"},
+	}, params)
+
+	_, err = TranslateParams("products", []query.Param{{Key: "include", Value: "author"}})
+	assert.Error(t, err)
+}
+
+// Test request documents unwrap to plain records
+func TestAttributes(t *testing.T) {
+	body, err := Attributes([]byte(`{"data": {"type": "products", "attributes": {"name": "Phone", "price": 10}}}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name": "Phone", "price": 10}`, string(body))
+
+	body, err = Attributes([]byte(`{"data": [{"type": "products", "id": "a1", "attributes": {"name": "Phone"}}, {"type": "products", "id": "a2"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"id":"a1","name": "Phone"},{"id":"a2"}]`, string(body))
+
+	_, err = Attributes([]byte(`{"name": "Phone"}`))
+	assert.Error(t, err)
+	_, err = Attributes([]byte(`{"data": {"attributes": {}}}`))
+	assert.Error(t, err)
+}
+
+// Test rows render as resource objects with pagination links
+func TestMarshal(t *testing.T) {
+	u, _ := url.Parse("/products?level=gt.5")
+	links := PageLinks(u, 2, 2, 2)
+	assert.Equal(t, "/products?level=gt.5&page%5Bnumber%5D=1&page%5Bsize%5D=2", links.Prev)
+	assert.Equal(t, "/products?level=gt.5&page%5Bnumber%5D=3&page%5Bsize%5D=2", links.Next)
+
+	body, err := Marshal("products", []map[string]interface{}{
+		{"id": float64(1), "name": "Phone"},
+		{"id": "abc", "name": "Case"},
+	}, Links{Self: "/products"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"data": [
+			{"type": "products", "id": "1", "attributes": {"name": "Phone"}},
+			{"type": "products", "id": "abc", "attributes": {"name": "Case"}}
+		],
+		"links": {"self": "/products"}
+	}`, string(body))
+
+	_, err = MarshalOne("products", map[string]interface{}{"name": "Phone"})
+	assert.Error(t, err)
+
+	req := httptest.NewRequest("GET", "/products", nil)
+	req.Header.Set("Accept", "text/html, application/vnd.api+json")
+	assert.True(t, Accepts(req))
+}
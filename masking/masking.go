@@ -0,0 +1,128 @@
+// Package masking masks column values of result rows by the requester's
+// role, so the same table can expose PII differently to different consumers
+// without a view for each.
+package masking
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Strategy is how a value is masked
+type Strategy string
+
+const (
+	// Clear leaves the value as it is
+	Clear Strategy = "clear"
+	// Redact replaces the value with [REDACTED]
+	Redact Strategy = "redact"
+	// Partial keeps the last Keep characters, e.g. ****1234. Values no
+	// longer than Keep are masked entirely.
+	Partial Strategy = "partial"
+	// Hash replaces the value with its SHA-256, so masked values can still
+	// be compared and joined
+	Hash Strategy = "hash"
+)
+
+// Redacted replaces values masked with Redact
+const Redacted = "[REDACTED]"
+
+// Policy masks one column. Roles choose their own strategy; every other
+// role, including an empty one, gets Default.
+type Policy struct {
+	Default Strategy
+	Roles   map[string]Strategy
+	// Keep is the number of trailing characters Partial shows, 4 by default
+	Keep int
+}
+
+// strategy returns the strategy for role
+func (p Policy) strategy(role string) Strategy {
+	if s, ok := p.Roles[role]; ok {
+		return s
+	}
+	return p.Default
+}
+
+// Rules holds the column policies of each table
+type Rules map[string]map[string]Policy
+
+// Validate reports a policy with an unknown strategy
+func (r Rules) Validate() error {
+	for table, columns := range r {
+		for column, policy := range columns {
+			strategies := []Strategy{policy.Default}
+			for _, s := range policy.Roles {
+				strategies = append(strategies, s)
+			}
+			for _, s := range strategies {
+				switch s {
+				case Clear, Redact, Partial, Hash, "":
+				default:
+					return fmt.Errorf("%s.%s: unknown masking strategy %s", table, column, s)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Apply masks the columns of rows read from table for role, in place. Rows
+// of tables without rules are left alone.
+func (r Rules) Apply(table, role string, rows []map[string]any) {
+	columns := r[table]
+	if len(columns) == 0 {
+		return
+	}
+	for _, row := range rows {
+		for column, policy := range columns {
+			if value, ok := row[column]; ok {
+				row[column] = Mask(value, policy.strategy(role), policy.Keep)
+			}
+		}
+	}
+}
+
+// Mask masks a single value. Nulls stay null, so masking does not hide
+// whether a value is set.
+func Mask(value any, strategy Strategy, keep int) any {
+	if value == nil {
+		return nil
+	}
+
+	switch strategy {
+	case Redact:
+		return Redacted
+	case Partial:
+		if keep <= 0 {
+			keep = 4
+		}
+		s := text(value)
+		n := utf8.RuneCountInString(s)
+		if n <= keep {
+			return strings.Repeat("*", n)
+		}
+		runes := []rune(s)
+		return strings.Repeat("*", 4) + string(runes[n-keep:])
+	case Hash:
+		sum := sha256.Sum256([]byte(text(value)))
+		return hex.EncodeToString(sum[:])
+	default:
+		return value
+	}
+}
+
+// text formats value as a string, keeping bytes as their content
+func text(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,61 @@
+package masking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test values are masked with each strategy
+func TestMask(t *testing.T) {
+	tests := []struct {
+		value    any
+		strategy Strategy
+		keep     int
+		want     any
+	}{
+		{"4111111111111234", Partial, 0, "****1234"},
+		{"jane@example.com", Partial, 3, "****com"},
+		{"abc", Partial, 4, "***"},
+		{int64(5551234567), Partial, 2, "****67"},
+		{"secret", Redact, 0, Redacted},
+		{"jane@example.com", Hash, 0, "8c87b489ce35cf2e2f39f80e282cb2e804932a56a213983eeeb428407d43b52d"},
+		{"jane@example.com", Clear, 0, "jane@example.com"},
+		{nil, Redact, 0, nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Mask(tt.value, tt.strategy, tt.keep), "%v %s", tt.value, tt.strategy)
+	}
+}
+
+// Test rules mask rows by role
+func TestApply(t *testing.T) {
+	rules := Rules{"users": {
+		"email": {Default: Redact, Roles: map[string]Strategy{"support": Partial, "admin": Clear}},
+		"ssn":   {Default: Redact},
+	}}
+	assert.NoError(t, rules.Validate())
+
+	rows := func() []map[string]any {
+		return []map[string]any{{"id": 1, "email": "jane@example.com", "ssn": "123-45-6789"}}
+	}
+
+	support := rows()
+	rules.Apply("users", "support", support)
+	assert.Equal(t, []map[string]any{{"id": 1, "email": "****.com", "ssn": Redacted}}, support)
+
+	admin := rows()
+	rules.Apply("users", "admin", admin)
+	assert.Equal(t, []map[string]any{{"id": 1, "email": "jane@example.com", "ssn": Redacted}}, admin)
+
+	anonymous := rows()
+	rules.Apply("users", "", anonymous)
+	assert.Equal(t, Redacted, anonymous[0]["email"])
+
+	other := []map[string]any{{"email": "jane@example.com"}}
+	rules.Apply("orders", "", other)
+	assert.Equal(t, "jane@example.com", other[0]["email"])
+
+	assert.EqualError(t, Rules{"users": {"email": {Default: "scramble"}}}.Validate(), "users.email: unknown masking strategy scramble")
+}
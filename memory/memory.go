@@ -0,0 +1,426 @@
+// Package memory serves the restql REST API from in-process maps, for unit
+// tests and demos that should not need a database. Filters are evaluated by
+// query.MatchFilters, so reads select the same rows as the generated SQL for
+// the grammar it supports; select, order and pagination work as on a
+// database. Aggregation, joins and the special tables are not supported.
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// DB holds tables of rows keyed by column name
+type DB struct {
+	mu     sync.RWMutex
+	tables map[string]*table
+}
+
+type table struct {
+	rows   []map[string]any
+	nextID int64
+}
+
+// New creates an empty database. Tables are created by their first insert.
+func New() *DB {
+	return &DB{tables: map[string]*table{}}
+}
+
+// Seed inserts rows into tableName, giving rows without an id the next one
+func (db *DB) Seed(tableName string, rows ...map[string]any) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.insert(tableName, rows)
+}
+
+// Rows returns a copy of the rows of tableName, in insertion order
+func (db *DB) Rows(tableName string) []map[string]any {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t, ok := db.tables[tableName]
+	if !ok {
+		return []map[string]any{}
+	}
+	rows := make([]map[string]any, len(t.rows))
+	for i, row := range t.rows {
+		rows[i] = cloneRow(row)
+	}
+	return rows
+}
+
+// ServeHTTP serves /{table} and /{table}/{id} like a handler running the
+// queries restql generates: GET lists rows, POST inserts one or more
+// records, PUT replaces a row, PATCH merges fields into it, and DELETE
+// removes a row or the rows matching filters. Responses are the affected rows as JSON.
+func (db *DB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 2 || parts[1] == "" {
+		http.Error(w, "table name required", http.StatusBadRequest)
+		return
+	}
+	tableName, id := parts[1], ""
+	if len(parts) > 2 {
+		id = parts[2]
+	}
+	if err := utils.ValidateTableName(tableName); err != nil {
+		http.Error(w, "invalid table name", http.StatusBadRequest)
+		return
+	}
+
+	params, err := query.ParseParams(r.URL.RawQuery)
+	if err != nil {
+		http.Error(w, "invalid query string", http.StatusBadRequest)
+		return
+	}
+
+	var rows []map[string]any
+	status := http.StatusOK
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		rows, err = db.list(tableName, params)
+	case r.Method == http.MethodPost && id == "":
+		rows, err = db.create(tableName, r)
+		status = http.StatusCreated
+	case (r.Method == http.MethodPut || r.Method == http.MethodPatch) && id != "":
+		rows, err = db.update(tableName, id, r, r.Method == http.MethodPut)
+	case r.Method == http.MethodDelete:
+		rows, err = db.remove(tableName, id, params)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rows == nil {
+		http.Error(w, "record not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rows)
+}
+
+// list reads the rows of a table matching the filters, ordered, paginated
+// and projected by the request
+func (db *DB) list(tableName string, params []query.Param) ([]map[string]any, error) {
+	values := map[string]string{}
+	for _, param := range params {
+		values[param.Key] = param.Value
+	}
+	columns, err := selectColumns(values["select"])
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	rows, err := db.matching(tableName, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := sortRows(rows, values["order"]); err != nil {
+		return nil, err
+	}
+
+	limit, offset := query.ParsePagination(values["page"], values["page_size"])
+	if n, err := strconv.Atoi(values["limit"]); err == nil && n >= 0 {
+		limit = n
+	}
+	if n, err := strconv.Atoi(values["offset"]); err == nil && n >= 0 {
+		offset = n
+	}
+	rows = rows[min(offset, len(rows)):]
+	rows = rows[:min(limit, len(rows))]
+
+	result := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		result[i] = project(row, columns)
+	}
+	return result, nil
+}
+
+// create inserts the records of a JSON body
+func (db *DB) create(tableName string, r *http.Request) ([]map[string]any, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body")
+	}
+	records, _, err := utils.DecodeRecords(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON format")
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no records to insert")
+	}
+	for _, record := range records {
+		for column := range record {
+			if err := utils.ValidateColumnName(column); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.insert(tableName, records), nil
+}
+
+// insert appends records, returning copies of the stored rows. The caller
+// holds db.mu.
+func (db *DB) insert(tableName string, records []map[string]any) []map[string]any {
+	t, ok := db.tables[tableName]
+	if !ok {
+		t = &table{}
+		db.tables[tableName] = t
+	}
+
+	inserted := make([]map[string]any, len(records))
+	for i, record := range records {
+		row := cloneRow(record)
+		if id, ok := row["id"]; !ok || id == nil {
+			t.nextID++
+			row["id"] = t.nextID
+		} else if n, ok := toInt(id); ok && n > t.nextID {
+			t.nextID = n
+		}
+		t.rows = append(t.rows, row)
+		inserted[i] = cloneRow(row)
+	}
+	return inserted
+}
+
+// update merges the fields of a JSON object into the row with id, or
+// replaces its fields with them
+func (db *DB) update(tableName, id string, r *http.Request, replace bool) ([]map[string]any, error) {
+	var updates map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		return nil, fmt.Errorf("invalid JSON format")
+	}
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("no fields to update")
+	}
+	for column := range updates {
+		if err := utils.ValidateColumnName(column); err != nil {
+			return nil, err
+		}
+	}
+	delete(updates, "id")
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, ok := db.tables[tableName]
+	if !ok {
+		return nil, nil
+	}
+	for _, row := range t.rows {
+		if fmt.Sprint(row["id"]) == id {
+			if replace {
+				for column := range row {
+					if column != "id" {
+						delete(row, column)
+					}
+				}
+			}
+			for column, value := range updates {
+				row[column] = value
+			}
+			return []map[string]any{cloneRow(row)}, nil
+		}
+	}
+	return nil, nil
+}
+
+// remove deletes the row with id, or the rows matching the filters
+func (db *DB) remove(tableName, id string, params []query.Param) ([]map[string]any, error) {
+	filtered := slices.ContainsFunc(params, func(p query.Param) bool {
+		_, reserved := utils.ReservedWords[p.Key]
+		return !reserved
+	})
+	if id == "" && !filtered {
+		return nil, fmt.Errorf("primary key or filters required for delete")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, ok := db.tables[tableName]
+	if !ok {
+		return []map[string]any{}, nil
+	}
+
+	deleted := []map[string]any{}
+	kept := make([]map[string]any, 0, len(t.rows))
+	for _, row := range t.rows {
+		match := fmt.Sprint(row["id"]) == id
+		if id == "" {
+			var err error
+			if match, err = query.MatchFilters(params, row); err != nil {
+				return nil, err
+			}
+		}
+		if match {
+			deleted = append(deleted, row)
+		} else {
+			kept = append(kept, row)
+		}
+	}
+	t.rows = kept
+	if id != "" && len(deleted) == 0 {
+		return nil, nil
+	}
+	return deleted, nil
+}
+
+// matching returns copies of the rows of tableName matching the filters.
+// The caller holds db.mu.
+func (db *DB) matching(tableName string, params []query.Param) ([]map[string]any, error) {
+	rows := []map[string]any{}
+	t, ok := db.tables[tableName]
+	if !ok {
+		return rows, nil
+	}
+	for _, row := range t.rows {
+		ok, err := query.MatchFilters(params, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, cloneRow(row))
+		}
+	}
+	return rows, nil
+}
+
+// selectColumns parses ?select=, returning nil for every column
+func selectColumns(selectParam string) ([]string, error) {
+	if selectParam == "" || selectParam == "*" {
+		return nil, nil
+	}
+	columns := []string{}
+	for _, column := range strings.Split(selectParam, ",") {
+		column = strings.TrimSpace(column)
+		if err := utils.ValidateColumnName(column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func project(row map[string]any, columns []string) map[string]any {
+	if columns == nil {
+		return row
+	}
+	projected := make(map[string]any, len(columns))
+	for _, column := range columns {
+		projected[column] = row[column]
+	}
+	return projected
+}
+
+// sortRows orders rows by ?order=, e.g. level.desc,name, with rows in
+// insertion order when none is given. Nulls sort last ascending, like on
+// Postgres.
+func sortRows(rows []map[string]any, order string) error {
+	if order == "" {
+		return nil
+	}
+
+	type key struct {
+		column string
+		desc   bool
+	}
+	keys := []key{}
+	for _, part := range strings.Split(order, ",") {
+		column, direction, _ := strings.Cut(part, ".")
+		if err := utils.ValidateColumnName(column); err != nil {
+			return err
+		}
+		keys = append(keys, key{column, strings.HasPrefix(direction, "desc")})
+	}
+
+	slices.SortStableFunc(rows, func(a, b map[string]any) int {
+		for _, k := range keys {
+			if c := compare(a[k.column], b[k.column]); c != 0 {
+				if k.desc {
+					return -c
+				}
+				return c
+			}
+		}
+		return 0
+	})
+	return nil
+}
+
+// compare orders two values, numbers by value and anything else by its
+// text, with nulls after everything
+func compare(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func toInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		if n == float64(int64(n)) {
+			return int64(n), true
+		}
+	}
+	return 0, false
+}
+
+func cloneRow(row map[string]any) map[string]any {
+	clone := make(map[string]any, len(row))
+	for k, v := range row {
+		clone[k] = v
+	}
+	return clone
+}
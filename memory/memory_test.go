@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serve(db *DB, method, path, body string) (int, []map[string]any) {
+	rec := httptest.NewRecorder()
+	db.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var rows []map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &rows)
+	return rec.Code, rows
+}
+
+// Test reads filter, order, paginate and project rows
+func TestList(t *testing.T) {
+	db := New()
+	db.Seed("products",
+		map[string]any{"name": "pen", "level": 1, "hidden": false},
+		map[string]any{"name": "cup", "level": 3, "hidden": false},
+		map[string]any{"name": "mug", "level": 2, "hidden": true},
+		map[string]any{"name": "pad", "level": nil, "hidden": false},
+	)
+
+	tests := []struct {
+		path string
+		want []map[string]any
+	}{
+		{"/products?level=lt.3&hidden=is.false&select=name", []map[string]any{{"name": "pen"}}},
+		{"/products?or=(level=gte.3,hidden=is.true)&order=level.desc&select=name,level", []map[string]any{{"name": "cup", "level": 3.0}, {"name": "mug", "level": 2.0}}},
+		{"/products?order=level&select=name", []map[string]any{{"name": "pen"}, {"name": "mug"}, {"name": "cup"}, {"name": "pad"}}},
+		{"/products?name=like.p*&page=2&page_size=1&select=id,name", []map[string]any{{"id": 4.0, "name": "pad"}}},
+		{"/products?level=is.null&select=name", []map[string]any{{"name": "pad"}}},
+		{"/products?level=ne.2&select=name", []map[string]any{{"name": "pen"}, {"name": "cup"}}},
+		{"/products?level=isdistinct.2&select=name", []map[string]any{{"name": "pen"}, {"name": "cup"}, {"name": "pad"}}},
+		{"/products?id=in.(1,3,9)&select=name", []map[string]any{{"name": "pen"}, {"name": "mug"}}},
+		{"/orders", []map[string]any{}},
+	}
+
+	for _, tt := range tests {
+		code, rows := serve(db, http.MethodGet, tt.path, "")
+		assert.Equal(t, http.StatusOK, code, tt.path)
+		assert.Equal(t, tt.want, rows, tt.path)
+	}
+
+	code, _ := serve(db, http.MethodGet, "/products?select=name;drop", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = serve(db, http.MethodGet, "/products?id=in.()", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// Test inserts, updates and deletes change the stored rows
+func TestWrites(t *testing.T) {
+	db := New()
+
+	code, rows := serve(db, http.MethodPost, "/products", `[{"name": "pen", "level": 1}, {"name": "cup", "level": 3}]`)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, []map[string]any{{"id": 1.0, "name": "pen", "level": 1.0}, {"id": 2.0, "name": "cup", "level": 3.0}}, rows)
+
+	code, rows = serve(db, http.MethodPatch, "/products/2", `{"level": 4}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []map[string]any{{"id": 2.0, "name": "cup", "level": 4.0}}, rows)
+
+	code, rows = serve(db, http.MethodPut, "/products/2", `{"level": 5}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []map[string]any{{"id": 2.0, "level": 5.0}}, rows)
+
+	code, _ = serve(db, http.MethodPut, "/products/9", `{"level": 4}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = serve(db, http.MethodDelete, "/products", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, rows = serve(db, http.MethodDelete, "/products?level=gt.3", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, []map[string]any{{"id": int64(1), "name": "pen", "level": 1.0}}, db.Rows("products"))
+
+	code, _ = serve(db, http.MethodDelete, "/products/1", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, db.Rows("products"))
+
+	code, _ = serve(db, http.MethodPost, "/products", `not json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = serve(db, http.MethodPatch, "/products", `{}`)
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+}
@@ -0,0 +1,155 @@
+// Package migrate applies versioned SQL files to a database, recording the
+// applied versions in a schema_migrations table. Files are named
+// <version>_<name>.sql, where version is a number, and may be specialized per
+// dialect as <version>_<name>.<dialect>.sql, e.g.
+//
+//	migrations/
+//	  0001_create_products.sql
+//	  0002_add_search.postgres.sql
+//	  0002_add_search.mysql.sql
+//
+// Migrations only go up: fix a mistake with a new migration.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Table records the applied migrations
+const Table = "schema_migrations"
+
+// Migration is a versioned SQL file
+type Migration struct {
+	Version int64
+	Name    string
+	SQL     string
+}
+
+// Load reads the migrations of fsys for a dialect, in version order. A file
+// for the dialect replaces the generic file of the same version, and files
+// for other dialects are skipped.
+func Load(fsys fs.FS, dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]Migration{}
+	specific := map[int64]bool{}
+	for _, entry := range entries {
+		base, ok := strings.CutSuffix(entry.Name(), ".sql")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		base, fileDialect, dialectSpecific := strings.Cut(base, ".")
+		if dialectSpecific && fileDialect != dialect {
+			continue
+		}
+		digits, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(digits, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %s: expected <version>_<name>.sql", entry.Name())
+		}
+
+		if previous, ok := byVersion[version]; ok {
+			switch {
+			case specific[version] == dialectSpecific:
+				return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, previous.Name, name)
+			case specific[version]:
+				continue
+			}
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		byVersion[version] = Migration{Version: version, Name: name, SQL: string(data)}
+		specific[version] = dialectSpecific
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Applied returns the versions recorded in the migrations table, creating it
+// when missing
+func Applied(ctx context.Context, db *sql.DB) (map[int64]bool, error) {
+	_, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+Table+
+		" (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", Table, err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version FROM "+Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]bool{}
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// Up applies the migrations not yet recorded, in order, each in a
+// transaction with its record, returning the ones applied. It stops at the
+// first failure. MySQL commits DDL statements implicitly, so a migration
+// failing there may be partly applied.
+func Up(ctx context.Context, db *sql.DB, dialect string, migrations []Migration) ([]Migration, error) {
+	applied, err := Applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	insert := "INSERT INTO " + Table + " (version, name) VALUES (?, ?)"
+	if dialect == "postgres" {
+		insert = "INSERT INTO " + Table + " (version, name) VALUES ($1, $2)"
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if err := apply(ctx, db, insert, m); err != nil {
+			return done, fmt.Errorf("migration %d_%s: %v", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+func apply(ctx context.Context, db *sql.DB, insert string, m Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, insert, m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test migrations are read in version order, preferring dialect files
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_add_search.sql":          {Data: []byte("CREATE INDEX products_name ON products (name)")},
+		"0010_add_search.postgres.sql": {Data: []byte("CREATE INDEX products_name ON products USING gin (to_tsvector('simple', name))")},
+		"0002_add_price.sql":           {Data: []byte("ALTER TABLE products ADD price NUMERIC")},
+		"0001_create_products.sql":     {Data: []byte("CREATE TABLE products (id INTEGER PRIMARY KEY)")},
+		"0003_partition.mysql.sql":     {Data: []byte("ALTER TABLE products PARTITION BY HASH(id) PARTITIONS 4")},
+		"README.md":                    {Data: []byte("notes")},
+	}
+
+	migrations, err := Load(fsys, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "create_products", SQL: "CREATE TABLE products (id INTEGER PRIMARY KEY)"},
+		{Version: 2, Name: "add_price", SQL: "ALTER TABLE products ADD price NUMERIC"},
+		{Version: 10, Name: "add_search", SQL: "CREATE INDEX products_name ON products USING gin (to_tsvector('simple', name))"},
+	}, migrations)
+
+	migrations, err = Load(fsys, "mysql")
+	assert.NoError(t, err)
+	assert.Len(t, migrations, 4)
+	assert.Equal(t, "CREATE INDEX products_name ON products (name)", migrations[3].SQL)
+}
+
+// Test badly named and duplicate files are rejected
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		fsys fstest.MapFS
+		err  string
+	}{
+		{fstest.MapFS{"create_products.sql": {}}, "invalid migration file name create_products.sql"},
+		{fstest.MapFS{"0_init.sql": {}}, "invalid migration file name 0_init.sql"},
+		{fstest.MapFS{"1_a.sql": {}, "01_b.sql": {}}, "duplicate migration version 1"},
+	}
+
+	for _, tt := range tests {
+		_, err := Load(tt.fsys, "postgres")
+		assert.ErrorContains(t, err, tt.err)
+	}
+}
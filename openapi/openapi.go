@@ -0,0 +1,190 @@
+// Package openapi generates an OpenAPI 3.1 document describing the REST
+// surface restql exposes for a set of tables.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Info is the metadata placed in the document's info object
+type Info struct {
+	Title   string
+	Version string
+}
+
+// Spec builds an OpenAPI 3.1 document with paths for each table:
+// /{table} (GET, POST, DELETE) and /{table}/{id} (PUT, DELETE)
+func Spec(info Info, tables []*utils.Table) map[string]any {
+	if info.Title == "" {
+		info.Title = "restql"
+	}
+	if info.Version == "" {
+		info.Version = "1.0.0"
+	}
+
+	paths := map[string]any{}
+	schemas := map[string]any{}
+
+	for _, table := range tables {
+		schemas[table.Name] = tableSchema(table)
+		ref := map[string]any{"$ref": "#/components/schemas/" + table.Name}
+		rows := map[string]any{"type": "array", "items": ref}
+
+		paths["/"+table.Name] = map[string]any{
+			"get": map[string]any{
+				"summary":     fmt.Sprintf("List %s", table.Name),
+				"operationId": "list_" + table.Name,
+				"parameters":  listParameters(table),
+				"responses":   responses(rows),
+			},
+			"post": map[string]any{
+				"summary":     fmt.Sprintf("Insert one or more %s", table.Name),
+				"operationId": "insert_" + table.Name,
+				"requestBody": requestBody(map[string]any{"oneOf": []any{ref, rows}}),
+				"responses":   responses(nil),
+			},
+			"delete": map[string]any{
+				"summary":     fmt.Sprintf("Delete %s matching filters", table.Name),
+				"operationId": "delete_" + table.Name,
+				"parameters":  filterParameters(table),
+				"responses":   responses(nil),
+			},
+		}
+
+		idParam := map[string]any{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "string"}}
+		paths["/"+table.Name+"/{id}"] = map[string]any{
+			"put": map[string]any{
+				"summary":     fmt.Sprintf("Replace a %s record", table.Name),
+				"operationId": "replace_" + table.Name,
+				"parameters":  []any{idParam},
+				"requestBody": requestBody(ref),
+				"responses":   responses(nil),
+			},
+			"patch": map[string]any{
+				"summary":     fmt.Sprintf("Update some columns of a %s record", table.Name),
+				"operationId": "update_" + table.Name,
+				"parameters":  []any{idParam},
+				"requestBody": requestBody(ref),
+				"responses":   responses(nil),
+			},
+			"delete": map[string]any{
+				"summary":     fmt.Sprintf("Delete a %s record", table.Name),
+				"operationId": "delete_" + table.Name + "_by_id",
+				"parameters":  []any{idParam},
+				"responses":   responses(nil),
+			},
+		}
+	}
+
+	return map[string]any{
+		"openapi":    "3.1.0",
+		"info":       map[string]any{"title": info.Title, "version": info.Version},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas},
+	}
+}
+
+// Handler serves the document as JSON, e.g. at /api/openapi.json
+func Handler(info Info, tables []*utils.Table) http.Handler {
+	body, err := json.Marshal(Spec(info, tables))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+// tableSchema describes a row of the table
+func tableSchema(table *utils.Table) map[string]any {
+	properties := map[string]any{}
+	for i := range table.Columns {
+		column := &table.Columns[i]
+		properties[column.Name] = columnSchema(column)
+	}
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+// columnSchema maps a column's SQL type to a JSON schema
+func columnSchema(column *utils.Column) map[string]any {
+	schema := map[string]any{}
+
+	jsonType := utils.JSONType(column.Type)
+	if jsonType == "decimal" {
+		// Decimals are served as strings to keep their precision
+		jsonType = "string"
+		schema["format"] = "decimal"
+	}
+	if column.Nullable {
+		schema["type"] = []string{jsonType, "null"}
+	} else {
+		schema["type"] = jsonType
+	}
+	if len(column.Enum) > 0 {
+		schema["enum"] = column.Enum
+	}
+	if column.ReadOnly() {
+		schema["readOnly"] = true
+	}
+
+	return schema
+}
+
+// listParameters documents filters, ordering, and pagination for GET
+func listParameters(table *utils.Table) []any {
+	return append(filterParameters(table),
+		queryParameter("order", "Sort columns, e.g. `price.desc,name.asc`"),
+		queryParameter("page", "Page number, starting at 1"),
+		queryParameter("page_size", fmt.Sprintf("Rows per page (max %d)", query.MaxPageSize)),
+		queryParameter("cursor", "The `next_cursor` of the previous page, under a pagination strategy"),
+		queryParameter("q", "Search term, matched case-insensitively in any of `q_columns`"),
+		queryParameter("q_columns", "Columns to search, e.g. `name,email`; every text column by default"),
+	)
+}
+
+// filterParameters documents one filter parameter per column plus groups
+func filterParameters(table *utils.Table) []any {
+	params := []any{}
+	for _, column := range table.Columns {
+		params = append(params, queryParameter(column.Name, "Filter as `operator.value`, e.g. `eq.1`, `gt.5`, `like.foo*`, `is.null`"))
+	}
+	for _, group := range []string{"and", "or", "not"} {
+		params = append(params, queryParameter(group, "Group of filters, e.g. `(level=lt.2,hidden=is.false)`"))
+	}
+	return params
+}
+
+func queryParameter(name, description string) map[string]any {
+	return map[string]any{
+		"name":        name,
+		"in":          "query",
+		"required":    false,
+		"description": description,
+		"schema":      map[string]any{"type": "string"},
+	}
+}
+
+func requestBody(schema map[string]any) map[string]any {
+	return map[string]any{
+		"required": true,
+		"content":  map[string]any{"application/json": map[string]any{"schema": schema}},
+	}
+}
+
+func responses(schema map[string]any) map[string]any {
+	ok := map[string]any{"description": "Success"}
+	if schema != nil {
+		ok["content"] = map[string]any{"application/json": map[string]any{"schema": schema}}
+	}
+	return map[string]any{
+		"200": ok,
+		"400": map[string]any{"description": "Invalid request"},
+	}
+}
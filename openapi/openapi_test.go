@@ -0,0 +1,58 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var products = &utils.Table{
+	Name: "products",
+	Columns: []utils.Column{
+		{Name: "id", Type: "BIGINT", Identity: true},
+		{Name: "name", Type: "VARCHAR(255)"},
+		{Name: "price", Type: "numeric(10,2)", Nullable: true},
+		{Name: "status", Type: "ENUM", Enum: []string{"draft", "published"}},
+		{Name: "active", Type: "BOOLEAN"},
+	},
+}
+
+// Test the generated document describes each table
+func TestSpec(t *testing.T) {
+	spec := Spec(Info{Title: "shop"}, []*utils.Table{products})
+
+	assert.Equal(t, "3.1.0", spec["openapi"])
+	assert.Equal(t, map[string]any{"title": "shop", "version": "1.0.0"}, spec["info"])
+
+	paths := spec["paths"].(map[string]any)
+	assert.Contains(t, paths, "/products")
+	assert.Contains(t, paths, "/products/{id}")
+	assert.Contains(t, paths["/products"], "get")
+	assert.Contains(t, paths["/products/{id}"], "put")
+	assert.Contains(t, paths["/products/{id}"], "patch")
+
+	schema := spec["components"].(map[string]any)["schemas"].(map[string]any)["products"].(map[string]any)
+	properties := schema["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "integer", "readOnly": true}, properties["id"])
+	assert.Equal(t, map[string]any{"type": "string"}, properties["name"])
+	assert.Equal(t, map[string]any{"type": []string{"string", "null"}, "format": "decimal"}, properties["price"])
+	assert.Equal(t, map[string]any{"type": "string", "enum": []string{"draft", "published"}}, properties["status"])
+	assert.Equal(t, map[string]any{"type": "boolean"}, properties["active"])
+}
+
+// Test the document is served as JSON
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler(Info{}, []*utils.Table{products}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var doc map[string]any
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "restql", doc["info"].(map[string]any)["title"])
+}
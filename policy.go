@@ -0,0 +1,1054 @@
+package restql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/The-ForgeBase/restql/admin"
+	"github.com/The-ForgeBase/restql/apikey"
+	"github.com/The-ForgeBase/restql/breaker"
+	"github.com/The-ForgeBase/restql/cache"
+	"github.com/The-ForgeBase/restql/events"
+	"github.com/The-ForgeBase/restql/export"
+	"github.com/The-ForgeBase/restql/handler"
+	"github.com/The-ForgeBase/restql/idempotency"
+	"github.com/The-ForgeBase/restql/masking"
+	"github.com/The-ForgeBase/restql/openapi"
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/signing"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// columnParams name columns in ways the column policy cannot check, so
+// they are rejected on tables with restricted columns
+var columnParams = []string{"stats", "per_group", "tree", "group_by"}
+
+// policy is everything derived from a config and schema, swapped as a whole
+// on reload
+type policy struct {
+	cfg     *Config
+	schema  map[string]*utils.Table
+	names   []string
+	tables  map[string]*tablePolicy
+	handler http.Handler
+	// results caches read responses, nil when off. Each config starts with
+	// an empty cache, as its policies shape the responses.
+	results *cache.ResultCache
+	// breaker fails database work fast while the database keeps failing,
+	// nil when off
+	breaker *breaker.Breaker
+	// events publishes the changes of writes, nil when off
+	events *events.Publisher
+}
+
+// tablePolicy is a TableConfig resolved against the schema
+type tablePolicy struct {
+	// table is the table or view queried, served as meta.Name
+	table string
+	verbs []string
+	// columns are the exposed columns, nil for all
+	columns map[string]bool
+	// meta is the table metadata limited to the exposed columns, named
+	// after the resource
+	meta        *utils.Table
+	filter      []query.Param
+	maxPageSize int
+	// intStrings are the integer columns served as strings
+	intStrings map[string]bool
+	// mask masks columns of the rows served by role, nil for none
+	mask masking.Rules
+}
+
+// policyError rejects a request breaking a table policy, or one the server
+// cannot serve
+type policyError struct {
+	status  int
+	message string
+}
+
+func (e *policyError) Error() string {
+	return e.message
+}
+
+// StatusCode returns the HTTP status for the error
+func (e *policyError) StatusCode() int {
+	return e.status
+}
+
+// signaturesSeen is the number of request signatures remembered to reject
+// replays
+const signaturesSeen = 100000
+
+// newPolicy resolves cfg against schema and builds its handler chain
+func (s *Server) newPolicy(cfg *Config, schema map[string]*utils.Table) (*policy, error) {
+	p := &policy{cfg: cfg, schema: schema, tables: map[string]*tablePolicy{}}
+
+	configs := cfg.Tables
+	if len(configs) == 0 {
+		configs = map[string]TableConfig{}
+		for name := range schema {
+			configs[name] = TableConfig{}
+		}
+	}
+
+	var errs []error
+	for name, tc := range configs {
+		table, ok := schema[tc.tableName(name)]
+		if !ok && tc.Table != "" {
+			errs = append(errs, fmt.Errorf("tables.%s: unknown table %s", name, tc.Table))
+			continue
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("tables: unknown table %s", name))
+			continue
+		}
+		tp, err := newTablePolicy(cfg, name, table, tc)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tables.%s: %v", name, err))
+			continue
+		}
+		p.tables[name] = tp
+		p.names = append(p.names, name)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	sort.Strings(p.names)
+
+	if rc := cfg.ResultCache; rc.MaxEntries > 0 {
+		p.results = cache.New(cache.NewLRU(rc.MaxEntries), time.Duration(rc.TTL)*time.Second)
+		p.results.StaleTTL = time.Duration(rc.StaleTTL) * time.Second
+	}
+	if bc := cfg.Breaker; bc.Threshold > 0 {
+		p.breaker = breaker.New(bc.Threshold, time.Duration(bc.Cooldown)*time.Second)
+		p.breaker.SlowCall = time.Duration(bc.SlowCall) * time.Second
+		p.breaker.IsFailure = databaseFailure
+	}
+	if ec := cfg.Events; len(ec.Webhooks) > 0 {
+		client := &http.Client{Timeout: time.Duration(ec.Timeout) * time.Second}
+		sinks := make([]events.Sink, len(ec.Webhooks))
+		for i, hook := range ec.Webhooks {
+			sinks[i] = &events.WebhookSink{URL: hook.URL, Secret: []byte(hook.Secret), Client: client}
+		}
+		p.events = events.NewPublisher(sinks...)
+	}
+
+	tables := make([]*utils.Table, len(p.names))
+	for i, name := range p.names {
+		tables[i] = p.tables[name].meta
+	}
+
+	var api http.Handler = http.StripPrefix(cfg.Prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serveTable(w, r, p)
+	}))
+	if ic := cfg.Idempotency; ic.MaxEntries > 0 {
+		// Kept across reloads, so retries spanning one are still replayed
+		if s.idempotency == nil {
+			s.idempotency = idempotency.New(cache.NewLRU(ic.MaxEntries), time.Duration(ic.TTL)*time.Second)
+		}
+		api = scopeIdempotency(s.idempotency.Middleware(api))
+	}
+	var reload http.Handler = http.HandlerFunc(s.serveReload)
+	var ddl http.Handler = http.StripPrefix(cfg.Prefix+"/_tables", http.HandlerFunc(s.serveTables))
+	if cfg.Auth.Mode == AuthAPIKey {
+		auth := apikey.New(cfg.keyStore())
+		auth.Prefix = cfg.Prefix
+		api = auth.Middleware(api)
+		reload = auth.Middleware(reload)
+		ddl = auth.Middleware(ddl)
+	}
+	if len(cfg.Signing.Secrets) > 0 {
+		// Signatures seen are kept across reloads, so rotating secrets
+		// does not let requests be replayed
+		if s.signatures == nil {
+			s.signatures = cache.NewLRU(signaturesSeen)
+		}
+		verifier := signing.New(s.signatures, cfg.Signing.secrets()...)
+		if cfg.Signing.Tolerance > 0 {
+			verifier.Tolerance = time.Duration(cfg.Signing.Tolerance) * time.Second
+		}
+		api = verifier.Middleware(api)
+		reload = verifier.Middleware(reload)
+		ddl = verifier.Middleware(ddl)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Prefix+"/openapi.json", openapi.Handler(openapi.Info{}, tables))
+	mux.HandleFunc(cfg.Prefix+"/_health", s.serveHealth)
+	if cfg.Admin {
+		mux.Handle(cfg.Prefix+"/_admin/", admin.Handler(admin.Options{Prefix: cfg.Prefix + "/_admin", API: cfg.Prefix}))
+	}
+	if cfg.Reload.Endpoint {
+		mux.Handle(cfg.Prefix+"/_reload", reload)
+	}
+	if cfg.DDL {
+		mux.Handle(cfg.Prefix+"/_tables", ddl)
+		mux.Handle(cfg.Prefix+"/_tables/", ddl)
+	}
+	mux.Handle(cfg.Prefix+"/", api)
+	p.handler = limitBody(corsMiddleware(cfg.CORS, mux))
+	return p, nil
+}
+
+func newTablePolicy(cfg *Config, name string, table *utils.Table, tc TableConfig) (*tablePolicy, error) {
+	tp := &tablePolicy{table: table.Name, meta: table, maxPageSize: query.MaxPageSize}
+	if name != table.Name {
+		meta := *table
+		meta.Name = name
+		tp.meta = &meta
+	}
+	if cfg.Pagination.MaxPageSize > 0 {
+		tp.maxPageSize = cfg.Pagination.MaxPageSize
+	}
+	if tc.MaxPageSize > 0 {
+		tp.maxPageSize = tc.MaxPageSize
+	}
+	for _, verb := range tc.Verbs {
+		tp.verbs = append(tp.verbs, strings.ToUpper(verb))
+	}
+
+	if len(tc.Columns) > 0 {
+		tp.columns = map[string]bool{}
+		tp.meta = &utils.Table{Name: name, Indexes: table.Indexes}
+		for _, name := range tc.Columns {
+			column, ok := table.Column(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown column %s", name)
+			}
+			tp.columns[name] = true
+			tp.meta.Columns = append(tp.meta.Columns, *column)
+		}
+	}
+
+	for _, name := range tc.IntStrings {
+		column, ok := table.Column(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %s in int_strings", name)
+		}
+		if utils.JSONType(column.Type) != "integer" {
+			return nil, fmt.Errorf("int_strings: column %s is not an integer", name)
+		}
+		if tp.intStrings == nil {
+			tp.intStrings = map[string]bool{}
+		}
+		tp.intStrings[name] = true
+	}
+
+	for column, mask := range tc.Mask {
+		if _, ok := table.Column(column); !ok {
+			return nil, fmt.Errorf("unknown column %s in mask", column)
+		}
+		if tp.mask == nil {
+			tp.mask = masking.Rules{name: {}}
+		}
+		tp.mask[name][column] = mask.policy()
+	}
+
+	if tc.Filter != "" {
+		params, err := query.ParseParams(tc.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %v", err)
+		}
+		for column := range query.ReferencedColumns(params) {
+			if _, ok := table.Column(column); !ok {
+				return nil, fmt.Errorf("unknown column %s in filter", column)
+			}
+		}
+		tp.filter = params
+	}
+	return tp, nil
+}
+
+// allows reports whether the policy allows a method. Reads by POST count as
+// GET.
+func (tp *tablePolicy) allows(method string) bool {
+	return len(tp.verbs) == 0 || slices.Contains(tp.verbs, method)
+}
+
+// restricted reports whether the table has column or row restrictions,
+// which the JSON query and aggregate endpoints cannot check
+func (tp *tablePolicy) restricted() bool {
+	return tp.columns != nil || tp.filter != nil
+}
+
+// serveTable answers a request below the prefix with the rows its query
+// returns, or the number of rows a write affected
+func (s *Server) serveTable(w http.ResponseWriter, r *http.Request, p *policy) {
+	// Nested routes like /users/1/orders are served under the policy of
+	// orders
+	r, err := s.ql.Unnest(r)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	tableName, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	tp, ok := p.tables[tableName]
+	if !ok {
+		http.Error(w, "unknown table "+tableName, http.StatusNotFound)
+		return
+	}
+	if tp.table != tableName {
+		r.URL.Path = "/" + tp.table + strings.TrimPrefix(r.URL.Path, "/"+tableName)
+		r.URL.RawPath = ""
+	}
+
+	if err := tp.check(r, id, s.ql); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	q, err := s.ql.GetQL(r)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	if tp.filter != nil && id != "" && r.Method != http.MethodGet {
+		if q, err = tp.filterWrite(q, s.db.dbType); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	if p.cfg.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.cfg.QueryTimeout)*time.Second)
+		defer cancel()
+	}
+
+	if q.Export != nil {
+		s.serveExport(ctx, w, r, q, tp)
+		return
+	}
+
+	// Reads are answered from the result cache until a write changes
+	// their tables
+	cached := p.cacheable(r, tp, q)
+	var key cache.Key
+	if cached != nil {
+		var body []byte
+		var ok bool
+		if body, key, ok = p.results.Get(cached); ok {
+			writeJSON(w, http.StatusOK, body)
+			return
+		}
+	}
+
+	// Paged reads also count the filtered rows for the total, and reads
+	// with stats summarize them
+	var rows, counted, stats []map[string]any
+	var affected int64
+	err = p.guard(ctx, func(ctx context.Context) error {
+		return handler.Retries.Do(ctx, func(ctx context.Context) error {
+			if rows, affected, err = s.db.exec(ctx, q); err != nil {
+				return err
+			}
+			if q.Page != nil {
+				if counted, _, err = s.db.exec(ctx, q.Page.Count); err != nil {
+					return err
+				}
+			}
+			if q.Stats != nil {
+				stats, _, err = s.db.exec(ctx, q.Stats)
+			}
+			return err
+		})
+	})
+	// Drivers report a query cut short in their own words
+	if err != nil && ctx.Err() != nil && r.Context().Err() == nil {
+		err = &policyError{http.StatusGatewayTimeout, fmt.Sprintf("query timed out after %ds", p.cfg.QueryTimeout)}
+	}
+	if err != nil {
+		err = handler.TranslateError(err)
+		var statusErr interface{ StatusCode() int }
+		var openErr *breaker.OpenError
+		down := errors.As(err, &openErr)
+		if !errors.As(err, &statusErr) {
+			log.Printf("restql: %s %s: %v", r.Method, r.URL.Path, err)
+			err = errors.New("database error")
+			down = true
+		}
+		// While the database is down, reads get their last response
+		if down && cached != nil {
+			if body, age, ok := p.results.GetStale(cached); ok {
+				cache.StaleHeaders(w.Header(), age)
+				writeJSON(w, http.StatusOK, body)
+				return
+			}
+		}
+		if openErr != nil {
+			openErr.Write(w)
+			return
+		}
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if p.results != nil {
+		p.results.Invalidate(q)
+	}
+
+	status := http.StatusOK
+	if r.Method == http.MethodPost && id == "" {
+		status = http.StatusCreated
+	}
+	var body any = map[string]int64{"rows_affected": affected}
+	if rows != nil {
+		rows = tp.project(rows)
+	}
+	p.publish(r, tp, q, rows, affected)
+	if rows != nil {
+		tp.mask.Apply(tp.meta.Name, role(r), rows)
+		utils.EncodeInts(rows, tp.intStrings, p.cfg.LargeIntsAsStrings)
+		body = rows
+	}
+	if rows != nil && (q.Page != nil || q.Stats != nil) {
+		page := map[string]any{"data": body}
+		if q.Page != nil {
+			page["meta"] = q.Page.Meta(rows, counted)
+		}
+		if len(stats) == 1 {
+			page["stats"] = stats[0]
+		}
+		body = page
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	data = append(data, '\n')
+	if cached != nil {
+		p.results.Set(key, data)
+	}
+	writeJSON(w, status, data)
+}
+
+// publish posts the change event of a successful write, with the rows it
+// returned unmasked. The write is done, so failed deliveries are logged.
+func (p *policy) publish(r *http.Request, tp *tablePolicy, q *utils.ReturnQuery, rows []map[string]any, affected int64) {
+	op, ok := events.OperationForMethod(r.Method)
+	if p.events == nil || !ok || q.ReadOnly || len(rows) == 0 && affected == 0 {
+		return
+	}
+	event := events.Event{Table: tp.meta.Name, Operation: op, Rows: rows}
+	if err := p.events.Publish(context.WithoutCancel(r.Context()), event); err != nil {
+		log.Printf("restql: %s %s: %v", r.Method, r.URL.Path, err)
+	}
+}
+
+// guard runs database work through the circuit breaker, when there is one
+func (p *policy) guard(ctx context.Context, fn func(ctx context.Context) error) error {
+	if p.breaker == nil {
+		return fn(ctx)
+	}
+	return p.breaker.Do(ctx, fn)
+}
+
+// cacheable returns the result cache key of a read served under tp, nil
+// when the result cache is off or q writes. Responses differ by the policy
+// of the name they are served under, and by role when it masks columns, so
+// both are part of the key.
+func (p *policy) cacheable(r *http.Request, tp *tablePolicy, q *utils.ReturnQuery) *utils.ReturnQuery {
+	if p.results == nil || !q.ReadOnly {
+		return nil
+	}
+	key := *q
+	key.Query = tp.meta.Name + ":" + q.Query
+	if tp.mask != nil {
+		key.Query = role(r) + ":" + key.Query
+	}
+	return &key
+}
+
+// role returns the role of the request's key, empty without one
+func role(r *http.Request) string {
+	if key, ok := apikey.FromContext(r.Context()); ok {
+		return key.Role
+	}
+	return ""
+}
+
+// databaseFailure reports whether an error counts against the database,
+// rather than being caused by the request like a constraint violation or a
+// client going away
+func databaseFailure(err error) bool {
+	var statusErr interface{ StatusCode() int }
+	return !errors.Is(err, context.Canceled) && !errors.As(handler.TranslateError(err), &statusErr)
+}
+
+// writeJSON answers a JSON body
+func writeJSON(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// serveExport streams the export q as a file download of the exposed
+// columns. Errors once the file has started can only cut it short.
+func (s *Server) serveExport(ctx context.Context, w http.ResponseWriter, r *http.Request, q *utils.ReturnQuery, tp *tablePolicy) {
+	err := export.Serve(ctx, w, q, func(ctx context.Context, q *utils.ReturnQuery) ([]string, [][]any, error) {
+		columns, rows, err := s.db.fetch(ctx, q)
+		if err != nil {
+			return nil, nil, err
+		}
+		if tp.columns != nil {
+			columns, rows = tp.projectValues(columns, rows)
+		}
+		tp.maskValues(r, columns, rows)
+		return columns, rows, nil
+	})
+	if err == nil {
+		return
+	}
+	if w.Header().Get("Content-Disposition") != "" {
+		log.Printf("restql: %s %s: export cut short: %v", r.Method, r.URL.Path, err)
+		return
+	}
+	err = handler.TranslateError(err)
+	var statusErr interface{ StatusCode() int }
+	if !errors.As(err, &statusErr) {
+		log.Printf("restql: %s %s: %v", r.Method, r.URL.Path, err)
+		err = errors.New("database error")
+	}
+	writeError(w, err, http.StatusInternalServerError)
+}
+
+// serveReload refreshes the server on POST, answering with the tables then
+// exposed
+func (s *Server) serveReload(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r, http.MethodPost) {
+		return
+	}
+	if err := s.Refresh(r.Context()); err != nil {
+		http.Error(w, "config not reloaded: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"tables": s.Tables()})
+}
+
+// serveHealth answers 200 while the database can be reached and 503
+// otherwise, for load balancers and orchestrators. It needs no key.
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status, code := "ok", http.StatusOK
+	if err := s.Ping(r.Context()); err != nil {
+		log.Printf("restql: health check: %v", err)
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// serveTables creates the table defined by a POST to /_tables, or alters
+// the one of a PATCH to /_tables/{table}, answering with its metadata as
+// read back from the schema
+func (s *Server) serveTables(w http.ResponseWriter, r *http.Request) {
+	tableName := strings.TrimPrefix(r.URL.Path, "/")
+	method := http.MethodPost
+	if tableName != "" {
+		method = http.MethodPatch
+	}
+	if !s.authorizeAdmin(w, r, method) {
+		return
+	}
+
+	var def handler.TableDefinition
+	var alt handler.TableAlteration
+	body := any(&def)
+	if tableName != "" {
+		body = &alt
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(body); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var table *utils.Table
+	var err error
+	if tableName == "" {
+		table, err = s.CreateTable(r.Context(), &def)
+	} else {
+		table, err = s.AlterTable(r.Context(), tableName, &alt)
+	}
+	if err != nil {
+		var statusErr interface{ StatusCode() int }
+		if !errors.As(err, &statusErr) {
+			log.Printf("restql: %s %s: %v", r.Method, r.URL.Path, err)
+			err = errors.New("database error")
+		}
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if tableName == "" {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(table)
+}
+
+// authorizeAdmin rejects requests to the admin endpoints using another
+// method, or refused by AuthorizeAdmin
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	authorize := s.AuthorizeAdmin
+	if authorize == nil {
+		authorize = adminKey
+	}
+	if err := authorize(r); err != nil {
+		writeError(w, err, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// adminKey requires a key with AdminRole. Unauthenticated requests are
+// refused, as anyone could otherwise change the schema.
+func adminKey(r *http.Request) error {
+	key, ok := apikey.FromContext(r.Context())
+	if !ok {
+		return &policyError{http.StatusForbidden, "the admin endpoints need api_key auth or an AuthorizeAdmin hook"}
+	}
+	if key.Role != AdminRole {
+		return &policyError{http.StatusForbidden, "requires an admin key"}
+	}
+	return nil
+}
+
+// checkAdmin refuses a config serving the reload or table endpoints with
+// nothing to authorize their requests
+func (s *Server) checkAdmin(cfg *Config) error {
+	if (cfg.DDL || cfg.Reload.Endpoint) && cfg.Auth.Mode != AuthAPIKey && s.AuthorizeAdmin == nil {
+		return errors.New("ddl and reload.endpoint need auth mode api_key or an AuthorizeAdmin hook")
+	}
+	return nil
+}
+
+// check enforces the policy on a request, rewriting its query string in
+// restql's grammar with the row filter and page size limit added. ql parses
+// the query string in the dialect served.
+func (tp *tablePolicy) check(r *http.Request, id string, ql *handler.Handler) error {
+	method := r.Method
+	if method == http.MethodPost && id == "query" {
+		method = http.MethodGet
+	}
+	if (id == "query" || id == "aggregate") && tp.restricted() {
+		return &policyError{http.StatusForbidden, fmt.Sprintf("/%s is not available on %s", id, tp.meta.Name)}
+	}
+	// Export pages continue after the id of the last row
+	if _, masked := tp.mask[tp.meta.Name]["id"]; id == "export" && (masked || tp.columns != nil && !tp.columns["id"]) {
+		return &policyError{http.StatusForbidden, "/export is not available on " + tp.meta.Name + " without a clear id"}
+	}
+	if !tp.allows(method) {
+		return &policyError{http.StatusMethodNotAllowed, fmt.Sprintf("%s is not allowed on %s", r.Method, tp.meta.Name)}
+	}
+
+	// Translate OData and JSON:API parameters first so the checks below see
+	// the columns they name
+	params, err := ql.Params(r, tp.table)
+	if err != nil {
+		return err
+	}
+	if tp.columns != nil {
+		if err := tp.checkColumns(r, params); err != nil {
+			return err
+		}
+	}
+	if masked := tp.masked(role(r)); masked != nil {
+		if err := tp.checkMasked(id, params, masked); err != nil {
+			return err
+		}
+	}
+	if (method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch) && id != "aggregate" {
+		if err := tp.checkBody(r); err != nil {
+			return err
+		}
+	}
+
+	// Reads ignore the path id, and deletes by id are filtered as writes
+	if tp.filter != nil && (method == http.MethodGet || method == http.MethodDelete && id == "") {
+		params = append(params, tp.filter...)
+	}
+	if method == http.MethodGet {
+		params = limitPageSize(params, tp.maxPageSize)
+	}
+	r.URL.RawQuery = encodeParams(params)
+	return nil
+}
+
+// checkColumns rejects requests reading, filtering, ordering or writing
+// columns the policy does not expose
+func (tp *tablePolicy) checkColumns(r *http.Request, params []query.Param) error {
+	for _, param := range params {
+		switch {
+		case slices.Contains(columnParams, param.Key):
+			return &policyError{http.StatusForbidden, param.Key + " is not available on " + tp.meta.Name}
+		case param.Key == "select":
+			if _, err := query.ParseSelect(param.Value, tp.meta); err != nil {
+				return &policyError{http.StatusForbidden, err.Error()}
+			}
+		case param.Key == "q_columns":
+			for _, column := range strings.Split(param.Value, ",") {
+				if err := tp.checkColumn(column); err != nil {
+					return err
+				}
+			}
+		case param.Key == "q" && !r.URL.Query().Has("q_columns"):
+			// Searching every text column would match hidden ones too
+			return &policyError{http.StatusForbidden, "q requires q_columns on " + tp.meta.Name}
+		case param.Key == "order" && !strings.HasPrefix(param.Value, "random"):
+			for _, part := range strings.Split(param.Value, ",") {
+				column, _, _ := strings.Cut(part, ".")
+				if err := tp.checkColumn(column); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for column := range query.ReferencedColumns(params) {
+		if err := tp.checkColumn(column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// masked returns the columns masked for role, nil for none
+func (tp *tablePolicy) masked(role string) map[string]bool {
+	var masked map[string]bool
+	for column, policy := range tp.mask[tp.meta.Name] {
+		strategy, ok := policy.Roles[role]
+		if !ok {
+			strategy = policy.Default
+		}
+		if strategy == "" || strategy == masking.Clear {
+			continue
+		}
+		if masked == nil {
+			masked = map[string]bool{}
+		}
+		masked[column] = true
+	}
+	return masked
+}
+
+// checkMasked rejects requests whose results would reveal masked values,
+// filtering, ordering, searching or summarizing by them
+func (tp *tablePolicy) checkMasked(id string, params []query.Param, masked map[string]bool) error {
+	if id == "query" || id == "aggregate" {
+		return &policyError{http.StatusForbidden, fmt.Sprintf("/%s is not available on %s with masked columns", id, tp.meta.Name)}
+	}
+	for _, param := range params {
+		switch {
+		case slices.Contains(columnParams, param.Key), param.Key == "q":
+			return &policyError{http.StatusForbidden, param.Key + " is not available on " + tp.meta.Name + " with masked columns"}
+		case param.Key == "order" && !strings.HasPrefix(param.Value, "random"):
+			for _, part := range strings.Split(param.Value, ",") {
+				if column, _, _ := strings.Cut(part, "."); masked[column] {
+					return &policyError{http.StatusForbidden, "cannot order by masked column " + column}
+				}
+			}
+		case param.Key == "select":
+			// Masks apply to the keys of the result, which an alias renames
+			for _, part := range strings.Split(param.Value, ",") {
+				alias, column, renamed := strings.Cut(strings.TrimSpace(part), ":")
+				if renamed && alias != column && masked[column] {
+					return &policyError{http.StatusForbidden, "cannot rename masked column " + column}
+				}
+			}
+		}
+	}
+	for column := range query.ReferencedColumns(params) {
+		if masked[column] {
+			return &policyError{http.StatusForbidden, "cannot filter by masked column " + column}
+		}
+	}
+	return nil
+}
+
+// checkBody rejects writes naming columns the table does not have, or
+// does not expose, before they reach the database. Restricted tables only
+// take JSON bodies.
+func (tp *tablePolicy) checkBody(r *http.Request) error {
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if tp.columns != nil && mediaType != "" && mediaType != "application/json" {
+		return &policyError{http.StatusUnsupportedMediaType, "writes to " + tp.meta.Name + " must be JSON"}
+	}
+	body, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &handler.LimitError{Limit: "body size", Max: tooLarge.Limit}
+	}
+	if err != nil {
+		return errors.New("failed to read request body")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	// The CSV and form decoders check the columns against the table
+	var records []map[string]any
+	switch {
+	case mediaType == "text/csv":
+		if records, _, err = utils.DecodeCSV(body, tp.meta, nil); err != nil {
+			return &policyError{http.StatusBadRequest, err.Error()}
+		}
+	case utils.IsForm(contentType):
+		record, _, err := utils.DecodeForm(body, contentType, tp.meta, nil)
+		if err != nil {
+			return &policyError{http.StatusBadRequest, err.Error()}
+		}
+		records = []map[string]any{record}
+	default:
+		if records, _, err = utils.DecodeRecords(body); err != nil {
+			// Leave malformed bodies to the handler's error
+			return nil
+		}
+		for _, record := range records {
+			for _, column := range slices.Sorted(maps.Keys(record)) {
+				if tp.columns != nil {
+					if err := tp.checkColumn(column); err != nil {
+						return err
+					}
+				} else if _, ok := tp.meta.Column(column); !ok {
+					return &policyError{http.StatusBadRequest, fmt.Sprintf("unknown column %s of %s", column, tp.meta.Name)}
+				}
+			}
+		}
+	}
+	return tp.checkFilter(r.Method, records)
+}
+
+// checkFilter rejects writes putting rows outside the row filter. Inserted
+// and replaced rows must match it, while updates must match the conditions
+// on the columns they set.
+func (tp *tablePolicy) checkFilter(method string, records []map[string]any) error {
+	if tp.filter == nil {
+		return nil
+	}
+	for _, record := range records {
+		params := tp.filter
+		if method == http.MethodPatch {
+			params = slices.DeleteFunc(slices.Clone(params), func(param query.Param) bool {
+				for column := range query.ReferencedColumns([]query.Param{param}) {
+					if _, ok := record[column]; ok {
+						return false
+					}
+				}
+				return true
+			})
+		}
+		if ok, err := query.MatchFilters(params, record); err != nil || !ok {
+			return &policyError{http.StatusForbidden, "rows written to " + tp.meta.Name + " must match its filter"}
+		}
+	}
+	return nil
+}
+
+func (tp *tablePolicy) checkColumn(column string) error {
+	if !tp.columns[column] {
+		return &policyError{http.StatusForbidden, fmt.Sprintf("column %s of %s is not exposed", column, tp.meta.Name)}
+	}
+	return nil
+}
+
+// filterWrite restricts a write by id to the rows of the row filter. The
+// query may be shared with the query cache, so a copy is returned.
+func (tp *tablePolicy) filterWrite(q *utils.ReturnQuery, dbType string) (*utils.ReturnQuery, error) {
+	filterSQL, filterArgs, err := query.ParseFilters(tp.filter, query.Options{DBType: dbType, Table: tp.meta})
+	if err != nil {
+		return nil, err
+	}
+
+	sql, returning := strings.CutSuffix(q.Query, " RETURNING *")
+	if !strings.Contains(sql, " WHERE ") {
+		return nil, &policyError{http.StatusForbidden, "writes to " + tp.meta.Name + " must be by id or filters"}
+	}
+	sql += " AND (" + filterSQL + ")"
+	if returning {
+		sql += " RETURNING *"
+	}
+
+	filtered := *q
+	filtered.Query = sql
+	filtered.Args = append(append([]any{}, q.Args...), filterArgs...)
+	return &filtered, nil
+}
+
+// project removes the columns the policy does not expose from rows, as
+// writes returning * and select=* read them all
+func (tp *tablePolicy) project(rows []map[string]any) []map[string]any {
+	if tp.columns == nil {
+		return rows
+	}
+	for _, row := range rows {
+		for column := range row {
+			if !tp.columns[column] {
+				delete(row, column)
+			}
+		}
+	}
+	return rows
+}
+
+// projectValues drops the columns the policy does not expose from rows read
+// in column order
+func (tp *tablePolicy) projectValues(columns []string, rows [][]any) ([]string, [][]any) {
+	var keep []int
+	for i, column := range columns {
+		if tp.columns[column] {
+			keep = append(keep, i)
+		}
+	}
+	projected := make([]string, len(keep))
+	for i, j := range keep {
+		projected[i] = columns[j]
+	}
+	for n, row := range rows {
+		values := make([]any, len(keep))
+		for i, j := range keep {
+			values[i] = row[j]
+		}
+		rows[n] = values
+	}
+	return projected, rows
+}
+
+// maskValues masks rows read in column order like the rows of reads
+func (tp *tablePolicy) maskValues(r *http.Request, columns []string, rows [][]any) {
+	if tp.mask == nil {
+		return
+	}
+	role := role(r)
+	for _, values := range rows {
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		tp.mask.Apply(tp.meta.Name, role, []map[string]any{row})
+		for i, column := range columns {
+			values[i] = row[column]
+		}
+	}
+}
+
+// limitPageSize caps page_size and limit at maxSize, adding a page_size when
+// the default page is larger
+func limitPageSize(params []query.Param, maxSize int) []query.Param {
+	capped := false
+	for i, param := range params {
+		if param.Key != "page_size" && param.Key != "limit" {
+			continue
+		}
+		if n, err := strconv.Atoi(param.Value); err != nil || n > maxSize || n <= 0 {
+			params[i].Value = strconv.Itoa(maxSize)
+		}
+		capped = true
+	}
+	if !capped && query.DefaultPageSize > maxSize {
+		params = append(params, query.Param{Key: "page_size", Value: strconv.Itoa(maxSize)})
+	}
+	return params
+}
+
+// encodeParams is the inverse of query.ParseParams, keeping the order
+func encodeParams(params []query.Param) string {
+	parts := make([]string, len(params))
+	for i, param := range params {
+		parts[i] = url.QueryEscape(param.Key) + "=" + url.QueryEscape(param.Value)
+	}
+	return strings.Join(parts, "&")
+}
+
+// writeError responds with the status of errors carrying one, like
+// handler.LimitError, and status otherwise
+func writeError(w http.ResponseWriter, err error, status int) {
+	var statusErr interface{ StatusCode() int }
+	if errors.As(err, &statusErr) {
+		status = statusErr.StatusCode()
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// scopeIdempotency prefixes the Idempotency-Key of requests with the ID of
+// their key, so clients cannot replay each other's responses
+func scopeIdempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := apikey.FromContext(r.Context())
+		if value := r.Header.Get(idempotency.Header); ok && value != "" {
+			r.Header.Set(idempotency.Header, key.ID+":"+value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitBody caps request bodies at handler.MaxBodySize before the
+// middleware reading them in full, like signing and idempotency, does
+func limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handler.MaxBodySize > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, handler.MaxBodySize)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsMiddleware answers preflights and sets the CORS headers of requests
+// from the allowed origins
+func corsMiddleware(cfg CORSConfig, next http.Handler) http.Handler {
+	if len(cfg.AllowOrigins) == 0 {
+		return next
+	}
+	headers := cfg.AllowHeaders
+	if len(headers) == 0 {
+		headers = []string{"Content-Type", "Authorization", apikey.Header, "Prefer"}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !slices.Contains(cfg.AllowOrigins, origin) && !slices.Contains(cfg.AllowOrigins, "*") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(Verbs, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		if cfg.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
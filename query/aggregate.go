@@ -0,0 +1,221 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// aggregateFunctions are the metrics allowed in ?metrics=, with their
+// SurrealDB equivalents
+var aggregateFunctions = map[string]string{
+	"count": "count",
+	"sum":   "math::sum",
+	"avg":   "math::mean",
+	"min":   "math::min",
+	"max":   "math::max",
+}
+
+// dateParts are the time buckets allowed in ?dimensions=, e.g. month(created_at)
+var dateParts = map[string]bool{
+	"year":  true,
+	"month": true,
+	"week":  true,
+	"day":   true,
+	"hour":  true,
+}
+
+// bucketFormats truncate a timestamp by formatting it, for MySQL and SQLite
+var bucketFormats = map[string]string{
+	"year":  "%Y-01-01",
+	"month": "%Y-%m-01",
+	"day":   "%Y-%m-%d",
+	"hour":  "%Y-%m-%d %H:00:00",
+}
+
+// Aggregate is a parsed aggregation request
+type Aggregate struct {
+	// Select is the select list, dimensions first
+	Select string
+	// GroupBy is the GROUP BY list, empty without dimensions
+	GroupBy string
+	// Aliases are the output column names, usable in ORDER BY
+	Aliases []string
+}
+
+// ParseAggregate parses ?metrics=sum(amount),count(*) and
+// ?dimensions=region,month(created_at) into a GROUP BY query. Only the
+// functions above are allowed, and columns are validated against the table
+// metadata when it is provided.
+func ParseAggregate(metrics, dimensions, dbType string, table *utils.Table) (*Aggregate, error) {
+	if metrics == "" {
+		return nil, fmt.Errorf("metrics required")
+	}
+
+	agg := &Aggregate{}
+	selects := []string{}
+	groups := []string{}
+
+	if dimensions != "" {
+		for _, dim := range strings.Split(dimensions, ",") {
+			fn, column, err := parseAggregateCall(dim)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkAggregateColumn(column, table, false); err != nil {
+				return nil, err
+			}
+
+			expr, alias := column, column
+			if fn != "" {
+				if !dateParts[fn] {
+					return nil, fmt.Errorf("unsupported dimension function %s", fn)
+				}
+				expr, alias = dateBucket(fn, column, dbType), fn+"_"+column
+			}
+
+			selects = append(selects, fmt.Sprintf("%s AS %s", expr, alias))
+			agg.Aliases = append(agg.Aliases, alias)
+			if dbType == "surrealdb" {
+				groups = append(groups, alias)
+			} else {
+				groups = append(groups, expr)
+			}
+		}
+	}
+
+	for _, metric := range strings.Split(metrics, ",") {
+		fn, column, err := parseAggregateCall(metric)
+		if err != nil {
+			return nil, err
+		}
+		surrealFn, ok := aggregateFunctions[fn]
+		if !ok {
+			return nil, fmt.Errorf("unsupported metric %s", strings.TrimSpace(metric))
+		}
+
+		alias := fn
+		if column != "*" {
+			if err := checkAggregateColumn(column, table, fn == "sum" || fn == "avg"); err != nil {
+				return nil, err
+			}
+			alias = fn + "_" + column
+		} else if fn != "count" {
+			return nil, fmt.Errorf("%s(*) is not supported", fn)
+		}
+
+		var expr string
+		switch {
+		case dbType == "surrealdb" && column == "*":
+			expr = "count()"
+		case dbType == "surrealdb":
+			expr = fmt.Sprintf("%s(%s)", surrealFn, column)
+		default:
+			expr = fmt.Sprintf("%s(%s)", strings.ToUpper(fn), column)
+		}
+
+		selects = append(selects, fmt.Sprintf("%s AS %s", expr, alias))
+		agg.Aliases = append(agg.Aliases, alias)
+	}
+
+	agg.Select = strings.Join(selects, ", ")
+	agg.GroupBy = strings.Join(groups, ", ")
+	return agg, nil
+}
+
+// GroupByMetrics extracts the metrics from ?select= for a grouped read like
+// ?select=region,sum(amount)&group_by=region. Plain columns must be grouped
+// on, since dimensions are always selected. An empty select counts rows.
+func GroupByMetrics(selectParam, groupBy string) (string, error) {
+	if selectParam == "" {
+		return "count(*)", nil
+	}
+
+	dims := map[string]bool{}
+	for _, dim := range strings.Split(groupBy, ",") {
+		fn, column, err := parseAggregateCall(dim)
+		if err != nil {
+			return "", err
+		}
+		if fn != "" {
+			column = fn + "_" + column
+		}
+		dims[column] = true
+	}
+
+	metrics := []string{}
+	for _, part := range strings.Split(selectParam, ",") {
+		part = strings.TrimSpace(part)
+		if strings.Contains(part, "(") {
+			metrics = append(metrics, part)
+			continue
+		}
+		if !dims[part] {
+			return "", fmt.Errorf("column %s must be in group_by", part)
+		}
+	}
+
+	if len(metrics) == 0 {
+		return "count(*)", nil
+	}
+	return strings.Join(metrics, ","), nil
+}
+
+// parseAggregateCall splits "sum(amount)" into ("sum", "amount"). A bare
+// column returns an empty function.
+func parseAggregateCall(s string) (string, string, error) {
+	s = strings.TrimSpace(s)
+	open := strings.IndexByte(s, '(')
+	if open < 0 {
+		return "", s, nil
+	}
+	if !strings.HasSuffix(s, ")") {
+		return "", "", fmt.Errorf("invalid expression %s", s)
+	}
+	return strings.ToLower(s[:open]), strings.TrimSpace(s[open+1 : len(s)-1]), nil
+}
+
+// checkAggregateColumn validates a column name, and that it is numeric when
+// numeric is set and the table metadata is known
+func checkAggregateColumn(column string, table *utils.Table, numeric bool) error {
+	if err := utils.ValidateColumnName(column); err != nil {
+		return err
+	}
+	if table == nil {
+		return nil
+	}
+
+	col, ok := table.Column(column)
+	if !ok {
+		return fmt.Errorf("unknown column %s", column)
+	}
+	if jsonType := utils.JSONType(col.Type); numeric && jsonType != "integer" && jsonType != "number" && jsonType != "decimal" {
+		return fmt.Errorf("column %s is not numeric", column)
+	}
+	return nil
+}
+
+// dateBucket truncates a timestamp column to a date part in the dialect of
+// dbType
+func dateBucket(part, column, dbType string) string {
+	switch dbType {
+	case "surrealdb":
+		if part == "week" {
+			return fmt.Sprintf("time::floor(%s, 1w)", column)
+		}
+		return fmt.Sprintf("time::group(%s, '%s')", column, part)
+	case "mysql":
+		if part == "week" {
+			return fmt.Sprintf("DATE_SUB(DATE(%s), INTERVAL WEEKDAY(%s) DAY)", column, column)
+		}
+		return fmt.Sprintf("DATE_FORMAT(%s, '%s')", column, bucketFormats[part])
+	case "sqlite":
+		if part == "week" {
+			return fmt.Sprintf("date(%s, 'weekday 0', '-6 days')", column)
+		}
+		return fmt.Sprintf("strftime('%s', %s)", bucketFormats[part], column)
+	default:
+		return fmt.Sprintf("date_trunc('%s', %s)", part, column)
+	}
+}
@@ -0,0 +1,70 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test metrics and dimensions build allow-listed GROUP BY expressions
+func TestParseAggregate(t *testing.T) {
+	tests := []struct {
+		dbType     string
+		selectList string
+		groupBy    string
+	}{
+		{"postgres", "region AS region, date_trunc('month', created_at) AS month_created_at, SUM(amount) AS sum_amount, COUNT(*) AS count", "region, date_trunc('month', created_at)"},
+		{"mysql", "region AS region, DATE_FORMAT(created_at, '%Y-%m-01') AS month_created_at, SUM(amount) AS sum_amount, COUNT(*) AS count", "region, DATE_FORMAT(created_at, '%Y-%m-01')"},
+		{"sqlite", "region AS region, strftime('%Y-%m-01', created_at) AS month_created_at, SUM(amount) AS sum_amount, COUNT(*) AS count", "region, strftime('%Y-%m-01', created_at)"},
+		{"surrealdb", "region AS region, time::group(created_at, 'month') AS month_created_at, math::sum(amount) AS sum_amount, count() AS count", "region, month_created_at"},
+	}
+
+	for _, tt := range tests {
+		agg, err := ParseAggregate("sum(amount),count(*)", "region,month(created_at)", tt.dbType, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.selectList, agg.Select, tt.dbType)
+		assert.Equal(t, tt.groupBy, agg.GroupBy, tt.dbType)
+		assert.Equal(t, []string{"region", "month_created_at", "sum_amount", "count"}, agg.Aliases)
+	}
+
+	table := &utils.Table{Name: "orders", Columns: []utils.Column{
+		{Name: "amount", Type: "NUMERIC(10,2)"},
+		{Name: "region", Type: "TEXT"},
+	}}
+	agg, err := ParseAggregate("avg(amount),max(region)", "", "postgres", table)
+	assert.NoError(t, err)
+	assert.Equal(t, "AVG(amount) AS avg_amount, MAX(region) AS max_region", agg.Select)
+	assert.Equal(t, "", agg.GroupBy)
+
+	invalid := [][2]string{
+		{"", "region"},
+		{"pg_sleep(1)", ""},
+		{"sum(*)", ""},
+		{"sum(region)", ""},
+		{"sum(missing)", ""},
+		{"count(*)", "lower(region)"},
+		{"count(*)", "region; DROP"},
+		{"sum(amount", ""},
+	}
+	for _, tt := range invalid {
+		_, err := ParseAggregate(tt[0], tt[1], "postgres", table)
+		assert.Error(t, err, tt)
+	}
+}
+
+// Test metrics are taken from select for grouped reads
+func TestGroupByMetrics(t *testing.T) {
+	metrics, err := GroupByMetrics("day_created_at,region,sum(amount),count(*)", "region,day(created_at)")
+	assert.NoError(t, err)
+	assert.Equal(t, "sum(amount),count(*)", metrics)
+
+	metrics, err = GroupByMetrics("", "region")
+	assert.NoError(t, err)
+	assert.Equal(t, "count(*)", metrics)
+
+	_, err = GroupByMetrics("name,count(*)", "region")
+	assert.EqualError(t, err, "column name must be in group_by")
+	_, err = GroupByMetrics("created_at", "day(created_at)")
+	assert.Error(t, err)
+}
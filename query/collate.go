@@ -0,0 +1,77 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Collations are the collations ?collate=ci stands for on each database,
+// comparing text case insensitively, and accent insensitively where the
+// collation allows
+var Collations = map[string]string{
+	"postgres": "und-x-icu",
+	"mysql":    "utf8mb4_0900_ai_ci",
+	"sqlite":   "NOCASE",
+}
+
+var collationRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// textTypes are the column types collations apply to
+var textTypes = map[string]bool{
+	"CHAR":              true,
+	"CHARACTER":         true,
+	"CHARACTER VARYING": true,
+	"NCHAR":             true,
+	"VARCHAR":           true,
+	"NVARCHAR":          true,
+	"TEXT":              true,
+	"TINYTEXT":          true,
+	"MEDIUMTEXT":        true,
+	"LONGTEXT":          true,
+	"CITEXT":            true,
+}
+
+// ParseCollation converts a collation name, or ci for the database's
+// insensitive one, into the COLLATE clause of dbType. Postgres names are
+// quoted, as ICU names like und-x-icu are not identifiers.
+func ParseCollation(name, dbType string) (string, error) {
+	if dbType == "surrealdb" {
+		return "", fmt.Errorf("collate is not supported on surrealdb")
+	}
+	if name == "ci" {
+		name = Collations[dbType]
+	}
+	if !collationRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid collation %q", name)
+	}
+	if dbType == "postgres" {
+		return `COLLATE "` + name + `"`, nil
+	}
+	return "COLLATE " + name, nil
+}
+
+// collate applies the collation of opts to a column compared to text: the
+// ?collate= one, or else the column's own. Without table metadata, text is
+// whether the value compared is a string.
+func collate(column string, text bool, opts *Options) (string, error) {
+	name := opts.Collate
+	if opts.Table != nil {
+		if col, ok := opts.Table.Column(column); ok {
+			text = textTypes[utils.BaseType(col.Type)]
+			if name == "" {
+				name = col.Collate
+			}
+		}
+	}
+	if name == "" || !text {
+		return column, nil
+	}
+
+	clause, err := ParseCollation(name, opts.DBType)
+	if err != nil {
+		return "", err
+	}
+	return column + " " + clause, nil
+}
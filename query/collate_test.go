@@ -0,0 +1,59 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test collations apply to text comparisons only, from the request or the
+// column
+func TestCollate(t *testing.T) {
+	table := &utils.Table{Name: "users", Columns: []utils.Column{
+		{Name: "id", Type: "INTEGER"},
+		{Name: "name", Type: "VARCHAR(100)"},
+		{Name: "email", Type: "TEXT", Collate: "ci"},
+		{Name: "code", Type: "TEXT"},
+	}}
+
+	tests := []struct {
+		query       string
+		opts        Options
+		expectedSQL string
+		errMsg      string
+	}{
+		{"name=eq.José", Options{DBType: "postgres", Collate: "ci"}, `name COLLATE "und-x-icu" = ?`, ""},
+		{"name=eq.José", Options{DBType: "mysql", Collate: "ci"}, "name COLLATE utf8mb4_0900_ai_ci = ?", ""},
+		{"name=eq.José", Options{DBType: "sqlite", Collate: "ci"}, "name COLLATE NOCASE = ?", ""},
+		{"name=eq.José", Options{DBType: "mysql", Collate: "utf8mb4_unicode_ci"}, "name COLLATE utf8mb4_unicode_ci = ?", ""},
+		{"level=gt.2&name=in.(a,b)", Options{DBType: "sqlite", Collate: "ci"}, "level > ? AND name COLLATE NOCASE IN (?, ?)", ""},
+		{"name=isdistinct.a", Options{DBType: "postgres", Collate: "ci"}, `name COLLATE "und-x-icu" IS DISTINCT FROM ?`, ""},
+		{"name=ilike.jo*", Options{DBType: "postgres", Collate: "ci", PostgREST: true}, `name COLLATE "und-x-icu" ILIKE ?`, ""},
+		{"id=eq.007&code=eq.007", Options{DBType: "postgres", Collate: "ci", Table: table}, `id = ? AND code COLLATE "und-x-icu" = ?`, ""},
+		{"email=eq.A@example.com&name=eq.a", Options{DBType: "mysql", Table: table}, "email COLLATE utf8mb4_0900_ai_ci = ? AND name = ?", ""},
+		{"name=eq.a", Options{DBType: "surrealdb", Collate: "ci"}, "", "collate is not supported on surrealdb"},
+		{"name=eq.a", Options{DBType: "postgres", Collate: `C" OR 1=1`}, "", `invalid collation "C\" OR 1=1"`},
+	}
+
+	for _, tt := range tests {
+		params, err := ParseParams(tt.query)
+		require.NoError(t, err)
+		sql, _, err := ParseFilters(params, tt.opts)
+		if tt.errMsg != "" {
+			assert.EqualError(t, err, tt.errMsg, tt.query)
+			continue
+		}
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.expectedSQL, sql, tt.query)
+	}
+
+	order, err := ParseCollatedOrder("name.desc,id,email", Options{DBType: "sqlite", Collate: "ci", Table: table})
+	require.NoError(t, err)
+	assert.Equal(t, "ORDER BY name COLLATE NOCASE DESC, id ASC, email COLLATE NOCASE ASC", order)
+
+	order, err = ParseCollatedOrder("name", Options{DBType: "sqlite", Collate: "ci"})
+	require.NoError(t, err)
+	assert.Equal(t, "ORDER BY name ASC", order)
+}
@@ -0,0 +1,168 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Filter is the JSON form of the filter grammar, used when a query is too
+// large for a URL. A filter is either a condition (column, op and value,
+// e.g. {"column": "level", "op": "lt", "value": 2}) or a group combining
+// other filters with and, or or not.
+type Filter struct {
+	And    []Filter `json:"and,omitempty"`
+	Or     []Filter `json:"or,omitempty"`
+	Not    *Filter  `json:"not,omitempty"`
+	Column string   `json:"column,omitempty"`
+	Op     string   `json:"op,omitempty"`
+	Value  any      `json:"value,omitempty"`
+}
+
+// ParseFilter converts a structured filter into a SQL WHERE clause using the
+// same operators and options as ParseFilters
+func ParseFilter(filter Filter, opts Options) (string, []interface{}, error) {
+	var buf bytes.Buffer
+	args, err := appendFilter(&buf, []interface{}{}, filter, &opts)
+	if err != nil {
+		return "", nil, err
+	}
+	return buf.String(), args, nil
+}
+
+// Columns returns the columns the filter restricts every row by: its own
+// condition and those of and groups, but not conditions under or or not
+func (f Filter) Columns() map[string]bool {
+	columns := map[string]bool{}
+	f.addColumns(columns)
+	return columns
+}
+
+func (f Filter) addColumns(columns map[string]bool) {
+	if f.Column != "" {
+		columns[f.Column] = true
+	}
+	for _, child := range f.And {
+		child.addColumns(columns)
+	}
+}
+
+func appendFilter(buf *bytes.Buffer, args []interface{}, filter Filter, opts *Options) ([]interface{}, error) {
+	kinds := 0
+	for _, set := range []bool{filter.And != nil, filter.Or != nil, filter.Not != nil, filter.Column != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, fmt.Errorf("filter must have exactly one of and, or, not or column")
+	}
+
+	switch {
+	case filter.Not != nil:
+		buf.WriteString("NOT (")
+		args, err := appendFilter(buf, args, *filter.Not, opts)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(")")
+		return args, nil
+	case filter.And != nil:
+		return appendFilterGroup(buf, args, " AND ", filter.And, opts)
+	case filter.Or != nil:
+		return appendFilterGroup(buf, args, " OR ", filter.Or, opts)
+	}
+
+	value, err := filterValue(filter.Value)
+	if list, ok := filter.Value.([]any); ok && filter.Op == "in" {
+		value, err = filterList(list)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for column %s: %v", filter.Column, err)
+	}
+	if err := utils.ValidateColumnName(filter.Column); err != nil {
+		return nil, err
+	}
+
+	// Conditions go through the same parser as URL filters, so values may
+	// contain characters that would need escaping in a URL group
+	clause, clauseArgs, err := parseCondition(filter.Column, filter.Op+"."+value, opts)
+	if err != nil {
+		return nil, err
+	}
+	if clause == "" {
+		return nil, fmt.Errorf("unsupported operator %q for column %s", filter.Op, filter.Column)
+	}
+	buf.WriteString(clause)
+	return append(args, clauseArgs...), nil
+}
+
+func appendFilterGroup(buf *bytes.Buffer, args []interface{}, sep string, filters []Filter, opts *Options) ([]interface{}, error) {
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("filter group must not be empty")
+	}
+
+	buf.WriteString("(")
+	for i, filter := range filters {
+		if i > 0 {
+			buf.WriteString(sep)
+		}
+		var err error
+		args, err = appendFilter(buf, args, filter, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString(")")
+	return args, nil
+}
+
+// filterValue renders a JSON value as it would appear in a URL filter.
+// Arrays become array literals like {a,b}.
+func filterValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number:
+		return v.String(), nil
+	case []any:
+		elems := make([]string, 0, len(v))
+		for _, elem := range v {
+			s, err := filterValue(elem)
+			if err != nil {
+				return "", err
+			}
+			elems = append(elems, s)
+		}
+		return "{" + strings.Join(elems, ",") + "}", nil
+	default:
+		return "", fmt.Errorf("unsupported type %T", value)
+	}
+}
+
+// filterList renders a JSON array as the list of an in filter, like (a,b),
+// quoting values holding commas
+func filterList(values []any) (string, error) {
+	elems := make([]string, 0, len(values))
+	for _, value := range values {
+		s, err := filterValue(value)
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(s, ",") {
+			s = `"` + s + `"`
+		}
+		elems = append(elems, s)
+	}
+	return "(" + strings.Join(elems, ",") + ")", nil
+}
@@ -0,0 +1,39 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test structured filters produce the same SQL as the URL grammar
+func TestParseFilter(t *testing.T) {
+	var filter Filter
+	err := json.Unmarshal([]byte(`{"and": [
+		{"column": "level", "op": "lt", "value": 2},
+		{"or": [{"column": "name", "op": "eq", "value": "a,(b)"}, {"not": {"column": "hidden", "op": "eq", "value": true}}]},
+		{"column": "tags", "op": "cs", "value": ["x", "y"]},
+		{"column": "id", "op": "in", "value": [1, "a,b"]}
+	]}`), &filter)
+	assert.NoError(t, err)
+
+	sql, args, err := ParseFilter(filter, Options{DBType: "postgres"})
+	assert.NoError(t, err)
+	assert.Equal(t, "(level < ? AND (name = ? OR NOT (hidden = ?)) AND tags @> ? AND id IN (?, ?))", sql)
+	assert.Equal(t, []interface{}{int64(2), "a,(b)", true, "{x,y}", int64(1), "a,b"}, args)
+
+	invalid := []Filter{
+		{},
+		{Column: "level", Op: "lt", Value: 2, Or: []Filter{}},
+		{Or: []Filter{}},
+		{Column: "level; DROP", Op: "eq", Value: 1},
+		{Column: "level", Op: "between", Value: 1},
+		{Column: "level", Op: "eq", Value: map[string]any{}},
+		{Column: "id", Op: "in", Value: []any{}},
+	}
+	for _, f := range invalid {
+		_, _, err := ParseFilter(f, Options{DBType: "postgres"})
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,163 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// sqlAlphabet is every character the parsers emit themselves: identifiers,
+// keywords, operators and placeholders. Quotes, semicolons, comment markers
+// or anything else in generated SQL can only have come from user input.
+var sqlAlphabet = regexp.MustCompile(`^[a-zA-Z0-9_ ,.()?<>=!@&|~*:-]*$`)
+
+var (
+	selectColumnRegexp = regexp.MustCompile(`^(\*|[a-zA-Z_][a-zA-Z0-9_]*( AS [a-zA-Z_][a-zA-Z0-9_]*)?)$`)
+	orderColumnRegexp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*( ASC| DESC)( NULLS FIRST| NULLS LAST)?$`)
+)
+
+// checkBound is the invariant of every parser producing SQL: the SQL holds
+// only characters the parsers emit, comment markers excepted, and each value
+// is bound, so there is one placeholder per argument
+func checkBound(sql string, args []interface{}) error {
+	if !sqlAlphabet.MatchString(sql) || strings.Contains(sql, "--") {
+		return fmt.Errorf("unbound input in %q", sql)
+	}
+	if n := strings.Count(sql, "?"); n != len(args) {
+		return fmt.Errorf("%d placeholders for %d args in %q", n, len(args), sql)
+	}
+	return nil
+}
+
+var fuzzTable = &utils.Table{
+	Name: "products",
+	Columns: []utils.Column{
+		{Name: "id", Type: "INTEGER"},
+		{Name: "name", Type: "TEXT"},
+		{Name: "addr_city", Type: "TEXT"},
+		{Name: "status", Type: "ENUM", Enum: []string{"draft", "published"}},
+	},
+}
+
+// Fuzz the URL filter grammar, in both modes and on every dialect
+func FuzzParseFilters(f *testing.F) {
+	for _, seed := range []string{
+		"level=lt.2&hidden=is.false",
+		"or=(level=lt.2,and=(name=like.pen*,hidden=is.true))",
+		"not=(level=gte.3)",
+		"name=not.ilike.*pen*&price=is.null",
+		"tags=cs.{a,b}&tags=any.x&status=eq.draft",
+		"created_at=gt.now-7d&created_at=lt.today",
+		"level=lt.2;DROP TABLE products",
+		"name=eq.'); DELETE FROM products; --",
+		"or=(name=eq.a)b,level=lt.(1)",
+	} {
+		f.Add(seed, false, uint8(0))
+		f.Add(seed, true, uint8(1))
+	}
+
+	dialects := []string{"postgres", "mysql", "sqlite", "surrealdb"}
+	f.Fuzz(func(t *testing.T, rawQuery string, postgREST bool, dialect uint8) {
+		params, err := ParseParams(rawQuery)
+		if err != nil {
+			return
+		}
+		opts := Options{DBType: dialects[int(dialect)%len(dialects)], Table: fuzzTable, PostgREST: postgREST}
+		sql, args, err := ParseFilters(params, opts)
+		if err != nil {
+			return
+		}
+		if err := checkBound(sql, args); err != nil {
+			t.Fatalf("%s: %v", rawQuery, err)
+		}
+	})
+}
+
+// Fuzz the JSON filter tree of POST /{table}/query
+func FuzzParseFilter(f *testing.F) {
+	for _, seed := range []string{
+		`{"column": "level", "op": "lt", "value": 2}`,
+		`{"or": [{"column": "level", "op": "lt", "value": 2}, {"not": {"column": "name", "op": "eq", "value": "x"}}]}`,
+		`{"and": [{"column": "tags", "op": "cs", "value": ["a", "b"]}]}`,
+		`{"column": "name", "op": "eq", "value": "'); DROP TABLE products; --"}`,
+		`{"column": "name; DROP", "op": "eq", "value": 1}`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var filter Filter
+		if err := json.Unmarshal(body, &filter); err != nil {
+			return
+		}
+		sql, args, err := ParseFilter(filter, Options{DBType: "postgres"})
+		if err != nil {
+			return
+		}
+		if err := checkBound(sql, args); err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+	})
+}
+
+// Fuzz ?select=, which must only ever produce columns and aliases
+func FuzzParseSelect(f *testing.F) {
+	for _, seed := range []string{
+		"id,name",
+		"label:name,*",
+		"addr_*",
+		"!status",
+		"author(name)",
+		"id,name FROM users; --",
+		"id:name,name",
+	} {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+
+	f.Fuzz(func(t *testing.T, selectParam string, withTable bool) {
+		var table *utils.Table
+		if withTable {
+			table = fuzzTable
+		}
+		sql, err := ParseSelect(selectParam, table)
+		if err != nil {
+			return
+		}
+		for _, column := range strings.Split(sql, ", ") {
+			if !selectColumnRegexp.MatchString(column) {
+				t.Fatalf("%s: unbound input in %q", selectParam, sql)
+			}
+		}
+	})
+}
+
+// Fuzz ?order=, which must only ever produce columns and directions
+func FuzzParseOrder(f *testing.F) {
+	for _, seed := range []string{
+		"id.desc,name.asc.nullslast",
+		"price.desc.nullsfirst",
+		"id;DROP TABLE products",
+		"id desc, (SELECT 1)",
+		"id.",
+		",",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, order string) {
+		sql, err := ParseOrder(order)
+		if err != nil || sql == "" {
+			return
+		}
+		for _, column := range strings.Split(strings.TrimPrefix(sql, "ORDER BY "), ", ") {
+			if !orderColumnRegexp.MatchString(column) {
+				t.Fatalf("%s: unbound input in %q", order, sql)
+			}
+		}
+	})
+}
@@ -0,0 +1,288 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// writeKeywords may not appear anywhere in a guarded statement
+// (data-modifying CTEs, SELECT INTO, FOR UPDATE/SHARE locks)
+var writeKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "UPSERT": true,
+	"DROP": true, "ALTER": true, "CREATE": true, "TRUNCATE": true, "GRANT": true,
+	"REVOKE": true, "COPY": true, "INTO": true, "CALL": true, "EXECUTE": true,
+	"LOCK": true, "SHARE": true,
+}
+
+// AllowedFunctions are the functions a guarded statement may call, by upper
+// case name. Any other name followed by a parenthesis is rejected, as
+// functions like pg_sleep, query_to_xml or dblink have side effects or read
+// tables the FROM check never sees. Add to it before serving to allow more.
+var AllowedFunctions = map[string]bool{
+	// Aggregates
+	"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true,
+	"STRING_AGG": true, "ARRAY_AGG": true, "GROUP_CONCAT": true, "JSON_AGG": true, "JSONB_AGG": true,
+	"BOOL_AND": true, "BOOL_OR": true, "STDDEV": true, "STDDEV_POP": true, "STDDEV_SAMP": true,
+	"VARIANCE": true, "VAR_POP": true, "VAR_SAMP": true, "PERCENTILE_CONT": true, "PERCENTILE_DISC": true,
+	// Window functions
+	"ROW_NUMBER": true, "RANK": true, "DENSE_RANK": true, "PERCENT_RANK": true, "CUME_DIST": true,
+	"NTILE": true, "LAG": true, "LEAD": true, "FIRST_VALUE": true, "LAST_VALUE": true, "NTH_VALUE": true,
+	// Conditionals and conversions
+	"COALESCE": true, "NULLIF": true, "GREATEST": true, "LEAST": true, "IFNULL": true, "IIF": true,
+	"CAST": true,
+	// Strings
+	"LOWER": true, "UPPER": true, "LENGTH": true, "CHAR_LENGTH": true, "SUBSTRING": true, "SUBSTR": true,
+	"TRIM": true, "LTRIM": true, "RTRIM": true, "REPLACE": true, "CONCAT": true, "CONCAT_WS": true,
+	"LEFT": true, "RIGHT": true, "LPAD": true, "RPAD": true, "POSITION": true, "STRPOS": true, "INSTR": true,
+	"SPLIT_PART": true, "REVERSE": true, "INITCAP": true, "REGEXP_REPLACE": true,
+	// Numbers
+	"ABS": true, "CEIL": true, "CEILING": true, "FLOOR": true, "ROUND": true, "TRUNC": true, "MOD": true,
+	"POWER": true, "SQRT": true, "EXP": true, "LN": true, "LOG": true, "SIGN": true, "RANDOM": true, "RAND": true,
+	// Dates
+	"NOW": true, "EXTRACT": true, "DATE_TRUNC": true, "DATE_PART": true, "DATE": true, "DATETIME": true,
+	"STRFTIME": true, "DATE_FORMAT": true, "TO_CHAR": true, "TO_DATE": true, "TO_TIMESTAMP": true, "AGE": true,
+	"DATE_ADD": true, "DATE_SUB": true, "DATEDIFF": true, "JULIANDAY": true, "YEAR": true, "MONTH": true, "DAY": true,
+	// JSON and arrays
+	"JSON_EXTRACT": true, "JSON_BUILD_OBJECT": true, "JSONB_BUILD_OBJECT": true, "JSON_BUILD_ARRAY": true,
+	"JSON_OBJECT": true, "JSON_ARRAY": true, "JSON_ARRAY_LENGTH": true, "JSONB_ARRAY_LENGTH": true,
+	"TO_JSON": true, "TO_JSONB": true, "JSON_EACH": true, "JSONB_EACH": true,
+	"JSON_ARRAY_ELEMENTS": true, "JSONB_ARRAY_ELEMENTS": true,
+	"ARRAY_LENGTH": true, "CARDINALITY": true, "ARRAY_TO_STRING": true, "STRING_TO_ARRAY": true,
+	// Table functions
+	"GENERATE_SERIES": true, "UNNEST": true,
+}
+
+// parenKeywords may be followed by a parenthesis without calling a function
+var parenKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true, "NOT": true, "IN": true,
+	"EXISTS": true, "ANY": true, "ALL": true, "SOME": true, "AS": true, "ON": true, "USING": true,
+	"JOIN": true, "LATERAL": true, "VALUES": true, "OVER": true, "FILTER": true, "GROUP": true, "BY": true,
+	"WHEN": true, "THEN": true, "ELSE": true, "IS": true, "BETWEEN": true, "LIKE": true, "ILIKE": true,
+	"TO": true, "DISTINCT": true, "UNION": true, "INTERSECT": true, "EXCEPT": true, "HAVING": true,
+	"LIMIT": true, "OFFSET": true, "ARRAY": true, "ROW": true, "TABLESAMPLE": true, "BERNOULLI": true,
+	"SYSTEM": true, "REPEATABLE": true, "MATCH": true, "AGAINST": true, "ESCAPE": true, "WITH": true,
+}
+
+// clauseKeywords end a FROM list
+var clauseKeywords = map[string]bool{
+	"WHERE": true, "GROUP": true, "ORDER": true, "HAVING": true, "LIMIT": true,
+	"OFFSET": true, "UNION": true, "INTERSECT": true, "EXCEPT": true, "WINDOW": true,
+	"ON": true, "USING": true, "SELECT": true, "FETCH": true,
+}
+
+// GuardSQL checks that sql is a single read-only SELECT (or WITH ... SELECT)
+// reading only the given tables and calling only AllowedFunctions, and caps
+// it at maxRows by appending a LIMIT when it has none. It is meant for
+// trusted tooling and is not a substitute for running the statement as a
+// read-only database role limited to the tables.
+func GuardSQL(sql string, tables []string, maxRows int) (string, error) {
+	tokens, err := tokenizeSQL(sql)
+	if err != nil {
+		return "", err
+	}
+
+	// Allow a single trailing semicolon
+	if n := len(tokens); n > 0 && tokens[n-1] == ";" {
+		tokens = tokens[:n-1]
+	}
+	if len(tokens) == 0 {
+		return "", fmt.Errorf("empty statement")
+	}
+	if first := strings.ToUpper(tokens[0]); first != "SELECT" && first != "WITH" {
+		return "", fmt.Errorf("only SELECT statements are allowed")
+	}
+
+	allowed := map[string]bool{}
+	for _, table := range tables {
+		allowed[strings.ToLower(table)] = true
+	}
+
+	// CTE names are readable like tables
+	for i := 1; i+2 < len(tokens); i++ {
+		prev := strings.ToUpper(tokens[i-1])
+		if (prev == "WITH" || prev == "RECURSIVE" || prev == ",") && strings.EqualFold(tokens[i+1], "AS") && tokens[i+2] == "(" {
+			allowed[strings.ToLower(unquoteIdentifier(tokens[i]))] = true
+		}
+	}
+
+	// queries[d] is true when the parenthesis at depth d holds a subquery,
+	// so FROM inside functions like EXTRACT(YEAR FROM ts) is not a table
+	queries := []bool{true}
+	inFrom := []bool{false}
+	topLimit := -1
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		upper := strings.ToUpper(token)
+		depth := len(queries) - 1
+
+		switch {
+		case token == ";":
+			return "", fmt.Errorf("only a single statement is allowed")
+		case token == "(":
+			next := ""
+			if i+1 < len(tokens) {
+				next = strings.ToUpper(tokens[i+1])
+			}
+			queries = append(queries, next == "SELECT" || next == "WITH")
+			inFrom = append(inFrom, false)
+			continue
+		case token == ")":
+			if depth == 0 {
+				return "", fmt.Errorf("unbalanced parentheses")
+			}
+			queries = queries[:depth]
+			inFrom = inFrom[:depth]
+			continue
+		case writeKeywords[upper]:
+			return "", fmt.Errorf("%s is not allowed", upper)
+		case i+1 < len(tokens) && tokens[i+1] == "(" && isCall(tokens, i):
+			name := unquoteIdentifier(token)
+			if !AllowedFunctions[strings.ToUpper(name)] {
+				return "", fmt.Errorf("function %s is not allowed", strings.ToLower(name))
+			}
+		}
+
+		if !queries[depth] {
+			continue
+		}
+
+		switch {
+		case upper == "LIMIT" && depth == 0:
+			topLimit = i
+			inFrom[depth] = false
+		case upper == "FROM" || upper == "JOIN":
+			inFrom[depth] = true
+			if err := checkTableRef(tokens, i+1, allowed); err != nil {
+				return "", err
+			}
+		case token == "," && inFrom[depth]:
+			if err := checkTableRef(tokens, i+1, allowed); err != nil {
+				return "", err
+			}
+		case clauseKeywords[upper]:
+			inFrom[depth] = false
+		}
+	}
+	if len(queries) != 1 {
+		return "", fmt.Errorf("unbalanced parentheses")
+	}
+
+	sql = strings.TrimSuffix(strings.TrimSpace(sql), ";")
+	if maxRows <= 0 {
+		return sql, nil
+	}
+	if topLimit < 0 {
+		return fmt.Sprintf("%s LIMIT %d", sql, maxRows), nil
+	}
+	if topLimit+1 >= len(tokens) {
+		return "", fmt.Errorf("invalid LIMIT")
+	}
+	limit, err := strconv.Atoi(tokens[topLimit+1])
+	if err != nil || limit < 0 {
+		return "", fmt.Errorf("LIMIT must be a number")
+	}
+	if limit > maxRows {
+		return "", fmt.Errorf("LIMIT exceeds the maximum of %d rows", maxRows)
+	}
+	return sql, nil
+}
+
+// isCall reports whether tokens[i], followed by a parenthesis, names a
+// function. Types like numeric(10,2) after AS or :: and column lists of
+// aliases are not calls.
+func isCall(tokens []string, i int) bool {
+	token := tokens[i]
+	if token[0] != '"' && token[0] != '`' && (!isIdentifierChar(token[0]) || token[0] >= '0' && token[0] <= '9') {
+		return false
+	}
+	if parenKeywords[strings.ToUpper(token)] {
+		return false
+	}
+	return i == 0 || !strings.EqualFold(tokens[i-1], "AS") && tokens[i-1] != ":"
+}
+
+// checkTableRef validates the table named at tokens[i], skipping LATERAL,
+// ONLY and subqueries. Table functions like generate_series(...) are
+// checked as functions.
+func checkTableRef(tokens []string, i int, allowed map[string]bool) error {
+	for i < len(tokens) && (strings.EqualFold(tokens[i], "LATERAL") || strings.EqualFold(tokens[i], "ONLY")) {
+		i++
+	}
+	if i >= len(tokens) || tokens[i] == "(" {
+		return nil
+	}
+	if i+1 < len(tokens) && tokens[i+1] == "(" {
+		return nil
+	}
+
+	name := unquoteIdentifier(tokens[i])
+	if !allowed[strings.ToLower(name)] {
+		return fmt.Errorf("table %s is not allowed", name)
+	}
+	return nil
+}
+
+func unquoteIdentifier(token string) string {
+	return strings.NewReplacer(`"`, "", "`", "").Replace(token)
+}
+
+// tokenizeSQL splits a statement into words, string literals and
+// punctuation. Comments are rejected so nothing can hide from the guard.
+func tokenizeSQL(sql string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*") || c == '#':
+			return nil, fmt.Errorf("comments are not allowed")
+		case c == '\'' || c == '"' || c == '`':
+			// Quotes are escaped by doubling them
+			j := i + 1
+			for {
+				if j >= len(sql) {
+					return nil, fmt.Errorf("unterminated quote")
+				}
+				if sql[j] == c {
+					if j+1 < len(sql) && sql[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				// MySQL reads backslash escapes in both kinds of strings
+				if sql[j] == '\\' && c != '`' {
+					return nil, fmt.Errorf("backslash escapes are not allowed")
+				}
+				j++
+			}
+			if c == '\'' {
+				tokens = append(tokens, "''")
+			} else {
+				tokens = append(tokens, sql[i:j+1])
+			}
+			i = j + 1
+		case isIdentifierChar(c):
+			j := i
+			for j < len(sql) && (isIdentifierChar(sql[j]) || sql[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, sql[i:j])
+			i = j
+		case c == '$':
+			// Dollar quoting could hide a statement
+			return nil, fmt.Errorf("dollar-quoted strings are not allowed")
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,60 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test raw SQL is limited to read-only statements on allowed tables
+func TestGuardSQL(t *testing.T) {
+	tables := []string{"orders", "customers"}
+
+	allowed := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT * FROM orders;", "SELECT * FROM orders LIMIT 100"},
+		{"select o.id, c.name from orders o join customers c on c.id = o.customer_id where o.note <> 'delete me'", "select o.id, c.name from orders o join customers c on c.id = o.customer_id where o.note <> 'delete me' LIMIT 100"},
+		{"SELECT EXTRACT(YEAR FROM created_at) AS y, COUNT(*) FROM orders, customers GROUP BY 1 LIMIT 10", "SELECT EXTRACT(YEAR FROM created_at) AS y, COUNT(*) FROM orders, customers GROUP BY 1 LIMIT 10"},
+		{"WITH recent AS (SELECT * FROM orders WHERE id IN (SELECT id FROM orders LIMIT 500)) SELECT * FROM recent", "WITH recent AS (SELECT * FROM orders WHERE id IN (SELECT id FROM orders LIMIT 500)) SELECT * FROM recent LIMIT 100"},
+		{"SELECT * FROM generate_series(1, 3)", "SELECT * FROM generate_series(1, 3) LIMIT 100"},
+		{"SELECT CAST(total AS numeric(10,2)), total::varchar(8), COUNT(*) FILTER (WHERE id IN (1, 2)) FROM orders", "SELECT CAST(total AS numeric(10,2)), total::varchar(8), COUNT(*) FILTER (WHERE id IN (1, 2)) FROM orders LIMIT 100"},
+		{"SELECT ROW_NUMBER() OVER (PARTITION BY customer_id ORDER BY id) FROM orders o WHERE EXISTS (SELECT 1 FROM customers)", "SELECT ROW_NUMBER() OVER (PARTITION BY customer_id ORDER BY id) FROM orders o WHERE EXISTS (SELECT 1 FROM customers) LIMIT 100"},
+	}
+	for _, tt := range allowed {
+		sql, err := GuardSQL(tt.sql, tables, 100)
+		assert.NoError(t, err, tt.sql)
+		assert.Equal(t, tt.expected, sql)
+	}
+
+	rejected := []string{
+		"",
+		"DELETE FROM orders",
+		"SELECT * FROM orders; DROP TABLE orders",
+		"SELECT * FROM users",
+		"SELECT * FROM orders JOIN users ON true",
+		"SELECT * FROM orders, users",
+		"SELECT * FROM orders WHERE id IN (SELECT id FROM users)",
+		"WITH x AS (DELETE FROM orders RETURNING *) SELECT * FROM x",
+		"SELECT * INTO backup FROM orders",
+		"SELECT * FROM orders FOR UPDATE",
+		"SELECT pg_sleep(10)",
+		`SELECT "pg_sleep"(10)`,
+		"SELECT pg_catalog.pg_sleep(10)",
+		"SELECT query_to_xml('select * from secrets', true, true, '')",
+		"SELECT * FROM orders WHERE id = (SELECT table_to_xml('secrets', true, true, ''))",
+		"SELECT * FROM query_to_xml('select * from secrets', true, true, '')",
+		`SELECT "a\" FROM orders`,
+		`SELECT 'a\' FROM orders`,
+		"SELECT * FROM orders -- comment",
+		"SELECT * FROM orders LIMIT 5000",
+		"SELECT * FROM orders LIMIT ALL",
+		"SELECT $$x$$",
+		"SELECT * FROM (orders",
+	}
+	for _, sql := range rejected {
+		_, err := GuardSQL(sql, tables, 100)
+		assert.Error(t, err, sql)
+	}
+}
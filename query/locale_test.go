@@ -0,0 +1,58 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test numbers and dates of numeric and date columns are read in the
+// locale, leaving other values and columns alone
+func TestLocale(t *testing.T) {
+	table := &utils.Table{Name: "orders", Columns: []utils.Column{
+		{Name: "id", Type: "INTEGER"},
+		{Name: "total", Type: "DECIMAL(10,2)"},
+		{Name: "placed", Type: "DATE"},
+		{Name: "shipped", Type: "TIMESTAMP"},
+		{Name: "code", Type: "TEXT"},
+	}}
+
+	tests := []struct {
+		query        string
+		locale       string
+		expectedSQL  string
+		expectedArgs []interface{}
+		errMsg       string
+	}{
+		{"total=gt.1.234,56", "de-DE", "total > ?", []interface{}{"1234.56"}, ""},
+		{"total=gt.1 234,5", "fr_FR.UTF-8", "total > ?", []interface{}{"1234.5"}, ""},
+		{"total=gt.1'234.5", "de-CH", "total > ?", []interface{}{"1234.5"}, ""},
+		{"total=lt.1,234.5", "en-US", "total < ?", []interface{}{"1234.5"}, ""},
+		{"total=lt.1.5", "de-DE", "total < ?", []interface{}{"1.5"}, ""},
+		{"id=in.(1.000,2.000)", "de-DE", "id IN (?, ?)", []interface{}{int64(1000), int64(2000)}, ""},
+		{"placed=gte.31/12/2024", "en-GB", "placed >= ?", []interface{}{"2024-12-31"}, ""},
+		{"placed=gte.12/31/2024", "en-US", "placed >= ?", []interface{}{"2024-12-31"}, ""},
+		{"placed=gte.31.12.2024", "de", "placed >= ?", []interface{}{"2024-12-31"}, ""},
+		{"placed=gte.2024-12-31", "de", "placed >= ?", []interface{}{"2024-12-31"}, ""},
+		{"placed=gte.31/02/2024", "en-GB", "placed >= ?", []interface{}{"31/02/2024"}, ""},
+		{"shipped=lt.1/2/2024 9:30", "en-GB", "shipped < ?", []interface{}{"2024-02-01 09:30:00"}, ""},
+		{"placed=isdistinct.31.12.2024", "de-DE", "placed IS DISTINCT FROM ?", []interface{}{"2024-12-31"}, ""},
+		{"code=eq.1.234,56", "de-DE", "code = ?", []interface{}{"1.234,56"}, ""},
+		{"total=gt.1,5", "xx", "", nil, `unknown locale "xx"`},
+	}
+
+	for _, tt := range tests {
+		params, err := ParseParams(tt.query)
+		require.NoError(t, err)
+		sql, args, err := ParseFilters(params, Options{DBType: "postgres", Table: table, Locale: tt.locale})
+		if tt.errMsg != "" {
+			assert.EqualError(t, err, tt.errMsg, tt.query)
+			continue
+		}
+		require.NoError(t, err, tt.query)
+		assert.Equal(t, tt.expectedSQL, sql, tt.query)
+		assert.Equal(t, tt.expectedArgs, args, tt.query)
+	}
+}
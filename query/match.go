@@ -0,0 +1,260 @@
+package query
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// MatchFilters reports whether a row satisfies the filters, evaluating the
+// same grammar as ParseFilters in memory. Parameters that are not filters are
+// ignored, as they are by ParseFilters.
+func MatchFilters(params []Param, row map[string]interface{}) (bool, error) {
+	for _, param := range params {
+		var ok bool
+		var err error
+		if param.Key == "and" || param.Key == "or" || param.Key == "not" {
+			ok, err = matchGroup(param.Key, param.Value, row)
+		} else {
+			ok, err = matchCondition(param.Key+"="+param.Value, row)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Evaluate a group (like or=(level=lt.2,hidden=is.false)) against a row
+func matchGroup(logic string, value string, row map[string]interface{}) (bool, error) {
+	value = strings.TrimPrefix(value, "(")
+	value = strings.TrimSuffix(value, ")")
+
+	for _, part := range splitPreservingGroups(value) {
+		var ok bool
+		var err error
+		if key, subValue, found := strings.Cut(part, "="); found && (key == "and" || key == "or" || key == "not") {
+			ok, err = matchGroup(key, subValue, row)
+		} else {
+			ok, err = matchCondition(part, row)
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if logic == "or" && ok {
+			return true, nil
+		}
+		if logic != "or" && !ok {
+			// not=(...) negates the conjunction of its parts
+			return logic == "not", nil
+		}
+	}
+
+	return logic == "and", nil
+}
+
+// Evaluate a condition like "level=lt.2" against a row
+func matchCondition(part string, row map[string]interface{}) (bool, error) {
+	matches := conditionRegexp.FindStringSubmatch(part)
+	if len(matches) != 4 {
+		return true, nil
+	}
+
+	column, operator, rawValue := matches[1], matches[2], matches[3]
+	if _, ok := utils.Operators[operator]; !ok {
+		return true, nil
+	}
+
+	actual, exists := row[column]
+
+	if operator == "is" {
+		switch strings.ToLower(rawValue) {
+		case "null":
+			return !exists || actual == nil, nil
+		case "true", "false":
+			return exists && fmt.Sprint(actual) == strings.ToLower(rawValue), nil
+		}
+	}
+
+	// Null-safe comparisons treat a missing value as NULL, equal only to null
+	if operator == "isdistinct" || operator == "notdistinct" {
+		equal, err := matchNullSafe(actual, rawValue)
+		return equal == (operator == "notdistinct"), err
+	}
+
+	if !exists || actual == nil {
+		return false, nil
+	}
+
+	if operator == "in" {
+		return matchList(actual, rawValue)
+	}
+
+	if operator == "like" {
+		return wildcardMatch(strings.ReplaceAll(rawValue, "*", "%"), fmt.Sprint(actual)), nil
+	}
+
+	// Fuzzy matches fall back to substrings, as on SQLite
+	if operator == "sim" {
+		return wildcardMatch("%"+strings.ToLower(rawValue)+"%", strings.ToLower(fmt.Sprint(actual))), nil
+	}
+
+	expected, err := parseExpected(actual, rawValue)
+	if err != nil {
+		return false, err
+	}
+
+	cmp, ok := compareValues(actual, expected)
+	if !ok {
+		return false, nil
+	}
+
+	switch operator {
+	case "eq", "is":
+		return cmp == 0, nil
+	case "ne":
+		return cmp != 0, nil
+	case "gt":
+		return cmp > 0, nil
+	case "gte":
+		return cmp >= 0, nil
+	case "lt":
+		return cmp < 0, nil
+	case "lte":
+		return cmp <= 0, nil
+	}
+
+	return false, nil
+}
+
+// matchNullSafe reports whether a row value equals a filter value, NULL
+// equalling only NULL
+func matchNullSafe(actual interface{}, rawValue string) (bool, error) {
+	if null := strings.EqualFold(rawValue, "null"); actual == nil || null {
+		return actual == nil && null, nil
+	}
+	expected, err := parseExpected(actual, rawValue)
+	if err != nil {
+		return false, err
+	}
+	cmp, ok := compareValues(actual, expected)
+	return ok && cmp == 0, nil
+}
+
+// matchList reports whether a row value equals a value of an in list
+func matchList(actual interface{}, rawValue string) (bool, error) {
+	values, err := parseList(rawValue)
+	if err != nil {
+		return false, err
+	}
+	for _, value := range values {
+		expected, err := parseExpected(actual, value)
+		if err != nil {
+			return false, err
+		}
+		if cmp, ok := compareValues(actual, expected); ok && cmp == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseExpected parses a filter value for comparison with a row value,
+// exactly when the row value is a decimal
+func parseExpected(actual interface{}, rawValue string) (interface{}, error) {
+	if _, ok := actual.(utils.Decimal); ok && utils.IsDecimal(rawValue) {
+		return utils.Decimal(rawValue), nil
+	}
+	return utils.ParseQueryParam(rawValue)
+}
+
+// compareValues compares a row value with a parsed filter value, treating all
+// numbers alike. It returns false when the values are not comparable.
+func compareValues(actual, expected interface{}) (int, bool) {
+	// Integers compare exactly, which floats cannot beyond 2^53
+	if a, ok := actual.(int64); ok {
+		if e, ok := expected.(int64); ok {
+			return cmp.Compare(a, e), true
+		}
+	}
+
+	// Decimals compare exactly, which floats cannot
+	_, actualDecimal := actual.(utils.Decimal)
+	_, expectedDecimal := expected.(utils.Decimal)
+	if actualDecimal || expectedDecimal {
+		if a, ok := utils.ToRat(actual); ok {
+			if e, ok := utils.ToRat(expected); ok {
+				return a.Cmp(e), true
+			}
+		}
+	}
+
+	if a, ok := toFloat(actual); ok {
+		if e, ok := toFloat(expected); ok {
+			switch {
+			case a < e:
+				return -1, true
+			case a > e:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	if a, ok := actual.(bool); ok {
+		if e, ok := expected.(bool); ok && a == e {
+			return 0, true
+		}
+		return 1, true
+	}
+
+	return strings.Compare(fmt.Sprint(actual), fmt.Sprint(expected)), true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// wildcardMatch matches s against a LIKE pattern where % matches any run of
+// characters and _ matches a single character
+func wildcardMatch(pattern, s string) bool {
+	p, i := 0, 0
+	star, mark := -1, 0
+
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '_' || pattern[p] == s[i]) && pattern[p] != '%':
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '%':
+			star, mark = p, i
+			p++
+		case star >= 0:
+			// Let the last % absorb one more character and retry
+			p = star + 1
+			mark++
+			i = mark
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '%' {
+		p++
+	}
+
+	return p == len(pattern)
+}
@@ -0,0 +1,58 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test in-memory evaluation of the filter grammar
+func TestMatchFilters(t *testing.T) {
+	row := map[string]interface{}{"level": float64(2), "name": "foobar", "hidden": false, "deleted_at": nil, "price": utils.Decimal("19.99")}
+
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{"level=eq.2", true},
+		{"level=gt.2", false},
+		{"level=lte.2&name=like.foo*", true},
+		{"name=like.*baz", false},
+		{"name=like.f_o*", true},
+		{"hidden=is.false", true},
+		{"deleted_at=is.null", true},
+		{"missing=eq.1", false},
+		{"or=(level=gt.5,name=eq.foobar)", true},
+		{"or=(level=gt.5,name=eq.baz)", false},
+		{"and=(level=eq.2,or=(hidden=is.true,name=ne.x))", true},
+		{"not=(level=eq.2,hidden=is.false)", false},
+		{"not=(level=eq.3)", true},
+		{"level=in.(1,2,3)", true},
+		{"name=in.(foo,bar)", false},
+		{"deleted_at=in.(1)", false},
+		{"deleted_at=ne.x", false},
+		{"deleted_at=isdistinct.x", true},
+		{"deleted_at=notdistinct.null", true},
+		{"missing=isdistinct.null", false},
+		{"level=isdistinct.2", false},
+		{"name=notdistinct.foobar", true},
+		{"name=eq.", false},
+		{"name=sim.OBA", true},
+		{"name=sim.baz", false},
+		{"price=eq.19.99", true},
+		{"price=gt.19.989999999999999999", true},
+		{"price=in.(5,19.990)", true},
+		{"page=2&order=level.desc", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			params, err := ParseParams(tt.query)
+			assert.NoError(t, err)
+			ok, err := MatchFilters(params, row)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, ok)
+		})
+	}
+}
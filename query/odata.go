@@ -0,0 +1,378 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// odataOperators maps OData comparison operators to filter operators
+var odataOperators = map[string]string{
+	"eq": "eq",
+	"ne": "ne",
+	"gt": "gt",
+	"ge": "gte",
+	"lt": "lt",
+	"le": "lte",
+}
+
+// ParseOData translates OData v4 system query options ($filter, $select,
+// $orderby, $top, $skip) into the filter grammar, e.g.
+// $filter=price gt 10 and status eq 'open' becomes price=gt.10&status=eq.open.
+// Other parameters are passed through unchanged. The result relies on
+// PostgREST semantics for null checks and string functions.
+func ParseOData(params []Param) ([]Param, error) {
+	out := make([]Param, 0, len(params))
+
+	for _, param := range params {
+		if !strings.HasPrefix(param.Key, "$") {
+			out = append(out, param)
+			continue
+		}
+
+		value := strings.TrimSpace(param.Value)
+		switch param.Key {
+		case "$filter":
+			node, err := parseODataFilter(value)
+			if err != nil {
+				return nil, err
+			}
+			// Top-level conjunctions become separate filters
+			for _, term := range node.conjuncts() {
+				key, val, err := term.param()
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, Param{Key: key, Value: val})
+			}
+		case "$select":
+			out = append(out, Param{Key: "select", Value: strings.ReplaceAll(value, " ", "")})
+		case "$orderby":
+			order, err := parseODataOrderBy(value)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, Param{Key: "order", Value: order})
+		case "$top":
+			if _, err := strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("odata: invalid $top %q", value)
+			}
+			out = append(out, Param{Key: "limit", Value: value})
+		case "$skip":
+			if _, err := strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("odata: invalid $skip %q", value)
+			}
+			out = append(out, Param{Key: "offset", Value: value})
+		default:
+			return nil, fmt.Errorf("odata: %s is not supported", param.Key)
+		}
+	}
+
+	return out, nil
+}
+
+// parseODataOrderBy converts "price desc, name" into "price.desc,name.asc"
+func parseODataOrderBy(value string) (string, error) {
+	clauses := []string{}
+	for _, part := range strings.Split(value, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 || len(fields) > 2 {
+			return "", fmt.Errorf("odata: invalid $orderby %q", value)
+		}
+		if err := utils.ValidateColumnName(fields[0]); err != nil {
+			return "", err
+		}
+		direction := "asc"
+		if len(fields) == 2 {
+			direction = strings.ToLower(fields[1])
+			if direction != "asc" && direction != "desc" {
+				return "", fmt.Errorf("odata: invalid $orderby direction %q", fields[1])
+			}
+		}
+		clauses = append(clauses, fields[0]+"."+direction)
+	}
+	return strings.Join(clauses, ","), nil
+}
+
+// odataNode is a parsed $filter expression. Leaves hold a condition in the
+// filter grammar ("price=gt.10"); branches combine their children with and,
+// or or not.
+type odataNode struct {
+	logic    string
+	children []*odataNode
+	column   string
+	operator string
+	value    string
+}
+
+// conjuncts flattens a top-level and into its terms
+func (n *odataNode) conjuncts() []*odataNode {
+	if n.logic != "and" {
+		return []*odataNode{n}
+	}
+	terms := []*odataNode{}
+	for _, child := range n.children {
+		terms = append(terms, child.conjuncts()...)
+	}
+	return terms
+}
+
+// param renders the node as a query parameter in the filter grammar
+func (n *odataNode) param() (string, string, error) {
+	if n.logic == "" {
+		return n.column, n.operator + "." + n.value, nil
+	}
+
+	// not over a single condition negates it in place, e.g. price=not.gt.10
+	if n.logic == "not" && n.children[0].logic == "" {
+		child := n.children[0]
+		return child.column, "not." + child.operator + "." + child.value, nil
+	}
+
+	parts := make([]string, 0, len(n.children))
+	for _, child := range n.children {
+		if child.logic == "" && strings.ContainsAny(child.value, ",()") {
+			return "", "", fmt.Errorf("odata: value %q cannot be used inside a group", child.value)
+		}
+		key, value, err := child.param()
+		if err != nil {
+			return "", "", err
+		}
+		parts = append(parts, key+"="+value)
+	}
+	return n.logic, "(" + strings.Join(parts, ",") + ")", nil
+}
+
+// odataParser is a recursive descent parser over $filter tokens
+type odataParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseODataFilter(filter string) (*odataNode, error) {
+	tokens, err := tokenizeOData(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("odata: empty $filter")
+	}
+
+	p := &odataParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("odata: unexpected %q in $filter", p.tokens[p.pos])
+	}
+	return node, nil
+}
+
+func (p *odataParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *odataParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *odataParser) expect(token string) error {
+	if got := p.next(); got != token {
+		return fmt.Errorf("odata: expected %q in $filter, got %q", token, got)
+	}
+	return nil
+}
+
+func (p *odataParser) parseOr() (*odataNode, error) {
+	return p.parseLogic("or", p.parseAnd)
+}
+
+func (p *odataParser) parseAnd() (*odataNode, error) {
+	return p.parseLogic("and", p.parseUnary)
+}
+
+// parseLogic parses operands joined by logic, e.g. a or b or c
+func (p *odataParser) parseLogic(logic string, operand func() (*odataNode, error)) (*odataNode, error) {
+	node, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != logic {
+		return node, nil
+	}
+
+	group := &odataNode{logic: logic, children: []*odataNode{node}}
+	for p.peek() == logic {
+		p.next()
+		child, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		group.children = append(group.children, child)
+	}
+	return group, nil
+}
+
+func (p *odataParser) parseUnary() (*odataNode, error) {
+	switch p.peek() {
+	case "not":
+		p.next()
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &odataNode{logic: "not", children: []*odataNode{child}}, nil
+	case "(":
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	}
+
+	name := p.next()
+	if name == "" {
+		return nil, fmt.Errorf("odata: unexpected end of $filter")
+	}
+
+	// String functions like contains(name,'phone')
+	if p.peek() == "(" {
+		return p.parseFunction(name)
+	}
+
+	if !isODataIdentifier(name) {
+		return nil, fmt.Errorf("odata: invalid property %q in $filter", name)
+	}
+
+	op := p.next()
+	operator, ok := odataOperators[op]
+	if !ok {
+		return nil, fmt.Errorf("odata: unsupported operator %q in $filter", op)
+	}
+
+	literal, isNull, err := parseODataLiteral(p.next())
+	if err != nil {
+		return nil, err
+	}
+	if isNull {
+		switch op {
+		case "eq":
+			return &odataNode{column: name, operator: "is", value: "null"}, nil
+		case "ne":
+			return &odataNode{logic: "not", children: []*odataNode{{column: name, operator: "is", value: "null"}}}, nil
+		}
+		return nil, fmt.Errorf("odata: null can only be compared with eq or ne")
+	}
+
+	return &odataNode{column: name, operator: operator, value: literal}, nil
+}
+
+// parseFunction parses contains, startswith and endswith into like filters
+func (p *odataParser) parseFunction(name string) (*odataNode, error) {
+	p.next()
+	column := p.next()
+	if !isODataIdentifier(column) {
+		return nil, fmt.Errorf("odata: invalid property %q in %s", column, name)
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	literal, isNull, err := parseODataLiteral(p.next())
+	if err != nil {
+		return nil, err
+	}
+	if isNull {
+		return nil, fmt.Errorf("odata: %s does not accept null", name)
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "contains":
+		literal = "*" + literal + "*"
+	case "startswith":
+		literal = literal + "*"
+	case "endswith":
+		literal = "*" + literal
+	default:
+		return nil, fmt.Errorf("odata: unsupported function %q in $filter", name)
+	}
+
+	return &odataNode{column: column, operator: "like", value: literal}, nil
+}
+
+// parseODataLiteral unquotes a string literal; numbers and booleans are kept
+// as written
+func parseODataLiteral(token string) (string, bool, error) {
+	switch {
+	case token == "":
+		return "", false, fmt.Errorf("odata: missing value in $filter")
+	case token == "null":
+		return "", true, nil
+	case strings.HasPrefix(token, "'"):
+		return strings.ReplaceAll(token[1:len(token)-1], "''", "'"), false, nil
+	case token == "true" || token == "false":
+		return token, false, nil
+	}
+	if _, err := strconv.ParseFloat(token, 64); err != nil {
+		return "", false, fmt.Errorf("odata: invalid value %q in $filter", token)
+	}
+	return token, false, nil
+}
+
+func isODataIdentifier(token string) bool {
+	return utils.ValidateColumnName(token) == nil
+}
+
+// tokenizeOData splits a $filter into words, quoted strings, parentheses and
+// commas
+func tokenizeOData(filter string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(filter); {
+		c := filter[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'':
+			// '' escapes a quote inside a string literal
+			j := i + 1
+			for {
+				if j >= len(filter) {
+					return nil, fmt.Errorf("odata: unterminated string in $filter")
+				}
+				if filter[j] == '\'' {
+					if j+1 < len(filter) && filter[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			tokens = append(tokens, filter[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(filter) && !unicode.IsSpace(rune(filter[j])) && !strings.ContainsRune("(),'", rune(filter[j])) {
+				j++
+			}
+			tokens = append(tokens, filter[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,84 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test OData query options are translated into the filter grammar
+func TestParseOData(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   []Param
+		expected []Param
+	}{
+		{
+			"conjunction",
+			[]Param{{"$filter", "price gt 10 and status eq 'open'"}},
+			[]Param{{"price", "gt.10"}, {"status", "eq.open"}},
+		},
+		{
+			"disjunction with negation",
+			[]Param{{"$filter", "level le 2 or not (name eq 'it''s')"}},
+			[]Param{{"or", "(level=lte.2,name=not.eq.it's)"}},
+		},
+		{
+			"nested groups",
+			[]Param{{"$filter", "(a eq 1 or b eq 2) and not (c eq 3 or d ne null)"}},
+			[]Param{{"or", "(a=eq.1,b=eq.2)"}, {"not", "(or=(c=eq.3,d=not.is.null))"}},
+		},
+		{
+			"string functions and null",
+			[]Param{{"$filter", "contains(name,'phone') and startswith(sku,'AB') and deleted_at eq null"}},
+			[]Param{{"name", "like.*phone*"}, {"sku", "like.AB*"}, {"deleted_at", "is.null"}},
+		},
+		{
+			"paging, ordering and selection",
+			[]Param{{"$select", "id, name"}, {"$orderby", "price desc, name"}, {"$top", "10"}, {"$skip", "20"}, {"live", "false"}},
+			[]Param{{"select", "id,name"}, {"order", "price.desc,name.asc"}, {"limit", "10"}, {"offset", "20"}, {"live", "false"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := ParseOData(tt.params)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, params)
+		})
+	}
+
+	// The translated filters render as the SQL the OData expression means,
+	// parsed with the PostgREST grammar as handlers in OData mode do
+	sqlTests := []struct {
+		filter string
+		sql    string
+	}{
+		{"not (c eq 3 or d eq 4)", "NOT ((c = ? OR d = ?))"},
+		{"not (c eq 3 and d eq 4)", "NOT ((c = ? AND d = ?))"},
+		{"a eq 1 and not (b eq 2 or not (c eq 3 and d eq 4))", "a = ? AND NOT ((b = ? OR NOT ((c = ? AND d = ?))))"},
+		{"not (name eq 'x')", "NOT (name = ?)"},
+	}
+	for _, tt := range sqlTests {
+		params, err := ParseOData([]Param{{"$filter", tt.filter}})
+		assert.NoError(t, err, tt.filter)
+		sql, _, err := ParseFilters(params, Options{DBType: "postgres", PostgREST: true})
+		assert.NoError(t, err, tt.filter)
+		assert.Equal(t, tt.sql, sql, tt.filter)
+	}
+
+	invalid := []Param{
+		{"$filter", "price gt"},
+		{"$filter", "price between 1"},
+		{"$filter", "name eq 'open"},
+		{"$filter", "a eq 1 or b eq 'x,y'"},
+		{"$filter", "Name/First eq 'x'"},
+		{"$orderby", "price sideways"},
+		{"$top", "ten"},
+		{"$expand", "orders"},
+	}
+	for _, param := range invalid {
+		_, err := ParseOData([]Param{param})
+		assert.Error(t, err, param.Value)
+	}
+}
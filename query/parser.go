@@ -1,11 +1,15 @@
 package query
 
 import (
+	"bytes"
 	"fmt"
 	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/The-ForgeBase/restql/utils"
 )
@@ -17,85 +21,348 @@ const (
 	MaxPageSize     = 1000 // To prevent excessive load on DB
 )
 
-// ParseFilters converts query parameters into SQL WHERE clause
-func ParseFilters(queryParams url.Values, dbType string) (string, []interface{}) {
-	clauses := []string{}
-	args := []interface{}{}
+// conditionRegexp matches a single condition like "level=lt.2"
+var conditionRegexp = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)=([a-z]+)\.(.*)$`)
+
+// Pools reused across ParseFilters calls to cut per-request allocations
+var (
+	bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+	argsPool   = sync.Pool{New: func() any { s := make([]interface{}, 0, 16); return &s }}
+)
+
+// Param is a single query string parameter
+type Param struct {
+	Key   string
+	Value string
+}
+
+// ParseParams splits a raw query string into parameters, preserving the order
+// in which they appear so identical requests always produce identical SQL
+func ParseParams(rawQuery string) ([]Param, error) {
+	params := []Param{}
+
+	for rawQuery != "" {
+		var pair string
+		pair, rawQuery, _ = strings.Cut(rawQuery, "&")
+		if pair == "" {
+			continue
+		}
+
+		key, value, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			return nil, err
+		}
+
+		params = append(params, Param{Key: key, Value: value})
+	}
+
+	return params, nil
+}
+
+// Options configure how filters are parsed
+type Options struct {
+	// DBType is the target database, e.g. "postgres" or "surrealdb"
+	DBType string
+	// Table validates filter values against schema metadata when set
+	Table *utils.Table
+	// PostgREST accepts PostgREST's filter grammar: not. negation, real
+	// LIKE/IS semantics, and the ilike, match, imatch and full-text operators
+	PostgREST bool
+	// TimeZone is the IANA zone relative dates like today are evaluated in,
+	// UTC when empty
+	TimeZone string
+	// Now is the time relative dates are evaluated at, the current time when
+	// zero
+	Now time.Time
+	// Collate is the collation of text comparisons, from ?collate=, see
+	// ParseCollation. Columns of Table may have their own.
+	Collate string
+	// Locale is the language tag numbers and dates of Table's numeric and
+	// date columns are written in, e.g. de-DE for 1.234,56 and 31.12.2024
+	Locale string
+}
+
+// ParseFilters converts query parameters into SQL WHERE clause, keeping the
+// order of the parameters
+func ParseFilters(params []Param, opts Options) (string, []interface{}, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+
+	argsPtr := argsPool.Get().(*[]interface{})
+	args := (*argsPtr)[:0]
+	defer func() {
+		clear(args)
+		*argsPtr = args[:0]
+		argsPool.Put(argsPtr)
+	}()
 
 	// Iterate over each query parameter
-	for key, values := range queryParams {
-		for _, value := range values {
-			if key == "and" || key == "or" || key == "not" {
-				// Handle nested groups like and=(...), or=(...), not=(...)
-				groupSQL, groupArgs := parseGroup(key, value, dbType)
-				clauses = append(clauses, fmt.Sprintf("(%s)", groupSQL))
-				args = append(args, groupArgs...)
-			} else {
-				// Handle standard column filters (e.g., level=lt.2)
-				clause, clauseArgs := parseCondition(key, value, dbType)
-				if clause != "" {
-					clauses = append(clauses, clause)
-					args = append(args, clauseArgs...)
-				}
+	for _, param := range params {
+		key, value := param.Key, param.Value
+
+		// Skip parameters that are not filters, like order or select
+		if _, reserved := utils.ReservedWords[key]; reserved {
+			continue
+		}
+
+		mark := buf.Len()
+		if mark > 0 {
+			buf.WriteString(" AND ")
+		}
+
+		var err error
+		if key == "and" || key == "or" || key == "not" {
+			// Handle nested groups like and=(...), or=(...), not=(...)
+			args, err = appendGroup(buf, args, key, value, &opts)
+			if err != nil {
+				return "", nil, err
 			}
+			continue
+		}
+
+		// Handle standard column filters (e.g., level=lt.2)
+		clause, clauseArgs, err := parseCondition(key, value, &opts)
+		if err != nil {
+			return "", nil, err
+		}
+		if clause == "" {
+			buf.Truncate(mark)
+			continue
+		}
+		buf.WriteString(clause)
+		args = append(args, clauseArgs...)
+	}
+
+	result := make([]interface{}, len(args))
+	copy(result, args)
+
+	return buf.String(), result, nil
+}
+
+// FilterColumns returns the columns that params restrict every row by:
+// top-level conditions and those of and groups, but not conditions under
+// or or not
+func FilterColumns(params []Param) map[string]bool {
+	columns := map[string]bool{}
+	for _, param := range params {
+		if _, reserved := utils.ReservedWords[param.Key]; reserved {
+			continue
+		}
+		addFilterColumns(param.Key+"="+param.Value, columns)
+	}
+	return columns
+}
+
+func addFilterColumns(part string, columns map[string]bool) {
+	key, value, _ := strings.Cut(part, "=")
+	switch key {
+	case "and":
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "("), ")")
+		for _, sub := range splitPreservingGroups(value) {
+			addFilterColumns(sub, columns)
+		}
+	case "or", "not":
+	default:
+		if conditionRegexp.MatchString(part) {
+			columns[key] = true
+		}
+	}
+}
+
+// ReferencedColumns returns every column params filter on, including
+// conditions under or and not groups
+func ReferencedColumns(params []Param) map[string]bool {
+	columns := map[string]bool{}
+	for _, param := range params {
+		if _, reserved := utils.ReservedWords[param.Key]; reserved {
+			continue
+		}
+		addReferencedColumns(param.Key+"="+param.Value, columns)
+	}
+	return columns
+}
+
+func addReferencedColumns(part string, columns map[string]bool) {
+	key, value, _ := strings.Cut(part, "=")
+	switch key {
+	case "and", "or", "not":
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "("), ")")
+		for _, sub := range splitPreservingGroups(value) {
+			addReferencedColumns(sub, columns)
+		}
+	default:
+		if conditionRegexp.MatchString(part) {
+			columns[key] = true
 		}
 	}
+}
+
+// Shape returns params as a query string with the values of their filters
+// replaced by ?, so requests that differ only in those values share it.
+// Lists keep their length, and is, isdistinct and notdistinct conditions and
+// empty values keep their value, since they change the SQL.
+func Shape(params []Param) string {
+	var b strings.Builder
+	for i, param := range params {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		value := param.Value
+		if _, reserved := utils.ReservedWords[param.Key]; !reserved {
+			value = shapeParam(param.Key, value)
+		}
+		b.WriteString(url.QueryEscape(param.Key) + "=" + url.QueryEscape(value))
+	}
+	return b.String()
+}
 
-	return strings.Join(clauses, " AND "), args
+func shapeParam(key, value string) string {
+	switch key {
+	case "and", "or", "not":
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "("), ")")
+		parts := splitPreservingGroups(value)
+		for i, part := range parts {
+			if key, value, ok := strings.Cut(part, "="); ok {
+				parts[i] = key + "=" + shapeParam(key, value)
+			}
+		}
+		return "(" + strings.Join(parts, ",") + ")"
+	}
+	return shapeValue(value)
 }
 
-// Parse a group (like and=(level=lt.2,or=(hidden=is.false)))
-func parseGroup(logic string, value string, dbType string) (string, []interface{}) {
-	clauses := []string{}
-	args := []interface{}{}
+// shapeValue replaces the value of a condition like lt.2 or not.in.(1,2)
+func shapeValue(value string) string {
+	operator, rawValue, ok := strings.Cut(value, ".")
+	if !ok || rawValue == "" {
+		return value
+	}
+	switch operator {
+	case "not":
+		return operator + "." + shapeValue(rawValue)
+	case "is", "isdistinct", "notdistinct":
+		return value
+	case "in":
+		values, err := parseList(rawValue)
+		if err != nil {
+			return value
+		}
+		return operator + ".(" + strings.Repeat("?,", len(values)-1) + "?)"
+	}
+	return operator + ".?"
+}
 
+// Write a parenthesized group (like and=(level=lt.2,or=(hidden=is.false))) to buf
+func appendGroup(buf *bytes.Buffer, args []interface{}, logic string, value string, opts *Options) ([]interface{}, error) {
 	// Remove parentheses from the value, e.g., "level=lt.2,or=(hidden=is.false)"
 	value = strings.TrimPrefix(value, "(")
 	value = strings.TrimSuffix(value, ")")
 
+	// not=(...) negates the conjunction of its parts
+	separator := " " + strings.ToUpper(logic) + " "
+	if logic == "not" {
+		separator = " AND "
+		buf.WriteString("NOT ")
+	}
+
+	buf.WriteByte('(')
+	start := buf.Len()
+
 	// Split into parts (comma-separated)
-	parts := splitPreservingGroups(value)
+	for _, part := range splitPreservingGroups(value) {
+		mark := buf.Len()
+		if mark > start {
+			buf.WriteString(separator)
+		}
 
-	for _, part := range parts {
-		if strings.HasPrefix(part, "and=") || strings.HasPrefix(part, "or=") || strings.HasPrefix(part, "not=") {
+		var err error
+		if key, subValue, ok := strings.Cut(part, "="); ok && (key == "and" || key == "or" || key == "not") {
 			// Handle nested logic groups
-			key := part[:3] // "and", "or", or "not"
-			subValue := strings.TrimPrefix(part, key+"=")
-			subSQL, subArgs := parseGroup(key, subValue, dbType)
-			clauses = append(clauses, fmt.Sprintf("(%s)", subSQL))
-			args = append(args, subArgs...)
-		} else {
-			// Handle basic conditions (like level=lt.2)
-			clause, clauseArgs := parseConditionFromPart(part, dbType)
-			if clause != "" {
-				clauses = append(clauses, clause)
-				args = append(args, clauseArgs...)
+			args, err = appendGroup(buf, args, key, subValue, opts)
+			if err != nil {
+				return nil, err
 			}
+			continue
 		}
+
+		// Handle basic conditions (like level=lt.2)
+		clause, clauseArgs, err := parseConditionFromPart(part, opts)
+		if err != nil {
+			return nil, err
+		}
+		if clause == "" {
+			buf.Truncate(mark)
+			continue
+		}
+		buf.WriteString(clause)
+		args = append(args, clauseArgs...)
 	}
 
-	return strings.Join(clauses, fmt.Sprintf(" %s ", strings.ToUpper(logic))), args
+	buf.WriteByte(')')
+
+	return args, nil
 }
 
 // Parse a condition like "level=lt.2"
-func parseCondition(key string, value string, dbType string) (string, []interface{}) {
-	return parseConditionFromPart(fmt.Sprintf("%s=%s", key, value), dbType)
+func parseCondition(key string, value string, opts *Options) (string, []interface{}, error) {
+	return parseConditionFromPart(key+"="+value, opts)
 }
 
-func parseConditionFromPart(part string, dbType string) (string, []interface{}) {
-	r := regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)=([a-z]+)\.(.+)$`)
-	matches := r.FindStringSubmatch(part)
+func parseConditionFromPart(part string, opts *Options) (string, []interface{}, error) {
+	matches := conditionRegexp.FindStringSubmatch(part)
 	if len(matches) != 4 {
-		return "", nil
+		return "", nil, nil
 	}
 
 	column := matches[1]
 	operator := matches[2]
 	rawValue := matches[3]
 
+	// Validate equality filters against ENUM/CHECK-constrained columns
+	if opts.Table != nil && utils.EnumOperators[operator] {
+		if col, ok := opts.Table.Column(column); ok {
+			if err := utils.ValidateEnumValue(col, rawValue); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	// Handle array column operators (e.g., tags=any.admin, tags=cs.{a,b})
+	if format, ok := utils.ArrayOperators[operator]; ok {
+		return parseArrayCondition(column, operator, format, rawValue, opts.DBType)
+	}
+
+	// Handle lists of values (e.g., id=in.(1,2,3))
+	if operator == "in" {
+		return parseInCondition(column, rawValue, opts)
+	}
+
+	// Handle fuzzy matches (e.g., name=sim.jonh)
+	if operator == "sim" {
+		return parseSimilarCondition(column, rawValue, opts)
+	}
+
+	// Handle null-safe comparisons (e.g., status=isdistinct.done)
+	if operator == "isdistinct" || operator == "notdistinct" {
+		return parseDistinctCondition(column, operator, rawValue, opts)
+	}
+
+	// Handle PostgREST grammar (e.g., level=not.eq.2, name=ilike.*foo*)
+	if opts.PostgREST {
+		if clause, args, ok, err := parsePostgRESTCondition(column, operator, rawValue, opts); ok || err != nil {
+			return clause, args, err
+		}
+	}
+
 	sqlOperator, ok := utils.Operators[operator]
 	if !ok {
-		return "", nil
+		return "", nil, nil
 	}
 
 	// Handle LIKE operator
@@ -103,19 +370,50 @@ func parseConditionFromPart(part string, dbType string) (string, []interface{})
 		rawValue = strings.ReplaceAll(rawValue, "*", "%")
 	}
 
-	// Handle IS operator for booleans
+	// Handle IS operator for nulls, which never equal a bound value, and
+	// booleans
 	if operator == "is" {
+		if strings.EqualFold(rawValue, "null") {
+			return fmt.Sprintf("%s IS NULL", column), []interface{}{}, nil
+		}
 		if rawValue == "true" || rawValue == "false" {
 			rawValue = strings.ToUpper(rawValue)
 		}
 	}
 
-	// Handle type conversion based on column type
-	// convertedValue := convertTypeForColumn(dbType, column, rawValue)
-	convertedValue, err := utils.ParseQueryParam(rawValue)
+	// Handle values written in the locale, like 1.234,56
+	if operator != "like" && operator != "is" {
+		var err error
+		if rawValue, err = localize(column, rawValue, opts); err != nil {
+			return "", nil, err
+		}
+	}
 
+	// Handle relative dates like now-7d, bound as timestamps
+	if operator != "like" && operator != "is" {
+		if t, ok, err := ParseRelativeTime(rawValue, *opts); ok || err != nil {
+			if err != nil {
+				return "", nil, err
+			}
+			return fmt.Sprintf("%s %s ?", column, sqlOperator), []interface{}{t}, nil
+		}
+	}
+
+	// Handle type conversion, by the column type when the table metadata
+	// knows it, so 007 stays a string for a TEXT column
+	var col *utils.Column
+	if opts.Table != nil && operator != "like" && operator != "is" {
+		col, _ = opts.Table.Column(column)
+	}
+	var convertedValue interface{}
+	var err error
+	if col != nil {
+		convertedValue, err = utils.ParseColumnValue(col, rawValue)
+	} else {
+		convertedValue, err = utils.ParseQueryParam(rawValue)
+	}
 	if err != nil {
-		panic(err)
+		return "", nil, err
 	}
 
 	// TODO: handle IS operator based on database type
@@ -123,92 +421,522 @@ func parseConditionFromPart(part string, dbType string) (string, []interface{})
 		sqlOperator = "="
 	}
 
-	// fmt.Printf("Column: %s, Operator: %s, Raw Value: %s, Converted Value: %v\n", column, operator, rawValue, convertedValue)
+	_, text := convertedValue.(string)
+	if column, err = collate(column, text, opts); err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("%s %s %s", column, sqlOperator, placeholder(col, opts.DBType)), []interface{}{convertedValue}, nil
+}
+
+// Parse a condition using PostgREST semantics. ok is false for operators that
+// behave the same as in the default grammar.
+func parsePostgRESTCondition(column, operator, rawValue string, opts *Options) (string, []interface{}, bool, error) {
+	switch operator {
+	case "not":
+		// Negate the remaining condition, e.g. not.eq.2
+		clause, args, err := parseConditionFromPart(column+"="+rawValue, opts)
+		if err != nil || clause == "" {
+			return "", nil, true, err
+		}
+		return fmt.Sprintf("NOT (%s)", clause), args, true, nil
+	case "is":
+		// IS takes a keyword rather than a bound value
+		switch strings.ToLower(rawValue) {
+		case "null", "true", "false", "unknown":
+			return fmt.Sprintf("%s IS %s", column, strings.ToUpper(rawValue)), []interface{}{}, true, nil
+		}
+		return "", nil, true, fmt.Errorf("invalid value %q for is operator: must be null, true, false or unknown", rawValue)
+	}
+
+	format, ok := utils.PostgRESTOperators[operator]
+	if !ok {
+		return "", nil, false, nil
+	}
+
+	if operator == "like" || operator == "ilike" {
+		rawValue = strings.ReplaceAll(rawValue, "*", "%")
+		var err error
+		if column, err = collate(column, true, opts); err != nil {
+			return "", nil, true, err
+		}
+	}
+
+	return fmt.Sprintf(format, column), []interface{}{rawValue}, true, nil
+}
+
+// distinctOperators are the null-safe comparisons of each database, as
+// isdistinct and notdistinct format strings taking the column name.
+// Postgres and SQLite support IS DISTINCT FROM from 3.39, older SQLite
+// has IS NOT, MySQL has <=>, and SurrealDB compares NULL like any value.
+var distinctOperators = map[string][2]string{
+	"postgres":  {"%s IS DISTINCT FROM ?", "%s IS NOT DISTINCT FROM ?"},
+	"sqlite":    {"%s IS NOT ?", "%s IS ?"},
+	"mysql":     {"NOT (%s <=> ?)", "%s <=> ?"},
+	"surrealdb": {"%s != ?", "%s = ?"},
+}
+
+// Parse a null-safe comparison like status=isdistinct.done, which unlike ne
+// matches rows where status is NULL. The value null binds NULL, and with
+// table metadata values are typed by the column.
+func parseDistinctCondition(column, operator, rawValue string, opts *Options) (string, []interface{}, error) {
+	formats, ok := distinctOperators[opts.DBType]
+	if !ok {
+		formats = distinctOperators["postgres"]
+	}
+	format := formats[0]
+	if operator == "notdistinct" {
+		format = formats[1]
+	}
+
+	var col *utils.Column
+	if opts.Table != nil {
+		col, _ = opts.Table.Column(column)
+	}
+	var value interface{}
+	if !strings.EqualFold(rawValue, "null") {
+		var err error
+		if rawValue, err = localize(column, rawValue, opts); err != nil {
+			return "", nil, err
+		}
+		if col == nil {
+			value, err = utils.ParseQueryParam(rawValue)
+		} else if err = utils.ValidateEnumValue(col, rawValue); err == nil {
+			value, err = utils.ParseColumnValue(col, rawValue)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	_, text := value.(string)
+	column, err := collate(column, text, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	format = strings.Replace(format, "?", placeholder(col, opts.DBType), 1)
+	return fmt.Sprintf(format, column), []interface{}{value}, nil
+}
+
+// localize rewrites a value of a numeric or date column of opts.Table
+// written in opts.Locale, see utils.Locale.Value
+func localize(column, value string, opts *Options) (string, error) {
+	if opts.Locale == "" || opts.Table == nil {
+		return value, nil
+	}
+	locale, err := utils.ParseLocale(opts.Locale)
+	if err != nil {
+		return "", err
+	}
+	col, _ := opts.Table.Column(column)
+	return locale.Value(col, value), nil
+}
+
+// Parse a list condition like id=in.(1,2,3). With table metadata the values
+// are typed by the column and checked against its ENUM values. SurrealDB
+// binds the list as one array.
+func parseInCondition(column, rawValue string, opts *Options) (string, []interface{}, error) {
+	values, err := parseList(rawValue)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var col *utils.Column
+	if opts.Table != nil {
+		col, _ = opts.Table.Column(column)
+	}
+
+	// On an array column in matches the arrays holding any of the values,
+	// bound as one array cast by Postgres to the column's type, as
+	// column IN (?, ?) would compare the arrays with scalars
+	if col != nil && opts.DBType == "postgres" && utils.IsArrayType(col.Type) {
+		return fmt.Sprintf("%s && ?", column), []interface{}{arrayLiteral(values)}, nil
+	}
+
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		if value, err = localize(column, value, opts); err != nil {
+			return "", nil, err
+		}
+		if col == nil {
+			args[i], err = utils.ParseQueryParam(value)
+		} else if err = utils.ValidateEnumValue(col, value); err == nil {
+			args[i], err = utils.ParseColumnValue(col, value)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	text := true
+	for _, arg := range args {
+		if _, ok := arg.(string); !ok {
+			text = false
+		}
+	}
+	if column, err = collate(column, text, opts); err != nil {
+		return "", nil, err
+	}
+
+	if opts.DBType == "surrealdb" {
+		if placeholder(col, opts.DBType) != "?" {
+			return fmt.Sprintf("%s IN <array<decimal>> ?", column), []interface{}{args}, nil
+		}
+		return fmt.Sprintf("%s IN ?", column), []interface{}{args}, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat(placeholder(col, opts.DBType)+", ", len(args)), ", ")
+	return fmt.Sprintf("%s IN (%s)", column, placeholders), args, nil
+}
 
-	return fmt.Sprintf("%s %s ?", column, sqlOperator), []interface{}{convertedValue}
+// decimalPlaceholders cast decimal text to an exact number on databases
+// that would otherwise compare it with a DECIMAL column as a float
+var decimalPlaceholders = map[string]string{
+	"mysql":     "CAST(? AS DECIMAL(65,30))",
+	"surrealdb": "<decimal> ?",
 }
 
-// Convert value based on the column's data type
-func convertTypeForColumn(dbType, column, rawValue string) any {
-	fmt.Printf("Column: %s, Raw Value: %s\n", column, rawValue)
-	// Lookup the column type in the DB schema
-	columnType := getColumnType(dbType, column)
-	converter, exists := utils.TypeConverters[columnType]
-	if exists {
+// placeholder returns the placeholder of a value compared with col
+func placeholder(col *utils.Column, dbType string) string {
+	if col != nil && utils.JSONType(col.Type) == "decimal" {
+		if p, ok := decimalPlaceholders[dbType]; ok {
+			return p
+		}
+	}
+	return "?"
+}
+
+// parseList splits the value of an in filter, like (1,2,3), into its
+// values. Values holding commas are double-quoted, e.g. ("a,b",c).
+func parseList(rawValue string) ([]string, error) {
+	if !strings.HasPrefix(rawValue, "(") || !strings.HasSuffix(rawValue, ")") || len(rawValue) == 2 {
+		return nil, fmt.Errorf("invalid list %q: expected in.(a,b,...)", rawValue)
+	}
+	inner := rawValue[1 : len(rawValue)-1]
 
-		// Check for specific type conversion
-		if columnType == "INTEGER" {
-			if intValue, err := strconv.ParseInt(rawValue, 10, 64); err == nil {
-				return intValue
+	values := []string{}
+	var value strings.Builder
+	quoted := false
+	for i := 0; i <= len(inner); i++ {
+		if i < len(inner) && (quoted || inner[i] != ',') {
+			if inner[i] == '"' {
+				quoted = !quoted
+			} else {
+				value.WriteByte(inner[i])
 			}
+			continue
 		}
-		// Convert the value using the appropriate type converter
-		return converter(rawValue)
+		if value.Len() == 0 {
+			return nil, fmt.Errorf("invalid list %q: empty value", rawValue)
+		}
+		values = append(values, value.String())
+		value.Reset()
+	}
+	if quoted {
+		return nil, fmt.Errorf("invalid list %q: unterminated quote", rawValue)
+	}
+	return values, nil
+}
+
+// Parse an array column condition. Only Postgres has native array columns,
+// so other databases reject these operators rather than drop the filter.
+func parseArrayCondition(column, operator, format, rawValue, dbType string) (string, []interface{}, error) {
+	if dbType != "postgres" {
+		return "", nil, fmt.Errorf("operator %s requires postgres", operator)
+	}
+
+	// any/all compare a scalar against every element of the array
+	if operator == "any" || operator == "all" {
+		convertedValue, err := utils.ParseQueryParam(rawValue)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf(format, column), []interface{}{convertedValue}, nil
+	}
+
+	// cs/cd/ov take an array literal such as {a,b}, which is bound as-is and
+	// cast by Postgres to the column's array type
+	if !strings.HasPrefix(rawValue, "{") || !strings.HasSuffix(rawValue, "}") {
+		return "", nil, fmt.Errorf("operator %s requires an array like {a,b}", operator)
 	}
 
-	// Default case: return the raw value (could be enhanced based on your needs)
-	return rawValue
+	return fmt.Sprintf(format, column), []interface{}{rawValue}, nil
 }
 
-// Get the column type based on the database type and column name
-func getColumnType(dbType, column string) string {
-	// For simplicity, assuming a default column type map
-	// This should be enhanced based on the actual DB schema
-	return "INTEGER" // Just an example, use actual DB schema here
+// arrayLiteral renders values as a Postgres array literal, quoting each
+// element so commas, braces and quotes inside them stay part of it
+func arrayLiteral(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	}
+	return "{" + strings.Join(quoted, ",") + "}"
 }
 
-// Split on `,` but respect nested groups, e.g., a=lt.2,or=(b=is.false)
+// Split on `,` but respect nested groups and array literals, e.g.,
+// a=lt.2,or=(b=is.false),tags=cs.{x,y}
 func splitPreservingGroups(input string) []string {
 	parts := []string{}
 	groupLevel := 0
-	current := ""
+	start := 0
 
-	for _, char := range input {
-		switch char {
-		case '(':
+	for i := 0; i < len(input); i++ {
+		switch input[i] {
+		case '(', '{':
 			groupLevel++
-			current += string(char)
-		case ')':
+		case ')', '}':
 			groupLevel--
-			current += string(char)
 		case ',':
 			if groupLevel == 0 {
-				parts = append(parts, current)
-				current = ""
-			} else {
-				current += string(char)
+				parts = append(parts, input[start:i])
+				start = i + 1
 			}
-		default:
-			current += string(char)
 		}
 	}
 
-	if current != "" {
-		parts = append(parts, current)
+	if start < len(input) {
+		parts = append(parts, input[start:])
 	}
 
 	return parts
 }
 
-// ParseOrder parses ?order=id.desc,name.asc into SQL ORDER BY clause
-func ParseOrder(order string) string {
+// ParseSelect parses ?select=id,title:name into a SQL column list. Columns
+// are validated against the table metadata when it is provided. An empty
+// select returns "*", ?select=addr_* the columns starting with addr_, and
+// ?select=!secret every column but secret. Each result column must have a distinct name, so
+// aliases may not collide with each other or with selected columns.
+func ParseSelect(selectParam string, table *utils.Table) (string, error) {
+	if selectParam == "" {
+		return "*", nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(selectParam), "!") {
+		return parseSelectExclusions(selectParam, table)
+	}
+
+	columns := []string{}
+	names := map[string]bool{}
+	addName := func(name string) error {
+		if names[name] {
+			return fmt.Errorf("duplicate column %s in select", name)
+		}
+		names[name] = true
+		return nil
+	}
+
+	for _, part := range splitPreservingGroups(selectParam) {
+		part = strings.TrimSpace(part)
+		if part == "*" {
+			// Without metadata, collisions with * are left to the database
+			if table != nil {
+				for _, col := range table.Columns {
+					if err := addName(col.Name); err != nil {
+						return "", err
+					}
+				}
+			}
+			columns = append(columns, part)
+			continue
+		}
+
+		// Embedded resources like author(name) need joins
+		if strings.ContainsAny(part, "()") {
+			return "", fmt.Errorf("resource embedding is not supported: %s", part)
+		}
+
+		// addr_* selects every column with the prefix
+		if strings.HasSuffix(part, "*") {
+			matched, err := matchColumns(part, table)
+			if err != nil {
+				return "", err
+			}
+			for _, column := range matched {
+				if err := addName(column); err != nil {
+					return "", err
+				}
+			}
+			columns = append(columns, matched...)
+			continue
+		}
+
+		// alias:column renames the column in the result
+		alias, column, renamed := strings.Cut(part, ":")
+		if !renamed {
+			column = alias
+		}
+
+		if err := utils.ValidateColumnName(column); err != nil {
+			return "", err
+		}
+		if table != nil {
+			if _, ok := table.Column(column); !ok {
+				return "", fmt.Errorf("unknown column %s", column)
+			}
+		}
+
+		if renamed {
+			if err := utils.ValidateColumnName(alias); err != nil {
+				return "", err
+			}
+			columns = append(columns, fmt.Sprintf("%s AS %s", column, alias))
+		} else {
+			columns = append(columns, column)
+		}
+		if err := addName(alias); err != nil {
+			return "", err
+		}
+	}
+
+	return strings.Join(columns, ", "), nil
+}
+
+// parseSelectExclusions expands ?select=!password_hash,!secret_token to every
+// column of the table except the excluded ones
+func parseSelectExclusions(selectParam string, table *utils.Table) (string, error) {
+	if table == nil {
+		return "", fmt.Errorf("select exclusions require table metadata")
+	}
+
+	excluded := map[string]bool{}
+	for _, part := range strings.Split(selectParam, ",") {
+		column, ok := strings.CutPrefix(strings.TrimSpace(part), "!")
+		if !ok {
+			return "", fmt.Errorf("cannot mix excluded and selected columns: %s", part)
+		}
+		if strings.HasSuffix(column, "*") {
+			matched, err := matchColumns(column, table)
+			if err != nil {
+				return "", err
+			}
+			for _, name := range matched {
+				excluded[name] = true
+			}
+			continue
+		}
+		if _, ok := table.Column(column); !ok {
+			return "", fmt.Errorf("unknown column %s", column)
+		}
+		excluded[column] = true
+	}
+
+	columns := []string{}
+	for _, col := range table.Columns {
+		if !excluded[col.Name] {
+			columns = append(columns, col.Name)
+		}
+	}
+	if len(columns) == 0 {
+		return "", fmt.Errorf("select excludes every column")
+	}
+	return strings.Join(columns, ", "), nil
+}
+
+// matchColumns expands a pattern like addr_* to the columns of the table
+// starting with the prefix, in table order
+func matchColumns(pattern string, table *utils.Table) ([]string, error) {
+	if table == nil {
+		return nil, fmt.Errorf("column patterns require table metadata: %s", pattern)
+	}
+	prefix := strings.TrimSuffix(pattern, "*")
+	if err := utils.ValidateColumnName(prefix); err != nil {
+		return nil, err
+	}
+
+	matched := []string{}
+	for _, col := range table.Columns {
+		if strings.HasPrefix(col.Name, prefix) {
+			matched = append(matched, col.Name)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no columns match %s", pattern)
+	}
+	return matched, nil
+}
+
+// ParsePerGroup parses ?per_group=category:3 into the column to partition by
+// and the number of rows to keep per group
+func ParsePerGroup(perGroup string, table *utils.Table) (string, int, error) {
+	column, countStr, ok := strings.Cut(perGroup, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid per_group %q: expected column:count", perGroup)
+	}
+	if err := utils.ValidateColumnName(column); err != nil {
+		return "", 0, err
+	}
+	if table != nil {
+		if _, ok := table.Column(column); !ok {
+			return "", 0, fmt.Errorf("unknown column %s", column)
+		}
+	}
+
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count <= 0 {
+		return "", 0, fmt.Errorf("invalid per_group count %q", countStr)
+	}
+	return column, count, nil
+}
+
+// ParseTree parses ?tree=descendants.of.42 or ?tree=ancestors.of.42 into the
+// direction to walk and the id of the starting row
+func ParseTree(tree string) (string, interface{}, error) {
+	direction, rawID, ok := strings.Cut(tree, ".of.")
+	if !ok || rawID == "" || (direction != "descendants" && direction != "ancestors") {
+		return "", nil, fmt.Errorf("invalid tree %q: expected descendants.of.<id> or ancestors.of.<id>", tree)
+	}
+
+	id, err := utils.ParseQueryParam(rawID)
+	if err != nil {
+		return "", nil, err
+	}
+	return direction, id, nil
+}
+
+// ParseOrder parses ?order=id.desc,name.asc.nullslast into SQL ORDER BY clause
+func ParseOrder(order string) (string, error) {
+	return parseOrder(order, nil)
+}
+
+// ParseCollatedOrder is ParseOrder ordering the text columns of opts.Table
+// by the collation of opts, or their own. Columns without metadata keep the
+// database's order.
+func ParseCollatedOrder(order string, opts Options) (string, error) {
+	return parseOrder(order, &opts)
+}
+
+func parseOrder(order string, opts *Options) (string, error) {
 	if order == "" {
-		return ""
+		return "", nil
 	}
 
 	parts := strings.Split(order, ",")
 	var orderClauses []string
 	for _, part := range parts {
-		subParts := strings.SplitN(part, ".", 2)
+		subParts := strings.Split(part, ".")
 		column := subParts[0]
+		if err := utils.ValidateColumnName(column); err != nil {
+			return "", err
+		}
 		direction := "ASC"
-		if len(subParts) == 2 && subParts[1] == "desc" {
-			direction = "DESC"
+		nulls := ""
+		for _, modifier := range subParts[1:] {
+			switch modifier {
+			case "desc":
+				direction = "DESC"
+			case "nullsfirst":
+				nulls = " NULLS FIRST"
+			case "nullslast":
+				nulls = " NULLS LAST"
+			}
 		}
-		orderClauses = append(orderClauses, fmt.Sprintf("%s %s", column, direction))
+		if opts != nil {
+			var err error
+			if column, err = collate(column, false, opts); err != nil {
+				return "", err
+			}
+		}
+		orderClauses = append(orderClauses, fmt.Sprintf("%s %s%s", column, direction, nulls))
 	}
 
-	return fmt.Sprintf("ORDER BY %s", strings.Join(orderClauses, ", "))
+	return fmt.Sprintf("ORDER BY %s", strings.Join(orderClauses, ", ")), nil
 }
 
 // ParsePagination converts ?page=2&page_size=10 into SQL LIMIT and OFFSET
@@ -239,24 +967,96 @@ func ParsePagination(pageStr, pageSizeStr string) (limit, offset int) {
 	return limit, offset
 }
 
-func BuildInsertQueryParts(records []map[string]interface{}) (string, []string, []interface{}) {
+// ParseLimitOffset converts PostgREST-style ?limit=10&offset=20 into SQL LIMIT
+// and OFFSET, with the same defaults and maximum as ParsePagination
+func ParseLimitOffset(limitStr, offsetStr string) (limit, offset int) {
+	limit = DefaultPageSize
+	if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	if o, err := strconv.Atoi(offsetStr); err == nil && o > 0 {
+		offset = o
+	}
+
+	return limit, offset
+}
+
+// ParseRange converts a PostgREST Range header like "0-24" into SQL LIMIT and
+// OFFSET. ok is false when the header is missing or malformed.
+func ParseRange(header string) (limit, offset int, ok bool) {
+	header = strings.TrimPrefix(strings.TrimSpace(header), "items=")
+	from, to, found := strings.Cut(header, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	start, err := strconv.Atoi(from)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+
+	// An open range like "10-" reads a default page
+	limit = DefaultPageSize
+	if to != "" {
+		end, err := strconv.Atoi(to)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		limit = end - start + 1
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	return limit, start, true
+}
+
+// BuildInsertQueryParts builds the column list, row placeholders, and values
+// for a bulk insert. The columns are the keys of every record, following
+// order with any remaining keys appended in sorted order. A record missing
+// a column inserts DEFAULT for it.
+func BuildInsertQueryParts(records []map[string]interface{}, order []string) (string, []string, []interface{}) {
 	if len(records) == 0 {
 		return "", nil, nil
 	}
 
-	columns := []string{}
-	for column := range records[0] {
-		columns = append(columns, column)
+	return BuildInsertColumnsQueryParts(records, InsertColumns(records, order))
+}
+
+// InsertColumns returns the union of the keys of records, ordered like
+// BuildInsertQueryParts
+func InsertColumns(records []map[string]interface{}, order []string) []string {
+	keys := map[string]interface{}{}
+	for _, record := range records {
+		for key := range record {
+			keys[key] = nil
+		}
 	}
+	return orderedColumns(keys, order)
+}
 
+// BuildInsertColumnsQueryParts builds the parts of a bulk insert over an
+// explicit column list, as given by ?columns=. Keys outside columns are
+// ignored. A column missing from a record takes its DEFAULT, while an
+// explicit null inserts NULL.
+func BuildInsertColumnsQueryParts(records []map[string]interface{}, columns []string) (string, []string, []interface{}) {
 	placeholders := []string{}
 	values := []interface{}{}
 
 	for _, record := range records {
 		rowPlaceholders := []string{}
 		for _, col := range columns {
+			value, ok := record[col]
+			if !ok {
+				rowPlaceholders = append(rowPlaceholders, "DEFAULT")
+				continue
+			}
 			rowPlaceholders = append(rowPlaceholders, "?")
-			values = append(values, record[col])
+			values = append(values, value)
 		}
 		placeholders = append(placeholders, fmt.Sprintf("(%s)", strings.Join(rowPlaceholders, ", ")))
 	}
@@ -264,7 +1064,9 @@ func BuildInsertQueryParts(records []map[string]interface{}) (string, []string,
 	return strings.Join(columns, ", "), placeholders, values
 }
 
-func BuildUpdateQueryParts(updates map[string]interface{}) (string, []interface{}) {
+// BuildUpdateQueryParts builds the SET clause and values for an update, with
+// columns ordered like BuildInsertQueryParts
+func BuildUpdateQueryParts(updates map[string]interface{}, order []string) (string, []interface{}) {
 	if len(updates) == 0 {
 		return "", nil
 	}
@@ -272,10 +1074,34 @@ func BuildUpdateQueryParts(updates map[string]interface{}) (string, []interface{
 	setClauses := []string{}
 	values := []interface{}{}
 
-	for column, value := range updates {
+	for _, column := range orderedColumns(updates, order) {
 		setClauses = append(setClauses, fmt.Sprintf("%s = ?", column))
-		values = append(values, value)
+		values = append(values, updates[column])
 	}
 
 	return strings.Join(setClauses, ", "), values
 }
+
+// orderedColumns returns the keys of record present in order, followed by the
+// remaining keys sorted so map iteration never affects the generated SQL
+func orderedColumns(record map[string]interface{}, order []string) []string {
+	columns := make([]string, 0, len(record))
+	seen := make(map[string]bool, len(record))
+
+	for _, column := range order {
+		if _, ok := record[column]; ok && !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+
+	rest := []string{}
+	for column := range record {
+		if !seen[column] {
+			rest = append(rest, column)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(columns, rest...)
+}
@@ -0,0 +1,312 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test splitting respects nested groups and array literals
+func TestSplitPreservingGroups(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"a=lt.2", []string{"a=lt.2"}},
+		{"a=lt.2,or=(b=is.false,c=eq.1)", []string{"a=lt.2", "or=(b=is.false,c=eq.1)"}},
+		{"tags=cs.{x,y},a=eq.1", []string{"tags=cs.{x,y}", "a=eq.1"}},
+		{"a=eq.1,", []string{"a=eq.1"}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, splitPreservingGroups(tt.input))
+	}
+}
+
+// Test query parameters keep their order
+func TestParseParams(t *testing.T) {
+	params, err := ParseParams("level=lt.2&hidden=is.false&&name=eq.a%20b&level=gt.0")
+	assert.NoError(t, err)
+	assert.Equal(t, []Param{
+		{"level", "lt.2"},
+		{"hidden", "is.false"},
+		{"name", "eq.a b"},
+		{"level", "gt.0"},
+	}, params)
+
+	_, err = ParseParams("name=eq.%zz")
+	assert.Error(t, err)
+}
+
+// Test select lists are validated and result names kept unique
+func TestParseSelect(t *testing.T) {
+	table := &utils.Table{Name: "users", Columns: []utils.Column{
+		{Name: "id"}, {Name: "name"}, {Name: "email"}, {Name: "addr_street"}, {Name: "addr_city"},
+	}}
+
+	tests := []struct {
+		input    string
+		table    *utils.Table
+		expected string
+		errMsg   string
+	}{
+		{"", table, "*", ""},
+		{"id,title:name", table, "id, name AS title", ""},
+		{"*,title:name", table, "*, name AS title", ""},
+		{"id,addr_*", table, "id, addr_street, addr_city", ""},
+		{"addr_*,addr_city", table, "", "duplicate column addr_city in select"},
+		{"zip_*", table, "", "no columns match zip_*"},
+		{"addr_*", nil, "", "column patterns require table metadata: addr_*"},
+		{"*,name:email", nil, "*, email AS name", ""},
+		{"id,id", nil, "", "duplicate column id in select"},
+		{"name,name:email", table, "", "duplicate column name in select"},
+		{"a:id,a:name", table, "", "duplicate column a in select"},
+		{"*,name:email", table, "", "duplicate column name in select"},
+		{"id,phone", table, "", "unknown column phone"},
+		{"!email", table, "id, name, addr_street, addr_city", ""},
+		{"!email, !name, !addr_*", table, "id", ""},
+		{"!email,name", table, "", "cannot mix excluded and selected columns: name"},
+		{"!phone", table, "", "unknown column phone"},
+		{"!id,!name,!email,!addr_*", table, "", "select excludes every column"},
+		{"!email", nil, "", "select exclusions require table metadata"},
+	}
+
+	for _, tt := range tests {
+		columns, err := ParseSelect(tt.input, tt.table)
+		if tt.errMsg != "" {
+			assert.EqualError(t, err, tt.errMsg, tt.input)
+			continue
+		}
+		assert.NoError(t, err, tt.input)
+		assert.Equal(t, tt.expected, columns, tt.input)
+	}
+}
+
+func BenchmarkParseFilters(b *testing.B) {
+	params := []Param{
+		{"level", "lt.2"},
+		{"hidden", "is.false"},
+		{"or", "(name=like.foo*,and=(price=gte.10,price=lte.20))"},
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ParseFilters(params, Options{DBType: "postgres"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Test referenced columns include conditions under or and not groups
+func TestReferencedColumns(t *testing.T) {
+	params, err := ParseParams("level=lt.2&or=(name=eq.a,not=(secret=eq.b))&order=rank.desc&bogus")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"level": true, "name": true, "secret": true}, ReferencedColumns(params))
+	assert.Equal(t, map[string]bool{"level": true}, FilterColumns(params))
+}
+
+// Test the shape of params replaces the values of filters only
+func TestShape(t *testing.T) {
+	params, err := ParseParams(`level=lt.2&name=not.in.(a,"b,c")&or=(a=eq.1,not=(b=is.null,c=eq.))&order=rank.desc`)
+	assert.NoError(t, err)
+	shape, err := url.QueryUnescape(Shape(params))
+	assert.NoError(t, err)
+	assert.Equal(t, "level=lt.?&name=not.in.(?,?)&or=(a=eq.?,not=(b=is.null,c=eq.))&order=rank.desc", shape)
+}
+
+// Test not groups negate the conjunction of their parts, as MatchFilters does
+func TestNotGroup(t *testing.T) {
+	tests := []struct {
+		query string
+		sql   string
+	}{
+		{"not=(a=eq.1,b=eq.2)", "NOT (a = ? AND b = ?)"},
+		{"not=(a=eq.1)", "NOT (a = ?)"},
+		{"or=(a=eq.1,not=(b=eq.2,c=eq.3))", "(a = ? OR NOT (b = ? AND c = ?))"},
+	}
+	for _, tt := range tests {
+		params, err := ParseParams(tt.query)
+		assert.NoError(t, err)
+		sql, _, err := ParseFilters(params, Options{DBType: "postgres"})
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.sql, sql, tt.query)
+	}
+}
+
+// Test the parameters of other routes are not read as filters
+func TestReservedParams(t *testing.T) {
+	for _, rawQuery := range []string{
+		"metrics=sum(amount)&dimensions=region&level=eq.2",
+		"tables=a,b&level=eq.2",
+		"columns=name,price&level=eq.2",
+		"format=csv&level=eq.2",
+	} {
+		params, err := ParseParams(rawQuery)
+		assert.NoError(t, err)
+		sql, args, err := ParseFilters(params, Options{DBType: "postgres"})
+		assert.NoError(t, err, rawQuery)
+		assert.Equal(t, "level = ?", sql, rawQuery)
+		assert.Equal(t, []interface{}{int64(2)}, args, rawQuery)
+	}
+}
+
+// Test in lists bind a placeholder per value, typed by the column
+func TestInFilter(t *testing.T) {
+	table := &utils.Table{Name: "products", Columns: []utils.Column{
+		{Name: "id", Type: "INTEGER"}, {Name: "sku", Type: "TEXT"}, {Name: "status", Type: "TEXT", Enum: []string{"open", "closed"}},
+	}}
+
+	tests := []struct {
+		query        string
+		opts         Options
+		expectedSQL  string
+		expectedArgs []interface{}
+		errMsg       string
+	}{
+		{"id=in.(1,2,3)", Options{DBType: "postgres"}, "id IN (?, ?, ?)", []interface{}{int64(1), int64(2), int64(3)}, ""},
+		{"sku=in.(007,a)", Options{DBType: "postgres", Table: table}, "sku IN (?, ?)", []interface{}{"007", "a"}, ""},
+		{"sku=in.(\"a,b\",c)", Options{DBType: "mysql", Table: table}, "sku IN (?, ?)", []interface{}{"a,b", "c"}, ""},
+		{"id=in.(1,2)", Options{DBType: "surrealdb", Table: table}, "id IN ?", []interface{}{[]interface{}{int64(1), int64(2)}}, ""},
+		{"or=(id=in.(1,2),sku=eq.a)", Options{DBType: "sqlite"}, "(id IN (?, ?) OR sku = ?)", []interface{}{int64(1), int64(2), "a"}, ""},
+		{"id=not.in.(1,2)", Options{DBType: "postgres", PostgREST: true}, "NOT (id IN (?, ?))", []interface{}{int64(1), int64(2)}, ""},
+		{"id=in.(1,x)", Options{DBType: "postgres", Table: table}, "", nil, `invalid integer value "x" for column id`},
+		{"status=in.(open,lost)", Options{DBType: "postgres", Table: table}, "", nil, `invalid value "lost" for column status: must be one of open, closed`},
+		{"id=in.()", Options{DBType: "postgres"}, "", nil, `invalid list "()": expected in.(a,b,...)`},
+		{"id=in.1,2", Options{DBType: "postgres"}, "", nil, `invalid list "1,2": expected in.(a,b,...)`},
+		{"id=in.(1,,2)", Options{DBType: "postgres"}, "", nil, `invalid list "(1,,2)": empty value`},
+		{"sku=in.(\"a,b)", Options{DBType: "postgres"}, "", nil, `invalid list "(\"a,b)": unterminated quote`},
+	}
+
+	for _, tt := range tests {
+		params, err := ParseParams(tt.query)
+		assert.NoError(t, err)
+		sql, args, err := ParseFilters(params, tt.opts)
+		if tt.errMsg != "" {
+			assert.EqualError(t, err, tt.errMsg, tt.query)
+			continue
+		}
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.expectedSQL, sql, tt.query)
+		assert.Equal(t, tt.expectedArgs, args, tt.query)
+	}
+}
+
+// Test filter values are typed by their column when the table metadata is
+// known, and only converted when they read back the same under StrictTypes
+func TestValueTypes(t *testing.T) {
+	defer func(strict bool) { utils.StrictTypes = strict }(utils.StrictTypes)
+
+	table := &utils.Table{Name: "products", Columns: []utils.Column{
+		{Name: "id", Type: "INTEGER"}, {Name: "sku", Type: "TEXT"}, {Name: "price", Type: "REAL"},
+	}}
+
+	tests := []struct {
+		query        string
+		strict       bool
+		table        *utils.Table
+		expectedArgs []interface{}
+		errMsg       string
+	}{
+		{"sku=eq.007&id=eq.7", false, table, []interface{}{"007", int64(7)}, ""},
+		{"sku=eq.1e5&price=gt.1e5", false, table, []interface{}{"1e5", float64(100000)}, ""},
+		{"id=eq.x", false, table, nil, `invalid integer value "x" for column id`},
+		{"sku=eq.007&code=eq.1e5", false, nil, []interface{}{int64(7), float64(100000)}, ""},
+		{"sku=eq.007&code=eq.1e5&hex=eq.0x1F", true, nil, []interface{}{"007", "1e5", "0x1F"}, ""},
+		{"id=eq.7&price=eq.-2.5&active=eq.true", true, nil, []interface{}{int64(7), -2.5, true}, ""},
+	}
+
+	for _, tt := range tests {
+		utils.StrictTypes = tt.strict
+		params, err := ParseParams(tt.query)
+		assert.NoError(t, err)
+		_, args, err := ParseFilters(params, Options{DBType: "postgres", Table: tt.table})
+		if tt.errMsg != "" {
+			assert.EqualError(t, err, tt.errMsg, tt.query)
+			continue
+		}
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.expectedArgs, args, tt.query)
+	}
+}
+
+// Test decimal values bind as exact text, cast where the database would
+// compare text with a DECIMAL column as a float
+func TestDecimalFilter(t *testing.T) {
+	table := &utils.Table{Name: "products", Columns: []utils.Column{
+		{Name: "price", Type: "DECIMAL(10,2)"},
+	}}
+
+	tests := []struct {
+		query        string
+		dbType       string
+		expectedSQL  string
+		expectedArgs []interface{}
+		errMsg       string
+	}{
+		{"price=gt.19.99", "postgres", "price > ?", []interface{}{"19.99"}, ""},
+		{"price=gt.19.99", "mysql", "price > CAST(? AS DECIMAL(65,30))", []interface{}{"19.99"}, ""},
+		{"price=gt.19.99", "surrealdb", "price > <decimal> ?", []interface{}{"19.99"}, ""},
+		{"price=in.(1,2.5)", "mysql", "price IN (CAST(? AS DECIMAL(65,30)), CAST(? AS DECIMAL(65,30)))", []interface{}{"1", "2.5"}, ""},
+		{"price=in.(1,2.5)", "surrealdb", "price IN <array<decimal>> ?", []interface{}{[]interface{}{"1", "2.5"}}, ""},
+		{"price=isdistinct.1", "mysql", "NOT (price <=> CAST(? AS DECIMAL(65,30)))", []interface{}{"1"}, ""},
+		{"price=like.1*", "mysql", "price = ?", []interface{}{"1%"}, ""},
+		{"price=eq.cheap", "postgres", "", nil, `invalid decimal value "cheap" for column price`},
+	}
+
+	for _, tt := range tests {
+		params, err := ParseParams(tt.query)
+		assert.NoError(t, err)
+		sql, args, err := ParseFilters(params, Options{DBType: tt.dbType, Table: table})
+		if tt.errMsg != "" {
+			assert.EqualError(t, err, tt.errMsg, tt.query)
+			continue
+		}
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.expectedSQL, sql, tt.query)
+		assert.Equal(t, tt.expectedArgs, args, tt.query)
+	}
+}
+
+// Test null-safe comparisons match NULL as a value on every database, and
+// is.null tests for NULL
+func TestDistinctFilter(t *testing.T) {
+	table := &utils.Table{Name: "products", Columns: []utils.Column{
+		{Name: "id", Type: "INTEGER"}, {Name: "status", Type: "TEXT", Enum: []string{"open", "closed"}},
+	}}
+
+	tests := []struct {
+		query        string
+		opts         Options
+		expectedSQL  string
+		expectedArgs []interface{}
+		errMsg       string
+	}{
+		{"status=isdistinct.open", Options{DBType: "postgres"}, "status IS DISTINCT FROM ?", []interface{}{"open"}, ""},
+		{"status=notdistinct.open", Options{DBType: "postgres"}, "status IS NOT DISTINCT FROM ?", []interface{}{"open"}, ""},
+		{"status=isdistinct.open", Options{DBType: "mysql"}, "NOT (status <=> ?)", []interface{}{"open"}, ""},
+		{"status=notdistinct.open", Options{DBType: "mysql"}, "status <=> ?", []interface{}{"open"}, ""},
+		{"status=isdistinct.open", Options{DBType: "sqlite"}, "status IS NOT ?", []interface{}{"open"}, ""},
+		{"status=notdistinct.open", Options{DBType: "sqlite"}, "status IS ?", []interface{}{"open"}, ""},
+		{"status=isdistinct.open", Options{DBType: "surrealdb"}, "status != ?", []interface{}{"open"}, ""},
+		{"id=isdistinct.null", Options{DBType: "postgres"}, "id IS DISTINCT FROM ?", []interface{}{nil}, ""},
+		{"id=notdistinct.007", Options{DBType: "postgres", Table: table}, "id IS NOT DISTINCT FROM ?", []interface{}{int64(7)}, ""},
+		{"status=isdistinct.lost", Options{DBType: "postgres", Table: table}, "", nil, `invalid value "lost" for column status: must be one of open, closed`},
+		{"id=is.null", Options{DBType: "postgres"}, "id IS NULL", []interface{}{}, ""},
+		{"status=eq.", Options{DBType: "postgres"}, "status = ?", []interface{}{""}, ""},
+	}
+
+	for _, tt := range tests {
+		params, err := ParseParams(tt.query)
+		assert.NoError(t, err)
+		sql, args, err := ParseFilters(params, tt.opts)
+		if tt.errMsg != "" {
+			assert.EqualError(t, err, tt.errMsg, tt.query)
+			continue
+		}
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.expectedSQL, sql, tt.query)
+		assert.Equal(t, tt.expectedArgs, args, tt.query)
+	}
+}
@@ -0,0 +1,77 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// relativeTimeRegexp matches relative date values like now, today, now-7d or
+// today+1w
+var relativeTimeRegexp = regexp.MustCompile(`^(now|today)(?:([+-])(\d+)(s|m|h|d|w|mo|y))?$`)
+
+// relativeQueryRegexp finds relative date values in a raw query string
+var relativeQueryRegexp = regexp.MustCompile(`\.(now|today)\b`)
+
+// HasRelativeTime reports whether a raw query string may contain relative
+// date values, whose SQL args change over time
+func HasRelativeTime(rawQuery string) bool {
+	return relativeQueryRegexp.MatchString(rawQuery)
+}
+
+// ParseRelativeTime evaluates a relative date value like now-7d in
+// opts.TimeZone at opts.Now. ok is false when the value is not relative.
+func ParseRelativeTime(value string, opts Options) (time.Time, bool, error) {
+	matches := relativeTimeRegexp.FindStringSubmatch(value)
+	if matches == nil {
+		return time.Time{}, false, nil
+	}
+
+	loc := time.UTC
+	if opts.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(opts.TimeZone); err != nil {
+			return time.Time{}, true, fmt.Errorf("invalid time zone %q", opts.TimeZone)
+		}
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	t := now.In(loc)
+	if matches[1] == "today" {
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+
+	if matches[2] == "" {
+		return t, true, nil
+	}
+
+	n, err := strconv.Atoi(matches[3])
+	if err != nil {
+		return time.Time{}, true, fmt.Errorf("invalid relative date %q", value)
+	}
+	if matches[2] == "-" {
+		n = -n
+	}
+
+	switch matches[4] {
+	case "s":
+		t = t.Add(time.Duration(n) * time.Second)
+	case "m":
+		t = t.Add(time.Duration(n) * time.Minute)
+	case "h":
+		t = t.Add(time.Duration(n) * time.Hour)
+	case "d":
+		t = t.AddDate(0, 0, n)
+	case "w":
+		t = t.AddDate(0, 0, 7*n)
+	case "mo":
+		t = t.AddDate(0, n, 0)
+	case "y":
+		t = t.AddDate(n, 0, 0)
+	}
+	return t, true, nil
+}
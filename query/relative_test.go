@@ -0,0 +1,52 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test relative dates are evaluated in the requested time zone
+func TestParseRelativeTime(t *testing.T) {
+	now := time.Date(2024, 3, 10, 2, 30, 0, 0, time.UTC)
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		value    string
+		tz       string
+		expected time.Time
+	}{
+		{"now", "", now},
+		{"now-7d", "", now.AddDate(0, 0, -7)},
+		{"now+90m", "", now.Add(90 * time.Minute)},
+		{"today", "", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)},
+		{"today-1mo", "", time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)},
+		{"today", "America/New_York", time.Date(2024, 3, 9, 0, 0, 0, 0, newYork)},
+		{"today+1w", "America/New_York", time.Date(2024, 3, 16, 0, 0, 0, 0, newYork)},
+	}
+	for _, tt := range tests {
+		value, ok, err := ParseRelativeTime(tt.value, Options{TimeZone: tt.tz, Now: now})
+		assert.NoError(t, err, tt.value)
+		assert.True(t, ok, tt.value)
+		assert.True(t, tt.expected.Equal(value), "%s: %v", tt.value, value)
+	}
+
+	_, ok, _ := ParseRelativeTime("nowhere", Options{})
+	assert.False(t, ok)
+	_, ok, _ = ParseRelativeTime("now-7x", Options{})
+	assert.False(t, ok)
+	_, _, err = ParseRelativeTime("now", Options{TimeZone: "Mars/Olympus"})
+	assert.Error(t, err)
+
+	// Filters bind the evaluated time
+	sql, args, err := ParseFilters([]Param{{"created_at", "gte.now-1h"}, {"name", "eq.now"}}, Options{Now: now})
+	assert.NoError(t, err)
+	assert.Equal(t, "created_at >= ? AND name = ?", sql)
+	assert.Equal(t, []interface{}{now.Add(-time.Hour), now}, args)
+
+	assert.True(t, HasRelativeTime("created_at=gte.now-7d"))
+	assert.True(t, HasRelativeTime("or=(a=eq.today,b=eq.1)"))
+	assert.False(t, HasRelativeTime("name=eq.nowhere"))
+}
@@ -0,0 +1,67 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseRandomOrder converts ?order=random into a random ORDER BY in the
+// dialect of dbType. ?order=random.42 orders by a seed, returning the same
+// shuffle on every request; it is supported on Postgres and MySQL. ok is
+// false when order is not random.
+func ParseRandomOrder(order, dbType string) (string, bool, error) {
+	if order != "random" && !strings.HasPrefix(order, "random.") {
+		return "", false, nil
+	}
+
+	seedStr, seeded := strings.CutPrefix(order, "random.")
+	if !seeded {
+		switch dbType {
+		case "mysql", "surrealdb":
+			return "ORDER BY RAND()", true, nil
+		default:
+			return "ORDER BY RANDOM()", true, nil
+		}
+	}
+
+	seed, err := strconv.ParseInt(seedStr, 10, 64)
+	if err != nil {
+		return "", true, fmt.Errorf("invalid random seed %q", seedStr)
+	}
+
+	switch dbType {
+	case "postgres":
+		return fmt.Sprintf("ORDER BY md5(id::text || '%d')", seed), true, nil
+	case "mysql":
+		return fmt.Sprintf("ORDER BY RAND(%d)", seed), true, nil
+	default:
+		return "", true, fmt.Errorf("seeded random order is not supported on %s", dbType)
+	}
+}
+
+// ParseSample converts ?sample=5 (a percentage of rows) into a TABLESAMPLE
+// clause to follow the table name on Postgres, which reads only a sample of
+// pages, or a random WHERE condition emulating it elsewhere
+func ParseSample(sample, dbType string) (tablesample string, condition string, err error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(sample, "%"), 64)
+	if err != nil || math.IsNaN(percent) || math.IsInf(percent, 0) || percent <= 0 || percent > 100 {
+		return "", "", fmt.Errorf("invalid sample %q: must be a percentage between 0 and 100", sample)
+	}
+
+	p := strconv.FormatFloat(percent, 'f', -1, 64)
+	fraction := strconv.FormatFloat(percent/100, 'f', -1, 64)
+
+	switch dbType {
+	case "postgres":
+		return fmt.Sprintf("TABLESAMPLE SYSTEM (%s)", p), "", nil
+	case "mysql":
+		return "", fmt.Sprintf("RAND() < %s", fraction), nil
+	case "surrealdb":
+		return "", fmt.Sprintf("rand() < %s", fraction), nil
+	default:
+		// random() is a 64-bit integer on SQLite
+		return "", fmt.Sprintf("abs(random()) %% 1000000 < %d", int(percent*10000)), nil
+	}
+}
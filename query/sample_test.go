@@ -0,0 +1,59 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test random order in each dialect
+func TestParseRandomOrder(t *testing.T) {
+	tests := []struct {
+		order    string
+		dbType   string
+		expected string
+	}{
+		{"random", "postgres", "ORDER BY RANDOM()"},
+		{"random", "sqlite", "ORDER BY RANDOM()"},
+		{"random", "mysql", "ORDER BY RAND()"},
+		{"random", "surrealdb", "ORDER BY RAND()"},
+		{"random.42", "postgres", "ORDER BY md5(id::text || '42')"},
+		{"random.42", "mysql", "ORDER BY RAND(42)"},
+	}
+	for _, tt := range tests {
+		sql, ok, err := ParseRandomOrder(tt.order, tt.dbType)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, tt.expected, sql)
+	}
+
+	_, ok, err := ParseRandomOrder("price.desc", "postgres")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = ParseRandomOrder("random.x'", "postgres")
+	assert.Error(t, err)
+	_, _, err = ParseRandomOrder("random.42", "sqlite")
+	assert.Error(t, err)
+}
+
+// Test sampling uses TABLESAMPLE on Postgres and a random filter elsewhere
+func TestParseSample(t *testing.T) {
+	tablesample, condition, err := ParseSample("5%", "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "TABLESAMPLE SYSTEM (5)", tablesample)
+	assert.Equal(t, "", condition)
+
+	_, condition, err = ParseSample("2.5", "mysql")
+	assert.NoError(t, err)
+	assert.Equal(t, "RAND() < 0.025", condition)
+
+	_, condition, err = ParseSample("5", "sqlite")
+	assert.NoError(t, err)
+	assert.Equal(t, "abs(random()) % 1000000 < 50000", condition)
+
+	for _, sample := range []string{"0", "101", "-1", "five", "1 OR 1=1", "NaN", "NaN%", "Inf", "-Inf%"} {
+		_, _, err := ParseSample(sample, "postgres")
+		assert.Error(t, err, sample)
+	}
+}
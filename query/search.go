@@ -0,0 +1,73 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// likeEscaper escapes LIKE wildcards so a search term matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ParseSearch converts a search box query like ?q=jo&q_columns=name,email
+// into an OR of case-insensitive substring matches over the columns. Without
+// columns every text column of opts.Table is searched. Mode fts matches
+// words with Postgres full-text search instead.
+func ParseSearch(term, columns, mode string, opts Options) (string, []interface{}, error) {
+	if term == "" {
+		return "", nil, fmt.Errorf("q requires a search term")
+	}
+
+	var names []string
+	if columns != "" {
+		names = strings.Split(columns, ",")
+	} else if opts.Table != nil {
+		for _, column := range opts.Table.Columns {
+			if textTypes[utils.BaseType(column.Type)] {
+				names = append(names, column.Name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return "", nil, fmt.Errorf("q requires q_columns")
+	}
+	for _, name := range names {
+		if err := utils.ValidateColumnName(name); err != nil {
+			return "", nil, err
+		}
+		if opts.Table != nil {
+			if _, ok := opts.Table.Column(name); !ok {
+				return "", nil, fmt.Errorf("unknown column %s in q_columns", name)
+			}
+		}
+	}
+
+	var format string
+	var arg interface{}
+	switch {
+	case mode == "fts" && opts.DBType == "postgres":
+		format, arg = "to_tsvector(%s) @@ websearch_to_tsquery(?)", term
+	case mode == "fts":
+		return "", nil, fmt.Errorf("q_mode=fts is only supported on postgres")
+	case mode != "":
+		return "", nil, fmt.Errorf("unknown q_mode %q: must be fts", mode)
+	case opts.DBType == "postgres":
+		format, arg = "%s ILIKE ?", "%"+likeEscaper.Replace(term)+"%"
+	case opts.DBType == "surrealdb":
+		format, arg = "string::lowercase(%s) CONTAINS ?", strings.ToLower(term)
+	case opts.DBType == "sqlite":
+		format, arg = `%s LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(term)+"%"
+	default:
+		// MySQL's default collations compare case-insensitively
+		format, arg = "%s LIKE ?", "%"+likeEscaper.Replace(term)+"%"
+	}
+
+	conditions := make([]string, len(names))
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		conditions[i] = fmt.Sprintf(format, name)
+		args[i] = arg
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args, nil
+}
@@ -0,0 +1,50 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test q searches the listed columns, or every text column, on each database
+func TestSearch(t *testing.T) {
+	table := &utils.Table{Name: "users", Columns: []utils.Column{
+		{Name: "id", Type: "INTEGER"},
+		{Name: "name", Type: "VARCHAR(100)"},
+		{Name: "email", Type: "TEXT"},
+	}}
+
+	tests := []struct {
+		term, columns, mode string
+		opts                Options
+		expectedSQL         string
+		expectedArgs        []interface{}
+		errMsg              string
+	}{
+		{"Jo", "name,email", "", Options{DBType: "postgres"}, "(name ILIKE ? OR email ILIKE ?)", []interface{}{"%Jo%", "%Jo%"}, ""},
+		{"Jo", "name", "", Options{DBType: "mysql"}, "(name LIKE ?)", []interface{}{"%Jo%"}, ""},
+		{"50%_off", "name", "", Options{DBType: "sqlite"}, `(name LIKE ? ESCAPE '\')`, []interface{}{`%50\%\_off%`}, ""},
+		{"Jo", "name", "", Options{DBType: "surrealdb"}, "(string::lowercase(name) CONTAINS ?)", []interface{}{"jo"}, ""},
+		{"jo smith", "name", "fts", Options{DBType: "postgres"}, "(to_tsvector(name) @@ websearch_to_tsquery(?))", []interface{}{"jo smith"}, ""},
+		{"Jo", "", "", Options{DBType: "postgres", Table: table}, "(name ILIKE ? OR email ILIKE ?)", []interface{}{"%Jo%", "%Jo%"}, ""},
+		{"Jo", "", "", Options{DBType: "postgres"}, "", nil, "q requires q_columns"},
+		{"", "name", "", Options{DBType: "postgres"}, "", nil, "q requires a search term"},
+		{"Jo", "nick", "", Options{DBType: "postgres", Table: table}, "", nil, "unknown column nick in q_columns"},
+		{"Jo", "name;drop", "", Options{DBType: "postgres"}, "", nil, `invalid column name "name;drop"`},
+		{"Jo", "name", "fts", Options{DBType: "mysql"}, "", nil, "q_mode=fts is only supported on postgres"},
+		{"Jo", "name", "exact", Options{DBType: "postgres"}, "", nil, `unknown q_mode "exact": must be fts`},
+	}
+
+	for _, tt := range tests {
+		sql, args, err := ParseSearch(tt.term, tt.columns, tt.mode, tt.opts)
+		if tt.errMsg != "" {
+			assert.EqualError(t, err, tt.errMsg, tt.term)
+			continue
+		}
+		require.NoError(t, err, tt.term)
+		assert.Equal(t, tt.expectedSQL, sql, tt.term)
+		assert.Equal(t, tt.expectedArgs, args, tt.term)
+	}
+}
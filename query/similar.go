@@ -0,0 +1,35 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// SimilarityThreshold is the trigram similarity from 0 to 1 sim filters
+// require on Postgres. Zero uses pg_trgm's % operator and its
+// pg_trgm.similarity_threshold setting, 0.3 by default, which trigram
+// indexes can serve.
+var SimilarityThreshold float64
+
+// Parse a typo-tolerant match like name=sim.jonh. Postgres compares
+// trigrams with pg_trgm, MySQL compares SOUNDEX codes, SurrealDB uses its
+// fuzzy ~ operator, and SQLite falls back to a substring LIKE.
+func parseSimilarCondition(column, rawValue string, opts *Options) (string, []interface{}, error) {
+	if rawValue == "" {
+		return "", nil, fmt.Errorf("sim requires a value")
+	}
+	switch opts.DBType {
+	case "postgres":
+		if SimilarityThreshold > 0 {
+			threshold := strconv.FormatFloat(SimilarityThreshold, 'f', -1, 64)
+			return fmt.Sprintf("similarity(%s, ?) >= %s", column, threshold), []interface{}{rawValue}, nil
+		}
+		return fmt.Sprintf("%s %% ?", column), []interface{}{rawValue}, nil
+	case "mysql":
+		return fmt.Sprintf("SOUNDEX(%s) = SOUNDEX(?)", column), []interface{}{rawValue}, nil
+	case "surrealdb":
+		return fmt.Sprintf("%s ~ ?", column), []interface{}{rawValue}, nil
+	default:
+		return fmt.Sprintf("%s LIKE ?", column), []interface{}{"%" + rawValue + "%"}, nil
+	}
+}
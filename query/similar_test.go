@@ -0,0 +1,37 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test sim matches fuzzily on each database, with the configured threshold
+func TestSimilar(t *testing.T) {
+	defer func(threshold float64) { SimilarityThreshold = threshold }(SimilarityThreshold)
+
+	tests := []struct {
+		dbType       string
+		threshold    float64
+		expectedSQL  string
+		expectedArgs []interface{}
+	}{
+		{"postgres", 0, "name % ?", []interface{}{"jonh"}},
+		{"postgres", 0.5, "similarity(name, ?) >= 0.5", []interface{}{"jonh"}},
+		{"mysql", 0, "SOUNDEX(name) = SOUNDEX(?)", []interface{}{"jonh"}},
+		{"surrealdb", 0, "name ~ ?", []interface{}{"jonh"}},
+		{"sqlite", 0, "name LIKE ?", []interface{}{"%jonh%"}},
+	}
+
+	for _, tt := range tests {
+		SimilarityThreshold = tt.threshold
+		sql, args, err := ParseFilters([]Param{{"name", "sim.jonh"}}, Options{DBType: tt.dbType})
+		require.NoError(t, err, tt.dbType)
+		assert.Equal(t, tt.expectedSQL, sql, tt.dbType)
+		assert.Equal(t, tt.expectedArgs, args, tt.dbType)
+	}
+
+	_, _, err := ParseFilters([]Param{{"name", "sim."}}, Options{DBType: "postgres"})
+	assert.EqualError(t, err, "sim requires a value")
+}
@@ -0,0 +1,85 @@
+package restql
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Registry serves several databases from one process, each Server under the
+// prefix of its config, e.g. /api/app and /api/analytics. Servers keep their
+// own database, schema, table policies, authentication and query cache. The
+// zero Registry serves nothing.
+type Registry struct {
+	mu      sync.RWMutex
+	servers map[string]*Server
+}
+
+// Add serves s under the prefix of its config, which no other Server of the
+// registry may serve below or above. The first overlapping prefix in order
+// is reported.
+func (reg *Registry) Add(s *Server) error {
+	prefix := s.Config().Prefix
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	for _, other := range slices.Sorted(maps.Keys(reg.servers)) {
+		if nested(prefix, other) || nested(other, prefix) {
+			return fmt.Errorf("prefix %s overlaps prefix %s", prefix, other)
+		}
+	}
+	if reg.servers == nil {
+		reg.servers = map[string]*Server{}
+	}
+	reg.servers[prefix] = s
+	return nil
+}
+
+// Remove stops serving the Server under prefix and returns it, nil when
+// there is none. The Server is not closed.
+func (reg *Registry) Remove(prefix string) *Server {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	s := reg.servers[prefix]
+	delete(reg.servers, prefix)
+	return s
+}
+
+// ServeHTTP serves a request with the Server of its prefix, or 404
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.RLock()
+	var s *Server
+	for prefix, server := range reg.servers {
+		if nested(r.URL.Path, prefix) {
+			s = server
+			break
+		}
+	}
+	reg.mu.RUnlock()
+
+	if s == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.ServeHTTP(w, r)
+}
+
+// Close closes the database pool of every Server
+func (reg *Registry) Close() error {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	var errs []error
+	for _, s := range reg.servers {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// nested reports whether path is prefix or below it
+func nested(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
@@ -0,0 +1,333 @@
+// Package restql serves a database as a REST API: it runs the queries the
+// handler package generates against Postgres or MySQL, applying the table
+// policies, pagination limits, CORS and authentication of a Config. It is
+// what the restql serve command runs, and can be embedded in a program:
+//
+//	cfg, err := restql.LoadConfig("restql.yaml")
+//	srv, err := restql.NewFromConfig(ctx, cfg)
+//	http.ListenAndServe(":8080", srv)
+//
+// or serve on the configured port until ctx is done, draining requests in
+// flight before closing the database:
+//
+//	err = srv.ListenAndServe(ctx)
+package restql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/The-ForgeBase/restql/cache"
+	"github.com/The-ForgeBase/restql/handler"
+	"github.com/The-ForgeBase/restql/idempotency"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Server serves the API of a Config. It is an http.Handler for the whole
+// URL space, serving the API under the configured prefix.
+type Server struct {
+	// Source reads the config on Refresh, e.g. from the config file and
+	// flags. Refresh keeps the current config when it is nil.
+	Source func() (*Config, error)
+	// AuthorizeAdmin decides whether a request may use the reload and table
+	// endpoints, rejecting it with an error, served with its StatusCode
+	// when it has one. By default requests need a key with AdminRole, so
+	// without api_key mode the hook is required to serve the endpoints.
+	AuthorizeAdmin func(r *http.Request) error
+
+	db         *database
+	loadSchema func(ctx context.Context) (map[string]*utils.Table, error)
+	// ql builds the queries of requests in the database's dialect
+	ql *handler.Handler
+	// mu serializes reloads
+	mu sync.Mutex
+	// policy is swapped by Reload while requests are served
+	policy atomic.Pointer[policy]
+	// idempotency replays retried POSTs, nil when off
+	idempotency *idempotency.Keys
+	// signatures are the request signatures seen, nil until signing is on
+	signatures cache.Store
+}
+
+// NewFromConfig validates cfg, connects to its database and reads the schema
+// of its tables
+func NewFromConfig(ctx context.Context, cfg *Config) (*Server, error) {
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	db, err := openDatabase(ctx, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		db:         db,
+		loadSchema: db.loadSchema,
+		ql: handler.New(db.dbType, handler.Options{
+			PostgREST:  cfg.Dialect.PostgREST,
+			OData:      cfg.Dialect.OData,
+			JSONAPI:    cfg.Dialect.JSONAPI,
+			Pagination: cfg.Pagination.Strategy,
+			Locale:     cfg.Locale,
+			QueryCache: cfg.QueryCache,
+		}),
+	}
+	schema, err := s.loadSchema(ctx)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read schema: %v", err)
+	}
+	p, err := s.newPolicy(cfg, schema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.policy.Store(p)
+	s.ql.SetSchema(schema)
+	db.setPool(cfg.Pool)
+	return s, nil
+}
+
+// Config returns the config being served
+func (s *Server) Config() *Config {
+	return s.policy.Load().cfg
+}
+
+// Tables returns the names of the exposed tables
+func (s *Server) Tables() []string {
+	return s.policy.Load().names
+}
+
+// Reload re-reads the schema and swaps it in with the table policies,
+// pagination limits, CORS and authentication of cfg. Requests in flight
+// finish under the previous config, and the current config is kept when
+// cfg is invalid or does not fit the new schema. The pool is resized in
+// place, while the database, port, prefix, dialect, query cache and
+// idempotency settings need a restart to change.
+func (s *Server) Reload(ctx context.Context, cfg *Config) error {
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.Config()
+	switch {
+	case cfg.DSN != current.DSN, cfg.Port != current.Port, cfg.Prefix != current.Prefix:
+		return errors.New("dsn, port and prefix cannot change without a restart")
+	case cfg.Dialect != current.Dialect, cfg.QueryCache != current.QueryCache, cfg.Idempotency != current.Idempotency:
+		return errors.New("dialect, query_cache and idempotency cannot change without a restart")
+	}
+
+	schema, err := s.loadSchema(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %v", err)
+	}
+	p, err := s.newPolicy(cfg, schema)
+	if err != nil {
+		return err
+	}
+	if err := s.checkAdmin(cfg); err != nil {
+		return err
+	}
+	s.ql.SetSchema(schema)
+	s.policy.Store(p)
+	s.db.setPool(cfg.Pool)
+	return nil
+}
+
+// CreateTable creates a table from its definition and reloads the schema
+// with the current config, returning the table as read back. The table is
+// served when the config exposes every table or lists it.
+func (s *Server) CreateTable(ctx context.Context, def *handler.TableDefinition) (*utils.Table, error) {
+	if _, ok := s.policy.Load().schema[def.Name]; ok {
+		return nil, &policyError{http.StatusConflict, "table " + def.Name + " already exists"}
+	}
+	q, err := handler.CreateTableQL(def, s.db.dbType)
+	if err != nil {
+		return nil, &policyError{http.StatusUnprocessableEntity, err.Error()}
+	}
+	if _, _, err := s.db.exec(ctx, q); err != nil {
+		return nil, handler.TranslateError(err)
+	}
+	return s.reloadTable(ctx, def.Name)
+}
+
+// AlterTable applies an alteration to a table and reloads the schema with
+// the current config, returning the table as read back. Renaming or
+// dropping what the table policies name is rejected, as the config would
+// no longer match the schema.
+func (s *Server) AlterTable(ctx context.Context, tableName string, alt *handler.TableAlteration) (*utils.Table, error) {
+	p := s.policy.Load()
+	if _, ok := p.schema[tableName]; !ok {
+		return nil, &policyError{http.StatusNotFound, "unknown table " + tableName}
+	}
+	var referenced bool
+	switch {
+	case alt.RenameTo != "":
+		referenced = p.cfg.references(tableName, "")
+	case alt.DropColumn != "":
+		referenced = p.cfg.references(tableName, alt.DropColumn)
+	case alt.RenameColumn != nil:
+		referenced = p.cfg.references(tableName, alt.RenameColumn.From)
+	}
+	if referenced {
+		return nil, &policyError{http.StatusConflict, "the config names what the alteration renames or drops: change the config first"}
+	}
+
+	q, err := s.ql.AlterTableQL(tableName, alt)
+	if err != nil {
+		return nil, &policyError{http.StatusUnprocessableEntity, err.Error()}
+	}
+	if _, _, err := s.db.exec(ctx, q); err != nil {
+		return nil, handler.TranslateError(err)
+	}
+
+	if alt.RenameTo != "" {
+		tableName = alt.RenameTo
+	}
+	return s.reloadTable(ctx, tableName)
+}
+
+// reloadTable reloads the schema after a change to a table, returning the
+// table
+func (s *Server) reloadTable(ctx context.Context, tableName string) (*utils.Table, error) {
+	if err := s.Reload(ctx, s.Config()); err != nil {
+		return nil, fmt.Errorf("table %s was changed but the schema was not reloaded: %v", tableName, err)
+	}
+	table, ok := s.policy.Load().schema[tableName]
+	if !ok {
+		return nil, fmt.Errorf("table %s was changed but is not in the schema", tableName)
+	}
+	return table, nil
+}
+
+// Refresh reloads the config from Source, or the current config when
+// Source is nil, and the schema
+func (s *Server) Refresh(ctx context.Context) error {
+	cfg := s.Config()
+	if s.Source != nil {
+		var err error
+		if cfg, err = s.Source(); err != nil {
+			return err
+		}
+	}
+	return s.Reload(ctx, cfg)
+}
+
+// WatchFile refreshes the server whenever the file at path changes, checking
+// every Reload.Interval seconds, until ctx is done or the config turns
+// Reload.Watch off. Failed refreshes are logged and keep the current config.
+func (s *Server) WatchFile(ctx context.Context, path string) {
+	last, _ := os.Stat(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(s.Config().Reload.Interval) * time.Second):
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+		last = info
+
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("restql: config not reloaded: %v", err)
+			continue
+		}
+		log.Printf("restql: config reloaded, serving %d tables", len(s.Tables()))
+		if !s.Config().Reload.Watch {
+			return
+		}
+	}
+}
+
+// ListenAndServe serves on the configured port until ctx is done, then shuts
+// down gracefully, see Serve
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Config().Port))
+	if err != nil {
+		s.Close()
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve serves on l until ctx is done. It then stops accepting connections,
+// lets requests in flight finish for up to ShutdownTimeout seconds,
+// cancelling the queries of those still running afterwards, and closes the
+// database pool, as it does when serving fails. It returns nil after a
+// shutdown that drained every request. It refuses to start when the config
+// serves the reload or table endpoints without api_key mode or an
+// AuthorizeAdmin hook.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	if err := s.checkAdmin(s.Config()); err != nil {
+		l.Close()
+		s.Close()
+		return err
+	}
+
+	// Requests run with queries rather than ctx, so their queries outlive
+	// the shutdown signal until the drain deadline
+	queries, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	hs := &http.Server{
+		Handler:     s,
+		BaseContext: func(net.Listener) context.Context { return queries },
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- hs.Serve(l)
+	}()
+
+	select {
+	case err := <-served:
+		s.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := time.Duration(s.Config().ShutdownTimeout) * time.Second
+	drain, cancelDrain := context.WithTimeout(context.Background(), timeout)
+	defer cancelDrain()
+	err := hs.Shutdown(drain)
+	if err != nil {
+		cancel()
+		hs.Close()
+		err = fmt.Errorf("requests still running after %s were cancelled", timeout)
+	}
+	<-served
+	if closeErr := s.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ServeHTTP serves a request with the current config
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.policy.Load().handler.ServeHTTP(w, r)
+}
+
+// Ping checks the database can be reached
+func (s *Server) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database pool
+func (s *Server) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,1021 @@
+package restql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/The-ForgeBase/restql/apikey"
+	"github.com/The-ForgeBase/restql/events"
+	"github.com/The-ForgeBase/restql/handler"
+	"github.com/The-ForgeBase/restql/idempotency"
+	"github.com/The-ForgeBase/restql/query"
+	"github.com/The-ForgeBase/restql/signing"
+	"github.com/The-ForgeBase/restql/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSchema is the schema testServer reads
+var testSchema = map[string]*utils.Table{
+	"products": {Name: "products", Columns: []utils.Column{
+		{Name: "id", Type: "INTEGER", Identity: true},
+		{Name: "name", Type: "TEXT"},
+		{Name: "price", Type: "NUMERIC"},
+		{Name: "cost", Type: "NUMERIC"},
+		{Name: "tenant_id", Type: "INTEGER"},
+	}},
+}
+
+// testServer serves cfg over testSchema without a database, for requests
+// the policy answers itself
+func testServer(t *testing.T, cfg *Config) *Server {
+	t.Helper()
+	s := &Server{
+		db: &database{dbType: "postgres"},
+		ql: handler.New("postgres", handler.Options{}),
+		loadSchema: func(ctx context.Context) (map[string]*utils.Table, error) {
+			return testSchema, nil
+		},
+	}
+	cfg.DSN = "postgres://localhost/app"
+	cfg.SetDefaults()
+	require.NoError(t, cfg.Validate())
+	p, err := s.newPolicy(cfg, testSchema)
+	require.NoError(t, err)
+	s.policy.Store(p)
+	s.ql.SetSchema(testSchema)
+	return s
+}
+
+// Test requests breaking a table policy are rejected before reaching the
+// database
+func TestPolicyRejects(t *testing.T) {
+	s := testServer(t, &Config{Tables: map[string]TableConfig{
+		"products": {Verbs: []string{"get", "post"}, Columns: []string{"id", "name", "price"}},
+	}})
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"GET", "/api/orders", "", http.StatusNotFound},
+		{"DELETE", "/api/products/1", "", http.StatusMethodNotAllowed},
+		{"GET", "/api/products?select=id,cost", "", http.StatusForbidden},
+		{"GET", "/api/products?cost=gt.10", "", http.StatusForbidden},
+		{"GET", "/api/products?or=(name=eq.a,cost=gt.10)", "", http.StatusForbidden},
+		{"GET", "/api/products?order=cost.desc", "", http.StatusForbidden},
+		{"GET", "/api/products?stats=cost", "", http.StatusForbidden},
+		{"GET", "/api/products/aggregate?sum=price", "", http.StatusForbidden},
+		{"POST", "/api/products/query", `{"select":["cost"]}`, http.StatusForbidden},
+		{"POST", "/api/products", `{"name":"a","cost":1}`, http.StatusForbidden},
+		{"GET", "/api/users/1/products", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, tt.status, w.Code, "%s %s: %s", tt.method, tt.target, w.Body)
+	}
+}
+
+// Test writes naming columns missing from the schema are rejected before
+// reaching the database, whatever the body's format
+func TestPolicyUnknownColumns(t *testing.T) {
+	s := testServer(t, &Config{})
+
+	tests := []struct {
+		method      string
+		target      string
+		contentType string
+		body        string
+		message     string
+	}{
+		{"POST", "/api/products", "application/json", `{"name) VALUES (1); DROP TABLE products; --":1}`, "unknown column name) VALUES (1); DROP TABLE products; -- of products"},
+		{"POST", "/api/products", "", `[{"name":"a"},{"owner":1}]`, "unknown column owner of products"},
+		{"PATCH", "/api/products/1", "application/json", `{"owner":1}`, "unknown column owner of products"},
+		{"PUT", "/api/products/1", "application/json", `{"name":"a","owner":1}`, "unknown column owner of products"},
+		{"POST", "/api/products", "text/csv", "name,owner\na,1\n", "unknown column owner"},
+		{"POST", "/api/products", "application/x-www-form-urlencoded", "name=a&owner=1", "unknown column owner"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		s.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "%s %s", tt.method, tt.body)
+		assert.Equal(t, tt.message+"\n", w.Body.String(), "%s %s", tt.method, tt.body)
+	}
+}
+
+// Test the row filter and page size limit are added to reads
+func TestPolicyCheck(t *testing.T) {
+	s := testServer(t, &Config{
+		Tables:     map[string]TableConfig{"products": {Filter: "tenant_id=eq.42"}},
+		Pagination: PaginationConfig{MaxPageSize: 50},
+	})
+	tp := s.policy.Load().tables["products"]
+
+	tests := []struct {
+		method   string
+		target   string
+		accept   string
+		rawQuery string
+	}{
+		{"GET", "/products?name=eq.a", "", "name=eq.a&tenant_id=eq.42&page_size=50"},
+		{"GET", "/products?page_size=500", "", "page_size=50&tenant_id=eq.42"},
+		{"GET", "/products?limit=10", "", "limit=10&tenant_id=eq.42"},
+		{"GET", "/products?sort=-name&page[size]=20", "application/vnd.api+json", "order=name.desc&page_size=20&tenant_id=eq.42"},
+		{"DELETE", "/products?name=eq.a", "", "name=eq.a&tenant_id=eq.42"},
+		{"POST", "/products", "", ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		r.Header.Set("Accept", tt.accept)
+		require.NoError(t, tp.check(r, "", s.ql), tt.target)
+		assert.Equal(t, tt.rawQuery, r.URL.RawQuery, "%s %s", tt.method, tt.target)
+	}
+}
+
+// Test writes by id are restricted to the rows of the row filter
+func TestFilterWrite(t *testing.T) {
+	s := testServer(t, &Config{Tables: map[string]TableConfig{"products": {Filter: "tenant_id=eq.42"}}})
+	tp := s.policy.Load().tables["products"]
+
+	q := &utils.ReturnQuery{Query: "UPDATE products SET name = ? WHERE id = ? RETURNING *", Args: []any{"a", "1"}}
+	filtered, err := tp.filterWrite(q, "postgres")
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATE products SET name = ? WHERE id = ? AND (tenant_id = ?) RETURNING *", filtered.Query)
+	assert.Equal(t, []any{"a", "1", int64(42)}, filtered.Args)
+	assert.Equal(t, "UPDATE products SET name = ? WHERE id = ? RETURNING *", q.Query)
+}
+
+// Test reads by id and written rows stay within the row filter
+func TestFilterTenant(t *testing.T) {
+	s := testServer(t, &Config{Tables: map[string]TableConfig{"products": {Filter: "tenant_id=eq.42"}}})
+	var queries []string
+	(&fakeDB{query: func(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+		queries = append(queries, query)
+		return &fakeRows{columns: []string{"id"}}, nil
+	}}).open(t, s)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/products/5", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, queries, 1)
+	assert.Contains(t, queries[0], "WHERE tenant_id = $1")
+
+	for _, tt := range []struct {
+		method, target, body string
+		status               int
+	}{
+		{http.MethodPost, "/api/products", `{"name": "pen", "tenant_id": 42}`, http.StatusCreated},
+		{http.MethodPost, "/api/products", `{"name": "pen", "tenant_id": 7}`, http.StatusForbidden},
+		{http.MethodPost, "/api/products", `[{"tenant_id": 42}, {"name": "pen"}]`, http.StatusForbidden},
+		{http.MethodPut, "/api/products/5", `{"name": "pen"}`, http.StatusForbidden},
+		{http.MethodPatch, "/api/products/5", `{"tenant_id": 7}`, http.StatusForbidden},
+		{http.MethodPatch, "/api/products/5", `{"name": "pen"}`, http.StatusOK},
+	} {
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, tt.status, w.Code, "%s %s %s", tt.method, tt.target, w.Body.String())
+	}
+}
+
+// Test resources served under another name query their table with its
+// projection and filter
+func TestAliases(t *testing.T) {
+	s := testServer(t, &Config{Tables: map[string]TableConfig{
+		"offers": {Table: "products", Verbs: []string{"get"}, Columns: []string{"id", "name", "price"}, Filter: "price=lt.10"},
+	}})
+	assert.Equal(t, []string{"offers"}, s.Tables())
+
+	tp := s.policy.Load().tables["offers"]
+	assert.Equal(t, "products", tp.table)
+	assert.Equal(t, "offers", tp.meta.Name)
+	r := httptest.NewRequest(http.MethodGet, "/offers?name=eq.a", nil)
+	require.NoError(t, tp.check(r, "", s.ql))
+	assert.Equal(t, "name=eq.a&price=lt.10", r.URL.RawQuery)
+
+	tests := []struct {
+		method string
+		target string
+		status int
+		body   string
+	}{
+		{"GET", "/api/products", http.StatusNotFound, "unknown table products"},
+		{"GET", "/api/offers?cost=gt.1", http.StatusForbidden, "column cost of offers is not exposed"},
+		{"GET", "/api/offers?q=pen&q_columns=name,cost", http.StatusForbidden, "column cost of offers is not exposed"},
+		{"GET", "/api/offers?q=pen", http.StatusForbidden, "q requires q_columns on offers"},
+		{"POST", "/api/offers", http.StatusMethodNotAllowed, "POST is not allowed on offers"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+		assert.Equal(t, tt.status, w.Code, "%s %s", tt.method, tt.target)
+		assert.Contains(t, w.Body.String(), tt.body)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	assert.Contains(t, w.Body.String(), `"/offers"`)
+	assert.NotContains(t, w.Body.String(), `"/products"`)
+
+	assert.True(t, s.Config().references("products", "price"))
+	assert.False(t, s.Config().references("products", "cost"))
+
+	_, err := s.newPolicy(&Config{Tables: map[string]TableConfig{"offers": {Table: "items"}}}, testSchema)
+	assert.EqualError(t, err, "tables.offers: unknown table items")
+
+	_, err = s.newPolicy(&Config{Tables: map[string]TableConfig{"products": {IntStrings: []string{"sku"}}}}, testSchema)
+	assert.EqualError(t, err, "tables.products: unknown column sku in int_strings")
+	_, err = s.newPolicy(&Config{Tables: map[string]TableConfig{"products": {IntStrings: []string{"name"}}}}, testSchema)
+	assert.EqualError(t, err, "tables.products: int_strings: column name is not an integer")
+}
+
+// Test page sizes above the limit are capped
+func TestLimitPageSize(t *testing.T) {
+	params := limitPageSize([]query.Param{{Key: "page_size", Value: "abc"}}, 20)
+	assert.Equal(t, []query.Param{{Key: "page_size", Value: "20"}}, params)
+
+	params = limitPageSize(nil, query.MaxPageSize)
+	assert.Empty(t, params)
+}
+
+// Test preflights from allowed origins are answered
+func TestCORS(t *testing.T) {
+	s := testServer(t, &Config{CORS: CORSConfig{AllowOrigins: []string{"https://app.example.com"}, MaxAge: 600}})
+
+	r := httptest.NewRequest(http.MethodOptions, "/api/products", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+
+	r.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+// Test API key mode rejects requests without a key
+func TestAuth(t *testing.T) {
+	s := testServer(t, &Config{Auth: AuthConfig{Mode: AuthAPIKey, Keys: []KeyConfig{{ID: "web", Hash: "abc"}}}})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/products", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// Test reloading swaps the policies and schema, keeping the current ones on
+// error
+func TestReload(t *testing.T) {
+	ctx := context.Background()
+	s := testServer(t, &Config{})
+	assert.Equal(t, []string{"products"}, s.Tables())
+
+	cfg := &Config{DSN: "postgres://localhost/app", Tables: map[string]TableConfig{"products": {Verbs: []string{"GET"}}}}
+	require.NoError(t, s.Reload(ctx, cfg))
+	assert.Same(t, cfg, s.Config())
+	assert.Same(t, testSchema["products"], s.ql.Table("products"))
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/products/1", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	assert.Error(t, s.Reload(ctx, &Config{DSN: "postgres://localhost/other"}))
+	assert.Error(t, s.Reload(ctx, &Config{DSN: "postgres://localhost/app", Tables: map[string]TableConfig{"orders": {}}}))
+	assert.Same(t, cfg, s.Config())
+
+	// A migration adding orders lets the config expose it
+	s.loadSchema = func(ctx context.Context) (map[string]*utils.Table, error) {
+		return map[string]*utils.Table{
+			"products": testSchema["products"],
+			"orders":   {Name: "orders", Columns: []utils.Column{{Name: "id", Type: "INTEGER"}}},
+		}, nil
+	}
+	s.Source = func() (*Config, error) {
+		return &Config{DSN: "postgres://localhost/app", Tables: map[string]TableConfig{"orders": {}}}, nil
+	}
+	require.NoError(t, s.Refresh(ctx))
+	assert.Equal(t, []string{"orders"}, s.Tables())
+	assert.NotNil(t, s.ql.Table("orders"))
+}
+
+// Test the reload endpoint requires POST and, in api_key mode, an admin key
+func TestReloadEndpoint(t *testing.T) {
+	s := testServer(t, &Config{
+		Reload: ReloadConfig{Endpoint: true},
+		Auth: AuthConfig{Mode: AuthAPIKey, Keys: []KeyConfig{
+			{ID: "ops", Hash: apikey.Hash("ops-secret"), Role: AdminRole},
+			{ID: "web", Hash: apikey.Hash("web-secret"), Role: "reader"},
+		}},
+	})
+
+	tests := []struct {
+		method string
+		secret string
+		status int
+	}{
+		{http.MethodPost, "", http.StatusUnauthorized},
+		{http.MethodPost, "web-secret", http.StatusForbidden},
+		{http.MethodGet, "ops-secret", http.StatusMethodNotAllowed},
+		{http.MethodPost, "ops-secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/_reload", nil)
+		if tt.secret != "" {
+			r.Header.Set(apikey.Header, tt.secret)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, tt.status, w.Code, "%s %s: %s", tt.method, tt.secret, w.Body)
+	}
+}
+
+// Test shutting down lets requests in flight finish, then cancels the
+// queries of the ones still running after the timeout
+func TestServe(t *testing.T) {
+	for _, drained := range []bool{true, false} {
+		s := testServer(t, &Config{ShutdownTimeout: 1})
+		db, err := sql.Open("pgx", "postgres://localhost/app")
+		require.NoError(t, err)
+		s.db.DB = db
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		s.policy.Load().handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			select {
+			case <-release:
+				w.Write([]byte("done"))
+			case <-r.Context().Done():
+			}
+		})
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		ctx, shutdown := context.WithCancel(context.Background())
+		served := make(chan error, 1)
+		go func() {
+			served <- s.Serve(ctx, l)
+		}()
+
+		responses := make(chan string, 1)
+		go func() {
+			resp, err := http.Get("http://" + l.Addr().String() + "/api/products")
+			if err != nil {
+				responses <- err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			responses <- string(body)
+		}()
+
+		<-started
+		shutdown()
+		if drained {
+			close(release)
+			assert.Equal(t, "done", <-responses)
+			assert.NoError(t, <-served)
+		} else {
+			assert.Error(t, <-served)
+			assert.NotEqual(t, "done", <-responses)
+		}
+		assert.ErrorContains(t, db.Ping(), "database is closed")
+	}
+}
+
+// Test the table endpoints reject changes before reaching the database
+func TestTablesEndpoint(t *testing.T) {
+	s := testServer(t, &Config{
+		DDL:    true,
+		Reload: ReloadConfig{Endpoint: true},
+		Tables: map[string]TableConfig{"products": {Columns: []string{"id", "name"}}},
+		Auth: AuthConfig{Mode: AuthAPIKey, Keys: []KeyConfig{
+			{ID: "ops", Hash: apikey.Hash("ops-secret"), Role: AdminRole},
+			{ID: "web", Hash: apikey.Hash("web-secret"), Role: "reader"},
+		}},
+	})
+
+	tests := []struct {
+		method string
+		target string
+		secret string
+		body   string
+		status int
+	}{
+		{"POST", "/api/_tables", "web-secret", `{"name": "orders", "columns": [{"name": "id", "type": "INTEGER"}]}`, http.StatusForbidden},
+		{"POST", "/api/_tables", "ops-secret", `{"name": "products", "columns": [{"name": "id", "type": "INTEGER"}]}`, http.StatusConflict},
+		{"POST", "/api/_tables", "ops-secret", `{"name": "orders", "columns": [{"name": "id", "type": "POINT"}]}`, http.StatusUnprocessableEntity},
+		{"POST", "/api/_tables", "ops-secret", `{"name": "orders", "colums": []}`, http.StatusBadRequest},
+		{"PATCH", "/api/_tables", "ops-secret", `{}`, http.StatusMethodNotAllowed},
+		{"POST", "/api/_tables/products", "ops-secret", `{}`, http.StatusMethodNotAllowed},
+		{"PATCH", "/api/_tables/orders", "ops-secret", `{"drop_column": "id"}`, http.StatusNotFound},
+		{"PATCH", "/api/_tables/products", "web-secret", `{"drop_column": "cost"}`, http.StatusForbidden},
+		{"PATCH", "/api/_tables/products", "ops-secret", `{"rename_to": "items"}`, http.StatusConflict},
+		{"PATCH", "/api/_tables/products", "ops-secret", `{"drop_column": "name"}`, http.StatusConflict},
+		{"PATCH", "/api/_tables/products", "ops-secret", `{"rename_column": {"from": "id", "to": "key"}}`, http.StatusConflict},
+		{"PATCH", "/api/_tables/products", "ops-secret", `{"drop_column": "level"}`, http.StatusUnprocessableEntity},
+		{"PATCH", "/api/_tables/products", "ops-secret", `{"drop_column": "cost", "rename_to": "items"}`, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		r.Header.Set(apikey.Header, tt.secret)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, tt.status, w.Code, "%s %s %s: %s", tt.method, tt.target, tt.body, w.Body)
+	}
+
+	// The hook replaces the admin role check
+	s.AuthorizeAdmin = func(r *http.Request) error {
+		return &policyError{http.StatusUnauthorized, "sign in first"}
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/_reload", nil)
+	r.Header.Set(apikey.Header, "ops-secret")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// Test the admin endpoints are refused without api_key mode or a hook to
+// authorize them
+func TestAdminWithoutAuth(t *testing.T) {
+	ctx := context.Background()
+	s := testServer(t, &Config{})
+	err := s.Reload(ctx, &Config{DSN: s.Config().DSN, DDL: true})
+	assert.EqualError(t, err, "ddl and reload.endpoint need auth mode api_key or an AuthorizeAdmin hook")
+
+	// Embedded as a handler, the default check refuses the endpoints
+	s = testServer(t, &Config{Reload: ReloadConfig{Endpoint: true}})
+	(&fakeDB{}).open(t, s)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/_reload", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.ErrorContains(t, s.Serve(ctx, l), "need auth mode api_key")
+
+	s = testServer(t, &Config{})
+	s.AuthorizeAdmin = func(r *http.Request) error { return nil }
+	assert.NoError(t, s.Reload(ctx, &Config{DSN: s.Config().DSN, DDL: true}))
+}
+
+// Test a registry routes requests to the server of their prefix, each with
+// its own schema
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	app := testServer(t, &Config{Prefix: "/api/app"})
+	analytics := testServer(t, &Config{Prefix: "/api/analytics"})
+	analytics.loadSchema = func(ctx context.Context) (map[string]*utils.Table, error) {
+		return map[string]*utils.Table{
+			"events": {Name: "events", Columns: []utils.Column{{Name: "id", Type: "INTEGER"}}},
+		}, nil
+	}
+	require.NoError(t, analytics.Reload(ctx, &Config{DSN: "postgres://localhost/app", Prefix: "/api/analytics"}))
+	assert.NotNil(t, app.ql.Table("products"))
+	assert.Nil(t, app.ql.Table("events"))
+	assert.Nil(t, analytics.ql.Table("products"))
+
+	var reg Registry
+	require.NoError(t, reg.Add(app))
+	require.NoError(t, reg.Add(analytics))
+	assert.EqualError(t, reg.Add(testServer(t, &Config{})), "prefix /api overlaps prefix /api/analytics")
+
+	tests := []struct {
+		target string
+		status int
+		body   string
+	}{
+		{"/api/app/openapi.json", http.StatusOK, `"/products"`},
+		{"/api/analytics/openapi.json", http.StatusOK, `"/events"`},
+		{"/api/analytics/products", http.StatusNotFound, "unknown table products"},
+		{"/api/other/products", http.StatusNotFound, "404 page not found"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		reg.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		assert.Equal(t, tt.status, w.Code, tt.target)
+		assert.Contains(t, w.Body.String(), tt.body, tt.target)
+	}
+
+	assert.Same(t, analytics, reg.Remove("/api/analytics"))
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/analytics/openapi.json", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// Test tenants are served from their own server, opened once on their
+// first request
+func TestTenants(t *testing.T) {
+	var opened atomic.Int64
+	tenants := &Tenants{
+		Resolve: TenantHeader("X-Tenant"),
+		Config: func(tenant string) (*Config, error) {
+			switch tenant {
+			case "acme", "globex":
+				return &Config{}, nil
+			case "broken":
+				return nil, errors.New("connection refused")
+			}
+			return nil, nil
+		},
+		open: func(ctx context.Context, cfg *Config) (*Server, error) {
+			opened.Add(1)
+			s := testServer(t, cfg)
+			(&fakeDB{}).open(t, s)
+			return s, nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+			r.Header.Set("X-Tenant", "acme")
+			w := httptest.NewRecorder()
+			tenants.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), opened.Load())
+
+	tests := []struct {
+		tenant string
+		status int
+		body   string
+	}{
+		{"globex", http.StatusOK, `"/products"`},
+		{"", http.StatusBadRequest, "tenant required"},
+		{"initech", http.StatusNotFound, "unknown tenant initech"},
+		{"broken", http.StatusServiceUnavailable, "tenant broken unavailable"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+		r.Header.Set("X-Tenant", tt.tenant)
+		w := httptest.NewRecorder()
+		tenants.ServeHTTP(w, r)
+		assert.Equal(t, tt.status, w.Code, tt.tenant)
+		assert.Contains(t, w.Body.String(), tt.body, tt.tenant)
+	}
+	assert.Equal(t, int64(2), opened.Load())
+
+	assert.NotNil(t, tenants.Remove("globex"))
+	assert.Nil(t, tenants.Remove("broken"))
+	assert.NoError(t, tenants.Close())
+}
+
+// Test tenants are resolved from the subdomain of the host
+func TestTenantSubdomain(t *testing.T) {
+	resolve := TenantSubdomain("example.com")
+	for host, tenant := range map[string]string{
+		"acme.example.com":      "acme",
+		"ACME.example.com:8080": "acme",
+		"example.com":           "",
+		"a.b.example.com":       "",
+		"acme.example.org":      "",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+		r.Host = host
+		name, err := resolve(r)
+		assert.NoError(t, err)
+		assert.Equal(t, tenant, name, host)
+	}
+}
+
+// fakeDB is a database answering every query with query, or refusing
+// connections when down
+type fakeDB struct {
+	down  bool
+	query func(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error)
+	// writes counts the writes run
+	writes atomic.Int64
+}
+
+func (f *fakeDB) Connect(ctx context.Context) (driver.Conn, error) {
+	if f.down {
+		return nil, errors.New("connection refused")
+	}
+	return fakeConn{f}, nil
+}
+
+func (f *fakeDB) Driver() driver.Driver { return f }
+
+func (f *fakeDB) Open(name string) (driver.Conn, error) { return f.Connect(context.Background()) }
+
+// open serves the fake database to s
+func (f *fakeDB) open(t *testing.T, s *Server) {
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	s.db.DB = db
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.ErrUnsupported }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.ErrUnsupported }
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.db.query == nil {
+		return nil, errors.ErrUnsupported
+	}
+	return c.db.query(ctx, query, args)
+}
+
+// ExecContext runs every write, affecting one row
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.writes.Add(1)
+	return driver.RowsAffected(1), nil
+}
+
+// fakeRows are the rows of a fakeDB query
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// Test the health endpoint reports whether the database can be reached,
+// without a key
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		down   bool
+		method string
+		status int
+		body   string
+	}{
+		{false, http.MethodGet, http.StatusOK, `{"status":"ok"}`},
+		{true, http.MethodGet, http.StatusServiceUnavailable, `{"status":"unavailable"}`},
+		{false, http.MethodPost, http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		s := testServer(t, &Config{Auth: AuthConfig{Mode: AuthAPIKey, Keys: []KeyConfig{
+			{ID: "ops", Hash: apikey.Hash("ops-secret"), Role: AdminRole},
+		}}})
+		(&fakeDB{down: tt.down}).open(t, s)
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(tt.method, "/api/_health", nil))
+		assert.Equal(t, tt.status, w.Code, "down %v %s", tt.down, tt.method)
+		if tt.body != "" {
+			assert.JSONEq(t, tt.body, w.Body.String())
+		}
+	}
+}
+
+// Test the pool is sized from the config and resized by Reload
+func TestPool(t *testing.T) {
+	s := testServer(t, &Config{})
+	(&fakeDB{}).open(t, s)
+
+	cfg := &Config{DSN: s.Config().DSN, Pool: PoolConfig{MaxOpenConns: 4}}
+	require.NoError(t, s.Reload(context.Background(), cfg))
+	assert.Equal(t, 4, s.db.Stats().MaxOpenConnections)
+
+	cfg = &Config{DSN: s.Config().DSN}
+	require.NoError(t, s.Reload(context.Background(), cfg))
+	assert.Equal(t, 0, s.db.Stats().MaxOpenConnections)
+}
+
+// Test queries running past query_timeout are cancelled and answered 504
+func TestQueryTimeout(t *testing.T) {
+	s := testServer(t, &Config{QueryTimeout: 1})
+	(&fakeDB{query: func(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}).open(t, s)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/products", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), "query timed out after 1s")
+}
+
+// Test exports stream every page as a file download of the exposed columns,
+// under the row filter
+func TestExport(t *testing.T) {
+	defer func(size int) { handler.ExportBatchSize = size }(handler.ExportBatchSize)
+	handler.ExportBatchSize = 2
+
+	s := testServer(t, &Config{Tables: map[string]TableConfig{
+		"products": {Columns: []string{"id", "name"}, Filter: "tenant_id=eq.7"},
+	}})
+	var queries []string
+	(&fakeDB{query: func(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+		queries = append(queries, query)
+		rows := &fakeRows{columns: []string{"id", "name", "cost"}}
+		if len(queries) == 1 {
+			rows.values = [][]driver.Value{{int64(1), "pen", "0.5"}, {int64(2), "ink", "1.5"}}
+		} else {
+			rows.values = [][]driver.Value{{int64(3), "pad", "2.5"}}
+		}
+		return rows, nil
+	}}).open(t, s)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/products/export?format=csv", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `attachment; filename=products.csv`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "id,name\n1,pen\n2,ink\n3,pad\n", w.Body.String())
+	require.Len(t, queries, 2)
+	assert.Contains(t, queries[0], "tenant_id = $1")
+	assert.Contains(t, queries[1], "id > $2")
+
+	s = testServer(t, &Config{Tables: map[string]TableConfig{
+		"products": {Columns: []string{"name"}},
+	}})
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/products/export", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// Test reads with stats answer the summary of the filtered rows next to
+// them
+func TestStats(t *testing.T) {
+	s := testServer(t, &Config{})
+	var queries []string
+	(&fakeDB{query: func(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+		queries = append(queries, query)
+		if strings.Contains(query, "MIN(price)") {
+			return &fakeRows{columns: []string{"min_price", "max_price"}, values: [][]driver.Value{{"1", "9"}}}, nil
+		}
+		return &fakeRows{columns: []string{"id"}, values: [][]driver.Value{{int64(1)}}}, nil
+	}}).open(t, s)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/products?select=id&stats=min(price),max(price)", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"data": [{"id": 1}], "stats": {"min_price": "1", "max_price": "9"}}`, w.Body.String())
+	assert.Len(t, queries, 2)
+}
+
+// Test reads are answered from the result cache until a write to their
+// table, and from the stale copy while the database is down
+func TestResultCache(t *testing.T) {
+	s := testServer(t, &Config{ResultCache: ResultCacheConfig{MaxEntries: 10, StaleTTL: 60}})
+	var queries int
+	down := false
+	(&fakeDB{query: func(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+		if down {
+			return nil, errors.New("connection refused")
+		}
+		queries++
+		return &fakeRows{columns: []string{"id"}, values: [][]driver.Value{{int64(queries)}}}, nil
+	}}).open(t, s)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	assert.JSONEq(t, `[{"id": 1}]`, get("/api/products?select=id").Body.String())
+	assert.JSONEq(t, `[{"id": 1}]`, get("/api/products?select=id").Body.String())
+	assert.JSONEq(t, `[{"id": 2}]`, get("/api/products?select=id&id=eq.1").Body.String())
+	assert.Equal(t, 2, queries)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/products", strings.NewReader(`{"name": "pen"}`)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.JSONEq(t, `[{"id": 3}]`, get("/api/products?select=id").Body.String())
+
+	down = true
+	w = get("/api/products?select=id")
+	assert.JSONEq(t, `[{"id": 3}]`, w.Body.String())
+	w = get("/api/products?select=id&name=eq.pen")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// Writes invalidate, but the stale copy survives for outages
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/products?id=eq.1", nil))
+	w = get("/api/products?select=id")
+	assert.JSONEq(t, `[{"id": 3}]`, w.Body.String())
+	assert.Equal(t, `110 - "Response is Stale"`, w.Header().Get("Warning"))
+
+	// Reads with stats are cached apart from the bare rows
+	down = false
+	get("/api/products?select=id")
+	assert.Contains(t, get("/api/products?select=id&stats=max(price)").Body.String(), `"stats"`)
+}
+
+// Test the breaker answers 503 without querying once the database keeps
+// failing
+func TestBreaker(t *testing.T) {
+	s := testServer(t, &Config{Breaker: BreakerConfig{Threshold: 2}})
+	var queries int
+	(&fakeDB{query: func(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+		queries++
+		return nil, errors.New("connection refused")
+	}}).open(t, s)
+
+	for _, status := range []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/products", nil))
+		assert.Equal(t, status, w.Code)
+	}
+	assert.Equal(t, 2, queries)
+}
+
+// Test masked columns are masked by the role of the key, and cannot be
+// filtered or ordered by where they are masked
+func TestMasking(t *testing.T) {
+	s := testServer(t, &Config{
+		Tables: map[string]TableConfig{"products": {Mask: map[string]MaskConfig{
+			"cost": {Default: "redact", Roles: map[string]string{AdminRole: "clear"}},
+			"name": {Default: "partial", Keep: 2},
+		}}},
+		Auth: AuthConfig{Mode: AuthAPIKey, Keys: []KeyConfig{
+			{ID: "ops", Hash: apikey.Hash("ops-secret"), Role: AdminRole},
+			{ID: "web", Hash: apikey.Hash("web-secret"), Role: "reader"},
+		}},
+	})
+	(&fakeDB{query: func(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+		return &fakeRows{columns: []string{"id", "name", "cost"}, values: [][]driver.Value{{int64(1), "pencil", "0.5"}}}, nil
+	}}).open(t, s)
+
+	tests := []struct {
+		secret string
+		target string
+		status int
+		body   string
+	}{
+		{"web-secret", "/api/products", http.StatusOK, `[{"id": 1, "name": "****il", "cost": "[REDACTED]"}]`},
+		{"ops-secret", "/api/products", http.StatusOK, `[{"id": 1, "name": "****il", "cost": "0.5"}]`},
+		{"web-secret", "/api/products?cost=gt.1", http.StatusForbidden, ""},
+		{"web-secret", "/api/products?order=cost.desc", http.StatusForbidden, ""},
+		{"web-secret", "/api/products?stats=max(cost)", http.StatusForbidden, ""},
+		{"ops-secret", "/api/products?cost=gt.1", http.StatusOK, ""},
+		{"ops-secret", "/api/products?name=eq.pen", http.StatusForbidden, ""},
+		{"web-secret", "/api/products?select=id,c:cost", http.StatusForbidden, ""},
+		{"web-secret", "/api/products/export?select=id,c:cost&format=csv", http.StatusForbidden, ""},
+		{"web-secret", "/api/products?select=id,cost:cost", http.StatusOK, ""},
+		{"ops-secret", "/api/products?select=id,c:cost", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		r.Header.Set(apikey.Header, tt.secret)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, tt.status, w.Code, "%s %s: %s", tt.secret, tt.target, w.Body)
+		if tt.body != "" {
+			assert.JSONEq(t, tt.body, w.Body.String())
+		}
+	}
+
+	cfg := &Config{DSN: s.Config().DSN, Tables: map[string]TableConfig{"products": {Mask: map[string]MaskConfig{"cost": {Default: "shuffle"}}}}}
+	assert.ErrorContains(t, cfg.Validate(), "tables.products: mask.cost: unknown masking strategy shuffle")
+}
+
+// Test POSTs retried with an Idempotency-Key are replayed, per API key
+func TestIdempotency(t *testing.T) {
+	s := testServer(t, &Config{
+		Idempotency: IdempotencyConfig{MaxEntries: 10},
+		Auth: AuthConfig{Mode: AuthAPIKey, Keys: []KeyConfig{
+			{ID: "ops", Hash: apikey.Hash("ops-secret")},
+			{ID: "web", Hash: apikey.Hash("web-secret")},
+		}},
+	})
+	db := &fakeDB{}
+	db.open(t, s)
+
+	for _, secret := range []string{"web-secret", "web-secret", "ops-secret"} {
+		r := httptest.NewRequest(http.MethodPost, "/api/products", strings.NewReader(`{"name": "pen"}`))
+		r.Header.Set(apikey.Header, secret)
+		r.Header.Set(idempotency.Header, "order-1")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+	assert.EqualValues(t, 2, db.writes.Load())
+
+	cfg := &Config{DSN: s.Config().DSN, Auth: s.Config().Auth}
+	assert.ErrorContains(t, s.Reload(context.Background(), cfg), "cannot change without a restart")
+}
+
+// Test signing requires signed requests, each accepted once even across a
+// reload rotating the secrets
+func TestSigning(t *testing.T) {
+	s := testServer(t, &Config{Signing: SigningConfig{Secrets: []string{"old"}}})
+	(&fakeDB{query: func(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+		return &fakeRows{columns: []string{"id"}}, nil
+	}}).open(t, s)
+
+	limit := 0
+	signed := func(secret string) *http.Request {
+		limit++
+		r := httptest.NewRequest(http.MethodGet, "/api/products?limit="+strconv.Itoa(limit), nil)
+		signing.Sign(r, []byte(secret), nil, time.Now())
+		return r
+	}
+	serve := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(httptest.NewRequest(http.MethodGet, "/api/products", nil)))
+	assert.Equal(t, http.StatusOK, serve(httptest.NewRequest(http.MethodGet, "/api/_health", nil)))
+	replayed := signed("old")
+	assert.Equal(t, http.StatusOK, serve(replayed.Clone(context.Background())))
+	assert.Equal(t, http.StatusUnauthorized, serve(signed("new")))
+
+	cfg := &Config{DSN: s.Config().DSN, Signing: SigningConfig{Secrets: []string{"new", "old"}}}
+	require.NoError(t, s.Reload(context.Background(), cfg))
+	assert.Equal(t, http.StatusOK, serve(signed("new")))
+	assert.Equal(t, http.StatusUnauthorized, serve(replayed))
+}
+
+// Test successful writes post their change events to the webhooks, and
+// reads do not
+func TestEvents(t *testing.T) {
+	received := make(chan events.Event, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.True(t, events.Verify([]byte("hook-secret"), body, r.Header.Get(events.SignatureHeader)))
+		var event events.Event
+		assert.NoError(t, json.Unmarshal(body, &event))
+		received <- event
+	}))
+	defer hook.Close()
+
+	s := testServer(t, &Config{Events: EventsConfig{Webhooks: []WebhookConfig{{URL: hook.URL, Secret: "hook-secret"}}}})
+	(&fakeDB{}).open(t, s)
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/products", nil))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/products", strings.NewReader(`{"name": "pen"}`)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	require.Len(t, received, 1)
+	event := <-received
+	assert.Equal(t, "products", event.Table)
+	assert.Equal(t, events.Insert, event.Operation)
+}
+
+// Test bodies over handler.MaxBodySize are refused before any middleware
+// buffers them
+func TestBodyLimit(t *testing.T) {
+	defer func(size int64) { handler.MaxBodySize = size }(handler.MaxBodySize)
+	handler.MaxBodySize = 64
+
+	body := `{"name": "` + strings.Repeat("a", 100) + `"}`
+	for _, cfg := range []*Config{
+		{},
+		{Idempotency: IdempotencyConfig{MaxEntries: 10}},
+		{Signing: SigningConfig{Secrets: []string{"secret"}}},
+	} {
+		s := testServer(t, cfg)
+		db := &fakeDB{}
+		db.open(t, s)
+
+		r := httptest.NewRequest(http.MethodPost, "/api/products", strings.NewReader(body))
+		r.Header.Set(idempotency.Header, "order-1")
+		signing.Sign(r, []byte("secret"), []byte(body), time.Now())
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+		assert.Zero(t, db.writes.Load())
+	}
+}
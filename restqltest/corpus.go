@@ -0,0 +1,120 @@
+package restqltest
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/handler"
+)
+
+// Dialects are the database types GetQL generates queries for
+var Dialects = []string{"postgres", "mysql", "sqlite", "surrealdb"}
+
+// Case is a request of the shared corpus
+type Case struct {
+	Method string
+	Target string
+	Body   string
+}
+
+func (c Case) String() string {
+	if c.Body == "" {
+		return c.Method + " " + c.Target
+	}
+	return c.Method + " " + c.Target + " " + c.Body
+}
+
+// Corpus is a shared set of requests covering the REST grammar. Running it
+// through every dialect with Snapshot and comparing against golden files
+// catches dialects diverging; dialect authors can reuse it for their own.
+var Corpus = []Case{
+	{http.MethodGet, "/products", ""},
+	{http.MethodGet, "/products?level=lt.2&hidden=is.false", ""},
+	{http.MethodGet, "/products?or=(level=lt.2,hidden=is.false)", ""},
+	{http.MethodGet, "/products?not=(level=gte.3)", ""},
+	{http.MethodGet, "/products?name=like.pen*", ""},
+	{http.MethodGet, "/products?price=is.null", ""},
+	{http.MethodGet, "/products?id=in.(1,2,3)", ""},
+	{http.MethodGet, "/products?name=isdistinct.pen", ""},
+	{http.MethodGet, "/products?price=notdistinct.null", ""},
+	{http.MethodGet, "/products?name=eq.", ""},
+	{http.MethodGet, "/products?name=eq.pen&collate=ci", ""},
+	{http.MethodGet, "/products?name=sim.pne", ""},
+	{http.MethodGet, "/products?q=pen&q_columns=name,description", ""},
+	{http.MethodGet, "/products?select=id,name&order=level.desc,name.asc", ""},
+	{http.MethodGet, "/products?order=price.desc.nullslast", ""},
+	{http.MethodGet, "/products?page=2&page_size=10", ""},
+	{http.MethodGet, "/products?level=gt.1&exists=true", ""},
+	{http.MethodGet, "/products?stats=count(*),avg(price)&stats_only=true", ""},
+	{http.MethodGet, "/products?group_by=status&select=status,count(*)", ""},
+	{http.MethodGet, "/orders/aggregate?metrics=sum(amount),count(*)&dimensions=region,month(created_at)", ""},
+	{http.MethodGet, "/products?level=lt.2;DROP", ""},
+	{http.MethodGet, "/products?order=id;DROP", ""},
+	{http.MethodPost, "/products", `{"name": "pen", "level": 1}`},
+	{http.MethodPost, "/products", `[{"name": "pen", "level": 1}, {"name": "cup"}]`},
+	{http.MethodPost, "/products/query", `{"filter": {"or": [{"column": "level", "op": "lt", "value": 2}, {"column": "name", "op": "eq", "value": "pen"}]}, "select": ["id", "name"], "order": ["id.desc"], "limit": 20}`},
+	{http.MethodPut, "/products/1", `{"name": "mug", "level": 2}`},
+	{http.MethodPatch, "/products/1", `{"level": 3}`},
+	{http.MethodDelete, "/products/1", ""},
+	{http.MethodDelete, "/products?level=lt.2", ""},
+	{http.MethodDelete, "/products?id=in.(1,2,3)", ""},
+	{http.MethodDelete, "/products", ""},
+}
+
+// Snapshot runs the cases through GetQL on dbType, rendering each request
+// with its SQL and args, or its error, for comparison with a golden file
+func Snapshot(t testing.TB, dbType string, cases []Case) string {
+	t.Helper()
+	var b strings.Builder
+	for _, c := range cases {
+		fmt.Fprintf(&b, "== %s\n", c)
+		q, err := handler.GetQL(Request(c.Method, c.Target, c.Body), dbType)
+		if err != nil {
+			fmt.Fprintf(&b, "error: %v\n\n", err)
+			continue
+		}
+		for _, statement := range q.Statements() {
+			fmt.Fprintf(&b, "%s\nargs: %s\n", statement.Query, typedArgs(statement.Args))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// AssertGolden compares got with the golden file at path, rewriting the
+// file instead when update is set
+func AssertGolden(t testing.TB, path, got string, update bool) {
+	t.Helper()
+	if update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v (run the test with -update to create it)", err)
+	}
+	if got == string(want) {
+		return
+	}
+
+	gotCases, wantCases := strings.Split(got, "\n\n"), strings.Split(string(want), "\n\n")
+	for i := 0; i < max(len(gotCases), len(wantCases)); i++ {
+		var g, w string
+		if i < len(gotCases) {
+			g = gotCases[i]
+		}
+		if i < len(wantCases) {
+			w = wantCases[i]
+		}
+		if g != w {
+			t.Errorf("%s differs from the golden file:\n got:\n%s\nwant:\n%s", path, g, w)
+			return
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package restqltest
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// Test the corpus generates the SQL recorded in each dialect's golden file
+func TestGolden(t *testing.T) {
+	for _, dbType := range Dialects {
+		t.Run(dbType, func(t *testing.T) {
+			got := Snapshot(t, dbType, Corpus)
+			AssertGolden(t, filepath.Join("testdata", dbType+".golden"), got, *update)
+		})
+	}
+}
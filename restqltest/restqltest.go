@@ -0,0 +1,215 @@
+// Package restqltest helps applications test their restql integration
+// without a database: canned table metadata, helpers asserting the SQL and
+// args generated for an HTTP request, and an executor capturing queries.
+package restqltest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/handler"
+	"github.com/The-ForgeBase/restql/utils"
+)
+
+// Canned tables, with common column types, for tests that need schema
+// metadata
+var (
+	Products = &utils.Table{
+		Name: "products",
+		Columns: []utils.Column{
+			{Name: "id", Type: "INTEGER", Identity: true},
+			{Name: "name", Type: "TEXT"},
+			{Name: "price", Type: "NUMERIC", Nullable: true},
+			{Name: "level", Type: "INTEGER"},
+			{Name: "hidden", Type: "BOOLEAN"},
+			{Name: "status", Type: "ENUM", Enum: []string{"draft", "published"}},
+			{Name: "created_at", Type: "TIMESTAMP"},
+		},
+		Indexes: []utils.Index{{Name: "products_pkey", Columns: []string{"id"}, Unique: true}},
+	}
+
+	Users = &utils.Table{
+		Name: "users",
+		Columns: []utils.Column{
+			{Name: "id", Type: "INTEGER", Identity: true},
+			{Name: "email", Type: "TEXT"},
+			{Name: "name", Type: "TEXT", Nullable: true},
+			{Name: "created_at", Type: "TIMESTAMP"},
+		},
+		Indexes: []utils.Index{
+			{Name: "users_pkey", Columns: []string{"id"}, Unique: true},
+			{Name: "users_email_key", Columns: []string{"email"}, Unique: true},
+		},
+	}
+
+	Orders = &utils.Table{
+		Name: "orders",
+		Columns: []utils.Column{
+			{Name: "id", Type: "INTEGER", Identity: true},
+			{Name: "user_id", Type: "INTEGER"},
+			{Name: "amount", Type: "NUMERIC"},
+			{Name: "status", Type: "ENUM", Enum: []string{"pending", "paid", "void"}},
+			{Name: "created_at", Type: "TIMESTAMP"},
+		},
+		Indexes: []utils.Index{
+			{Name: "orders_pkey", Columns: []string{"id"}, Unique: true},
+			{Name: "orders_user_id", Columns: []string{"user_id", "created_at"}},
+		},
+	}
+)
+
+// UseSchema registers tables in handler.Schema for the duration of the test,
+// restoring the previous entries when it ends. Without tables it registers
+// Products, Users and Orders.
+func UseSchema(t testing.TB, tables ...*utils.Table) {
+	t.Helper()
+	if len(tables) == 0 {
+		tables = []*utils.Table{Products, Users, Orders}
+	}
+
+	for _, table := range tables {
+		previous, ok := handler.Schema[table.Name]
+		handler.Schema[table.Name] = table
+		t.Cleanup(func() {
+			if ok {
+				handler.Schema[table.Name] = previous
+			} else {
+				delete(handler.Schema, table.Name)
+			}
+		})
+	}
+}
+
+// Request builds a request for GetQL. The target is the path and query
+// string below the API prefix, like "/products?level=lt.2".
+func Request(method, target, body string) *http.Request {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	return r
+}
+
+// Query runs GetQL for the request on dbType, failing the test if it
+// returns an error
+func Query(t testing.TB, dbType string, r *http.Request) *utils.ReturnQuery {
+	t.Helper()
+	q, err := handler.GetQL(r, dbType)
+	if err != nil {
+		t.Fatalf("%s %s: unexpected error: %v", r.Method, r.URL, err)
+	}
+	return q
+}
+
+// AssertQuery checks the SQL and args generated for a request
+func AssertQuery(t testing.TB, dbType string, r *http.Request, wantSQL string, wantArgs ...any) {
+	t.Helper()
+	method, target := r.Method, r.URL.String()
+	q := Query(t, dbType, r)
+	if q.Query != wantSQL {
+		t.Errorf("%s %s on %s:\n got SQL: %s\nwant SQL: %s", method, target, dbType, q.Query, wantSQL)
+	}
+	if wantArgs == nil {
+		wantArgs = []any{}
+	}
+	args := q.Args
+	if args == nil {
+		args = []any{}
+	}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("%s %s on %s:\n got args: %s\nwant args: %s", method, target, dbType, typedArgs(args), typedArgs(wantArgs))
+	}
+}
+
+// typedArgs formats args with their types, as int 2 and int64 2 differ
+func typedArgs(args []any) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		if named, ok := arg.(sql.NamedArg); ok {
+			parts[i] = fmt.Sprintf("$%s=%#v", named.Name, named.Value)
+			continue
+		}
+		parts[i] = fmt.Sprintf("%T(%#v)", arg, arg)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// AssertError checks GetQL rejects a request with the message wantErr
+func AssertError(t testing.TB, dbType string, r *http.Request, wantErr string) {
+	t.Helper()
+	method, target := r.Method, r.URL.String()
+	q, err := handler.GetQL(r, dbType)
+	switch {
+	case err == nil:
+		t.Errorf("%s %s on %s: want error %q, got query %s", method, target, dbType, wantErr, q.Query)
+	case err.Error() != wantErr:
+		t.Errorf("%s %s on %s:\n got error: %v\nwant error: %s", method, target, dbType, err, wantErr)
+	}
+}
+
+// Executor stands in for the code running generated queries: it records
+// every query and returns canned rows, so tests can check what their
+// handlers would run
+type Executor struct {
+	mu      sync.Mutex
+	queries []utils.ReturnQuery
+
+	// Rows are returned for every query, unless Results has rows for the
+	// query's table
+	Rows []map[string]any
+	// Results holds rows to return per table
+	Results map[string][]map[string]any
+	// Err, when set, is returned instead of rows
+	Err error
+}
+
+// Exec records q, returning the canned rows of its table
+func (e *Executor) Exec(ctx context.Context, q *utils.ReturnQuery) ([]map[string]any, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.queries = append(e.queries, *q)
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	if rows, ok := e.Results[q.Table]; ok {
+		return rows, nil
+	}
+	return e.Rows, nil
+}
+
+// Queries returns the queries executed so far, oldest first
+func (e *Executor) Queries() []utils.ReturnQuery {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]utils.ReturnQuery(nil), e.queries...)
+}
+
+// Last returns the most recently executed query, or nil
+func (e *Executor) Last() *utils.ReturnQuery {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queries) == 0 {
+		return nil
+	}
+	q := e.queries[len(e.queries)-1]
+	return &q
+}
+
+// Reset forgets the executed queries
+func (e *Executor) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.queries = nil
+}
@@ -0,0 +1,79 @@
+package restqltest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/The-ForgeBase/restql/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT captures failures of the helpers under test
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.failures = append(t.failures, fmt.Sprintf(format, args...))
+}
+
+// Test the assertions pass on matching queries and report mismatches
+func TestAssertQuery(t *testing.T) {
+	UseSchema(t)
+
+	AssertQuery(t, "postgres", Request(http.MethodGet, "/products?level=lt.2&select=id,name", ""),
+		"SELECT id, name FROM products WHERE level < ? ORDER BY id ASC LIMIT 100 OFFSET 0", int64(2))
+	AssertError(t, "postgres", Request(http.MethodGet, "/products?status=eq.archived", ""),
+		`invalid value "archived" for column status: must be one of draft, published`)
+
+	rec := &recordingT{TB: t}
+	AssertQuery(rec, "postgres", Request(http.MethodGet, "/products?level=lt.2", ""), "SELECT * FROM products", 3)
+	assert.Len(t, rec.failures, 2)
+
+	rec = &recordingT{TB: t}
+	AssertError(rec, "postgres", Request(http.MethodGet, "/products", ""), "table name required")
+	assert.Len(t, rec.failures, 1)
+}
+
+// Test UseSchema restores handler.Schema when the test ends
+func TestUseSchema(t *testing.T) {
+	t.Run("schema", func(t *testing.T) {
+		UseSchema(t, Users)
+		assert.Equal(t, Users, handler.Schema["users"])
+	})
+	_, ok := handler.Schema["users"]
+	assert.False(t, ok)
+}
+
+// Test the executor records queries and returns canned rows
+func TestExecutor(t *testing.T) {
+	e := &Executor{
+		Rows:    []map[string]any{{"id": 1}},
+		Results: map[string][]map[string]any{"users": {{"id": 7, "email": "a@b.co"}}},
+	}
+	ctx := context.Background()
+
+	rows, err := e.Exec(ctx, Query(t, "postgres", Request(http.MethodGet, "/products", "")))
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"id": 1}}, rows)
+
+	rows, err = e.Exec(ctx, Query(t, "postgres", Request(http.MethodPost, "/users", `{"email": "a@b.co"}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"id": 7, "email": "a@b.co"}}, rows)
+
+	assert.Len(t, e.Queries(), 2)
+	assert.Equal(t, "INSERT INTO users (email) VALUES (?)", e.Last().Query)
+
+	e.Err = errors.New("connection refused")
+	_, err = e.Exec(ctx, e.Last())
+	assert.Equal(t, e.Err, err)
+
+	e.Reset()
+	assert.Nil(t, e.Last())
+}
@@ -0,0 +1,60 @@
+package signing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/The-ForgeBase/restql/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test signed requests pass once and tampered, stale or replayed ones fail
+func TestMiddleware(t *testing.T) {
+	oldSecret, secret := []byte("old"), []byte("new")
+	var got string
+	h := New(cache.NewLRU(100), oldSecret, secret).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = string(body)
+	}))
+
+	request := func(body string, secret []byte, at time.Time) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/products?select=id", strings.NewReader(body))
+		if secret != nil {
+			Sign(req, secret, []byte(body), at)
+		}
+		return req
+	}
+	serve := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	signed := request(`{"name":"pen"}`, secret, time.Now())
+	replay := signed.Clone(signed.Context())
+	replay.Body = io.NopCloser(strings.NewReader(`{"name":"pen"}`))
+	assert.Equal(t, http.StatusOK, serve(signed))
+	assert.Equal(t, `{"name":"pen"}`, got)
+	assert.Equal(t, http.StatusUnauthorized, serve(replay))
+
+	// The same signature in upper case is still a replay
+	signed = request(`{"name":"pen"}`, secret, time.Now().Add(-time.Second))
+	replay = signed.Clone(signed.Context())
+	replay.Body = io.NopCloser(strings.NewReader(`{"name":"pen"}`))
+	replay.Header.Set(SignatureHeader, strings.ToUpper(signed.Header.Get(SignatureHeader)))
+	assert.Equal(t, http.StatusOK, serve(signed))
+	assert.Equal(t, http.StatusUnauthorized, serve(replay))
+
+	assert.Equal(t, http.StatusOK, serve(request(`{"name":"cup"}`, oldSecret, time.Now())))
+	assert.Equal(t, http.StatusUnauthorized, serve(request(`{"name":"cup"}`, nil, time.Now())))
+	assert.Equal(t, http.StatusUnauthorized, serve(request(`{"name":"cup"}`, []byte("wrong"), time.Now())))
+	assert.Equal(t, http.StatusUnauthorized, serve(request(`{"name":"cup"}`, secret, time.Now().Add(-time.Hour))))
+
+	tampered := request(`{"name":"mug"}`, secret, time.Now())
+	tampered.Body = io.NopCloser(strings.NewReader(`{"name":"mug","price":0}`))
+	assert.Equal(t, http.StatusUnauthorized, serve(tampered))
+}
@@ -0,0 +1,175 @@
+package restql
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Tenants serves each tenant from its own database, like a Registry keyed
+// by tenant instead of prefix. The Server of a tenant is made by
+// NewFromConfig on its first request, so it has its own pool, sized by the
+// Pool of its config, schema, table policies and query cache. Resolve and
+// Config are required.
+type Tenants struct {
+	// Resolve names the tenant of a request, e.g. with TenantHeader or
+	// TenantSubdomain, or from a claim of a token verified by middleware
+	// in front. Requests it fails or names no tenant for are answered 400.
+	Resolve func(r *http.Request) (string, error)
+	// Config returns the config of a tenant, nil for an unknown tenant,
+	// which is answered 404
+	Config func(tenant string) (*Config, error)
+
+	// open makes the Server of a config, NewFromConfig by default
+	open    func(ctx context.Context, cfg *Config) (*Server, error)
+	mu      sync.Mutex
+	tenants map[string]*tenant
+}
+
+// tenant is the Server of a tenant, ready once it is opened
+type tenant struct {
+	ready  chan struct{}
+	server *Server
+	err    error
+}
+
+// errUnknownTenant is returned for tenants without a config
+var errUnknownTenant = errors.New("unknown tenant")
+
+// TenantHeader resolves the tenant of a request from a header, e.g.
+// X-Tenant
+func TenantHeader(name string) func(r *http.Request) (string, error) {
+	return func(r *http.Request) (string, error) {
+		return r.Header.Get(name), nil
+	}
+}
+
+// TenantSubdomain resolves the tenant of a request from the subdomain of
+// its host below domain, e.g. acme for acme.example.com
+func TenantSubdomain(domain string) func(r *http.Request) (string, error) {
+	return func(r *http.Request) (string, error) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		sub, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(domain))
+		if !ok || strings.Contains(sub, ".") {
+			return "", nil
+		}
+		return sub, nil
+	}
+}
+
+// ServeHTTP serves a request with the Server of its tenant, opening it
+// first on the tenant's first request. A tenant whose database cannot be
+// opened is answered 503, and opened again by its next request.
+func (t *Tenants) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, err := t.Resolve(r)
+	if err == nil && name == "" {
+		err = errors.New("tenant required")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s, err := t.server(r.Context(), name)
+	switch {
+	case errors.Is(err, errUnknownTenant):
+		http.Error(w, "unknown tenant "+name, http.StatusNotFound)
+		return
+	case r.Context().Err() != nil:
+		return
+	case err != nil:
+		log.Printf("restql: tenant %s: %v", name, err)
+		http.Error(w, "tenant "+name+" unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	s.ServeHTTP(w, r)
+}
+
+// server returns the Server of a tenant, opening it once for the requests
+// waiting on it
+func (t *Tenants) server(ctx context.Context, name string) (*Server, error) {
+	t.mu.Lock()
+	tn, ok := t.tenants[name]
+	if !ok {
+		if t.tenants == nil {
+			t.tenants = map[string]*tenant{}
+		}
+		tn = &tenant{ready: make(chan struct{})}
+		t.tenants[name] = tn
+		t.mu.Unlock()
+
+		// The first request going away does not fail the others waiting
+		tn.server, tn.err = t.openTenant(context.WithoutCancel(ctx), name)
+		if tn.err != nil {
+			t.mu.Lock()
+			if t.tenants[name] == tn {
+				delete(t.tenants, name)
+			}
+			t.mu.Unlock()
+		}
+		close(tn.ready)
+	} else {
+		t.mu.Unlock()
+	}
+
+	select {
+	case <-tn.ready:
+		return tn.server, tn.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *Tenants) openTenant(ctx context.Context, name string) (*Server, error) {
+	cfg, err := t.Config(name)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, errUnknownTenant
+	}
+	open := t.open
+	if open == nil {
+		open = NewFromConfig
+	}
+	return open(ctx, cfg)
+}
+
+// Remove stops serving a tenant and returns its Server, nil when it is not
+// open. The Server is not closed; the tenant's next request opens a new one.
+func (t *Tenants) Remove(name string) *Server {
+	t.mu.Lock()
+	tn, ok := t.tenants[name]
+	delete(t.tenants, name)
+	t.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	<-tn.ready
+	return tn.server
+}
+
+// Close closes the database pool of every open tenant
+func (t *Tenants) Close() error {
+	t.mu.Lock()
+	tenants := t.tenants
+	t.tenants = nil
+	t.mu.Unlock()
+
+	var errs []error
+	for _, tn := range tenants {
+		<-tn.ready
+		if tn.server != nil {
+			errs = append(errs, tn.server.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
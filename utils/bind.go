@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// BindStyle is the form of placeholders and args a driver expects. Generated
+// queries are in the Question style; Bind converts them to the others.
+type BindStyle int
+
+const (
+	// Question keeps ? placeholders with positional args: MySQL and SQLite
+	Question BindStyle = iota
+	// Dollar numbers placeholders $1, $2... with positional args: Postgres
+	Dollar
+	// Colon names placeholders :p1, :p2... with sql.Named args, e.g. Oracle
+	Colon
+	// At names placeholders @p1, @p2... with sql.Named args: SQL Server
+	At
+)
+
+// BindStyleOf returns the style of the drivers of a database type: Dollar
+// for Postgres, otherwise Question. SurrealDB binds variables itself, see
+// package surreal.
+func BindStyleOf(dbType string) BindStyle {
+	if dbType == "postgres" {
+		return Dollar
+	}
+	return Question
+}
+
+// Bind returns the query text and args of q in a driver's style. The nth ?
+// outside quoted strings binds the nth positional arg. sql.NamedArg args,
+// e.g. the $data of SurrealDB writes, keep their name in every style.
+func (q *ReturnQuery) Bind(style BindStyle) (string, []any) {
+	if style == Question {
+		return q.Query, q.Args
+	}
+
+	var b strings.Builder
+	n := 0
+	inString := false
+	for _, c := range q.Query {
+		switch {
+		case c == '\'':
+			inString = !inString
+		case c == '?' && !inString:
+			n++
+			switch style {
+			case Dollar:
+				fmt.Fprintf(&b, "$%d", n)
+			case Colon:
+				fmt.Fprintf(&b, ":p%d", n)
+			case At:
+				fmt.Fprintf(&b, "@p%d", n)
+			}
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	if style == Dollar {
+		return b.String(), q.Args
+	}
+	args := make([]any, len(q.Args))
+	n = 0
+	for i, arg := range q.Args {
+		if _, ok := arg.(sql.NamedArg); !ok {
+			n++
+			arg = sql.Named(fmt.Sprintf("p%d", n), arg)
+		}
+		args[i] = arg
+	}
+	return b.String(), args
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test queries convert to each placeholder style
+func TestBind(t *testing.T) {
+	q := &ReturnQuery{
+		Query: "SELECT * FROM products WHERE name = ? AND note <> 'why?' AND level > ?",
+		Args:  []any{"pen", 2},
+	}
+
+	tests := []struct {
+		style BindStyle
+		query string
+		args  []any
+	}{
+		{Question, "SELECT * FROM products WHERE name = ? AND note <> 'why?' AND level > ?", []any{"pen", 2}},
+		{Dollar, "SELECT * FROM products WHERE name = $1 AND note <> 'why?' AND level > $2", []any{"pen", 2}},
+		{Colon, "SELECT * FROM products WHERE name = :p1 AND note <> 'why?' AND level > :p2", []any{sql.Named("p1", "pen"), sql.Named("p2", 2)}},
+		{At, "SELECT * FROM products WHERE name = @p1 AND note <> 'why?' AND level > @p2", []any{sql.Named("p1", "pen"), sql.Named("p2", 2)}},
+	}
+
+	for _, tt := range tests {
+		query, args := q.Bind(tt.style)
+		assert.Equal(t, tt.query, query)
+		assert.Equal(t, tt.args, args)
+	}
+
+	// Named args keep their name
+	q = &ReturnQuery{Query: "UPDATE products:1 MERGE $data", Args: []any{sql.Named("data", map[string]any{"name": "pen"})}}
+	_, args := q.Bind(At)
+	assert.Equal(t, q.Args, args)
+	assert.Equal(t, Dollar, BindStyleOf("postgres"))
+	assert.Equal(t, Question, BindStyleOf("sqlite"))
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+)
+
+// DecodeCSV decodes a CSV body whose header row names the columns,
+// returning the records along with the columns in header order. With table
+// metadata the columns must exist and cells are converted to the column
+// type, read in locale when it is set; otherwise they stay strings. Empty
+// cells are NULL.
+func DecodeCSV(body []byte, table *Table, locale *Locale) ([]map[string]interface{}, []string, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("invalid CSV: missing header row")
+	}
+
+	header := rows[0]
+	types := make([]string, len(header))
+	columns := make([]*Column, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		if err := ValidateColumnName(name); err != nil {
+			return nil, nil, err
+		}
+		if seen[name] {
+			return nil, nil, fmt.Errorf("duplicate column %s", name)
+		}
+		seen[name] = true
+
+		types[i] = "string"
+		if table != nil {
+			column, ok := table.Column(name)
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown column %s", name)
+			}
+			types[i] = JSONType(column.Type)
+			columns[i] = column
+		}
+	}
+
+	records := make([]map[string]interface{}, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		record := make(map[string]interface{}, len(header))
+		for j, cell := range row {
+			value, err := parseTextValue(locale.Value(columns[j], cell), types[j])
+			if err != nil {
+				return nil, nil, fmt.Errorf("row %d: invalid %s value %q for column %s", i+1, types[j], cell, header[j])
+			}
+			record[header[j]] = value
+		}
+		records = append(records, record)
+	}
+
+	return records, header, nil
+}
+
+// parseTextValue converts a CSV cell or form field to a JSON type as
+// returned by JSONType. Empty values are NULL.
+func parseTextValue(value, jsonType string) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	switch jsonType {
+	case "integer":
+		return strconv.ParseInt(value, 10, 64)
+	case "number":
+		return strconv.ParseFloat(value, 64)
+	case "boolean":
+		return strconv.ParseBool(value)
+	case "decimal":
+		// Decimals stay text, which the database reads exactly
+		if !IsDecimal(value) {
+			return nil, fmt.Errorf("invalid decimal %q", value)
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"database/sql"
+	"math/big"
+	"regexp"
+	"strconv"
+)
+
+var decimalRegexp = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?$`)
+
+// Decimal is an exact DECIMAL/NUMERIC value in its text form. It encodes
+// as a JSON string, so clients do not round money through float64.
+type Decimal string
+
+// NullDecimal scans a DECIMAL/NUMERIC column as text, without the rounding
+// of sql.NullFloat64
+type NullDecimal struct {
+	sql.NullString
+}
+
+// IsDecimal reports whether s is a decimal number like -12.50 or 1e-3
+func IsDecimal(s string) bool {
+	return decimalRegexp.MatchString(s)
+}
+
+// Rat returns the exact value of d
+func (d Decimal) Rat() (*big.Rat, bool) {
+	if !IsDecimal(string(d)) {
+		return nil, false
+	}
+	return new(big.Rat).SetString(string(d))
+}
+
+// ToRat converts a Decimal or a Go number to its exact value. Floats are
+// read as their shortest decimal form, so 19.99 equals Decimal("19.99").
+func ToRat(v any) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case Decimal:
+		return n.Rat()
+	case int:
+		return new(big.Rat).SetInt64(int64(n)), true
+	case int64:
+		return new(big.Rat).SetInt64(n), true
+	case float64:
+		return new(big.Rat).SetString(strconv.FormatFloat(n, 'f', -1, 64))
+	}
+	return nil, false
+}
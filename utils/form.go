@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
+)
+
+// IsForm reports whether contentType is a urlencoded or multipart form
+func IsForm(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data"
+}
+
+// DecodeForm decodes a urlencoded or multipart form body into a record,
+// returning its fields in order. Fields are converted like CSV cells, except
+// that an empty field of a string column stays an empty string. Uploaded
+// files are read as []byte for BLOB/bytea columns.
+func DecodeForm(body []byte, contentType string, table *Table, locale *Locale) (map[string]interface{}, []string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid form: %v", err)
+	}
+
+	record := map[string]interface{}{}
+	keys := []string{}
+	add := func(name string, value interface{}) error {
+		if err := ValidateColumnName(name); err != nil {
+			return err
+		}
+		if _, ok := record[name]; ok {
+			return fmt.Errorf("duplicate field %s", name)
+		}
+
+		if text, ok := value.(string); ok {
+			jsonType := "string"
+			if table != nil {
+				column, ok := table.Column(name)
+				if !ok {
+					return fmt.Errorf("unknown column %s", name)
+				}
+				jsonType = JSONType(column.Type)
+				text = locale.Value(column, text)
+			}
+			if text != "" || jsonType != "string" {
+				if value, err = parseTextValue(text, jsonType); err != nil {
+					return fmt.Errorf("invalid %s value %q for column %s", jsonType, text, name)
+				}
+			}
+		} else if table != nil {
+			if _, ok := table.Column(name); !ok {
+				return fmt.Errorf("unknown column %s", name)
+			}
+		}
+
+		record[name] = value
+		keys = append(keys, name)
+		return nil
+	}
+
+	if mediaType == "multipart/form-data" {
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid form: %v", err)
+			}
+			data, err := io.ReadAll(part)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid form: %v", err)
+			}
+
+			var value interface{} = string(data)
+			if part.FileName() != "" {
+				value = data
+			}
+			if err := add(part.FormName(), value); err != nil {
+				return nil, nil, err
+			}
+		}
+		return record, keys, nil
+	}
+
+	for rawQuery := string(body); rawQuery != ""; {
+		var pair string
+		pair, rawQuery, _ = strings.Cut(rawQuery, "&")
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		if key, err = url.QueryUnescape(key); err != nil {
+			return nil, nil, fmt.Errorf("invalid form: %v", err)
+		}
+		if value, err = url.QueryUnescape(value); err != nil {
+			return nil, nil, fmt.Errorf("invalid form: %v", err)
+		}
+		if err := add(key, value); err != nil {
+			return nil, nil, err
+		}
+	}
+	return record, keys, nil
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"strconv"
+)
+
+// MaxSafeInteger is the largest integer read exactly by JSON clients that
+// parse numbers as float64, like JavaScript's JSON.parse
+const MaxSafeInteger = 1<<53 - 1
+
+// EncodeInts rewrites integers of result rows as strings for JSON clients
+// that would round them: every integer of columns, and with large those
+// beyond ±MaxSafeInteger in any column
+func EncodeInts(rows []map[string]any, columns map[string]bool, large bool) {
+	if len(columns) == 0 && !large {
+		return
+	}
+	for _, row := range rows {
+		for column, value := range row {
+			switch n := value.(type) {
+			case int64:
+				if columns[column] || large && (n > MaxSafeInteger || n < -MaxSafeInteger) {
+					row[column] = strconv.FormatInt(n, 10)
+				}
+			case uint64:
+				if columns[column] || large && n > MaxSafeInteger {
+					row[column] = strconv.FormatUint(n, 10)
+				}
+			}
+		}
+	}
+}
+
+// DecodeInts reads integers a client sent back as strings, like those of
+// EncodeInts, into the integer columns of a write payload. Strings that are
+// not integers are left for the database to reject.
+func DecodeInts(table *Table, record map[string]any) {
+	if table == nil {
+		return
+	}
+	for name, value := range record {
+		text, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if column, ok := table.Column(name); !ok || JSONType(column.Type) != "integer" {
+			continue
+		}
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			record[name] = n
+		} else if n, err := strconv.ParseUint(text, 10, 64); err == nil {
+			record[name] = n
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test integers JSON clients would round survive a round trip as strings
+func TestLargeInts(t *testing.T) {
+	rows := []map[string]any{{"id": int64(1), "ref": int64(MaxSafeInteger + 2), "big": uint64(1 << 63), "price": 1.5}}
+	EncodeInts(rows, nil, false)
+	assert.Equal(t, int64(1), rows[0]["id"])
+
+	EncodeInts(rows, nil, true)
+	assert.Equal(t, map[string]any{"id": int64(1), "ref": "9007199254740993", "big": "9223372036854775808", "price": 1.5}, rows[0])
+
+	EncodeInts(rows, map[string]bool{"id": true}, false)
+	assert.Equal(t, "1", rows[0]["id"])
+
+	records, _, err := DecodeRecords([]byte(`{"id":"1","ref":9007199254740993,"big":"9223372036854775808","name":"7","price":1.5}`))
+	require.NoError(t, err)
+	table := &Table{Name: "items", Columns: []Column{
+		{Name: "id", Type: "BIGINT"},
+		{Name: "ref", Type: "BIGINT"},
+		{Name: "big", Type: "UNSIGNED BIGINT"},
+		{Name: "name", Type: "TEXT"},
+		{Name: "price", Type: "REAL"},
+	}}
+	DecodeInts(table, records[0])
+	assert.Equal(t, map[string]any{"id": int64(1), "ref": int64(MaxSafeInteger + 2), "big": uint64(1 << 63), "name": "7", "price": 1.5}, records[0])
+}
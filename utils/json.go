@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var errInvalidJSON = errors.New("invalid JSON format")
+
+// DecodeRecords decodes a JSON object or an array of objects, returning the
+// records along with their keys in the order they first appear in the body
+func DecodeRecords(body []byte) ([]map[string]interface{}, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, errInvalidJSON
+	}
+
+	records := []map[string]interface{}{}
+	keys := []string{}
+	seen := map[string]bool{}
+
+	switch tok {
+	case json.Delim('['):
+		for dec.More() {
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+				return nil, nil, errInvalidJSON
+			}
+			record, err := decodeObject(dec, &keys, seen)
+			if err != nil {
+				return nil, nil, err
+			}
+			records = append(records, record)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, nil, errInvalidJSON
+		}
+	case json.Delim('{'):
+		record, err := decodeObject(dec, &keys, seen)
+		if err != nil {
+			return nil, nil, err
+		}
+		records = append(records, record)
+	default:
+		return nil, nil, errInvalidJSON
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, errInvalidJSON
+	}
+
+	return records, keys, nil
+}
+
+// DecodeObject decodes a single JSON object, returning its keys in order
+func DecodeObject(body []byte) (map[string]interface{}, []string, error) {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, nil, errInvalidJSON
+	}
+
+	records, keys, err := DecodeRecords(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return records[0], keys, nil
+}
+
+// decodeObject reads the members of an object whose opening brace has already
+// been consumed, appending unseen keys to keys
+func decodeObject(dec *json.Decoder, keys *[]string, seen map[string]bool) (map[string]interface{}, error) {
+	record := map[string]interface{}{}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, errInvalidJSON
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, errInvalidJSON
+		}
+
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidJSON, err)
+		}
+
+		record[key] = decodeNumbers(value)
+		if !seen[key] {
+			seen[key] = true
+			*keys = append(*keys, key)
+		}
+	}
+
+	// Consume the closing brace
+	if _, err := dec.Token(); err != nil {
+		return nil, errInvalidJSON
+	}
+
+	return record, nil
+}
+
+// decodeNumbers converts the json.Numbers of a decoded value to float64,
+// except for integers float64 cannot hold exactly, like 64-bit ids beyond
+// 2^53, which become int64 or uint64
+func decodeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			if n > MaxSafeInteger || n < -MaxSafeInteger {
+				return n
+			}
+		} else if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		// Out of the range of float64, left to the database
+		return string(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = decodeNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = decodeNumbers(v[key])
+		}
+	}
+	return value
+}
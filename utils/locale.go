@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Locale is how a language and region write numbers and dates, e.g.
+// 1.234,56 and 31.12.2024 in de-DE
+type Locale struct {
+	Tag string
+	// Decimal separates the fraction of numbers and any of Group the
+	// thousands
+	Decimal rune
+	Group   string
+	// DateOrder is the order of day, month and year in dates: DMY, MDY or
+	// YMD
+	DateOrder string
+}
+
+const spaceGroups = " \u00a0\u202f"
+
+// locales are the conventions of each language, with regionLocales
+// overriding them for regions that differ
+var (
+	locales = map[string]Locale{
+		"en": {Decimal: '.', Group: ",", DateOrder: "MDY"},
+		"de": {Decimal: ',', Group: ".", DateOrder: "DMY"},
+		"es": {Decimal: ',', Group: ".", DateOrder: "DMY"},
+		"it": {Decimal: ',', Group: ".", DateOrder: "DMY"},
+		"pt": {Decimal: ',', Group: ".", DateOrder: "DMY"},
+		"nl": {Decimal: ',', Group: ".", DateOrder: "DMY"},
+		"da": {Decimal: ',', Group: ".", DateOrder: "DMY"},
+		"tr": {Decimal: ',', Group: ".", DateOrder: "DMY"},
+		"id": {Decimal: ',', Group: ".", DateOrder: "DMY"},
+		"fr": {Decimal: ',', Group: spaceGroups, DateOrder: "DMY"},
+		"ru": {Decimal: ',', Group: spaceGroups, DateOrder: "DMY"},
+		"uk": {Decimal: ',', Group: spaceGroups, DateOrder: "DMY"},
+		"pl": {Decimal: ',', Group: spaceGroups, DateOrder: "DMY"},
+		"cs": {Decimal: ',', Group: spaceGroups, DateOrder: "DMY"},
+		"sv": {Decimal: ',', Group: spaceGroups, DateOrder: "YMD"},
+		"nb": {Decimal: ',', Group: spaceGroups, DateOrder: "DMY"},
+		"fi": {Decimal: ',', Group: spaceGroups, DateOrder: "DMY"},
+		"hu": {Decimal: ',', Group: spaceGroups, DateOrder: "YMD"},
+		"ja": {Decimal: '.', Group: ",", DateOrder: "YMD"},
+		"zh": {Decimal: '.', Group: ",", DateOrder: "YMD"},
+		"ko": {Decimal: '.', Group: ",", DateOrder: "YMD"},
+	}
+	regionLocales = map[string]Locale{
+		"en-GB": {Decimal: '.', Group: ",", DateOrder: "DMY"},
+		"en-IE": {Decimal: '.', Group: ",", DateOrder: "DMY"},
+		"en-AU": {Decimal: '.', Group: ",", DateOrder: "DMY"},
+		"en-NZ": {Decimal: '.', Group: ",", DateOrder: "DMY"},
+		"en-IN": {Decimal: '.', Group: ",", DateOrder: "DMY"},
+		"en-ZA": {Decimal: ',', Group: spaceGroups, DateOrder: "YMD"},
+		"de-CH": {Decimal: '.', Group: "'’", DateOrder: "DMY"},
+		"fr-CH": {Decimal: '.', Group: "'’" + spaceGroups, DateOrder: "DMY"},
+		"it-CH": {Decimal: '.', Group: "'’", DateOrder: "DMY"},
+		"es-MX": {Decimal: '.', Group: ",", DateOrder: "DMY"},
+	}
+
+	localDateRegexp = regexp.MustCompile(`^(\d{1,4})[/.-](\d{1,2})[/.-](\d{1,4})(?:[ T](\d{1,2}:\d{2}(?::\d{2})?))?$`)
+)
+
+// ParseLocale looks up the conventions of a language tag like de-DE or
+// de_DE.UTF-8
+func ParseLocale(tag string) (*Locale, error) {
+	normalized, _, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), ".")
+	language, region, _ := strings.Cut(normalized, "-")
+	language = strings.ToLower(language)
+	if region != "" {
+		normalized = language + "-" + strings.ToUpper(region)
+	}
+
+	locale, ok := regionLocales[normalized]
+	if !ok {
+		if locale, ok = locales[language]; !ok {
+			return nil, fmt.Errorf("unknown locale %q", tag)
+		}
+	}
+	locale.Tag = tag
+	return &locale, nil
+}
+
+// Value rewrites a value of a numeric or date column written in the locale,
+// like 1.234,56 or 31/12/2024, as 1234.56 or 2024-12-31. Other values and
+// columns are returned as is, as are all values when l is nil.
+func (l *Locale) Value(column *Column, value string) string {
+	if l == nil || column == nil {
+		return value
+	}
+	jsonType, base := JSONType(column.Type), BaseType(column.Type)
+	switch {
+	case jsonType == "integer" || jsonType == "number" || jsonType == "decimal":
+		return l.number(value)
+	case base == "DATE" || base == "DATETIME" || strings.HasPrefix(base, "TIMESTAMP"):
+		return l.date(value)
+	}
+	return value
+}
+
+// Record rewrites the string values of numeric and date columns of a JSON
+// record written in the locale, numbers becoming JSON numbers
+func (l *Locale) Record(table *Table, record map[string]interface{}) {
+	if l == nil || table == nil {
+		return
+	}
+	for name, value := range record {
+		text, ok := value.(string)
+		column, known := table.Column(name)
+		if !ok || !known {
+			continue
+		}
+		text = l.Value(column, text)
+		if converted, err := parseTextValue(text, JSONType(column.Type)); err == nil && converted != nil {
+			record[name] = converted
+		} else {
+			record[name] = text
+		}
+	}
+}
+
+// number strips the group separators of a number and makes its decimal
+// separator a point. Group separators must be followed by three digits,
+// so values that are not numbers of the locale are left as they are.
+func (l *Locale) number(value string) string {
+	var b strings.Builder
+	digits, decimal := 0, false
+	for i, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+			digits++
+		case (r == '-' || r == '+') && i == 0:
+			b.WriteRune(r)
+		case r == l.Decimal && !decimal && digits > 0:
+			b.WriteByte('.')
+			decimal = true
+		case strings.ContainsRune(l.Group, r) && !decimal && digits > 0:
+			rest := value[i+len(string(r)):]
+			if len(rest) < 3 || strings.Trim(rest[:3], "0123456789") != "" || len(rest) > 3 && rest[3] >= '0' && rest[3] <= '9' {
+				return value
+			}
+		default:
+			return value
+		}
+	}
+	return b.String()
+}
+
+// date reorders a date written in the locale, with an optional time, into
+// ISO 8601. Dates that are not valid in the locale are left as they are.
+func (l *Locale) date(value string) string {
+	m := localDateRegexp.FindStringSubmatch(value)
+	if m == nil {
+		return value
+	}
+	var year, month, day string
+	switch l.DateOrder {
+	case "DMY":
+		day, month, year = m[1], m[2], m[3]
+	case "MDY":
+		month, day, year = m[1], m[2], m[3]
+	default:
+		year, month, day = m[1], m[2], m[3]
+	}
+	if len(year) != 4 || len(month) > 2 || len(day) > 2 {
+		return value
+	}
+	iso := year + "-" + twoDigits(month) + "-" + twoDigits(day)
+	if _, err := time.Parse(time.DateOnly, iso); err != nil {
+		return value
+	}
+	if m[4] != "" {
+		hour, rest, _ := strings.Cut(m[4], ":")
+		clock := twoDigits(hour) + ":" + rest
+		if len(clock) == 5 {
+			clock += ":00"
+		}
+		if _, err := time.Parse(time.TimeOnly, clock); err != nil {
+			return value
+		}
+		iso += " " + clock
+	}
+	return iso
+}
+
+// twoDigits pads a month, day or hour to two digits
+func twoDigits(s string) string {
+	if len(s) == 1 {
+		return "0" + s
+	}
+	return s
+}
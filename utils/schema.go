@@ -0,0 +1,95 @@
+package utils
+
+// Column describes a table column as reported by the database schema
+type Column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable,omitempty"`
+	// Enum lists the allowed values for ENUM or CHECK-constrained columns
+	Enum []string `json:"enum,omitempty"`
+	// Generated marks GENERATED ALWAYS AS (...) columns computed by the database
+	Generated bool `json:"generated,omitempty"`
+	// Identity marks GENERATED ALWAYS AS IDENTITY columns
+	Identity bool `json:"identity,omitempty"`
+	// Default marks columns with a DEFAULT, which writes may omit
+	Default bool `json:"default,omitempty"`
+	// Collate is the collation text comparisons and ordering of the column
+	// use unless a request sets one, e.g. ci, see query.ParseCollation
+	Collate string `json:"collate,omitempty"`
+}
+
+// ReadOnly reports whether the database rejects explicit values for the column
+func (c *Column) ReadOnly() bool {
+	return c.Generated || c.Identity
+}
+
+// Index describes a table index
+type Index struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique,omitempty"`
+}
+
+// ForeignKey describes a column referencing a column of another table
+type ForeignKey struct {
+	Column    string `json:"column"`
+	RefTable  string `json:"ref_table"`
+	RefColumn string `json:"ref_column"`
+}
+
+// Table describes a table and its columns
+type Table struct {
+	Name    string   `json:"name"`
+	Columns []Column `json:"columns"`
+	// Indexes lists the table's indexes, when known
+	Indexes []Index `json:"indexes,omitempty"`
+	// ForeignKeys lists the table's single-column foreign keys, when known
+	ForeignKeys []ForeignKey `json:"foreign_keys,omitempty"`
+}
+
+// References returns the foreign keys of the table referencing column of
+// refTable
+func (t *Table) References(refTable, column string) []ForeignKey {
+	var keys []ForeignKey
+	for _, key := range t.ForeignKeys {
+		if key.RefTable == refTable && key.RefColumn == column {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Indexed reports whether column leads one of the table's indexes, so a
+// filter on it can use the index
+func (t *Table) Indexed(column string) bool {
+	for _, index := range t.Indexes {
+		if len(index.Columns) > 0 && index.Columns[0] == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Column returns the column with the given name
+func (t *Table) Column(name string) (*Column, bool) {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i], true
+		}
+	}
+	return nil, false
+}
+
+// StripReadOnlyColumns removes generated and identity columns from an
+// insert/update payload so the database can compute them itself
+func StripReadOnlyColumns(table *Table, record map[string]interface{}) {
+	if table == nil {
+		return
+	}
+
+	for name := range record {
+		if column, ok := table.Column(name); ok && column.ReadOnly() {
+			delete(record, name)
+		}
+	}
+}
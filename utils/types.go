@@ -10,8 +10,12 @@ import (
 
 type TypeConverter func(any) any
 
+// StrictTypes makes ParseQueryParam convert only values that read back the
+// same, for filters on columns without table metadata: 007 would match 7
+// and 1e5 would match 100000 otherwise, corrupting text filters
+var StrictTypes = false
+
 var (
-	numericRegexp = regexp.MustCompile(`^(INT|FLOAT)\d+`)
 	// Various data types
 	// PG: https://www.postgresql.org/docs/current/datatype.html
 	// MY: https://dev.mysql.com/doc/refman/8.0/en/data-types.html
@@ -29,9 +33,16 @@ var (
 		"BIGINT":      func() any { return new(sql.NullInt64) },
 		"BIGSERIAL":   func() any { return new(sql.NullInt64) },
 
-		"DEC":              func() any { return new(sql.NullFloat64) },
-		"DECIMAL":          func() any { return new(sql.NullFloat64) },
-		"NUMERIC":          func() any { return new(sql.NullFloat64) },
+		// MySQL's unsigned integers, which may exceed int64
+		"UNSIGNED TINYINT":   func() any { return new(sql.Null[uint64]) },
+		"UNSIGNED SMALLINT":  func() any { return new(sql.Null[uint64]) },
+		"UNSIGNED MEDIUMINT": func() any { return new(sql.Null[uint64]) },
+		"UNSIGNED INT":       func() any { return new(sql.Null[uint64]) },
+		"UNSIGNED BIGINT":    func() any { return new(sql.Null[uint64]) },
+
+		"DEC":              func() any { return new(NullDecimal) },
+		"DECIMAL":          func() any { return new(NullDecimal) },
+		"NUMERIC":          func() any { return new(NullDecimal) },
 		"FLOAT":            func() any { return new(sql.NullFloat64) },
 		"REAL":             func() any { return new(sql.NullFloat64) },
 		"DOUBLE":           func() any { return new(sql.NullFloat64) },
@@ -54,54 +65,88 @@ var (
 		"DATE":      func() any { return new(sql.NullString) },
 		"DATETIME":  func() any { return new(sql.NullString) },
 		"TIMESTAMP": func() any { return new(sql.NullString) },
+
+		// Postgres extension and network types, read as their text form
+		"CITEXT":  func() any { return new(sql.NullString) },
+		"INET":    func() any { return new(sql.NullString) },
+		"CIDR":    func() any { return new(sql.NullString) },
+		"MACADDR": func() any { return new(sql.NullString) },
+		"MONEY":   func() any { return new(sql.NullString) },
+		"VECTOR":  func() any { return new(sql.NullString) },
 	}
 
+	// TypeConverters convert a value scanned into a value of Types to the
+	// value encoded in JSON, nil for NULL so it encodes as null
 	TypeConverters = map[string]TypeConverter{
-		"TINYINT":     func(i any) any { return i.(*sql.NullInt64).Int64 },
-		"SMALLINT":    func(i any) any { return i.(*sql.NullInt64).Int64 },
-		"SMALLSERIAL": func(i any) any { return i.(*sql.NullInt64).Int64 },
-		"SERIAL":      func(i any) any { return i.(*sql.NullInt64).Int64 },
-		"INT":         func(i any) any { return i.(*sql.NullInt64).Int64 },
-		"INTEGER":     func(i any) any { return i.(*sql.NullInt64).Int64 },
-		"BIGINT":      func(i any) any { return i.(*sql.NullInt64).Int64 },
-		"BIGSERIAL":   func(i any) any { return i.(*sql.NullInt64).Int64 },
-
-		"DEC":              func(i any) any { return i.(*sql.NullFloat64).Float64 },
-		"DECIMAL":          func(i any) any { return i.(*sql.NullFloat64).Float64 },
-		"NUMERIC":          func(i any) any { return i.(*sql.NullFloat64).Float64 },
-		"FLOAT":            func(i any) any { return i.(*sql.NullFloat64).Float64 },
-		"REAL":             func(i any) any { return i.(*sql.NullFloat64).Float64 },
-		"DOUBLE":           func(i any) any { return i.(*sql.NullFloat64).Float64 },
-		"DOUBLE PRECISION": func(i any) any { return i.(*sql.NullFloat64).Float64 },
-
-		"BOOL":    func(i any) any { return i.(*sql.NullBool).Bool },
-		"BOOLEAN": func(i any) any { return i.(*sql.NullBool).Bool },
-
-		"CHAR":      func(i any) any { return i.(*sql.NullString).String },
-		"VARCHAR":   func(i any) any { return i.(*sql.NullString).String },
-		"NVARCHAR":  func(i any) any { return i.(*sql.NullString).String },
-		"TEXT":      func(i any) any { return i.(*sql.NullString).String },
-		"UUID":      func(i any) any { return i.(*sql.NullString).String },
-		"ENUM":      func(i any) any { return i.(*sql.NullString).String },
-		"BLOB":      func(i any) any { return i.(*sql.NullString).String },
-		"BINARY":    func(i any) any { return i.(*sql.NullString).String },
-		"XML":       func(i any) any { return i.(*sql.NullString).String },
-		"DATE":      func(i any) any { return i.(*sql.NullString).String },
-		"DATETIME":  func(i any) any { return i.(*sql.NullString).String },
-		"TIMESTAMP": func(i any) any { return i.(*sql.NullString).String },
+		"TINYINT":     int64Value,
+		"SMALLINT":    int64Value,
+		"SMALLSERIAL": int64Value,
+		"SERIAL":      int64Value,
+		"INT":         int64Value,
+		"INTEGER":     int64Value,
+		"BIGINT":      int64Value,
+		"BIGSERIAL":   int64Value,
+
+		"UNSIGNED TINYINT":   uint64Value,
+		"UNSIGNED SMALLINT":  uint64Value,
+		"UNSIGNED MEDIUMINT": uint64Value,
+		"UNSIGNED INT":       uint64Value,
+		"UNSIGNED BIGINT":    uint64Value,
+
+		"DEC":              decimalValue,
+		"DECIMAL":          decimalValue,
+		"NUMERIC":          decimalValue,
+		"FLOAT":            float64Value,
+		"REAL":             float64Value,
+		"DOUBLE":           float64Value,
+		"DOUBLE PRECISION": float64Value,
+
+		"BOOL":    boolValue,
+		"BOOLEAN": boolValue,
+
+		"CHAR":      stringValue,
+		"VARCHAR":   stringValue,
+		"NVARCHAR":  stringValue,
+		"TEXT":      stringValue,
+		"UUID":      stringValue,
+		"ENUM":      stringValue,
+		"BLOB":      stringValue,
+		"BINARY":    stringValue,
+		"XML":       stringValue,
+		"DATE":      stringValue,
+		"DATETIME":  stringValue,
+		"TIMESTAMP": stringValue,
+
+		"CITEXT":  stringValue,
+		"INET":    stringValue,
+		"CIDR":    stringValue,
+		"MACADDR": stringValue,
+		"MONEY":   stringValue,
+		"VECTOR":  stringValue,
 
 		"JSON": func(i any) any {
-			rawData := i.(*sql.NullString).String
-			if s, err := strconv.ParseFloat(rawData, 64); err == nil {
+			v := i.(*sql.NullString)
+			if !v.Valid {
+				return nil
+			}
+			if s, err := strconv.ParseFloat(v.String, 64); err == nil {
 				return s
 			}
-			if s, err := strconv.ParseBool(rawData); err == nil {
+			if s, err := strconv.ParseBool(v.String); err == nil {
 				return s
 			}
-			return rawData
+			return v.String
 		},
 	}
 
+	// typePatterns are the types of RegisterTypePattern, tried in order for
+	// types missing from Types. Postgres drivers name integers and floats
+	// by their size, e.g. INT8 and FLOAT4.
+	typePatterns = []typePattern{
+		{regexp.MustCompile(`^INT[248]$`), Types["BIGINT"], TypeConverters["BIGINT"]},
+		{regexp.MustCompile(`^FLOAT[48]$`), Types["DOUBLE"], TypeConverters["DOUBLE"]},
+	}
+
 	Operators = map[string]string{
 		"eq":   "=",
 		"ne":   "<>",
@@ -111,21 +156,188 @@ var (
 		"lte":  "<=",
 		"is":   "IS",
 		"like": "LIKE",
+		"in":   "IN",
+		// Null-safe comparisons, which treat NULL as a value: isdistinct
+		// keeps the NULL rows ne drops
+		"isdistinct":  "IS DISTINCT FROM",
+		"notdistinct": "IS NOT DISTINCT FROM",
+		// Typo-tolerant matching, see query.SimilarityThreshold
+		"sim": "%",
 	}
 
+	// ArrayOperators compare a value against a Postgres array column. Each
+	// entry is a format string taking the column name.
+	ArrayOperators = map[string]string{
+		"any": "? = ANY(%s)",
+		"all": "? = ALL(%s)",
+		"cs":  "%s @> ?",
+		"cd":  "%s <@ ?",
+		"ov":  "%s && ?",
+	}
+
+	// PostgRESTOperators are accepted in PostgREST compatibility mode. Each
+	// entry is a format string taking the column name; values bind as text.
+	PostgRESTOperators = map[string]string{
+		"like":   "%s LIKE ?",
+		"ilike":  "%s ILIKE ?",
+		"match":  "%s ~ ?",
+		"imatch": "%s ~* ?",
+		"fts":    "%s @@ to_tsquery(?)",
+		"plfts":  "%s @@ plainto_tsquery(?)",
+		"phfts":  "%s @@ phraseto_tsquery(?)",
+		"wfts":   "%s @@ websearch_to_tsquery(?)",
+	}
+
+	// EnumOperators compare a filter value for equality, so the value must be
+	// one of the allowed values of an ENUM column
+	EnumOperators = map[string]bool{
+		"eq":  true,
+		"ne":  true,
+		"any": true,
+		"all": true,
+	}
+
+	// ReservedWords are query parameters that are never treated as filters
 	ReservedWords = map[string]struct{}{
-		"select": {},
-		"order":  {},
-		"count":  {},
+		"select":     {},
+		"order":      {},
+		"count":      {},
+		"page":       {},
+		"page_size":  {},
+		"limit":      {},
+		"offset":     {},
+		"live":       {},
+		"exists":     {},
+		"stats":      {},
+		"stats_only": {},
+		"sample":     {},
+		"per_group":  {},
+		"tree":       {},
+		"group_by":   {},
+		"tz":         {},
+		"cursor":     {},
+		"collate":    {},
+		"q":          {},
+		"q_columns":  {},
+		"q_mode":     {},
+		"locale":     {},
+		"metrics":    {},
+		"dimensions": {},
+		"tables":     {},
+		"columns":    {},
+		"format":     {},
 	}
 )
 
 type ReturnQuery struct {
 	Query string
 	Args  []any
+	// Table is the table the query reads from or writes to, or a
+	// comma-separated list for reads over several tables
+	Table string
+	// ReadOnly is set for queries that never write, so callers can route
+	// them to a read replica
+	ReadOnly bool
+	// Batch holds every statement of a bulk insert split to fit the
+	// database's placeholder limit, to run in order in one transaction.
+	// Query and Args are the first of them.
+	Batch []ReturnQuery
+	// Copy is set for bulk loads to run with COPY FROM STDIN, e.g. with
+	// pgx's CopyFrom, instead of executing Query
+	Copy *CopyData
+	// Export is set for file downloads of a whole result set, read in pages
+	Export *Export
+	// Stats summarizes the rows of a read in a single row, for ?stats=
+	Stats *ReturnQuery
+	// Page describes the page a read returns under a pagination strategy
+	Page *Page
 }
 
-// ParseQueryParam tries to convert a query parameter string to an appropriate type (int, float64, bool, or string)
+// Export describes a file download of a result set read in keyset pages
+// ordered by id
+type Export struct {
+	// Format is the file format, e.g. "csv" or "jsonl"
+	Format string
+	// Filename is the suggested name of the downloaded file
+	Filename string
+	// BatchSize is the number of rows per page; a shorter page is the last
+	BatchSize int
+	// Next returns the query for the page after the row with id after
+	Next func(after any) *ReturnQuery
+}
+
+// Page describes the page of rows a read returns, to report it in the
+// response
+type Page struct {
+	// Strategy is the pagination strategy: offset, keyset or token
+	Strategy string
+	// Number is the page number from 1, zero when the strategy does not
+	// track it
+	Number int
+	// Size is the number of rows per page; a shorter page is the last
+	Size int
+	// Count counts the filtered rows of every page, as one row with a
+	// count column
+	Count *ReturnQuery
+	// Next returns the cursor of the page after the one ending with row
+	// last
+	Next func(last map[string]any) string
+}
+
+// PageMeta is the pagination metadata of a response. Every field is
+// present, null when unknown: page for keyset pages, total when the rows
+// were not counted, and next_cursor on the last page.
+type PageMeta struct {
+	Page       *int    `json:"page"`
+	PageSize   int     `json:"page_size"`
+	Total      *int64  `json:"total"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// Meta returns the metadata of a page of rows. counted are the rows of
+// Count, nil when it was not run.
+func (p *Page) Meta(rows, counted []map[string]any) PageMeta {
+	meta := PageMeta{PageSize: p.Size}
+	if p.Number > 0 {
+		number := p.Number
+		meta.Page = &number
+	}
+	if len(counted) == 1 {
+		if total, err := strconv.ParseInt(fmt.Sprint(counted[0]["count"]), 10, 64); err == nil {
+			meta.Total = &total
+		}
+	}
+
+	last := len(rows) < p.Size || len(rows) == 0
+	if meta.Total != nil && p.Number > 0 && int64(p.Number*p.Size) >= *meta.Total {
+		last = true
+	}
+	if !last {
+		cursor := p.Next(rows[len(rows)-1])
+		meta.NextCursor = &cursor
+	}
+	return meta
+}
+
+// CopyData is the input of a COPY FROM STDIN bulk load
+type CopyData struct {
+	Table   string
+	Columns []string
+	Rows    [][]any
+}
+
+// Statements returns the statements to run for the query: the batch when it
+// was split, otherwise the query itself
+func (q *ReturnQuery) Statements() []ReturnQuery {
+	if len(q.Batch) > 0 {
+		return q.Batch
+	}
+	return []ReturnQuery{*q}
+}
+
+// ParseQueryParam tries to convert a query parameter string to an appropriate type (int, float64, bool, or string).
+// Under StrictTypes only numbers written the way Go formats them are
+// converted, so 007, 1e5 and 0x1F stay strings.
 func ParseQueryParam(value string) (interface{}, error) {
 	// Check if it's a boolean
 	if strings.ToLower(value) == "true" || strings.ToLower(value) == "false" {
@@ -133,17 +345,190 @@ func ParseQueryParam(value string) (interface{}, error) {
 	}
 
 	// Check if it's an integer
+	if StrictTypes {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil && strconv.FormatInt(i, 10) == value {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == value {
+			return f, nil
+		}
+		return value, nil
+	}
 	if i, err := strconv.ParseInt(value, 0, 64); err == nil {
-		// fmt.Println("Parsed int:", i)
 		return int64(i), nil
 	}
 
 	// Check if it's a float
 	if f, err := strconv.ParseFloat(value, 64); err == nil {
-		fmt.Println("Parsed float:", f)
 		return f, nil
 	}
 
 	// Default to string if it can't be parsed as int, float, or bool
 	return value, nil
 }
+
+// ParseColumnValue converts a query parameter to the JSON type of a column,
+// as returned by JSONType, so "007" stays a string for a TEXT key and is an
+// integer for an INTEGER one
+func ParseColumnValue(column *Column, value string) (interface{}, error) {
+	jsonType := JSONType(column.Type)
+	if jsonType == "string" {
+		return value, nil
+	}
+	v, err := parseTextValue(value, jsonType)
+	if err != nil || v == nil {
+		return nil, fmt.Errorf("invalid %s value %q for column %s", jsonType, value, column.Name)
+	}
+	return v, nil
+}
+
+// typePattern scans and converts the column types matching pattern
+type typePattern struct {
+	pattern *regexp.Regexp
+	scanner func() any
+	convert TypeConverter
+}
+
+// RegisterType adds a column type, or replaces a built-in one, with the
+// scanner returning the destination of its values and the converter of
+// TypeConverters, which must return nil for NULL. Register types before
+// serving.
+func RegisterType(name string, scanner func() any, converter TypeConverter) {
+	name = BaseType(name)
+	Types[name] = scanner
+	TypeConverters[name] = converter
+}
+
+// RegisterTypePattern adds the column types matching a regular expression,
+// like `^NUMERIC\(\d+,\d+\)$`, for families of types or user-defined
+// ones. Patterns match the whole type in upper case, e.g. "VECTOR(3)", and
+// are tried in the order they were registered, after the names of Types.
+// Register them before serving.
+func RegisterTypePattern(pattern string, scanner func() any, converter TypeConverter) {
+	typePatterns = append(typePatterns, typePattern{regexp.MustCompile(pattern), scanner, converter})
+}
+
+// LookupType returns the scanner and converter of a column type, by its
+// name in Types or else a pattern of RegisterTypePattern
+func LookupType(sqlType string) (func() any, TypeConverter, bool) {
+	base := BaseType(sqlType)
+	if scanner, ok := Types[base]; ok {
+		if convert, ok := TypeConverters[base]; ok {
+			return scanner, convert, true
+		}
+	}
+	normalized := strings.ToUpper(strings.TrimSpace(sqlType))
+	for _, p := range typePatterns {
+		if p.pattern.MatchString(normalized) {
+			return p.scanner, p.convert, true
+		}
+	}
+	return nil, nil, false
+}
+
+// NewValue returns the destination to scan a value of a column type into:
+// a value of LookupType, or an *any for types it does not know
+func NewValue(sqlType string) any {
+	if scanner, _, ok := LookupType(sqlType); ok {
+		return scanner()
+	}
+	return new(any)
+}
+
+// ConvertValue converts a value scanned into the destination of NewValue to
+// the value encoded in JSON, with TypeConverters. NULL becomes nil, so it
+// encodes as null rather than as the zero value of the column type.
+func ConvertValue(sqlType string, value any) any {
+	if v, ok := value.(*any); ok {
+		if b, ok := (*v).([]byte); ok {
+			return string(b)
+		}
+		return *v
+	}
+	if _, convert, ok := LookupType(sqlType); ok {
+		return convert(value)
+	}
+	return value
+}
+
+func int64Value(i any) any {
+	if v := i.(*sql.NullInt64); v.Valid {
+		return v.Int64
+	}
+	return nil
+}
+
+func uint64Value(i any) any {
+	if v := i.(*sql.Null[uint64]); v.Valid {
+		return v.V
+	}
+	return nil
+}
+
+func decimalValue(i any) any {
+	if v := i.(*NullDecimal); v.Valid {
+		return Decimal(v.String)
+	}
+	return nil
+}
+
+func float64Value(i any) any {
+	if v := i.(*sql.NullFloat64); v.Valid {
+		return v.Float64
+	}
+	return nil
+}
+
+func boolValue(i any) any {
+	if v := i.(*sql.NullBool); v.Valid {
+		return v.Bool
+	}
+	return nil
+}
+
+func stringValue(i any) any {
+	if v := i.(*sql.NullString); v.Valid {
+		return v.String
+	}
+	return nil
+}
+
+// BaseType normalizes a column type for lookups in Types, e.g.
+// "varchar(255)" becomes "VARCHAR"
+func BaseType(sqlType string) string {
+	base := strings.ToUpper(strings.TrimSpace(sqlType))
+	if i := strings.IndexByte(base, '('); i >= 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+	return base
+}
+
+// IsArrayType reports whether a column type is a Postgres array, like
+// TEXT[] or the ARRAY of information_schema
+func IsArrayType(sqlType string) bool {
+	upper := strings.ToUpper(strings.TrimSpace(sqlType))
+	return upper == "ARRAY" || strings.HasSuffix(upper, "[]")
+}
+
+// JSONType maps a column type to the JSON type its values are encoded as:
+// "integer", "number", "boolean", or "string", or "decimal" for exact
+// numbers encoded as strings, see Decimal
+func JSONType(sqlType string) string {
+	newValue, _, ok := LookupType(sqlType)
+	if !ok {
+		return "string"
+	}
+
+	switch newValue().(type) {
+	case *sql.NullInt64, *sql.Null[uint64]:
+		return "integer"
+	case *sql.NullFloat64:
+		return "number"
+	case *NullDecimal:
+		return "decimal"
+	case *sql.NullBool:
+		return "boolean"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test scanned values convert to their JSON types, with NULL as null
+// rather than the zero value of the type
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		sqlType string
+		value   any
+		want    any
+	}{
+		{"INTEGER", int64(7), int64(7)},
+		{"UNSIGNED BIGINT", uint64(1 << 63), uint64(1 << 63)},
+		{"NUMERIC(10,2)", "19.99", Decimal("19.99")},
+		{"REAL", 1.5, 1.5},
+		{"BOOLEAN", false, false},
+		{"varchar(255)", "", ""},
+		{"JSON", "2", 2.0},
+		{"INET", []byte("10.0.0.1"), "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		value := NewValue(tt.sqlType)
+		if scanner, ok := value.(sql.Scanner); ok {
+			require.NoError(t, scanner.Scan(tt.value))
+		} else {
+			*value.(*any) = tt.value
+		}
+		assert.Equal(t, tt.want, ConvertValue(tt.sqlType, value), tt.sqlType)
+
+		value = NewValue(tt.sqlType)
+		if scanner, ok := value.(sql.Scanner); ok {
+			require.NoError(t, scanner.Scan(nil))
+		}
+		body, err := json.Marshal(map[string]any{"v": ConvertValue(tt.sqlType, value)})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"v":null}`, string(body), tt.sqlType)
+	}
+}
+
+// Test registered types and patterns are scanned and converted like the
+// built-in ones, names taking precedence over patterns
+func TestRegisterType(t *testing.T) {
+	defer func(patterns []typePattern) {
+		typePatterns = patterns
+		delete(Types, "LTREE")
+		delete(TypeConverters, "LTREE")
+	}(typePatterns)
+
+	RegisterType("ltree", Types["TEXT"], TypeConverters["TEXT"])
+	RegisterTypePattern(`^GEOMETRY\(POINT,\d+\)$`, Types["TEXT"], TypeConverters["TEXT"])
+	RegisterTypePattern(`^TEXT`, Types["INTEGER"], TypeConverters["INTEGER"])
+
+	tests := []struct {
+		sqlType  string
+		known    bool
+		jsonType string
+	}{
+		{"LTREE", true, "string"},
+		{"geometry(Point,4326)", true, "string"},
+		{"GEOMETRY(POLYGON,4326)", false, "string"},
+		{"int8", true, "integer"},
+		{"FLOAT4", true, "number"},
+		{"INT4RANGE", false, "string"},
+		{"citext", true, "string"},
+		{"VECTOR(3)", true, "string"},
+		{"TEXT", true, "string"},
+	}
+
+	for _, tt := range tests {
+		_, _, ok := LookupType(tt.sqlType)
+		assert.Equal(t, tt.known, ok, tt.sqlType)
+		assert.Equal(t, tt.jsonType, JSONType(tt.sqlType), tt.sqlType)
+	}
+
+	value := NewValue("geometry(Point,4326)")
+	require.NoError(t, value.(sql.Scanner).Scan("POINT(1 2)"))
+	assert.Equal(t, "POINT(1 2)", ConvertValue("geometry(Point,4326)", value))
+}
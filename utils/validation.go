@@ -2,7 +2,11 @@ package utils
 
 import (
 	"errors"
+	"fmt"
+	"maps"
 	"regexp"
+	"slices"
+	"strings"
 )
 
 var tableNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
@@ -14,3 +18,55 @@ func ValidateTableName(tableName string) error {
 	}
 	return nil
 }
+
+// ValidateColumnName ensures a column name is safe for SQL use
+func ValidateColumnName(column string) error {
+	if !tableNameRegex.MatchString(column) {
+		return fmt.Errorf("invalid column name %q", column)
+	}
+	return nil
+}
+
+// ValidateEnumValue ensures a value is allowed for an ENUM or CHECK-constrained column
+func ValidateEnumValue(column *Column, value any) error {
+	if column == nil || len(column.Enum) == 0 || value == nil {
+		return nil
+	}
+
+	s := fmt.Sprint(value)
+	for _, allowed := range column.Enum {
+		if s == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid value %q for column %s: must be one of %s", s, column.Name, strings.Join(column.Enum, ", "))
+}
+
+// ValidateRecord checks an insert/update payload against the table schema.
+// Keys become column names in the generated SQL, so they must be valid
+// names, and columns of the table when its schema is known.
+func ValidateRecord(table *Table, record map[string]interface{}) error {
+	for _, name := range slices.Sorted(maps.Keys(record)) {
+		if err := ValidateColumnName(name); err != nil {
+			return err
+		}
+		if table == nil {
+			continue
+		}
+		column, ok := table.Column(name)
+		if !ok {
+			return fmt.Errorf("unknown column %s", name)
+		}
+		value := record[name]
+		if err := ValidateEnumValue(column, value); err != nil {
+			return err
+		}
+		// Decimals sent as strings keep every digit, so they must be numbers
+		if text, ok := value.(string); ok && JSONType(column.Type) == "decimal" && !IsDecimal(text) {
+			return fmt.Errorf("invalid decimal value %q for column %s", text, column.Name)
+		}
+	}
+
+	return nil
+}